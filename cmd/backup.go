@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/netapp/cake/pkg/engine/rkecli"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var backupSnapshotName string
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Manage etcd snapshots of a deployed RKE cluster",
+	Long: `Backup wraps the rke etcd snapshot commands using the cluster.yml and rkestate
+	files that were saved to ~/.cake/<cluster name>/ at the end of a deploy.`,
+}
+
+// backupNowCmd represents the backup now command
+var backupNowCmd = &cobra.Command{
+	Use:   "now",
+	Short: "Take a one-off etcd snapshot of a deployed RKE cluster",
+	Long: `Takes an etcd snapshot immediately. If the spec file has an S3 target
+	configured in the Backup section, the snapshot is also uploaded there.
+	For example:
+	    "cake backup now --name my-awesome-cluster"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := rkeClusterFromSpec()
+		if backupSnapshotName == "" {
+			backupSnapshotName = fmt.Sprintf("%s-%s", c.ClusterName, time.Now().UTC().Format("20060102T150405Z"))
+		}
+		log.Infof("saving etcd snapshot %s", backupSnapshotName)
+		err := c.SnapshotSave(context.Background(), backupSnapshotName)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		log.Infof("etcd snapshot %s saved", backupSnapshotName)
+	},
+}
+
+func init() {
+	backupCmd.PersistentFlags().StringVarP(&specFile, "spec-file", "f", "", "Location of cluster-spec file corresponding to the cluster, default is at ~/.cake/<cluster name>/spec.yaml")
+	backupNowCmd.Flags().StringVarP(&backupSnapshotName, "snapshot", "s", "", "Name of the snapshot, default is <cluster name>-<timestamp>")
+	backupCmd.AddCommand(backupNowCmd)
+	rootCmd.AddCommand(backupCmd)
+}
+
+// rkeClusterFromSpec reads the spec file and points it at the deliverables saved for the cluster
+func rkeClusterFromSpec() *rkecli.MgmtCluster {
+	if specFile == "" {
+		specFile = filepath.Join(specPath, defaultSpecFileName)
+	}
+	if !fileExists(specFile) {
+		log.Fatalf("cluster spec file doesnt exist: %s\n", specFile)
+	}
+	contents, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		log.Fatalf("error reading config file (%s)", specFile)
+	}
+	c := rkecli.NewMgmtClusterCli()
+	err = yaml.Unmarshal(contents, &c)
+	if err != nil {
+		log.Fatalf("unable to parse config (%s), %v", specFile, err.Error())
+	}
+	c.UseLocalDeliverables(specPath)
+	return c
+}
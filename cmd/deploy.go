@@ -1,19 +1,26 @@
 package cmd
 
 import (
-	"github.com/nats-io/go-nats"
+	"context"
+	"fmt"
+	"github.com/netapp/cake/pkg/metrics"
 	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/tracing"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/netapp/cake/pkg/engine/rke"
 	"github.com/netapp/cake/pkg/engine/rkecli"
+	"github.com/netapp/cake/pkg/config"
 	"github.com/netapp/cake/pkg/provider"
+	"github.com/netapp/cake/pkg/provider/baremetal"
+	"github.com/netapp/cake/pkg/provider/kvm"
 	"github.com/netapp/cake/pkg/provider/vsphere"
 
 	"github.com/netapp/cake/pkg/engine"
@@ -27,6 +34,9 @@ var (
 	deploymentType          string
 	localDeploy             bool
 	progressEndpointEnabled bool
+	metricsAddress          string
+	deployCtx               context.Context
+	deploySpan              *tracing.Span
 )
 
 var deployCmd = &cobra.Command{
@@ -45,10 +55,8 @@ var deployCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalf("error reading config file (%s)", specFile)
 		}
-		err = progress.RunServer()
-		if err != nil {
-			log.Fatalf("error starting events server: %v", err)
-		}
+		serveMetrics()
+		startTrace()
 		if localDeploy {
 			runEngine()
 		} else {
@@ -60,6 +68,7 @@ var deployCmd = &cobra.Command{
 func init() {
 	deployCmd.Flags().BoolVarP(&localDeploy, "local", "l", false, "Run the engine locally")
 	deployCmd.Flags().BoolVarP(&progressEndpointEnabled, "progress", "p", false, "Serve progress from HTTP endpoint")
+	deployCmd.Flags().StringVar(&metricsAddress, "metrics-address", "", "Serve Prometheus metrics of this process on the address, for example :9090, overrides MetricsAddress of the spec")
 	deployCmd.Flags().StringVarP(&deploymentType, "deployment-type", "d", "", "The type of deployment to create (capv, rke)")
 	deployCmd.PersistentFlags().StringVarP(&specFile, "spec-file", "f", "", "Location of cluster-spec file corresponding to the cluster, default is at ~/.cake/<cluster name>/spec.yaml")
 	deployCmd.MarkFlagRequired("deployment-type")
@@ -75,6 +84,85 @@ func delay(start time.Time) {
 	log.Infof("missionDuration: %v", stop.Sub(start).Round(time.Second))
 }
 
+// serveMetrics serves the Prometheus metrics of this process on the address of the --metrics-address flag, or of
+// MetricsAddress in the spec, which the cake on a bootstrap node reads from its config
+func serveMetrics() {
+	address := metricsAddress
+	if address == "" {
+		var spec struct {
+			MetricsAddress string `yaml:"MetricsAddress"`
+		}
+		yaml.Unmarshal(specContents, &spec)
+		address = spec.MetricsAddress
+	}
+	if address == "" {
+		return
+	}
+	go func() {
+		err := metrics.Serve(address)
+		if err != nil {
+			log.Error(err.Error())
+		}
+	}()
+}
+
+// startTrace starts the root span of the deploy with the Tracing config of the spec, deployCtx carries it to the
+// phases. The cake on a bootstrap node continues the trace of the provider from the parent in its config
+func startTrace() {
+	var spec struct {
+		Tracing tracing.Config `yaml:"Tracing"`
+	}
+	yaml.Unmarshal(specContents, &spec)
+	tracing.Init(spec.Tracing)
+	name := "deploy"
+	if localDeploy {
+		name = "engine"
+	}
+	deployCtx, deploySpan = tracing.StartRoot(context.Background(), name, spec.Tracing.Parent)
+	deploySpan.SetAttribute("cake.deployment_type", deploymentType)
+	log.DeferExitHandler(func() {
+		endTrace(fmt.Errorf("deploy exited"))
+	})
+}
+
+// endTrace ends the root span and exports all remaining spans
+func endTrace(err error) {
+	deploySpan.SetAttribute("cake.cluster", clusterName)
+	deploySpan.End(err)
+	err = tracing.Flush()
+	if err != nil {
+		log.Warn(err.Error())
+	}
+}
+
+// newEvents connects to the event sinks configured in the spec. An engine running on a bootstrap node only keeps
+// a local history since the provider republishes its events to the configured sinks
+func newEvents(sinks []progress.SinkConfig) progress.Events {
+	if localDeploy && progressEndpointEnabled {
+		sinks = nil
+	}
+	events, err := progress.NewEvents(sinks, clusterName, filepath.Join(cakeBaseDirPath(), clusterName))
+	if err != nil {
+		log.Fatalf("unable to set up event sinks: %v", err)
+	}
+	log.DeferExitHandler(func() {
+		closeEvents(events)
+	})
+	return events
+}
+
+// closeEvents delivers the events still queued for the sinks before cake exits
+func closeEvents(events progress.Events) {
+	c, ok := events.(io.Closer)
+	if !ok {
+		return
+	}
+	err := c.Close()
+	if err != nil {
+		log.Warn(err.Error())
+	}
+}
+
 func runProvider() {
 	var err error
 	var controlPlaneCount int
@@ -89,7 +177,40 @@ func runProvider() {
 		delay(start)
 	})
 
-	if deploymentType == "capv" {
+	var spec config.Spec
+	yaml.Unmarshal(specContents, &spec)
+	isBaremetal := strings.EqualFold(string(spec.ProviderType), string(config.BaremetalProvider))
+	isKVM := strings.EqualFold(string(spec.ProviderType), string(config.KVMProvider))
+
+	if isBaremetal && deploymentType != "rke" {
+		log.Fatalf("deployment-type %s is not supported on %s", deploymentType, config.BaremetalProvider)
+	} else if isBaremetal {
+		bmProvider := baremetal.NewMgmtBootstrapRKE(new(baremetal.MgmtBootstrapRKE))
+		errJ := yaml.Unmarshal(specContents, &bmProvider)
+		if errJ != nil {
+			log.Fatalf("unable to parse config (%s), %v", specFile, errJ.Error())
+		}
+		clusterName = bmProvider.ClusterName
+		controlPlaneCount = bmProvider.ControlPlaneCount
+		workerCount = bmProvider.WorkerCount
+		bmProvider.LogDir = specPath
+		bmProvider.EventStream = newEvents(bmProvider.EventSinks)
+		bootstrap = bmProvider
+	} else if isKVM && deploymentType != "rke" {
+		log.Fatalf("deployment-type %s is not supported on %s", deploymentType, config.KVMProvider)
+	} else if isKVM {
+		kvmProvider := kvm.NewMgmtBootstrapRKE(new(kvm.MgmtBootstrapRKE))
+		errJ := yaml.Unmarshal(specContents, &kvmProvider)
+		if errJ != nil {
+			log.Fatalf("unable to parse config (%s), %v", specFile, errJ.Error())
+		}
+		clusterName = kvmProvider.ClusterName
+		controlPlaneCount = kvmProvider.ControlPlaneCount
+		workerCount = kvmProvider.WorkerCount
+		kvmProvider.LogDir = specPath
+		kvmProvider.EventStream = newEvents(kvmProvider.EventSinks)
+		bootstrap = kvmProvider
+	} else if deploymentType == "capv" {
 		vsProvider := vsphere.NewMgmtBootstrapCAPV(new(vsphere.MgmtBootstrapCAPV))
 		errJ := yaml.Unmarshal(specContents, &vsProvider)
 		if errJ != nil {
@@ -99,10 +220,7 @@ func runProvider() {
 		controlPlaneCount = vsProvider.ControlPlaneCount
 		workerCount = vsProvider.WorkerCount
 		vsProvider.LogDir = specPath
-		vsProvider.EventStream, err = progress.NewNatsPubSub(nats.DefaultURL, clusterName)
-		if err != nil {
-			log.Fatalf("unable to connect to events server: %v", err)
-		}
+		vsProvider.EventStream = newEvents(vsProvider.EventSinks)
 		bootstrap = vsProvider
 	} else if deploymentType == "rke" {
 		vsProvider := vsphere.NewMgmtBootstrapRKE(new(vsphere.MgmtBootstrapRKE))
@@ -114,10 +232,7 @@ func runProvider() {
 		controlPlaneCount = vsProvider.ControlPlaneCount
 		workerCount = vsProvider.WorkerCount
 		vsProvider.LogDir = specPath
-		vsProvider.EventStream, err = progress.NewNatsPubSub(nats.DefaultURL, clusterName)
-		if err != nil {
-			log.Fatalf("unable to connect to events server: %v", err)
-		}
+		vsProvider.EventStream = newEvents(vsProvider.EventSinks)
 		bootstrap = vsProvider
 	}
 
@@ -128,6 +243,7 @@ func runProvider() {
 		"workerMachineCount":       workerCount,
 	}).Info("Let's launch a cluster")
 	status := bootstrap.Events()
+	defer closeEvents(status)
 
 	fn := func(p *progress.StatusEvent) {
 		log.WithFields(p.ToLogrusFields()).Info("progress event")
@@ -138,7 +254,8 @@ func runProvider() {
 		log.Fatalf(err.Error())
 	}
 
-	err = provider.Run(bootstrap)
+	err = provider.Run(deployCtx, bootstrap)
+	endTrace(err)
 	if err != nil {
 		log.Error("error encountered during bootstrap")
 		log.Fatal(err.Error())
@@ -171,10 +288,7 @@ func runEngine() {
 		clusterName = engine.ClusterName
 		controlPlaneCount = engine.ControlPlaneCount
 		workerCount = engine.WorkerCount
-		engine.EventStream, err = progress.NewNatsPubSub(nats.DefaultURL, clusterName)
-		if err != nil {
-			log.Fatalf("unable to connect to events server: %v", err)
-		}
+		engine.EventStream = newEvents(engine.EventSinks)
 		logFile = engine.LogFile
 		engine.ProgressEndpointEnabled = progressEndpointEnabled
 		engineName = engine
@@ -192,10 +306,7 @@ func runEngine() {
 			clusterName = engine.ClusterName
 			controlPlaneCount = engine.ControlPlaneCount
 			workerCount = engine.WorkerCount
-			engine.EventStream, err = progress.NewNatsPubSub(nats.DefaultURL, clusterName)
-			if err != nil {
-				log.Fatalf("unable to connect to events server: %v", err)
-			}
+			engine.EventStream = newEvents(engine.EventSinks)
 			logFile = engine.LogFile
 			engine.LogDir = filepath.Join(cakeBaseDirPath(), clusterName)
 			engine.ProgressEndpointEnabled = progressEndpointEnabled
@@ -209,10 +320,7 @@ func runEngine() {
 			clusterName = engine.ClusterName
 			controlPlaneCount = engine.ControlPlaneCount
 			workerCount = engine.WorkerCount
-			engine.EventStream, err = progress.NewNatsPubSub(nats.DefaultURL, clusterName)
-			if err != nil {
-				log.Fatalf("unable to connect to events server: %v", err)
-			}
+			engine.EventStream = newEvents(engine.EventSinks)
 			logFile = engine.LogFile
 			engine.LogDir = filepath.Join(cakeBaseDirPath(), clusterName)
 			engine.ProgressEndpointEnabled = progressEndpointEnabled
@@ -240,6 +348,7 @@ func runEngine() {
 		"workerMachineCount":       workerCount,
 	}).Info("Let's launch a cluster")
 	status := engineName.Events()
+	defer closeEvents(status)
 
 	fn := func(p *progress.StatusEvent) {
 		log.WithFields(p.ToLogrusFields()).Info("progress event")
@@ -249,7 +358,8 @@ func runEngine() {
 		log.Fatalf(err.Error())
 	}
 
-	err = engine.Run(engineName)
+	err = engine.Run(deployCtx, engineName)
+	endTrace(err)
 	if err != nil {
 		log.Error(err.Error())
 	}
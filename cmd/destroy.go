@@ -1,34 +1,38 @@
 package cmd
 
 import (
-	log "github.com/sirupsen/logrus"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 
+	"github.com/netapp/cake/pkg/config"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider/vsphere"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 // destroyCmd represents the destroy command
 var destroyCmd = &cobra.Command{
 	Use:   "destroy",
-	Short: "Destroy a previously deploy Cake install",
-	Long: `This doesn't exist yet, but when it does, you'll
-	use it the same as you do deploy, but obviously instead
-	of setting up a deployment, it's going to destroy it.`,
+	Short: "Destroy a previously deployed Cake install",
+	Long: `Destroy removes the VMs, DRS rules and empty folders of a vSphere deployment and
+	releases the addresses reserved for its VMs. Everything cake creates is tagged with
+	the cluster name in the cake tag category, so a cluster can be destroyed even when
+	~/.cake/<cluster name>/inventory.json was lost. Templates are only removed with
+	CleanupTemplates set in the spec file and when no other cluster clones from them.
+	For example:
+	    "cake destroy --name my-awesome-cluster"`,
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Fatal("destroy command is not implemented yet")
-		/*
-			var err error
-			if specFile == "" {
-				specFile = filepath.Join(specPath, defaultSpecFileName)
-			}
-			if !fileExists(specFile) {
-				fmt.Printf("cluster spec file doesnt exist: %s\n", specFile)
-				os.Exit(1)
-			}
-			specContents, err = ioutil.ReadFile(specFile)
-			if err != nil {
-				log.Fatalf("error reading config file (%s)", specFile)
-			}
-		*/
+		vsProvider := connectVsphere()
+		defer closeEvents(vsProvider.EventStream)
+		err := vsProvider.Destroy()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		log.Infof("destroyed cluster %s", vsProvider.ClusterName)
 	},
 }
 
@@ -36,3 +40,43 @@ func init() {
 	rootCmd.AddCommand(destroyCmd)
 	destroyCmd.PersistentFlags().StringVarP(&specFile, "spec-file", "f", "", "Location of cluster-spec file corresponding to the cluster, default is at ~/.cake/<cluster name>/spec.yaml")
 }
+
+// connectVsphere reads the spec file of the cluster and connects to its vCenter, events are logged
+func connectVsphere() *vsphere.MgmtBootstrap {
+	if specFile == "" {
+		specFile = filepath.Join(specPath, defaultSpecFileName)
+	}
+	if !fileExists(specFile) {
+		log.Fatalf("cluster spec file doesnt exist: %s\n", specFile)
+	}
+	contents, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		log.Fatalf("error reading config file (%s)", specFile)
+	}
+	var spec config.Spec
+	err = yaml.Unmarshal(contents, &spec)
+	if err != nil {
+		log.Fatalf("unable to parse config (%s), %v", specFile, err.Error())
+	}
+	if spec.ProviderType != "" && !strings.EqualFold(string(spec.ProviderType), string(config.VsphereProvider)) {
+		log.Fatalf("only clusters on %s are supported, the cluster is on %s", config.VsphereProvider, spec.ProviderType)
+	}
+	vsProvider := new(vsphere.MgmtBootstrap)
+	err = yaml.Unmarshal(contents, vsProvider)
+	if err != nil {
+		log.Fatalf("unable to parse config (%s), %v", specFile, err.Error())
+	}
+	vsProvider.LogDir = specPath
+	vsProvider.EventStream = newEvents(vsProvider.EventSinks)
+	err = vsProvider.EventStream.Subscribe(func(p *progress.StatusEvent) {
+		log.WithFields(p.ToLogrusFields()).Info("progress event")
+	})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = vsProvider.Client(context.Background())
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return vsProvider
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/progress"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	followEvents bool
+	remoteEvents bool
+	eventsSince  string
+	eventsLevel  string
+	eventsPhase  string
+	eventsOutput string
+)
+
+// eventsCmd represents the events command
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Show the progress events of a deployment",
+	Long: `Events prints the progress events saved to ~/.cake/<cluster name>/events.jsonl,
+	the file is only written by a jsonl event sink, the default when the spec file has
+	no EventSinks. With --follow new events are printed as the deployment publishes them
+	until it finishes. When the events are not saved locally, or with --remote, the
+	progress endpoint of the bootstrap node is followed instead until the engine completes.
+	For example:
+	    "cake events --name my-awesome-cluster --follow --level warn --phase Provision"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flag("name").Changed {
+			log.Fatal("--name of the cluster is required")
+		}
+		filter := progress.Filter{Level: eventsLevel, Phase: eventsPhase}
+		err := filter.Validate()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		if eventsSince != "" {
+			filter.Since, err = parseSince(eventsSince, time.Now())
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+		}
+		if eventsOutput != "text" && eventsOutput != "json" {
+			log.Fatalf("unknown output format %q, must be text or json", eventsOutput)
+		}
+		show := func(e *progress.StatusEvent) {
+			if filter.Match(e) {
+				printEvent(e)
+			}
+		}
+
+		historyPath := filepath.Join(specPath, progress.EventsFileName)
+		endpointPath := filepath.Join(specPath, progress.EndpointFileName)
+		if remoteEvents || (!fileExists(historyPath) && fileExists(endpointPath)) {
+			err = followRemoteEvents(endpointPath, show)
+		} else {
+			err = showLocalEvents(historyPath, show)
+		}
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	},
+}
+
+func init() {
+	eventsCmd.Flags().BoolVar(&followEvents, "follow", false, "Keep printing new events as they are published until the deployment finishes")
+	eventsCmd.Flags().BoolVar(&remoteEvents, "remote", false, "Read the events from the progress endpoint of the bootstrap node")
+	eventsCmd.Flags().StringVar(&eventsSince, "since", "", "Only show events newer than a relative duration like 10m or an RFC3339 timestamp")
+	eventsCmd.Flags().StringVar(&eventsLevel, "level", "", "Only show events at or above this level (debug, info, warn, error)")
+	eventsCmd.Flags().StringVar(&eventsPhase, "phase", "", "Only show events of this phase, for example Provision")
+	eventsCmd.Flags().StringVarP(&eventsOutput, "output", "o", "text", "Output format (text, json)")
+	rootCmd.AddCommand(eventsCmd)
+}
+
+// parseSince accepts a duration before now or an absolute RFC3339 time
+func parseSince(since string, now time.Time) (time.Time, error) {
+	d, err := time.ParseDuration(since)
+	if err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q, must be a duration like 10m or an RFC3339 timestamp", since)
+	}
+	return t, nil
+}
+
+func printEvent(e *progress.StatusEvent) {
+	if eventsOutput == "json" {
+		out, _ := json.Marshal(e)
+		fmt.Println(string(out))
+		return
+	}
+	fmt.Println(formatEvent(e))
+}
+
+// formatEvent is the text output of an event, fields are appended as key=value
+func formatEvent(e *progress.StatusEvent) string {
+	var ts string
+	if e.Start != nil {
+		ts = e.Start.Local().Format(time.RFC3339)
+	}
+	line := fmt.Sprintf("%-25s %-5s %-19s %s", ts, strings.ToUpper(e.Level), e.Phase, e.Msg)
+	if e.Type == progress.TypePhase {
+		line += fmt.Sprintf(" (%s, %v%%)", e.Step, e.Percent)
+	}
+	if e.ErrorCode != "" {
+		line += " errorCode=" + e.ErrorCode
+	}
+	for key, value := range e.Fields {
+		line += fmt.Sprintf(" %s=%s", key, value)
+	}
+	return line
+}
+
+// showLocalEvents prints the saved history and with --follow polls it for new events until the latest run in it
+// is over, like followRemoteEvents stops once the engine completes
+func showLocalEvents(path string, fn func(*progress.StatusEvent)) error {
+	var run progress.RunState
+	read := func(e *progress.StatusEvent) {
+		run.Add(e)
+		fn(e)
+	}
+	offset, err := progress.ReadHistory(path, 0, read)
+	if os.IsNotExist(err) && !followEvents {
+		return fmt.Errorf("no events saved for %s at %s, they are only saved by a %s event sink", clusterName, path, progress.SinkJSONL)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for followEvents && !run.Done() {
+		time.Sleep(500 * time.Millisecond)
+		offset, err = progress.ReadHistory(path, offset, read)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// followRemoteEvents prints the events held by the bootstrap node and with --follow polls it until the engine completes
+func followRemoteEvents(path string, fn func(*progress.StatusEvent)) error {
+	client, err := progress.LoadEndpoint(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no bootstrap node is serving the progress of %s", clusterName)
+	}
+	if err != nil {
+		return err
+	}
+	var seq int
+	for {
+		status, err := client.Progress(seq)
+		if err != nil {
+			return err
+		}
+		if status.Truncated {
+			log.Warnf("events after %v were dropped by the bootstrap node", seq)
+		}
+		for x := range status.Messages {
+			fn(&status.Messages[x])
+		}
+		seq = status.Seq
+		if status.Complete || !followEvents {
+			return nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -102,7 +102,8 @@ func writeSpec(spec *types.ConfigSpec) {
 		log.Fatalln(err)
 	}
 
-	err = writeFile(clusterSpec, configOut, 0644)
+	// the spec holds the vCenter and Element passwords
+	err = writeFile(clusterSpec, configOut, 0600)
 	if err != nil {
 		log.Println(fmt.Sprintf("Unable to save cluster spec file (%s), %s", clusterSpec, err.Error()))
 		return
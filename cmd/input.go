@@ -15,6 +15,7 @@ import (
 	"github.com/vmware/govmomi/vim25/mo"
 
 	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/ipam"
 )
 
 const (
@@ -67,22 +68,20 @@ type NameAndID struct {
 }
 
 func collectNetworkInformation(spec *types.ConfigSpec) {
-	/*
-		getIPAMProvider(spec)
-
-			switch spec.IPAM.Provider {
-			case types.MNodeIPService:
-				getMNodeInfo(spec)
-			case types.Infoblox:
-				// Infoblox input comes from config file only for now, need a better input mechanism when running via interactive CLI
-				return
-			case types.DHCP:
-				return
-			default:
-				fmt.Println(fmt.Sprintf("IPAM provider %s is not implemented, defaulting to DHCP", spec.IPAM.Provider))
-				spec.IPAM.Provider = types.DHCP
-			}
-	*/
+	getIPAMProvider(spec)
+
+	switch spec.IPAM.Provider {
+	case types.MNodeIPService:
+		getMNodeInfo(spec)
+	case types.Infoblox:
+		// Infoblox input comes from config file only for now, need a better input mechanism when running via interactive CLI
+		return
+	case types.DHCP:
+		return
+	default:
+		fmt.Println(fmt.Sprintf("IPAM provider %s is not implemented, defaulting to DHCP", spec.IPAM.Provider))
+		spec.IPAM.Provider = types.DHCP
+	}
 }
 
 func collectVsphereInformation(spec *types.ConfigSpec) error {
@@ -98,7 +97,7 @@ func collectVsphereInformation(spec *types.ConfigSpec) error {
 		return fmt.Errorf("unable to get vCenter password, %v", err)
 	}
 
-	client, err := NewGovmomiClient(spec.VCenterUser, spec.VCenterPassword, spec.VCenterURL)
+	client, err := NewGovmomiClient(spec.VCenterUser, spec.VCenterPassword.Reveal(), spec.VCenterURL)
 	if err != nil {
 		return fmt.Errorf("unable to get vSphere client, %v", err)
 	}
@@ -243,8 +242,6 @@ func collectAdditionalConfiguration(spec *types.ConfigSpec) {
 
 	getServiceClusterServiceCIDR(spec)
 
-	checkDisableCleanup(spec)
-
 	disableAntiAffinity(spec)
 
 	collectObservabilityInformation(spec)
@@ -259,13 +256,12 @@ func disableAntiAffinity(spec *types.ConfigSpec) {
 	//spec.OptionalConfiguration.DisableHALoadbalancer = true
 }
 
-/*
 func getIPAMProvider(spec *types.ConfigSpec) {
 	if spec.IPAM.Provider != "" {
 		return
 	}
 
-	IPAMProviders := registration.AvailableIPAMProviders()
+	IPAMProviders := ipam.Providers()
 
 	if len(IPAMProviders) == 0 {
 		log.Fatal("No IPAM provider found")
@@ -288,7 +284,6 @@ func getIPAMProvider(spec *types.ConfigSpec) {
 
 	spec.IPAM.Provider = IPAMProviders[idx]
 }
-*/
 
 func getMNodeInfo(spec *types.ConfigSpec) {
 
@@ -337,7 +332,7 @@ func getMNodeAuthSecret(spec *types.ConfigSpec) {
 	if spec.IPAM.MNode.AuthSecret != "" {
 		return
 	}
-	spec.IPAM.MNode.AuthSecret = getInputWithLabel(labelMNodeAuthSecret)
+	spec.IPAM.MNode.AuthSecret = types.Secret(getInputWithLabel(labelMNodeAuthSecret))
 }
 
 func getMNodeTLSInsecure(spec *types.ConfigSpec) {
@@ -387,7 +382,7 @@ func getSolidfirePassword(spec *types.ConfigSpec) {
 		return
 	}
 
-	spec.Solidfire.Password = getPasswordInputWithLabel(labelElementPassword)
+	spec.Solidfire.Password = types.Secret(getPasswordInputWithLabel(labelElementPassword))
 }
 
 func setupElementStorage() bool {
@@ -441,9 +436,9 @@ func getVCenterURL(spec *types.ConfigSpec) error {
 
 func getVCenterPassword(spec *types.ConfigSpec) error {
 	if cliSettings.vCenterPassword != "" {
-		spec.VCenterPassword = cliSettings.vCenterPassword
+		spec.VCenterPassword = types.Secret(cliSettings.vCenterPassword)
 	} else if envSettings.vCenterPassword != "" {
-		spec.VCenterPassword = envSettings.vCenterPassword
+		spec.VCenterPassword = types.Secret(envSettings.vCenterPassword)
 	}
 
 	if spec.VCenterPassword != "" {
@@ -455,8 +450,8 @@ func getVCenterPassword(spec *types.ConfigSpec) error {
 		Mask:  '*',
 	}
 
-	var err error
-	spec.VCenterPassword, err = prompt.Run()
+	password, err := prompt.Run()
+	spec.VCenterPassword = types.Secret(password)
 	return err
 }
 
@@ -495,15 +490,6 @@ func getServiceClusterServiceCIDR(spec *types.ConfigSpec) {
 	}
 }
 
-func checkDisableCleanup(spec *types.ConfigSpec) {
-
-	if cliSettings.disableCleanup {
-		spec.OptionalConfiguration.DisableCleanup = cliSettings.disableCleanup
-	} else if envSettings.disableCleanup {
-		spec.OptionalConfiguration.DisableCleanup = envSettings.disableCleanup
-	}
-}
-
 func selectObject(allObjects []NameAndID, label string) (string, error) {
 	if len(allObjects) == 1 {
 		return allObjects[0].ID, nil
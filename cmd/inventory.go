@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/netapp/cake/pkg/provider"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var rebuildInventory bool
+
+// inventoryCmd represents the inventory command
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Show the infrastructure of a deployment",
+	Long: `Inventory prints ~/.cake/<cluster name>/inventory.json, which deploy keeps up to
+	date as resources are created. With --rebuild it is written again from the objects
+	tagged with the cluster name in vCenter first, ie when the local state was lost.
+	For example:
+	    "cake inventory --name my-awesome-cluster --rebuild"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var inv *provider.Inventory
+		var err error
+		if rebuildInventory {
+			vsProvider := connectVsphere()
+			defer closeEvents(vsProvider.EventStream)
+			inv, err = vsProvider.RebuildInventory()
+		} else {
+			inv, err = provider.LoadInventory(filepath.Join(specPath, provider.InventoryFileName))
+		}
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		out, err := json.MarshalIndent(inv, "", "  ")
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		fmt.Println(string(out))
+	},
+}
+
+func init() {
+	inventoryCmd.Flags().BoolVar(&rebuildInventory, "rebuild", false, "Rebuild the inventory from the tags of the vSphere objects")
+	inventoryCmd.Flags().StringVarP(&specFile, "spec-file", "f", "", "Location of cluster-spec file corresponding to the cluster, default is at ~/.cake/<cluster name>/spec.yaml")
+	rootCmd.AddCommand(inventoryCmd)
+}
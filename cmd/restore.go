@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var restoreSnapshotName string
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore etcd of a deployed RKE cluster from a snapshot",
+	Long: `Restore wraps rke etcd snapshot-restore using the cluster.yml and rkestate
+	files that were saved to ~/.cake/<cluster name>/ at the end of a deploy. If the spec
+	file has an S3 target configured in the Backup section, the snapshot is fetched from there.
+	For example:
+	    "cake restore --name my-awesome-cluster --snapshot my-awesome-cluster-20200601T120000Z"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := rkeClusterFromSpec()
+		log.Infof("restoring etcd snapshot %s", restoreSnapshotName)
+		err := c.SnapshotRestore(context.Background(), restoreSnapshotName)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		log.Infof("etcd snapshot %s restored", restoreSnapshotName)
+	},
+}
+
+func init() {
+	restoreCmd.PersistentFlags().StringVarP(&specFile, "spec-file", "f", "", "Location of cluster-spec file corresponding to the cluster, default is at ~/.cake/<cluster name>/spec.yaml")
+	restoreCmd.Flags().StringVarP(&restoreSnapshotName, "snapshot", "s", "", "Name of the snapshot to restore")
+	restoreCmd.MarkFlagRequired("snapshot")
+	rootCmd.AddCommand(restoreCmd)
+}
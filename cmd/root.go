@@ -14,7 +14,6 @@ type settings struct {
 	vCenterPassword          string
 	managementClusterPodCIDR string
 	managementClusterCIDR    string
-	disableCleanup           bool
 	disablePreflight         bool
 	logLevel                 string
 }
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/config"
+	"github.com/netapp/cake/pkg/config/cluster"
+	"github.com/netapp/cake/pkg/config/types"
+	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
+	"github.com/netapp/cake/pkg/provider"
+	"github.com/netapp/cake/pkg/provider/vsphere"
+	"github.com/netapp/cake/pkg/support"
+	"github.com/netapp/cake/pkg/util/ssh"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	bundleOutput string
+	bundleSSHKey string
+	bundleSince  time.Duration
+)
+
+// supportSpec is the part of a spec file needed to reach the infrastructure of a deployment
+type supportSpec struct {
+	vsphereConfig.ProviderVsphere `yaml:",inline"`
+	ProviderType                  types.ProviderType `yaml:"ProviderType"`
+	EngineType                    types.EngineType   `yaml:"EngineType"`
+	SSH                           cluster.SSH        `yaml:"SSH"`
+	BootstrapIP                   string             `yaml:"BootstrapIP"`
+	Nodes                         map[string]string  `yaml:"Nodes"`
+}
+
+// supportBundleCmd represents the support-bundle command
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Collect the logs and state of a deployment into a tarball",
+	Long: `Support-bundle collects the files in ~/.cake/<cluster name>/, the cake output,
+	cloud-init logs and containers of every node over ssh, the kind and CAPI controller
+	logs, pod logs over the Kubernetes API and the vSphere events of the deployment.
+	Secrets are redacted. Whatever can not be collected is recorded in the index of
+	the bundle, so it also works when only part of the infrastructure was created.
+	For example:
+	    "cake support-bundle --name my-awesome-cluster --since 2h"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flag("name").Changed {
+			log.Fatal("--name of the cluster is required")
+		}
+		if specFile == "" {
+			specFile = filepath.Join(specPath, defaultSpecFileName)
+		}
+		var spec supportSpec
+		specContents, err := ioutil.ReadFile(specFile)
+		if err == nil {
+			err = yaml.Unmarshal(specContents, &spec)
+		}
+		if err != nil {
+			log.Warnf("unable to read spec file %s, nodes are only known from the inventory: %v", specFile, err)
+		}
+
+		bundle, err := support.NewBundle(bundleOutput, clusterName, time.Now())
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		err = collectSupportBundle(bundle, spec, specContents)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		err = bundle.Close()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		var failed int
+		for _, e := range bundle.Entries() {
+			if e.Error != "" {
+				failed++
+			}
+		}
+		log.Infof("support bundle written to %s, %v of %v items could not be collected, see %s", bundle.Path, failed, len(bundle.Entries()), support.IndexFileName)
+	},
+}
+
+func init() {
+	supportBundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", ".", "Directory the bundle is written to")
+	supportBundleCmd.Flags().StringVar(&bundleSSHKey, "ssh-key", "", "Private key for the nodes, defaults to the key generated for the deployment or SSH.KeyPath of the spec file")
+	supportBundleCmd.Flags().DurationVar(&bundleSince, "since", 24*time.Hour, "How far back vSphere events are collected")
+	supportBundleCmd.Flags().StringVarP(&specFile, "spec-file", "f", "", "Location of cluster-spec file corresponding to the cluster, default is at ~/.cake/<cluster name>/spec.yaml")
+	rootCmd.AddCommand(supportBundleCmd)
+}
+
+// collectSupportBundle adds everything that can be reached to bundle, only errors writing the bundle are returned
+func collectSupportBundle(bundle *support.Bundle, spec supportSpec, specContents []byte) error {
+	// the generated key, the rke state and earlier bundles hold secrets that can not be redacted
+	err := bundle.CollectFiles(specPath, provider.SSHKeyFileName, "*.rkestate", "cake-support-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	if filepath.Dir(specFile) != filepath.Clean(specPath) && len(specContents) > 0 {
+		redacted, err := support.RedactYAML(specContents)
+		err = bundle.Add(filepath.Join("spec", filepath.Base(specFile)), specFile, redacted, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	inv, err := provider.LoadInventory(filepath.Join(specPath, provider.InventoryFileName))
+	if err != nil {
+		// deploys before the inventory was saved only know the nodes of the spec file
+		inv = &provider.Inventory{Cluster: clusterName, Engine: spec.EngineType}
+		for name, ip := range spec.Nodes {
+			inv.Node(name).Address = ip
+		}
+		if spec.BootstrapIP != "" {
+			var found bool
+			for x := range inv.Nodes {
+				if inv.Nodes[x].Address == spec.BootstrapIP {
+					inv.Nodes[x].Bootstrap = true
+					found = true
+				}
+			}
+			if !found {
+				inv.Nodes = append(inv.Nodes, provider.InventoryNode{Name: "bootstrap", Address: spec.BootstrapIP, Bootstrap: true})
+			}
+		}
+	}
+	if inv.Engine == "" {
+		inv.Engine = spec.EngineType
+	}
+
+	auth := supportSSHAuth(inv, spec)
+	for _, n := range inv.Nodes {
+		commands := support.NodeCommands
+		if n.Bootstrap {
+			commands = append(support.BootstrapCommands(inv.Engine, clusterName), commands...)
+		}
+		log.Infof("collecting from %s", n.Name)
+		auth.HostKeys = n.HostKeys
+		err = bundle.CollectNode(n.Name, n.Address, auth, commands)
+		if err != nil {
+			return err
+		}
+	}
+
+	kubeconfigs, _ := filepath.Glob(filepath.Join(specPath, "kube_config_*.yml"))
+	if fileExists(filepath.Join(specPath, "kubeconfig")) {
+		kubeconfigs = append(kubeconfigs, filepath.Join(specPath, "kubeconfig"))
+	}
+	for _, k := range kubeconfigs {
+		log.Infof("collecting pods of %s", k)
+		err = bundle.CollectKube(k, support.KubeNamespaces)
+		if err != nil {
+			return err
+		}
+	}
+
+	isBaremetal := strings.EqualFold(string(spec.ProviderType), string(config.BaremetalProvider))
+	isKVM := strings.EqualFold(string(spec.ProviderType), string(config.KVMProvider))
+	if isBaremetal || isKVM || spec.URL == "" {
+		return nil
+	}
+	log.Infof("collecting vSphere events from %s", spec.URL)
+	return collectVSphere(bundle, spec, inv)
+}
+
+// supportSSHAuth prefers --ssh-key, then the key generated for the deployment, then the key of the spec file. Nodes
+// without pinned host keys are verified with the known_hosts of the spec file
+func supportSSHAuth(inv *provider.Inventory, spec supportSpec) ssh.Auth {
+	username := inv.SSHUser
+	if username == "" {
+		username = spec.SSH.Username
+	}
+	for _, keyPath := range []string{bundleSSHKey, inv.SSHKey, spec.SSH.KeyPath} {
+		if keyPath == "" {
+			continue
+		}
+		auth, err := ssh.AuthFromKeyFile(username, keyPath)
+		if err == nil {
+			auth.KnownHosts = spec.SSH.KnownHosts
+			return auth
+		}
+		log.Warn(err.Error())
+	}
+	return ssh.Auth{Username: username, KnownHosts: spec.SSH.KnownHosts}
+}
+
+func collectVSphere(bundle *support.Bundle, spec supportSpec, inv *provider.Inventory) error {
+	session, err := vsphere.NewClient(spec.URL, spec.Username, spec.Password.Reveal())
+	if err == nil {
+		session.Datacenter, err = session.GetDatacenter(spec.Datacenter)
+	}
+	if err != nil {
+		return bundle.Add("vsphere", spec.URL, nil, fmt.Errorf("unable to connect to vSphere, %v", err))
+	}
+	var names, paths []string
+	for _, n := range inv.Nodes {
+		names = append(names, n.Name)
+		if n.VM != "" {
+			paths = append(paths, n.VM)
+		}
+	}
+	events, err := session.EventLog(time.Now().Add(-bundleSince), names)
+	err = bundle.Add("vsphere/events.txt", spec.URL+" "+spec.Datacenter, events, err)
+	if err != nil {
+		return err
+	}
+	tasks, err := session.TaskErrors(paths)
+	return bundle.Add("vsphere/task-errors.txt", spec.URL+" "+spec.Datacenter, tasks, err)
+}
@@ -22,6 +22,8 @@ require (
 	github.com/nats-io/nats-server/v2 v2.1.6 // indirect
 	github.com/nats-io/nats.go v1.9.2
 	github.com/pkg/errors v0.9.1
+	github.com/pkg/sftp v1.11.0
+	github.com/prometheus/client_golang v1.5.0
 	github.com/rakyll/statik v0.1.7
 	github.com/rancher/norman v0.0.0-20190821234528-20a936b685b0
 	github.com/rancher/types v0.0.0-20190911221659-bba8483953e4
@@ -0,0 +1,24 @@
+package baremetal
+
+import "github.com/netapp/cake/pkg/config/types"
+
+// ProviderBaremetal is data for pre-existing linux hosts reachable over SSH
+type ProviderBaremetal struct {
+	Hosts []Host `yaml:"Hosts" json:"hosts"`
+}
+
+// Host is a pre-existing linux machine, the first control plane host is used as the bootstrap node.
+// Address can include the ssh port, ie 10.0.0.10:2222
+type Host struct {
+	Address string `yaml:"Address" json:"address"`
+	// Role is either controlplane or worker
+	Role string `yaml:"Role" json:"role"`
+	// Username defaults to the SSH Username
+	Username string       `yaml:"Username,omitempty" json:"username,omitempty"`
+	Password types.Secret `yaml:"Password,omitempty" json:"password,omitempty"`
+	// KeyPath is the private key on the workstation used to connect to the host
+	KeyPath string `yaml:"KeyPath,omitempty" json:"keypath,omitempty"`
+	// HostKeys pins the ssh host keys of the host in authorized_keys format, without them the host has to be in the
+	// SSH KnownHosts file
+	HostKeys []string `yaml:"HostKeys,omitempty" json:"hostkeys,omitempty"`
+}
@@ -1,6 +1,8 @@
 package cluster
 
+import "github.com/netapp/cake/pkg/config/types"
+
 // CAPIConfig is config needed for the CAPI engine
 type CAPIConfig struct {
-	GithubToken string `yaml:"GithubToken" json:"githubtoken"`
+	GithubToken types.Secret `yaml:"GithubToken" json:"githubtoken"`
 }
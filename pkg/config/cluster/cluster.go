@@ -1,5 +1,7 @@
 package cluster
 
+import "github.com/netapp/cake/pkg/config/types"
+
 // K8sConfig specifies the details about the management cluster
 type K8sConfig struct {
 	ClusterName           string `yaml:"ClusterName" json:"clustername"`
@@ -17,6 +19,9 @@ type SSH struct {
 	Username       string   `yaml:"Username" json:"username"`
 	AuthorizedKeys []string `yaml:"AuthorizedKeys" json:"authorizedkeys"`
 	KeyPath        string   `yaml:"KeyPath,omitempty" json:"keyPath,omitempty"`
+	// KnownHosts verifies the hosts cake did not create and that do not pin their host keys, defaults to
+	// ~/.ssh/known_hosts
+	KnownHosts string `yaml:"KnownHosts,omitempty" json:"knownHosts,omitempty"`
 }
 
 // Addons holds optional configuration values
@@ -33,9 +38,33 @@ type ObservabilitySpec struct {
 
 // Solidfire Addon info
 type Solidfire struct {
-	Enable   bool   `yaml:"Enable"`
-	MVIP     string `yaml:"MVIP"`
-	SVIP     string `yaml:"SVIP"`
-	User     string `yaml:"User"`
-	Password string `yaml:"Password"`
+	Enable   bool         `yaml:"Enable"`
+	MVIP     string       `yaml:"MVIP"`
+	SVIP     string       `yaml:"SVIP"`
+	User     string       `yaml:"User"`
+	Password types.Secret `yaml:"Password"`
+}
+
+// Backup holds the recurring etcd snapshot configuration
+type Backup struct {
+	Enable        bool     `yaml:"Enable" json:"enable"`
+	IntervalHours int      `yaml:"IntervalHours,omitempty" json:"intervalhours,omitempty"`
+	Retention     int      `yaml:"Retention,omitempty" json:"retention,omitempty"`
+	S3            S3Target `yaml:"S3,omitempty" json:"s3,omitempty"`
+}
+
+// S3Target is an S3-compatible object store for etcd snapshots
+type S3Target struct {
+	Endpoint  string       `yaml:"Endpoint" json:"endpoint"`
+	Bucket    string       `yaml:"Bucket" json:"bucket"`
+	Folder    string       `yaml:"Folder,omitempty" json:"folder,omitempty"`
+	Region    string       `yaml:"Region,omitempty" json:"region,omitempty"`
+	AccessKey string       `yaml:"AccessKey" json:"accesskey"`
+	SecretKey types.Secret `yaml:"SecretKey" json:"secretkey"`
+	CustomCA  string       `yaml:"CustomCA,omitempty" json:"customca,omitempty"`
+}
+
+// Enabled returns true if snapshots should be shipped to S3
+func (s S3Target) Enabled() bool {
+	return s.Endpoint != "" && s.Bucket != ""
 }
@@ -0,0 +1,14 @@
+package kvm
+
+// ProviderKVM is libvirt specific data
+type ProviderKVM struct {
+	// URI of the libvirt connection, ie qemu:///system or qemu+ssh://root@host/system
+	URI         string `yaml:"URI" json:"uri"`
+	StoragePool string `yaml:"StoragePool" json:"storagepool"`
+	Network     string `yaml:"Network" json:"network"`
+	// Image is a qcow2 cloud image with cloud-init, local path or http(s) URL
+	Image    string `yaml:"Image" json:"image"`
+	VCPUs    int    `yaml:"VCPUs,omitempty" json:"vcpus,omitempty"`
+	MemoryMB int    `yaml:"MemoryMB,omitempty" json:"memorymb,omitempty"`
+	DiskGB   int    `yaml:"DiskGB,omitempty" json:"diskgb,omitempty"`
+}
@@ -8,10 +8,11 @@ import (
 
 // Supported Provider and Engine Types
 const (
-	VsphereProvider = types.ProviderType("VSPHERE")
-	KVMProvider     = types.ProviderType("KVM")
-	EngineRKE       = types.EngineType("RKE")
-	EngineCAPI      = types.EngineType("CAPV")
+	VsphereProvider   = types.ProviderType("VSPHERE")
+	KVMProvider       = types.ProviderType("KVM")
+	BaremetalProvider = types.ProviderType("BAREMETAL")
+	EngineRKE         = types.EngineType("RKE")
+	EngineCAPI        = types.EngineType("CAPV")
 )
 
 // Node Role Names
@@ -0,0 +1,37 @@
+package types
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// maskedSecret is printed instead of the value of a Secret
+const maskedSecret = "********"
+
+// Secret is a password, token or key from the spec. It is masked when formatted with fmt, logged or marshalled
+// to json, so it can not leak into logs and events. Yaml keeps the value, the spec is only ever saved with
+// mode 0600 and uploaded to the bootstrap node over sftp
+type Secret string
+
+// Reveal returns the value, only use it where the value is handed to the system that needs it
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// String masks a non-empty secret
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return maskedSecret
+}
+
+// GoString masks the secret for %#v
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+// MarshalJSON masks the secret
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
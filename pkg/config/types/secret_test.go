@@ -0,0 +1,50 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+type credentials struct {
+	User     string `yaml:"User" json:"user"`
+	Password Secret `yaml:"Password" json:"password"`
+}
+
+func TestSecret(t *testing.T) {
+	c := credentials{User: "admin", Password: "hunter2"}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q"} {
+		out := fmt.Sprintf(format, c)
+		if strings.Contains(out, "hunter2") {
+			t.Fatalf("expected %s to mask the secret, actual: %s", format, out)
+		}
+	}
+	out, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"user":"admin","password":"********"}` {
+		t.Fatalf("expected json to mask the secret, actual: %s", out)
+	}
+
+	out, err = yaml.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed credentials
+	err = yaml.Unmarshal(out, &parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Password.Reveal() != "hunter2" {
+		t.Fatalf("expected yaml to keep the secret, actual: %s", out)
+	}
+
+	if Secret("").String() != "" {
+		t.Fatal("expected an empty secret to stay empty")
+	}
+}
@@ -12,7 +12,7 @@ type ConfigSpec struct {
 	Provider              string        `yaml:"Provider" json:"provider"`
 	VCenterURL            string        `yaml:"VCenterURL" json:"vcenterurl"`
 	VCenterUser           string        `yaml:"VCenterUser" json:"vcenteruser"`
-	VCenterPassword       string        `yaml:"VCenterPassword" json:"vcenterpassword"`
+	VCenterPassword       Secret        `yaml:"VCenterPassword" json:"vcenterpassword"`
 	DatacenterID          string        `yaml:"DatacenterID" json:"datacenterid"`
 	ResourcePoolID        string        `yaml:"ResourcePoolID" json:"resourcepoolid"`
 	DatastoreID           string        `yaml:"DatastoreID" json:"datastoreid"`
@@ -23,7 +23,7 @@ type ConfigSpec struct {
 	StorageNetworkID      string        `yaml:"StorageNetworkID" json:"storagenetworkid"`
 	StorageNetworkName    string        `yaml:"StorageNetworkName" json:"storagenetworkname"`
 	OrganizationID        string        `yaml:"OrganizationID" json:"organizationid"`
-	CloudCentralKey       string        `yaml:"CloudCentralKey" json:"cloudcentralkey"`
+	CloudCentralKey       Secret        `yaml:"CloudCentralKey" json:"cloudcentralkey"`
 	Solidfire             Solidfire     `yaml:"Solidfire,omitempty" json:"solidfire,omitempty"`
 	IPAM                  IPAMConfig    `yaml:"IPAM,omitempty" json:"ipam,omitempty"`
 	ProxySettings         ProxySettings `yaml:"ProxySettings,omitempty" json:"proxysettings,omitempty"`
@@ -32,7 +32,6 @@ type ConfigSpec struct {
 
 // Configuration holds optional configuration values
 type Configuration struct {
-	DisableCleanup        bool `yaml:"-" json:"-"`
 	DisableHALoadbalancer bool `yaml:"-" json:"-"`
 
 	OVA        OVASpec       `yaml:"OVA,omitempty" json:"ova,omitempty"`
@@ -47,9 +46,7 @@ type Configuration struct {
 type ClusterSpec struct {
 	Name                  string `yaml:"Name,omitempty" json:"name,omitempty"`
 	ControlPlaneNodeCount int    `yaml:"ControlPlaneNodeCount,omitempty" json:"controlplanenodecount,omitempty"`
-	ControlPlaneNodeSize  string `yaml:"ControlPlaneNodeSize,omitempty" json:"controlplanenodesize,omitempty"`
 	WorkerCount           int    `yaml:"WorkerCount,omitempty" json:"workercount,omitempty"`
-	WorkerSize            string `yaml:"WorkerSize,omitempty" json:"workersize,omitempty"`
 	KubernetesVersion     string `yaml:"KubernetesVersion,omitempty" json:"kubernetesversion,omitempty"`
 	KubernetesPodCidr     string `yaml:"KubernetesPodCidr,omitempty" json:"kubernetespodcidr,omitempty"`
 	KubernetesServiceCidr string `yaml:"KubernetesServiceCidr,omitempty" json:"kubernetesservicecidr,omitempty"`
@@ -78,7 +75,7 @@ type BintraySpec struct {
 	Subject  string `yaml:"Subject,omitempty" json:"subject,omitempty"`
 	BasePath string `yaml:"BasePath,omitempty" json:"basepath,omitempty"`
 	User     string `yaml:"User,omitempty" json:"user,omitempty"`
-	Token    string `yaml:"Token,omitempty" json:"token,omitempty"`
+	Token    Secret `yaml:"Token,omitempty" json:"token,omitempty"`
 }
 
 // OVASpec sets OVA information used for virtual machine templates
@@ -94,7 +91,7 @@ type Solidfire struct {
 	MVIP     string `yaml:"MVIP" json:"mvip"`
 	SVIP     string `yaml:"SVIP" json:"svip"`
 	User     string `yaml:"User" json:"user"`
-	Password string `yaml:"Password" json:"password"`
+	Password Secret `yaml:"Password" json:"password"`
 }
 
 // IPAMProvider controls what IP address management provider will be used for the region
@@ -117,7 +114,7 @@ type MNodeConfig struct {
 	Path        string `yaml:"Path" json:"path"`
 	Version     string `yaml:"Version" json:"version"`
 	AuthHostURL string `yaml:"AuthHostURL" json:"authhosturl"`
-	AuthSecret  string `yaml:"AuthSecret" json:"authsecret"`
+	AuthSecret  Secret `yaml:"AuthSecret" json:"authsecret"`
 	TLSInsecure bool   `yaml:"TLSInsecure" json:"tlsinsecure"`
 }
 
@@ -125,7 +122,7 @@ type InfobloxConfig struct {
 	Host      string            `yaml:"Host" json:"host"`
 	Port      string            `yaml:"Port" json:"port"`
 	User      string            `yaml:"User" json:"user"`
-	Password  string            `yaml:"Password" json:"password"`
+	Password  Secret            `yaml:"Password" json:"password"`
 	TenantID  string            `yaml:"TenantID" json:"tenantid" `
 	Version   string            `yaml:"Version" json:"version"`
 	SSLVerify bool              `yaml:"SSLVerify" json:"sslverify"`
@@ -149,7 +146,7 @@ type ProxySettings struct {
 	Port     int    `yaml:"Port" json:"port"`
 	SshPort  int    `yaml:"SSHPort" json:"sshport"`
 	Username string `yaml:"Username" json:"username"`
-	Password string `yaml:"Password" json:"password"`
+	Password Secret `yaml:"Password" json:"password"`
 }
 
 // ObservabilitySpec holds values for the observability archive file
@@ -1,17 +1,99 @@
 package vsphere
 
+import "github.com/netapp/cake/pkg/config/types"
+
 // ProviderVsphere is vsphere specifc data
 type ProviderVsphere struct {
-	URL               string  `yaml:"URL" json:"url"`
-	Username          string  `yaml:"Username" json:"username"`
-	Password          string  `yaml:"Password" json:"password"`
-	Datacenter        string  `yaml:"Datacenter" json:"datacenter"`
-	ResourcePool      string  `yaml:"ResourcePool" json:"resourcepool"`
-	Datastore         string  `yaml:"Datastore" json:"datastore"`
-	ManagementNetwork string  `yaml:"ManagementNetwork" json:"managementnetwork"`
-	StorageNetwork    string  `yaml:"StorageNetwork" json:"storagenetwork"`
-	Folder            string  `yaml:"Folder" json:"folder"`
-	OVA               OVASpec `yaml:"OVA" json:"ova"`
+	URL               string       `yaml:"URL" json:"url"`
+	Username          string       `yaml:"Username" json:"username"`
+	Password          types.Secret `yaml:"Password" json:"password"`
+	Datacenter        string       `yaml:"Datacenter" json:"datacenter"`
+	ResourcePool      string       `yaml:"ResourcePool" json:"resourcepool"`
+	Datastore         string       `yaml:"Datastore" json:"datastore"`
+	ManagementNetwork string       `yaml:"ManagementNetwork" json:"managementnetwork"`
+	StorageNetwork    string       `yaml:"StorageNetwork" json:"storagenetwork"`
+	// BootstrapNetwork is the network of the CAPV BootstrapVM, it defaults to ManagementNetwork
+	BootstrapNetwork string  `yaml:"BootstrapNetwork,omitempty" json:"bootstrapnetwork,omitempty"`
+	Folder           string  `yaml:"Folder" json:"folder"`
+	OVA              OVASpec `yaml:"OVA" json:"ova"`
+	// CleanupTemplates lets Finalize remove the templates the cluster does not clone from, including
+	// templates imported by an earlier deploy and reused
+	CleanupTemplates bool `yaml:"CleanupTemplates,omitempty" json:"cleanuptemplates,omitempty"`
+	// StaticIPs are fixed addresses for the VMs cake clones, VMs without one use DHCP
+	StaticIPs *StaticIPs `yaml:"StaticIPs,omitempty" json:"staticips,omitempty"`
+	// IPAM reserves an address for every VM cake clones that has no static IP
+	IPAM types.IPAMConfig `yaml:"IPAM,omitempty" json:"ipam,omitempty"`
+	// VMSizes are the resources of the VMs cake clones by role
+	VMSizes VMSizes `yaml:"VMSizes,omitempty" json:"vmsizes,omitempty"`
+	// Networks are attached to the VMs cake clones by role, in addition to the management network
+	Networks VMNetworks `yaml:"Networks,omitempty" json:"networks,omitempty"`
+	// AntiAffinity keeps the RKE nodes of a role on different hosts of the compute cluster
+	AntiAffinity AntiAffinity `yaml:"AntiAffinity,omitempty" json:"antiaffinity,omitempty"`
+}
+
+// AntiAffinity selects the roles that get a DRS VM-VM anti-affinity rule, the control plane nodes run etcd and
+// get one unless it is disabled
+type AntiAffinity struct {
+	DisableControlPlane bool `yaml:"DisableControlPlane,omitempty" json:"disablecontrolplane,omitempty"`
+	Workers             bool `yaml:"Workers,omitempty" json:"workers,omitempty"`
+	// Mandatory rules keep DRS and HA from ever placing two VMs of a role on one host
+	Mandatory bool `yaml:"Mandatory,omitempty" json:"mandatory,omitempty"`
+}
+
+// VMNetworks are the additional networks of the VMs cake clones, roles are the same as for VMSizes
+type VMNetworks struct {
+	Bootstrap    []VMNetwork `yaml:"Bootstrap,omitempty" json:"bootstrap,omitempty"`
+	ControlPlane []VMNetwork `yaml:"ControlPlane,omitempty" json:"controlplane,omitempty"`
+	Worker       []VMNetwork `yaml:"Worker,omitempty" json:"worker,omitempty"`
+}
+
+// VMNetwork is an additional NIC, ie for iSCSI storage. The management network is always the first NIC and
+// the only one with a default route
+type VMNetwork struct {
+	// Name is the vSphere network
+	Name string `yaml:"Name" json:"name"`
+	// Order places the NIC after the management network, NICs with the same Order keep the order of the list
+	Order int `yaml:"Order,omitempty" json:"order,omitempty"`
+	MTU   int `yaml:"MTU,omitempty" json:"mtu,omitempty"`
+	// Addresses are IP/prefix by VM name, VMs without one use DHCP on this network
+	Addresses map[string]string `yaml:"Addresses,omitempty" json:"addresses,omitempty"`
+}
+
+// VMSizes are the sizes of the VMs cake clones, Bootstrap is the CAPV BootstrapVM and the RKE engine runs on the
+// first control plane node
+type VMSizes struct {
+	Bootstrap    VMSize `yaml:"Bootstrap,omitempty" json:"bootstrap,omitempty"`
+	ControlPlane VMSize `yaml:"ControlPlane,omitempty" json:"controlplane,omitempty"`
+	Worker       VMSize `yaml:"Worker,omitempty" json:"worker,omitempty"`
+}
+
+// VMSize is a named Size, explicit resources or both, explicit resources override those of the named Size.
+// Resources that are not set keep the value of the template, except memory which defaults to 8 GB
+type VMSize struct {
+	// Size is small, medium, large or xlarge
+	Size     string `yaml:"Size,omitempty" json:"size,omitempty"`
+	VCPUs    int    `yaml:"VCPUs,omitempty" json:"vcpus,omitempty"`
+	MemoryMB int    `yaml:"MemoryMB,omitempty" json:"memorymb,omitempty"`
+	// DiskGB grows the first disk of the template, it can not be smaller than the template disk
+	DiskGB int `yaml:"DiskGB,omitempty" json:"diskgb,omitempty"`
+}
+
+// StaticIPs are the addresses of the VMs by name, ie BootstrapVM for CAPV or mgmt-controlplane-1 for RKE.
+// Gateway, Nameservers and SearchDomains apply to every VM that does not set its own
+type StaticIPs struct {
+	Gateway       string                 `yaml:"Gateway" json:"gateway"`
+	Nameservers   []string               `yaml:"Nameservers,omitempty" json:"nameservers,omitempty"`
+	SearchDomains []string               `yaml:"SearchDomains,omitempty" json:"searchdomains,omitempty"`
+	Nodes         map[string]NodeNetwork `yaml:"Nodes" json:"nodes"`
+}
+
+// NodeNetwork is the static address of a VM
+type NodeNetwork struct {
+	// Address is IP/prefix, ie 10.0.0.11/24
+	Address       string   `yaml:"Address" json:"address"`
+	Gateway       string   `yaml:"Gateway,omitempty" json:"gateway,omitempty"`
+	Nameservers   []string `yaml:"Nameservers,omitempty" json:"nameservers,omitempty"`
+	SearchDomains []string `yaml:"SearchDomains,omitempty" json:"searchdomains,omitempty"`
 }
 
 // OVASpec sets OVA information used for virtual machine templates
@@ -19,4 +101,17 @@ type OVASpec struct {
 	BootstrapTemplate    string `yaml:"BootstrapTemplate" json:"bootstraptemplate"`
 	NodeTemplate         string `yaml:"NodeTemplate" json:"nodetemplate,omitempty"`
 	LoadbalancerTemplate string `yaml:"LoadbalancerTemplate" json:"loadbalancertemplate,omitempty"`
+	// Checksums are the SHA-256 of OVAs by URL, a downloaded OVA without one is verified against its manifest
+	Checksums map[string]string `yaml:"Checksums,omitempty" json:"checksums,omitempty"`
+	// ContentLibrary publishes the OVAs to a vSphere content library, the VMs cake clones are deployed from its items
+	ContentLibrary ContentLibrary `yaml:"ContentLibrary,omitempty" json:"contentlibrary,omitempty"`
+}
+
+// ContentLibrary is the library the OVAs are published to or consumed from. An item is named after the OVA and the
+// digest of its descriptor and manifest, a template entry that is not an OVA names an item as is
+type ContentLibrary struct {
+	Name string `yaml:"Name,omitempty" json:"name,omitempty"`
+	// Publish uploads the OVAs the library has no item for and creates the library on the Datastore when it does
+	// not exist, without it every item must already be in the library
+	Publish bool `yaml:"Publish,omitempty" json:"publish,omitempty"`
 }
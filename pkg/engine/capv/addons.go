@@ -15,7 +15,7 @@ const (
 )
 
 // InstallAddons installs any optional Addons to a management cluster
-func (m MgmtCluster) InstallAddons() error {
+func (m MgmtCluster) InstallAddons(ctx context.Context) error {
 	//var g errgroup.Group
 	//cf := new(ConfigFile)
 	//cf.Spec = *spec
@@ -23,7 +23,7 @@ func (m MgmtCluster) InstallAddons() error {
 	//
 	//g.Go(func() error {
 	//	if cf.Addons.Solidfire.Enable {
-	//		return installTrident(cf)
+	//		return installTrident(ctx, cf)
 	//	}
 	//	return nil
 	//})
@@ -77,7 +77,7 @@ func installObservability(m *MgmtCluster) error {
 	return err
 }
 
-func installTrident(m *MgmtCluster) error {
+func installTrident(ctx context.Context, m *MgmtCluster) error {
 	m.EventStream.Publish(&progress.StatusEvent{
 		Type: "progress",
 		Msg:  "installing the trident addon",
@@ -87,12 +87,12 @@ func installTrident(m *MgmtCluster) error {
 	if err != nil {
 		return err
 	}
-	permanentKubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, "kubeconfig")
+	permanentKubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, PermanentKubeconfig)
 	envs := map[string]string{
 		"KUBECONFIG": permanentKubeConfig,
 	}
 	args := []string{"install", "--namespace=trident"}
-	err = cmd.GenericExecute(envs, string(tridentctl), args, nil)
+	err = cmd.GenericExecute(envs, string(tridentctl), args, &ctx)
 	if err != nil {
 		return err
 	}
@@ -100,12 +100,12 @@ func installTrident(m *MgmtCluster) error {
 	backend := fmt.Sprintf(
 		elementBackendJSON.Contents,
 		m.Addons.Solidfire.User,
-		m.Addons.Solidfire.Password,
+		m.Addons.Solidfire.Password.Reveal(),
 		m.Addons.Solidfire.MVIP,
 		m.Addons.Solidfire.SVIP,
 		m.ClusterName,
 	)
-	err = writeToDisk(m.ClusterName, elementBackendJSON.Name, []byte(backend), 0644)
+	err = writeToDisk(m.ClusterName, elementBackendJSON.Name, []byte(backend), secretMode)
 	if err != nil {
 		return err
 	}
@@ -117,7 +117,7 @@ func installTrident(m *MgmtCluster) error {
 		"backend",
 		"--filename=" + fpath,
 	}
-	err = cmd.GenericExecute(envs, string(tridentctl), args, nil)
+	err = cmd.GenericExecute(envs, string(tridentctl), args, &ctx)
 	if err != nil {
 		return err
 	}
@@ -134,7 +134,7 @@ func installTrident(m *MgmtCluster) error {
 		"apply",
 		"--filename=" + fpath,
 	}
-	err = cmd.GenericExecute(envs, string(kubectl), args, nil)
+	err = cmd.GenericExecute(envs, string(kubectl), args, &ctx)
 	if err != nil {
 		return err
 	}
@@ -187,7 +187,7 @@ func injectTridentPrereqs(clusterName, storageNetwork, kubeconfigLocation string
 	if err != nil || string(stderr) != "" {
 		return fmt.Errorf("err: %v, stderr: %v", err, string(stderr))
 	}
-	err = writeToDisk(clusterName, fmt.Sprintf(specWithTrident, clusterName), stdout, 0644)
+	err = writeToDisk(clusterName, fmt.Sprintf(specWithTrident, clusterName), stdout, secretMode)
 	if err != nil {
 		return err
 	}
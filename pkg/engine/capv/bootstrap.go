@@ -1,6 +1,7 @@
 package capv
 
 import (
+	"context"
 	"fmt"
 	"github.com/netapp/cake/pkg/progress"
 	"time"
@@ -9,7 +10,7 @@ import (
 )
 
 // CreateBootstrap creates the temporary CAPv bootstrap cluster
-func (m MgmtCluster) CreateBootstrap() error {
+func (m MgmtCluster) CreateBootstrap(ctx context.Context) error {
 	var err error
 	m.EventStream.Publish(&progress.StatusEvent{
 		Type: "progress",
@@ -20,7 +21,7 @@ func (m MgmtCluster) CreateBootstrap() error {
 		"create",
 		"cluster",
 	}
-	err = cmd.GenericExecute(nil, string(kind), args, nil)
+	err = cmd.GenericExecute(nil, string(kind), args, &ctx)
 	if err != nil {
 		return err
 	}
@@ -33,13 +34,13 @@ func (m MgmtCluster) CreateBootstrap() error {
 		"get",
 		"kubeconfig",
 	}
-	c := cmd.NewCommandLine(nil, string(kind), args, nil)
+	c := cmd.NewCommandLine(nil, string(kind), args, &ctx)
 	stdout, stderr, err := c.Program().Execute()
 	if err != nil || string(stderr) != "" {
 		return fmt.Errorf("err: %v, stderr: %v", err, string(stderr))
 	}
 
-	err = writeToDisk(m.ClusterName, bootstrapKubeconfig, []byte(stdout), 0644)
+	err = writeToDisk(m.ClusterName, BootstrapKubeconfig, []byte(stdout), secretMode)
 	if err != nil {
 		return err
 	}
@@ -1,10 +1,18 @@
 package capv
 
+import "os"
+
+// secretMode is used for files holding credentials, like kubeconfigs and the vSphere credentials secret
+const secretMode os.FileMode = 0600
+
 // names for capv things
 const (
 	ConfigDir             = ".cluster-engine/"
 	vsphereWorkloadFolder = "workloads"
 	vsphereBaseFolder     = "nks"
-	bootstrapKubeconfig   = "bootstrap.kubeconfig"
-	appName               = ".cluster-engine"
+	// BootstrapKubeconfig is the kubeconfig of the kind cluster in the ConfigDir of the cluster
+	BootstrapKubeconfig = "bootstrap.kubeconfig"
+	// PermanentKubeconfig is the kubeconfig of the management cluster in the ConfigDir of the cluster
+	PermanentKubeconfig = "kubeconfig"
+	appName             = ".cluster-engine"
 )
@@ -179,8 +179,11 @@ func writeToDisk(dirname string, fileName string, specFile []byte, perms os.File
 	newpath := filepath.Join(home, appName, dirname)
 	os.MkdirAll(newpath, os.ModePerm)
 	err = ioutil.WriteFile(filepath.Join(newpath, fileName), specFile, perms)
-
-	return err
+	if err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file written by an earlier run
+	return os.Chmod(filepath.Join(newpath, fileName), perms)
 }
 
 func downloadFile(URL, fileName string, fileLocation string) error {
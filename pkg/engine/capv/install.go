@@ -1,6 +1,7 @@
 package capv
 
 import (
+	"context"
 	"fmt"
 	"github.com/netapp/cake/pkg/progress"
 	"path/filepath"
@@ -12,7 +13,7 @@ import (
 )
 
 // InstallControlPlane installs CAPv CRDs into the temporary bootstrap cluster
-func (m MgmtCluster) InstallControlPlane() error {
+func (m MgmtCluster) InstallControlPlane(ctx context.Context) error {
 	var err error
 	home, err := homedir.Dir()
 	if err != nil {
@@ -23,15 +24,15 @@ func (m MgmtCluster) InstallControlPlane() error {
 	secretSpecContents := fmt.Sprintf(
 		vsphereCredsSecret.Contents,
 		m.Username,
-		m.Password,
+		m.Password.Reveal(),
 	)
-	err = writeToDisk(m.ClusterName, vsphereCredsSecret.Name, []byte(secretSpecContents), 0644)
+	err = writeToDisk(m.ClusterName, vsphereCredsSecret.Name, []byte(secretSpecContents), secretMode)
 	if err != nil {
 		return err
 	}
 	time.Sleep(10 * time.Second)
 
-	kubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, bootstrapKubeconfig)
+	kubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, BootstrapKubeconfig)
 	envs := map[string]string{
 		"KUBECONFIG": kubeConfig,
 	}
@@ -39,7 +40,7 @@ func (m MgmtCluster) InstallControlPlane() error {
 		"apply",
 		"--filename=" + secretSpecLocation,
 	}
-	err = cmd.GenericExecute(envs, string(kubectl), args, nil)
+	err = cmd.GenericExecute(envs, string(kubectl), args, &ctx)
 	if err != nil {
 		m.EventStream.Publish(&progress.StatusEvent{
 			Type: "progress",
@@ -56,7 +57,7 @@ func (m MgmtCluster) InstallControlPlane() error {
 	nodeTemplate := strings.Split(filepath.Base(m.OVA.NodeTemplate), ".ova")[0]
 	LoadBalancerTemplate := strings.Split(filepath.Base(m.OVA.LoadbalancerTemplate), ".ova")[0]
 	envs = map[string]string{
-		"VSPHERE_PASSWORD":           m.Password,
+		"VSPHERE_PASSWORD":           m.Password.Reveal(),
 		"VSPHERE_USERNAME":           m.Username,
 		"VSPHERE_SERVER":             m.URL,
 		"VSPHERE_DATACENTER":         m.Datacenter,
@@ -70,14 +71,14 @@ func (m MgmtCluster) InstallControlPlane() error {
 		"KUBECONFIG":                 kubeConfig,
 	}
 	if m.GithubToken != "" {
-		envs["GITHUB_TOKEN"] = m.GithubToken
+		envs["GITHUB_TOKEN"] = m.GithubToken.Reveal()
 	}
 	args = []string{
 		"init",
 		"--infrastructure=vsphere",
 	}
 
-	err = cmd.GenericExecute(envs, string(clusterctl), args, nil)
+	err = cmd.GenericExecute(envs, string(clusterctl), args, &ctx)
 	if err != nil {
 		return err
 	}
@@ -98,13 +99,13 @@ func (m MgmtCluster) InstallControlPlane() error {
 		fmt.Sprintf("--control-plane-machine-count=%v", m.ControlPlaneCount),
 		fmt.Sprintf("--worker-machine-count=%v", m.WorkerCount),
 	}
-	c := cmd.NewCommandLine(envs, string(clusterctl), args, nil)
+	c := cmd.NewCommandLine(envs, string(clusterctl), args, &ctx)
 	stdout, stderr, err := c.Program().Execute()
 	if err != nil || string(stderr) != "" {
-		return fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+		return fmt.Errorf("err: %v, stderr: %v, cmd: %v", err, string(stderr), c)
 	}
 
-	err = writeToDisk(m.ClusterName, m.ClusterName+"-base"+".yaml", []byte(stdout), 0644)
+	err = writeToDisk(m.ClusterName, m.ClusterName+"-base"+".yaml", []byte(stdout), secretMode)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package capv
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"time"
@@ -11,7 +12,7 @@ import (
 )
 
 // CreatePermanent creates the permanent CAPv management cluster
-func (m MgmtCluster) CreatePermanent() error {
+func (m MgmtCluster) CreatePermanent(ctx context.Context) error {
 	var err error
 	var capiConfig string
 
@@ -19,7 +20,7 @@ func (m MgmtCluster) CreatePermanent() error {
 	if err != nil {
 		return err
 	}
-	kubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, bootstrapKubeconfig)
+	kubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, BootstrapKubeconfig)
 	if m.Addons.Solidfire.Enable {
 		err = injectTridentPrereqs(m.ClusterName, m.StorageNetwork, kubeConfig, nil)
 		if err != nil {
@@ -37,7 +38,7 @@ func (m MgmtCluster) CreatePermanent() error {
 		"apply",
 		"--filename=" + capiConfig,
 	}
-	err = cmd.GenericExecute(envs, string(kubectl), args, nil)
+	err = cmd.GenericExecute(envs, string(kubectl), args, &ctx)
 	if err != nil {
 		return err
 	}
@@ -69,13 +70,13 @@ func (m MgmtCluster) CreatePermanent() error {
 	}
 	workloadClusterKubeconfig := getKubeconfig.(v1.Secret).Data["value"]
 	m.Kubeconfig = string(workloadClusterKubeconfig)
-	err = writeToDisk(m.ClusterName, "kubeconfig", workloadClusterKubeconfig, 0644)
+	err = writeToDisk(m.ClusterName, PermanentKubeconfig, workloadClusterKubeconfig, secretMode)
 	if err != nil {
 		return err
 	}
 
 	// apply cni
-	permanentKubeconfig := filepath.Join(home, ConfigDir, m.ClusterName, "kubeconfig")
+	permanentKubeconfig := filepath.Join(home, ConfigDir, m.ClusterName, PermanentKubeconfig)
 	envs = map[string]string{
 		"KUBECONFIG": permanentKubeconfig,
 	}
@@ -83,7 +84,7 @@ func (m MgmtCluster) CreatePermanent() error {
 		"apply",
 		"--filename=https://docs.projectcalico.org/v3.12/manifests/calico.yaml",
 	}
-	err = cmd.GenericExecute(envs, string(kubectl), args, nil)
+	err = cmd.GenericExecute(envs, string(kubectl), args, &ctx)
 	if err != nil {
 		return err
 	}
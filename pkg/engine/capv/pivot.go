@@ -1,6 +1,7 @@
 package capv
 
 import (
+	"context"
 	"path/filepath"
 	"strings"
 	"time"
@@ -10,15 +11,15 @@ import (
 )
 
 // PivotControlPlane moves CAPv from the bootstrap cluster to the permanent management cluster
-func (m MgmtCluster) PivotControlPlane() error {
+func (m MgmtCluster) PivotControlPlane(ctx context.Context) error {
 	var err error
 	home, err := homedir.Dir()
 	if err != nil {
 		return err
 	}
 	secretSpecLocation := filepath.Join(home, ConfigDir, m.ClusterName, vsphereCredsSecret.Name)
-	permanentKubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, "kubeconfig")
-	bootstrapKubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, bootstrapKubeconfig)
+	permanentKubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, PermanentKubeconfig)
+	bootstrapKubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, BootstrapKubeconfig)
 	envs := map[string]string{
 		"KUBECONFIG": permanentKubeConfig,
 	}
@@ -26,7 +27,7 @@ func (m MgmtCluster) PivotControlPlane() error {
 		"apply",
 		"--filename=" + secretSpecLocation,
 	}
-	err = cmd.GenericExecute(envs, string(kubectl), args, nil)
+	err = cmd.GenericExecute(envs, string(kubectl), args, &ctx)
 	if err != nil {
 		return err
 	}
@@ -35,14 +36,14 @@ func (m MgmtCluster) PivotControlPlane() error {
 		"ns",
 		m.Namespace,
 	}
-	err = cmd.GenericExecute(envs, string(kubectl), args, nil)
+	err = cmd.GenericExecute(envs, string(kubectl), args, &ctx)
 	if err != nil {
 		return err
 	}
 	nodeTemplate := strings.Split(filepath.Base(m.OVA.NodeTemplate), ".ova")[0]
 	LoadBalancerTemplate := strings.Split(filepath.Base(m.OVA.LoadbalancerTemplate), ".ova")[0]
 	envs = map[string]string{
-		"VSPHERE_PASSWORD":           m.Password,
+		"VSPHERE_PASSWORD":           m.Password.Reveal(),
 		"VSPHERE_USERNAME":           m.Username,
 		"VSPHERE_SERVER":             m.URL,
 		"VSPHERE_DATACENTER":         m.Datacenter,
@@ -56,14 +57,14 @@ func (m MgmtCluster) PivotControlPlane() error {
 		"KUBECONFIG":                 permanentKubeConfig,
 	}
 	if m.GithubToken != "" {
-		envs["GITHUB_TOKEN"] = m.GithubToken
+		envs["GITHUB_TOKEN"] = m.GithubToken.Reveal()
 	}
 
 	args = []string{
 		"init",
 		"--infrastructure=vsphere",
 	}
-	err = cmd.GenericExecute(envs, string(clusterctl), args, nil)
+	err = cmd.GenericExecute(envs, string(clusterctl), args, &ctx)
 	if err != nil {
 		return err
 	}
@@ -90,7 +91,7 @@ func (m MgmtCluster) PivotControlPlane() error {
 		"move",
 		"--to-kubeconfig=" + permanentKubeConfig,
 	}
-	err = cmd.GenericExecute(envs, string(clusterctl), args, nil)
+	err = cmd.GenericExecute(envs, string(clusterctl), args, &ctx)
 	if err != nil {
 		return err
 	}
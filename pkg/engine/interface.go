@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 	"github.com/netapp/cake/pkg/progress"
 	"net"
@@ -8,20 +9,22 @@ import (
 	"time"
 
 	"github.com/netapp/cake/pkg/config/cluster"
+	"github.com/netapp/cake/pkg/metrics"
+	"github.com/netapp/cake/pkg/tracing"
 )
 
-// Cluster interface for deploying K8s clusters
+// Cluster interface for deploying K8s clusters, ctx carries the tracing span of the phase a method runs in
 type Cluster interface {
 	// CreateBootstrap sets up the boostrap cluster
-	CreateBootstrap() error
+	CreateBootstrap(ctx context.Context) error
 	// InstallControlPlane puts the control plane on the boostrap cluster
-	InstallControlPlane() error
+	InstallControlPlane(ctx context.Context) error
 	// CreatePermanent provisions the permanent management cluster
-	CreatePermanent() error
+	CreatePermanent(ctx context.Context) error
 	// PivotControlPlane moves the control plane from bootstrap to permanent management cluster
-	PivotControlPlane() error
+	PivotControlPlane(ctx context.Context) error
 	// InstallAddons will install any addons into the permanent management cluster
-	InstallAddons() error
+	InstallAddons(ctx context.Context) error
 	// RequiredCommands returns the command like binaries need to run the engine
 	RequiredCommands() []string
 	// Events are messages from the implementation
@@ -36,17 +39,27 @@ type MgmtCluster struct {
 	LogDir                  string         `yaml:"LogDir" json:"logdir"`
 	SSH                     cluster.SSH    `yaml:"SSH" json:"ssh"`
 	Addons                  cluster.Addons `yaml:"Addons,omitempty" json:"addons,omitempty"`
+	Backup                  cluster.Backup `yaml:"Backup,omitempty" json:"backup,omitempty"`
 	cluster.K8sConfig       `yaml:",inline" json:",inline" mapstructure:",squash"`
-	EventStream             progress.Events `yaml:"-" json:"-" mapstructure:"-"`
-	ProgressEndpointEnabled bool            `yaml:"-" json:"-" mapstructure:"-"`
+	EventStream             progress.Events       `yaml:"-" json:"-" mapstructure:"-"`
+	ProgressEndpointEnabled bool                  `yaml:"-" json:"-" mapstructure:"-"`
+	ProgressEndpoint        progress.Credentials  `yaml:"ProgressEndpoint,omitempty" json:"progressendpoint,omitempty"`
+	EventSinks              []progress.SinkConfig `yaml:"EventSinks,omitempty" json:"eventsinks,omitempty"`
+	Tracing                 tracing.Config        `yaml:"Tracing,omitempty" json:"tracing,omitempty"`
+	MetricsAddress          string                `yaml:"MetricsAddress,omitempty" json:"metricsaddress,omitempty"`
 	FileDeliverables        []string
 }
 
-// Run provider bootstrap process
-func Run(c Cluster) error {
+// maxServeDuration is how long the progress endpoint waits for the provider to download the deliverables
+const maxServeDuration = 24 * time.Hour
+
+// Run provider bootstrap process, the phases are traced as children of the span of ctx
+func Run(ctx context.Context, c Cluster) (err error) {
+	metrics.SetInProgress()
+	defer func() { metrics.SetSuccess(err == nil) }()
 	spec := c.Spec()
 	if spec.ProgressEndpointEnabled {
-		defer progress.ServeDuration()
+		defer progress.WaitForFinalize(maxServeDuration)
 		defer progress.UpdateProgressComplete(true)
 		go progress.Serve(
 			spec.LogFile,
@@ -54,6 +67,7 @@ func Run(c Cluster) error {
 			"8081",
 			c.Events(),
 			spec.FileDeliverables,
+			spec.ProgressEndpoint,
 		)
 	}
 	// TODO poll for the endpoints to be up or something similar before starting to send messages
@@ -65,29 +79,29 @@ func Run(c Cluster) error {
 		return fmt.Errorf(errMsg)
 	}
 
-	err := c.CreateBootstrap()
-	if err != nil {
-		return err
+	phases := progress.NewPhases(c.Events(),
+		progress.PhaseCreateBootstrap,
+		progress.PhaseInstallControlPlane,
+		progress.PhaseCreatePermanent,
+		progress.PhasePivotControlPlane,
+		progress.PhaseInstallAddons,
+	)
+	steps := []struct {
+		phase string
+		msg   string
+		fn    func(context.Context) error
+	}{
+		{progress.PhaseCreateBootstrap, "Creating bootstrap cluster", c.CreateBootstrap},
+		{progress.PhaseInstallControlPlane, "Installing control plane", c.InstallControlPlane},
+		{progress.PhaseCreatePermanent, "Creating permanent management cluster", c.CreatePermanent},
+		{progress.PhasePivotControlPlane, "Pivoting control plane", c.PivotControlPlane},
+		{progress.PhaseInstallAddons, "Installing addons", c.InstallAddons},
 	}
-
-	err = c.InstallControlPlane()
-	if err != nil {
-		return err
-	}
-
-	err = c.CreatePermanent()
-	if err != nil {
-		return err
-	}
-
-	err = c.PivotControlPlane()
-	if err != nil {
-		return err
-	}
-
-	err = c.InstallAddons()
-	if err != nil {
-		return err
+	for _, step := range steps {
+		err = phases.Run(ctx, step.phase, step.msg, step.fn)
+		if err != nil {
+			return err
+		}
 	}
 	if spec.ProgressEndpointEnabled {
 		progress.UpdateProgressCompletedSuccessfully(true)
@@ -22,6 +22,7 @@ import (
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
+	"github.com/netapp/cake/pkg/config/cluster"
 	"github.com/netapp/cake/pkg/config/vsphere"
 	"github.com/netapp/cake/pkg/engine"
 	"github.com/netapp/cake/pkg/util/cmd"
@@ -101,7 +102,7 @@ func (osCli) GenericExecute(envs map[string]string, name string, args []string,
 }
 
 // InstallAddons to HA RKE cluster
-func (c MgmtCluster) InstallAddons() error {
+func (c MgmtCluster) InstallAddons(ctx context.Context) error {
 	c.EventStream.Publish(&progress.StatusEvent{
 		Type: "progress",
 		Msg:  "TODO: install addons",
@@ -124,7 +125,7 @@ func (c *MgmtCluster) Spec() engine.MgmtCluster {
 }
 
 // CreateBootstrap deploys a rancher container as single node RKE cluster
-func (c MgmtCluster) CreateBootstrap() error {
+func (c MgmtCluster) CreateBootstrap(ctx context.Context) error {
 	c.EventStream.Publish(&progress.StatusEvent{
 		Type: "progress",
 		Msg:  "docker pull rancher",
@@ -138,7 +139,6 @@ func (c MgmtCluster) CreateBootstrap() error {
 		return err
 	}
 
-	ctx := context.Background()
 	imageName := "rancher/rancher"
 
 	// This call was not working for some reason... required canonical image format?
@@ -150,7 +150,7 @@ func (c MgmtCluster) CreateBootstrap() error {
 		"pull",
 		imageName,
 	}
-	err = c.osCli.GenericExecute(nil, string(docker), args, nil)
+	err = c.osCli.GenericExecute(nil, string(docker), args, &ctx)
 	if err != nil {
 		c.EventStream.Publish(&progress.StatusEvent{
 			Type: "progress",
@@ -226,7 +226,7 @@ func (c MgmtCluster) CreateBootstrap() error {
 }
 
 // InstallControlPlane configures a single node RKE cluster
-func (c *MgmtCluster) InstallControlPlane() error {
+func (c *MgmtCluster) InstallControlPlane(ctx context.Context) error {
 	// TODO: Remove TLS hack
 	// Get "https://localhost/": x509: certificate signed by unknown authority
 	dt := http.DefaultTransport
@@ -481,13 +481,13 @@ func newVsphereNodeTemplate(ccID, datacenter, datastore, folder, pool string, ne
 }
 
 // CreatePermanent deploys HA RKE cluster to vSphere
-func (c *MgmtCluster) CreatePermanent() error {
+func (c *MgmtCluster) CreatePermanent(ctx context.Context) error {
 	c.EventStream.Publish(&progress.StatusEvent{
 		Type: "progress",
 		Msg:  "configure RKE management cluster",
 	})
 	// POST https://localhost/v3/cloudcredential
-	body := newVsphereCloudCredential(c.URL, c.Username, c.Password)
+	body := newVsphereCloudCredential(c.URL, c.Username, c.Password.Reveal())
 	resp, err := c.makeHTTPRequest("POST", "https://localhost/v3/cloudcredential", body)
 	if err != nil {
 		return err
@@ -567,16 +567,11 @@ func (c *MgmtCluster) CreatePermanent() error {
 						"heartbeat-interval": "500",
 						"election-timeout":   "5000",
 					},
-					GID:       0,
-					Retention: "72h",
-					Snapshot:  &[]bool{false}[0],
-					UID:       0,
-					BackupConfig: &v3.BackupConfig{
-						Enabled:       &[]bool{true}[0],
-						IntervalHours: 12,
-						Retention:     6,
-						SafeTimestamp: false,
-					},
+					GID:          0,
+					Retention:    "72h",
+					Snapshot:     &[]bool{false}[0],
+					UID:          0,
+					BackupConfig: newBackupConfig(c.Backup),
 				},
 			},
 			// Missing UpgradeStrategy
@@ -622,6 +617,7 @@ func (c *MgmtCluster) CreatePermanent() error {
 		return err
 	}
 	for _, node := range nodeCollectionResp.Data {
+		node := node
 		g.Go(func() error {
 			return c.waitForCondition(node.Links["self"], "type", "Ready", 5)
 		})
@@ -630,8 +626,39 @@ func (c *MgmtCluster) CreatePermanent() error {
 	return g.Wait()
 }
 
+// newBackupConfig returns the etcd backup config, recurring local snapshots are kept when no backup spec is given
+func newBackupConfig(b cluster.Backup) *v3.BackupConfig {
+	backup := &v3.BackupConfig{
+		Enabled:       &[]bool{true}[0],
+		IntervalHours: 12,
+		Retention:     6,
+		SafeTimestamp: false,
+	}
+	if !b.Enable {
+		return backup
+	}
+	if b.IntervalHours > 0 {
+		backup.IntervalHours = int64(b.IntervalHours)
+	}
+	if b.Retention > 0 {
+		backup.Retention = int64(b.Retention)
+	}
+	if b.S3.Enabled() {
+		backup.S3BackupConfig = &v3.S3BackupConfig{
+			AccessKey:  b.S3.AccessKey,
+			SecretKey:  b.S3.SecretKey.Reveal(),
+			BucketName: b.S3.Bucket,
+			Region:     b.S3.Region,
+			Endpoint:   b.S3.Endpoint,
+			CustomCA:   b.S3.CustomCA,
+			Folder:     b.S3.Folder,
+		}
+	}
+	return backup
+}
+
 // PivotControlPlane deploys rancher server via helm chart to HA RKE cluster
-func (c MgmtCluster) PivotControlPlane() error {
+func (c MgmtCluster) PivotControlPlane(ctx context.Context) error {
 	c.EventStream.Publish(&progress.StatusEvent{
 		Type: "progress",
 		Msg:  "install production rancher server",
@@ -48,7 +48,7 @@ func TestMgmtCluster_CreateBootstrap(t *testing.T) {
 				osCli:         tt.os,
 			}
 			go mockEventsReceiver(c)
-			if err := c.CreateBootstrap(); (err != nil) != tt.wantErr {
+			if err := c.CreateBootstrap(context.Background()); (err != nil) != tt.wantErr {
 				t.Errorf("CreateBootstrap() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -80,7 +80,7 @@ func TestMgmtCluster_CreatePermanent(t *testing.T) {
 				rancherClient: tt.fields.rancherClient,
 				BootstrapIP:   tt.fields.BootstrapIP,
 			}
-			if err := c.CreatePermanent(); (err != nil) != tt.wantErr {
+			if err := c.CreatePermanent(context.Background()); (err != nil) != tt.wantErr {
 				t.Errorf("CreatePermanent() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -144,7 +144,7 @@ func TestMgmtCluster_InstallAddons(t *testing.T) {
 				rancherClient: tt.fields.rancherClient,
 				BootstrapIP:   tt.fields.BootstrapIP,
 			}
-			if err := c.InstallAddons(); (err != nil) != tt.wantErr {
+			if err := c.InstallAddons(context.Background()); (err != nil) != tt.wantErr {
 				t.Errorf("InstallAddons() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -176,7 +176,7 @@ func TestMgmtCluster_InstallControlPlane(t *testing.T) {
 				rancherClient: tt.fields.rancherClient,
 				BootstrapIP:   tt.fields.BootstrapIP,
 			}
-			if err := c.InstallControlPlane(); (err != nil) != tt.wantErr {
+			if err := c.InstallControlPlane(context.Background()); (err != nil) != tt.wantErr {
 				t.Errorf("InstallControlPlane() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -208,7 +208,7 @@ func TestMgmtCluster_PivotControlPlane(t *testing.T) {
 				rancherClient: tt.fields.rancherClient,
 				BootstrapIP:   tt.fields.BootstrapIP,
 			}
-			if err := c.PivotControlPlane(); (err != nil) != tt.wantErr {
+			if err := c.PivotControlPlane(context.Background()); (err != nil) != tt.wantErr {
 				t.Errorf("PivotControlPlane() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
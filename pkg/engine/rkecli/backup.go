@@ -0,0 +1,150 @@
+package rkecli
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/netapp/cake/pkg/config/cluster"
+	"github.com/netapp/cake/pkg/util/cmd"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultBackupIntervalHours = 12
+	defaultBackupRetention     = 6
+	snapshotSave               = "snapshot-save"
+	snapshotRestore            = "snapshot-restore"
+)
+
+// newRKEBackupConfig converts the cake backup spec into the rke cluster.yml backup_config
+func newRKEBackupConfig(b cluster.Backup) *rkeBackupConfig {
+	enabled := b.Enable
+	backup := &rkeBackupConfig{
+		Enabled:       &enabled,
+		IntervalHours: b.IntervalHours,
+		Retention:     b.Retention,
+		SafeTimestamp: true,
+	}
+	if backup.IntervalHours == 0 {
+		backup.IntervalHours = defaultBackupIntervalHours
+	}
+	if backup.Retention == 0 {
+		backup.Retention = defaultBackupRetention
+	}
+	if b.S3.Enabled() {
+		backup.S3BackupConfig = &rkeS3BackupConfig{
+			AccessKey:  b.S3.AccessKey,
+			SecretKey:  b.S3.SecretKey.Reveal(),
+			BucketName: b.S3.Bucket,
+			Region:     b.S3.Region,
+			Endpoint:   b.S3.Endpoint,
+			CustomCA:   b.S3.CustomCA,
+			Folder:     b.S3.Folder,
+		}
+	}
+	return backup
+}
+
+// stateFilePath returns the location rke uses for the cluster state of a cluster.yml
+func stateFilePath(configPath string) string {
+	return strings.TrimSuffix(configPath, filepath.Ext(configPath)) + ".rkestate"
+}
+
+// SnapshotSave takes a one-off etcd snapshot with the delivered cluster.yml and rkestate
+func (c *MgmtCluster) SnapshotSave(ctx context.Context, name string) error {
+	return c.runSnapshot(ctx, snapshotSave, name)
+}
+
+// SnapshotRestore restores etcd from a named snapshot with the delivered cluster.yml and rkestate
+func (c *MgmtCluster) SnapshotRestore(ctx context.Context, name string) error {
+	if name == "" {
+		return fmt.Errorf("a snapshot name is required to restore")
+	}
+	return c.runSnapshot(ctx, snapshotRestore, name)
+}
+
+func (c *MgmtCluster) runSnapshot(ctx context.Context, action, name string) error {
+	if _, err := os.Stat(c.RKEConfigPath); err != nil {
+		return fmt.Errorf("unable to find RKE cluster config file %s: %s", c.RKEConfigPath, err)
+	}
+	if _, err := os.Stat(stateFilePath(c.RKEConfigPath)); err != nil {
+		return fmt.Errorf("unable to find RKE cluster state file %s: %s", stateFilePath(c.RKEConfigPath), err)
+	}
+	// rke reads the S3 target from the config file, its credentials are kept off the command line
+	if c.Backup.S3.Enabled() {
+		err := setBackupConfig(c.RKEConfigPath, c.Backup)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.LogFile != "" {
+		cmd.FileLogLocation = c.LogFile
+	}
+	args := snapshotArgs(action, c.RKEConfigPath, name)
+	err := cmd.GenericExecute(nil, "rke", args, &ctx)
+	if err != nil {
+		return fmt.Errorf("error running rke etcd %s cmd: %s", action, err)
+	}
+	return nil
+}
+
+// setBackupConfig writes the backup config of b to the etcd service of the RKE cluster config file
+func setBackupConfig(configPath string, b cluster.Backup) error {
+	raw, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("error reading RKE cluster config file %s: %s", configPath, err)
+	}
+	var y map[string]interface{}
+	err = yaml.Unmarshal(raw, &y)
+	if err != nil {
+		return fmt.Errorf("error unmarshaling RKE cluster config file %s: %s", configPath, err)
+	}
+	services, ok := y["services"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("error configuring etcd backups: services missing from RKE cluster config")
+	}
+	etcd, ok := services["etcd"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("error configuring etcd backups: etcd service missing from RKE cluster config")
+	}
+	etcd["backup_config"] = newRKEBackupConfig(b)
+
+	clusterYML, err := yaml.Marshal(y)
+	if err != nil {
+		return fmt.Errorf("error marshaling RKE cluster config file: %s", err)
+	}
+	// the config holds the S3 credentials of etcd snapshots
+	err = ioutil.WriteFile(configPath, clusterYML, 0600)
+	if err != nil {
+		return fmt.Errorf("error writing RKE cluster config file to file %s: %s", configPath, err)
+	}
+	return nil
+}
+
+// snapshotArgs leaves out the --s3 flags, they would replace the S3 target of the config file
+func snapshotArgs(action, configPath, name string) []string {
+	args := []string{
+		"etcd",
+		action,
+		"--config=" + configPath,
+	}
+	if name != "" {
+		args = append(args, "--name="+name)
+	}
+	return args
+}
+
+// UseLocalDeliverables points the cluster at the cluster.yml and rkestate saved to dir during Finalize
+func (c *MgmtCluster) UseLocalDeliverables(dir string) {
+	configPath := c.RKEConfigPath
+	if configPath == "" {
+		configPath = defaultConfigPath
+	}
+	c.RKEConfigPath = filepath.Join(dir, filepath.Base(configPath))
+	c.LogFile = filepath.Join(dir, "etcd-snapshot.log")
+}
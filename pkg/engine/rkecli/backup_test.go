@@ -0,0 +1,93 @@
+package rkecli
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/netapp/cake/pkg/config/cluster"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNewRKEBackupConfig(t *testing.T) {
+	b := cluster.Backup{
+		Enable: true,
+		S3: cluster.S3Target{
+			Endpoint:  "minio.local:9000",
+			Bucket:    "etcd",
+			Folder:    "mgmt",
+			AccessKey: "access",
+			SecretKey: "secret",
+		},
+	}
+	backup := newRKEBackupConfig(b)
+	if backup.IntervalHours != defaultBackupIntervalHours || backup.Retention != defaultBackupRetention {
+		t.Fatalf("expected defaults %v/%v, actual: %v/%v", defaultBackupIntervalHours, defaultBackupRetention, backup.IntervalHours, backup.Retention)
+	}
+	if backup.S3BackupConfig == nil {
+		t.Fatal("expected an s3 backup config")
+	}
+
+	out, err := yaml.Marshal(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"interval_hours: 12", "s3backupconfig:", "bucket_name: etcd", "endpoint: minio.local:9000", "folder: mgmt"} {
+		if !strings.Contains(string(out), key) {
+			t.Fatalf("expected: %s to contain: %s", out, key)
+		}
+	}
+
+	b.S3 = cluster.S3Target{}
+	if newRKEBackupConfig(b).S3BackupConfig != nil {
+		t.Fatal("expected no s3 backup config without an endpoint and bucket")
+	}
+}
+
+func TestSnapshotArgs(t *testing.T) {
+	actual := strings.Join(snapshotArgs(snapshotSave, "/rke-config.yml", "snap"), " ")
+	if actual != "etcd snapshot-save --config=/rke-config.yml --name=snap" {
+		t.Fatalf("expected: etcd snapshot-save --config=/rke-config.yml --name=snap, actual: %s", actual)
+	}
+}
+
+func TestSetBackupConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "cluster.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("nodes: []\nservices:\n  etcd:\n    snapshot: true\n")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := cluster.Backup{S3: cluster.S3Target{Endpoint: "minio.local:9000", Bucket: "etcd", AccessKey: "access", SecretKey: "secret"}}
+	err = setBackupConfig(f.Name(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"snapshot: true", "bucket_name: etcd", "secret_key: secret", "nodes: []"} {
+		if !strings.Contains(string(out), key) {
+			t.Fatalf("expected: %s to contain: %s", out, key)
+		}
+	}
+
+	err = setBackupConfig(f.Name()+".missing", b)
+	if err == nil {
+		t.Fatal("expected a missing config file to fail")
+	}
+}
+
+func TestStateFilePath(t *testing.T) {
+	actual := stateFilePath("/root/.cake/mgmt/rke-config.yml")
+	if actual != "/root/.cake/mgmt/rke-config.rkestate" {
+		t.Fatalf("expected: /root/.cake/mgmt/rke-config.rkestate, actual: %s", actual)
+	}
+}
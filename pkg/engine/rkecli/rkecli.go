@@ -1,6 +1,7 @@
 package rkecli
 
 import (
+	"context"
 	"fmt"
 	"github.com/netapp/cake/pkg/progress"
 	"gopkg.in/yaml.v3"
@@ -53,7 +54,7 @@ type MgmtCluster struct {
 }
 
 // InstallAddons to HA RKE cluster
-func (c MgmtCluster) InstallAddons() error {
+func (c MgmtCluster) InstallAddons(ctx context.Context) error {
 	c.EventStream.Publish(&progress.StatusEvent{
 		Type: "progress",
 		Msg:  "TODO: install addons",
@@ -71,7 +72,7 @@ func (c MgmtCluster) RequiredCommands() []string {
 }
 
 // CreateBootstrap is not needed for rkecli
-func (c MgmtCluster) CreateBootstrap() error {
+func (c MgmtCluster) CreateBootstrap(ctx context.Context) error {
 	c.EventStream.Publish(&progress.StatusEvent{
 		Type: "progress",
 		Msg:  "CreateBootstrap nothing to do...",
@@ -80,7 +81,7 @@ func (c MgmtCluster) CreateBootstrap() error {
 }
 
 // InstallControlPlane helm installs rancher server
-func (c *MgmtCluster) InstallControlPlane() error {
+func (c *MgmtCluster) InstallControlPlane(ctx context.Context) error {
 	c.EventStream.Publish(&progress.StatusEvent{
 		Type: "progress",
 		Msg:  "InstallControlPlan nothing to do...",
@@ -94,11 +95,14 @@ func (c *MgmtCluster) Spec() engine.MgmtCluster {
 		c.RKEConfigPath,
 		"/kube_config_rke-config.yml",
 	}
+	if c.RKEConfigPath != "" {
+		c.MgmtCluster.FileDeliverables = append(c.MgmtCluster.FileDeliverables, stateFilePath(c.RKEConfigPath))
+	}
 	return c.MgmtCluster
 }
 
 // CreatePermanent deploys HA RKE cluster to provided nodes
-func (c *MgmtCluster) CreatePermanent() error {
+func (c *MgmtCluster) CreatePermanent(ctx context.Context) error {
 	c.EventStream.Publish(&progress.StatusEvent{
 		Type: "progress",
 		Msg:  "install HA rke cluster",
@@ -168,6 +172,21 @@ func (c *MgmtCluster) CreatePermanent() error {
 
 	y["nodes"] = nodes
 	y["ssh_key_path"] = c.SSH.KeyPath
+	if c.Backup.Enable {
+		services, ok := y["services"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("error configuring etcd backups: services missing from RKE cluster config")
+		}
+		etcd, ok := services["etcd"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("error configuring etcd backups: etcd service missing from RKE cluster config")
+		}
+		etcd["backup_config"] = newRKEBackupConfig(c.Backup)
+		c.EventStream.Publish(&progress.StatusEvent{
+			Type: "progress",
+			Msg:  fmt.Sprintf("recurring etcd snapshots enabled, S3 target: %v", c.Backup.S3.Enabled()),
+		})
+	}
 	sans = append(sans, c.Hostname)
 	y["authentication"] = map[string]interface{}{
 		"sans":     sans,
@@ -179,7 +198,8 @@ func (c *MgmtCluster) CreatePermanent() error {
 	if err != nil {
 		return fmt.Errorf("error marshaling RKE cluster config file: %s", err)
 	}
-	err = ioutil.WriteFile(c.RKEConfigPath, clusterYML, 0644)
+	// the config holds the S3 credentials of etcd snapshots
+	err = ioutil.WriteFile(c.RKEConfigPath, clusterYML, 0600)
 	if err != nil {
 		return fmt.Errorf("error writing RKE cluster config file to file %s: %s", c.RKEConfigPath, err)
 	}
@@ -189,7 +209,7 @@ func (c *MgmtCluster) CreatePermanent() error {
 		"up",
 		"--config=" + c.RKEConfigPath,
 	}
-	err = cmd.GenericExecute(nil, "rke", args, nil)
+	err = cmd.GenericExecute(nil, "rke", args, &ctx)
 	if err != nil {
 		return fmt.Errorf("error running rke up cmd: %s", err)
 	}
@@ -198,7 +218,7 @@ func (c *MgmtCluster) CreatePermanent() error {
 }
 
 // PivotControlPlane deploys rancher server via helm chart to HA RKE cluster
-func (c MgmtCluster) PivotControlPlane() error {
+func (c MgmtCluster) PivotControlPlane(ctx context.Context) error {
 	kubeConfigFile := filepath.Join(filepath.Dir(c.RKEConfigPath), fmt.Sprintf("kube_config_%s", filepath.Base(c.RKEConfigPath)))
 	namespace := "cattle-system"
 	rVersion := "rancher-stable"
@@ -209,7 +229,7 @@ func (c MgmtCluster) PivotControlPlane() error {
 		"https://releases.rancher.com/server-charts/stable",
 		fmt.Sprintf("--kubeconfig=%s", kubeConfigFile),
 	}
-	err := cmd.GenericExecute(nil, "helm", args, nil)
+	err := cmd.GenericExecute(nil, "helm", args, &ctx)
 	if err != nil {
 		return fmt.Errorf("error adding rancher helm chart: %s", err)
 	}
@@ -222,7 +242,7 @@ func (c MgmtCluster) PivotControlPlane() error {
 		"list",
 		fmt.Sprintf("--kubeconfig=%s", kubeConfigFile),
 	}
-	err = cmd.GenericExecute(nil, "helm", args, nil)
+	err = cmd.GenericExecute(nil, "helm", args, &ctx)
 	if err != nil {
 		return fmt.Errorf("error reading helm chart: %s", err)
 	}
@@ -234,7 +254,7 @@ func (c MgmtCluster) PivotControlPlane() error {
 		"https://charts.jetstack.io",
 		fmt.Sprintf("--kubeconfig=%s", kubeConfigFile),
 	}
-	err = cmd.GenericExecute(nil, "helm", args, nil)
+	err = cmd.GenericExecute(nil, "helm", args, &ctx)
 	if err != nil {
 		return fmt.Errorf("error adding jetstack helm chart: %s", err)
 	}
@@ -288,7 +308,7 @@ func (c MgmtCluster) PivotControlPlane() error {
 		certManagerCRDURL,
 		fmt.Sprintf("--kubeconfig=%s", kubeConfigFile),
 	}
-	err = cmd.GenericExecute(nil, "kubectl", args, nil)
+	err = cmd.GenericExecute(nil, "kubectl", args, &ctx)
 	if err != nil {
 		return fmt.Errorf("error installing cert-manager CRD: %s", err)
 	}
@@ -302,7 +322,7 @@ func (c MgmtCluster) PivotControlPlane() error {
 		"update",
 		fmt.Sprintf("--kubeconfig=%s", kubeConfigFile),
 	}
-	err = cmd.GenericExecute(nil, "helm", args, nil)
+	err = cmd.GenericExecute(nil, "helm", args, &ctx)
 	if err != nil {
 		return fmt.Errorf("error updating helm charts: %s", err)
 	}
@@ -319,7 +339,7 @@ func (c MgmtCluster) PivotControlPlane() error {
 		fmt.Sprintf("--version=%s", certManagerVersion),
 		fmt.Sprintf("--kubeconfig=%s", kubeConfigFile),
 	}
-	err = cmd.GenericExecute(nil, "helm", args, nil)
+	err = cmd.GenericExecute(nil, "helm", args, &ctx)
 	if err != nil {
 		return fmt.Errorf("error installing cert-manager helm chart: %s", err)
 	}
@@ -339,7 +359,7 @@ func (c MgmtCluster) PivotControlPlane() error {
 		"--namespace=cert-manager",
 		fmt.Sprintf("--kubeconfig=%s", kubeConfigFile),
 	}
-	err = cmd.GenericExecute(nil, "kubectl", args, nil)
+	err = cmd.GenericExecute(nil, "kubectl", args, &ctx)
 	if err != nil {
 		return fmt.Errorf("error waiting for cert-manager: %s", err)
 	}
@@ -358,7 +378,7 @@ func (c MgmtCluster) PivotControlPlane() error {
 		"--set",
 		fmt.Sprintf("%s,%s", fmt.Sprintf("hostname=%s", c.Hostname), fmt.Sprintf("certmanager.version=%s", certManagerVersion)),
 	}
-	err = cmd.GenericExecute(nil, "helm", args, nil)
+	err = cmd.GenericExecute(nil, "helm", args, &ctx)
 	if err != nil {
 		c.EventStream.Publish(&progress.StatusEvent{
 			Type: "progress",
@@ -377,7 +397,7 @@ func (c MgmtCluster) PivotControlPlane() error {
 		fmt.Sprintf("--namespace=%s", namespace),
 		fmt.Sprintf("--kubeconfig=%s", kubeConfigFile),
 	}
-	err = cmd.GenericExecute(nil, "kubectl", args, nil)
+	err = cmd.GenericExecute(nil, "kubectl", args, &ctx)
 	if err != nil {
 		return fmt.Errorf("error waiting for rancher: %s", err)
 	}
@@ -393,12 +413,12 @@ func (c MgmtCluster) PivotControlPlane() error {
 		"--namespace=ingress-nginx",
 		fmt.Sprintf("--kubeconfig=%s", kubeConfigFile),
 	}
-	err = cmd.GenericExecute(nil, "kubectl", args, nil)
+	err = cmd.GenericExecute(nil, "kubectl", args, &ctx)
 	if err != nil {
 		return fmt.Errorf("error waiting for nginx ingress: %s", err)
 	}
 
-	if err := c.rancherIssuerWorkaround(kubeCfg, namespace, kubeConfigFile); err != nil {
+	if err := c.rancherIssuerWorkaround(ctx, kubeCfg, namespace, kubeConfigFile); err != nil {
 		return fmt.Errorf("error attempting rancher issuer workaround: %s", err)
 	}
 
@@ -429,8 +449,8 @@ func (c MgmtCluster) Events() progress.Events {
 	return c.EventStream
 }
 
-func (c MgmtCluster) rancherIssuerWorkaround(kubeCfg *restclient.Config, ns, kubeCfgFile string) error {
-	err := waitForRancherIssuer(ns, kubeCfgFile)
+func (c MgmtCluster) rancherIssuerWorkaround(ctx context.Context, kubeCfg *restclient.Config, ns, kubeCfgFile string) error {
+	err := waitForRancherIssuer(ctx, ns, kubeCfgFile)
 	if err == nil {
 		c.EventStream.Publish(&progress.StatusEvent{
 			Type: "progress",
@@ -481,10 +501,10 @@ func (c MgmtCluster) rancherIssuerWorkaround(kubeCfg *restclient.Config, ns, kub
 	if err != nil {
 		return fmt.Errorf("unable to create issuer resource: %s", err)
 	}
-	return waitForRancherIssuer(ns, kubeCfgFile)
+	return waitForRancherIssuer(ctx, ns, kubeCfgFile)
 }
 
-func waitForRancherIssuer(ns, kubeCfg string) error {
+func waitForRancherIssuer(ctx context.Context, ns, kubeCfg string) error {
 	args := []string{
 		"wait",
 		"issuer",
@@ -494,5 +514,5 @@ func waitForRancherIssuer(ns, kubeCfg string) error {
 		fmt.Sprintf("--namespace=%s", ns),
 		fmt.Sprintf("--kubeconfig=%s", kubeCfg),
 	}
-	return cmd.GenericExecute(nil, "kubectl", args, nil)
+	return cmd.GenericExecute(nil, "kubectl", args, &ctx)
 }
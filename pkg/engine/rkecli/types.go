@@ -40,3 +40,33 @@ type rkeTaint struct {
 	Key   string `json:"key,omitempty" yaml:"key"`
 	Value string `json:"value,omitempty" yaml:"value"`
 }
+
+type rkeBackupConfig struct {
+	// Enable or disable recurring backups in rancher
+	Enabled *bool `yaml:"enabled" json:"enabled,omitempty"`
+	// Backup interval in hours
+	IntervalHours int `yaml:"interval_hours" json:"intervalHours,omitempty"`
+	// Number of backups to keep
+	Retention int `yaml:"retention" json:"retention,omitempty"`
+	// s3 target
+	S3BackupConfig *rkeS3BackupConfig `yaml:"s3backupconfig,omitempty" json:"s3BackupConfig,omitempty"`
+	// replace special characters in snapshot names
+	SafeTimestamp bool `yaml:"safe_timestamp" json:"safeTimestamp,omitempty"`
+}
+
+type rkeS3BackupConfig struct {
+	// Access key ID
+	AccessKey string `yaml:"access_key" json:"accessKey,omitempty"`
+	// Secret access key
+	SecretKey string `yaml:"secret_key" json:"secretKey,omitempty" norman:"type=password"`
+	// name of the bucket to use for backup
+	BucketName string `yaml:"bucket_name" json:"bucketName,omitempty"`
+	// AWS Region, AWS spcific
+	Region string `yaml:"region" json:"region,omitempty"`
+	// Endpoint is used if this is not an AWS API
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+	// CustomCA is used to connect to custom s3 endpoints
+	CustomCA string `yaml:"custom_ca" json:"customCa,omitempty"`
+	// Folder to place the files
+	Folder string `yaml:"folder" json:"folder,omitempty"`
+}
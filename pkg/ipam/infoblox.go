@@ -0,0 +1,207 @@
+package ipam
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+const (
+	defaultWAPIVersion = "2.7"
+	// managementNetworkType selects the Networks nodes are allocated from, every network is used when none has it
+	managementNetworkType = "management"
+	tenantAttribute       = "Tenant ID"
+	// reservedMAC makes a fixed address a reservation that no DHCP client is given
+	reservedMAC = "00:00:00:00:00:00"
+)
+
+// Infoblox reserves the next free address of a network over the WAPI. Networks with EnableHostDNS get a host
+// record named <name>.<HostDNSSuffix>, the others a reserved fixed address
+type Infoblox struct {
+	// BaseURL is https://<Host>:<Port>/wapi/v<Version>
+	BaseURL  string
+	user     string
+	password types.Secret
+	tenant   string
+	networks []types.InfobloxNetwork
+	http     *http.Client
+}
+
+type infobloxIPv4 struct {
+	IPv4Addr string `json:"ipv4addr"`
+}
+
+type infobloxAttribute struct {
+	Value string `json:"value"`
+}
+
+type infobloxObject struct {
+	Ref      string                       `json:"_ref,omitempty"`
+	Name     string                       `json:"name,omitempty"`
+	Comment  string                       `json:"comment,omitempty"`
+	IPv4Addr string                       `json:"ipv4addr,omitempty"`
+	Mac      string                       `json:"mac,omitempty"`
+	Match    string                       `json:"match_client,omitempty"`
+	IPv4s    []infobloxIPv4               `json:"ipv4addrs,omitempty"`
+	DNS      *bool                        `json:"configure_for_dns,omitempty"`
+	ExtAttrs map[string]infobloxAttribute `json:"extattrs,omitempty"`
+}
+
+// NewInfoblox returns a client for the grid of c
+func NewInfoblox(c types.InfobloxConfig) (*Infoblox, error) {
+	if c.Host == "" {
+		return nil, fmt.Errorf("InfobloxConfig.Host is required")
+	}
+	if len(c.Networks) == 0 {
+		return nil, fmt.Errorf("InfobloxConfig.Networks is required")
+	}
+	for _, n := range c.Networks {
+		_, _, err := net.ParseCIDR(n.NetworkCIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Infoblox network %q, %v", n.NetworkCIDR, err)
+		}
+	}
+	host := c.Host
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	if c.Port != "" {
+		host += ":" + c.Port
+	}
+	version := strings.TrimPrefix(c.Version, "v")
+	if version == "" {
+		version = defaultWAPIVersion
+	}
+	var networks []types.InfobloxNetwork
+	for _, n := range c.Networks {
+		for _, t := range n.NetworkTypes {
+			if strings.EqualFold(t, managementNetworkType) {
+				networks = append(networks, n)
+				break
+			}
+		}
+	}
+	if len(networks) == 0 {
+		networks = c.Networks
+	}
+	return &Infoblox{
+		BaseURL:  fmt.Sprintf("%s/wapi/v%s", host, version),
+		user:     c.User,
+		password: c.Password,
+		tenant:   c.TenantID,
+		networks: networks,
+		http:     newHTTPClient(!c.SSLVerify),
+	}, nil
+}
+
+// Allocate reserves the next free address for name, the networks are tried in order until one has a free address
+func (i *Infoblox) Allocate(name string) (*Address, error) {
+	var errs []string
+	for _, n := range i.networks {
+		a, err := i.allocate(name, n)
+		if err == nil {
+			return a, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("unable to allocate an address for %s, %v", name, strings.Join(errs, "; "))
+}
+
+func (i *Infoblox) allocate(name string, n types.InfobloxNetwork) (*Address, error) {
+	next := "func:nextavailableip:" + n.NetworkCIDR
+	obj := infobloxObject{Comment: "cake node " + name}
+	if i.tenant != "" {
+		obj.ExtAttrs = map[string]infobloxAttribute{tenantAttribute: {Value: i.tenant}}
+	}
+	var objType, fields string
+	if n.EnableHostDNS {
+		dns := true
+		objType, fields = "record:host", "ipv4addrs"
+		obj.Name = name
+		if n.HostDNSSuffix != "" {
+			obj.Name = name + "." + strings.TrimPrefix(n.HostDNSSuffix, ".")
+		}
+		obj.IPv4s = []infobloxIPv4{{IPv4Addr: next}}
+		obj.DNS = &dns
+	} else {
+		objType, fields = "fixedaddress", "ipv4addr,name"
+		obj.Name = name
+		obj.IPv4Addr = next
+		obj.Mac = reservedMAC
+		obj.Match = "RESERVED"
+	}
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	out, err := i.do(http.MethodPost, objType+"?_return_as_object=1&_return_fields%2B="+fields, body)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Result infobloxObject `json:"result"`
+	}
+	err = json.Unmarshal(out, &result)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the %s of %s, %v", objType, name, err)
+	}
+	ip := result.Result.IPv4Addr
+	if len(result.Result.IPv4s) > 0 {
+		ip = result.Result.IPv4s[0].IPv4Addr
+	}
+	if result.Result.Ref == "" || net.ParseIP(ip) == nil {
+		return nil, fmt.Errorf("Infoblox returned an invalid %s for %s: %s", objType, name, out)
+	}
+	_, network, _ := net.ParseCIDR(n.NetworkCIDR)
+	prefix, _ := network.Mask.Size()
+	return &Address{
+		Address:       fmt.Sprintf("%s/%v", ip, prefix),
+		Gateway:       n.Gateway,
+		Nameservers:   n.DNSServers,
+		SearchDomains: n.SearchDomains,
+		Ref:           result.Result.Ref,
+	}, nil
+}
+
+// Release deletes the fixed address or host record ref
+func (i *Infoblox) Release(ref string) error {
+	_, err := i.do(http.MethodDelete, ref, nil)
+	if err == errNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to release %s, %v", ref, err)
+	}
+	return nil
+}
+
+func (i *Infoblox) do(method, uri string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, i.BaseURL+"/"+uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(i.user, i.password.Reveal())
+	resp, err := i.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodDelete {
+		return nil, errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s failed, %v: %s", method, req.URL.Path, resp.Status, bytes.TrimSpace(out))
+	}
+	return out, nil
+}
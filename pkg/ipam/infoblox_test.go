@@ -0,0 +1,168 @@
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+// fakeWAPI is a stand-in for the Infoblox WAPI, full networks answer like a grid without free addresses
+type fakeWAPI struct {
+	mu      sync.Mutex
+	objects map[string]infobloxObject
+	full    map[string]bool
+	next    int
+}
+
+func (f *fakeWAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "infoblox" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/wapi/v2.10/")
+	switch r.Method {
+	case http.MethodPost:
+		if r.URL.Query().Get("_return_as_object") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var obj infobloxObject
+		json.NewDecoder(r.Body).Decode(&obj)
+		next := obj.IPv4Addr
+		if path == "record:host" && len(obj.IPv4s) == 1 {
+			next = obj.IPv4s[0].IPv4Addr
+		}
+		cidr := strings.TrimPrefix(next, "func:nextavailableip:")
+		if f.full[cidr] {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"Error": "AdmConDataError: None (IBDataConflictError: IB.Data.Conflict:No available IP address in network)"}`)
+			return
+		}
+		f.next++
+		ip := strings.Replace(cidr, ".0/24", fmt.Sprintf(".%v", f.next), 1)
+		obj.Ref = fmt.Sprintf("%s/ZG5z%v:%s/default", path, f.next, ip)
+		if path == "record:host" {
+			obj.IPv4s[0].IPv4Addr = ip
+		} else {
+			obj.IPv4Addr = ip
+		}
+		f.objects[obj.Ref] = obj
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]infobloxObject{"result": obj})
+	case http.MethodDelete:
+		if _, ok := f.objects[path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.objects, path)
+		fmt.Fprintf(w, "%q", path)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newTestInfoblox(t *testing.T, networks []types.InfobloxNetwork) (*Infoblox, *fakeWAPI) {
+	f := &fakeWAPI{objects: map[string]infobloxObject{}, full: map[string]bool{}}
+	server := httptest.NewTLSServer(f)
+	t.Cleanup(server.Close)
+	i, err := NewInfoblox(types.InfobloxConfig{
+		Host:     server.URL,
+		User:     "admin",
+		Password: "infoblox",
+		TenantID: "tenant-1",
+		Version:  "v2.10",
+		Networks: networks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i, f
+}
+
+func TestInfobloxFixedAddress(t *testing.T) {
+	i, f := newTestInfoblox(t, []types.InfobloxNetwork{
+		{NetworkCIDR: "10.1.0.0/24", NetworkTypes: []string{"workload"}},
+		{NetworkCIDR: "10.0.0.0/24", Gateway: "10.0.0.254", DNSServers: []string{"10.0.0.253"}, SearchDomains: []string{"example.com"}, NetworkTypes: []string{"Management"}},
+	})
+
+	a, err := i.Allocate("node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Address != "10.0.0.1/24" || a.Gateway != "10.0.0.254" || a.Nameservers[0] != "10.0.0.253" || a.SearchDomains[0] != "example.com" {
+		t.Errorf("not allocated from the management network, %+v", a)
+	}
+	obj, ok := f.objects[a.Ref]
+	if !ok {
+		t.Fatalf("no fixed address %s", a.Ref)
+	}
+	if obj.Name != "node-1" || obj.Match != "RESERVED" || obj.ExtAttrs[tenantAttribute].Value != "tenant-1" {
+		t.Errorf("unexpected fixed address %+v", obj)
+	}
+
+	err = i.Release(a.Ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.objects) != 0 {
+		t.Errorf("fixed address was not released, %v", f.objects)
+	}
+	err = i.Release(a.Ref)
+	if err != nil {
+		t.Errorf("releasing twice should not fail, %v", err)
+	}
+}
+
+func TestInfobloxHostRecord(t *testing.T) {
+	i, f := newTestInfoblox(t, []types.InfobloxNetwork{
+		{NetworkCIDR: "10.0.0.0/24", EnableHostDNS: true, HostDNSSuffix: ".example.com"},
+		{NetworkCIDR: "10.2.0.0/24"},
+	})
+	f.full["10.0.0.0/24"] = true
+
+	// without a management network every network is tried in order
+	a, err := i.Allocate("node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Address != "10.2.0.1/24" || !strings.HasPrefix(a.Ref, "fixedaddress/") {
+		t.Errorf("expected the second network, got %+v", a)
+	}
+
+	f.full["10.0.0.0/24"] = false
+	a, err = i.Allocate("node-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := f.objects[a.Ref]
+	if a.Address != "10.0.0.2/24" || obj.Name != "node-2.example.com" || obj.DNS == nil || !*obj.DNS {
+		t.Errorf("unexpected host record %+v for %+v", obj, a)
+	}
+
+	f.full["10.0.0.0/24"] = true
+	f.full["10.2.0.0/24"] = true
+	_, err = i.Allocate("node-3")
+	if err == nil || !strings.Contains(err.Error(), "No available IP address") {
+		t.Errorf("expected the error of the grid, got %v", err)
+	}
+}
+
+func TestInfobloxUnauthorized(t *testing.T) {
+	i, _ := newTestInfoblox(t, []types.InfobloxNetwork{{NetworkCIDR: "10.0.0.0/24"}})
+	i.password = "wrong"
+	_, err := i.Allocate("node-1")
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected an unauthorized error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "wrong") {
+		t.Errorf("error reveals the password: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+// Package ipam reserves node addresses from an IP address management service
+package ipam
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+const requestTimeout = time.Minute
+
+// errNotFound is returned for a reservation that was already released
+var errNotFound = errors.New("not found")
+
+// Address is a reserved IP with the settings of its network
+type Address struct {
+	// Address is IP/prefix, ie 10.0.0.11/24
+	Address       string   `json:"address"`
+	Gateway       string   `json:"gateway,omitempty"`
+	Nameservers   []string `json:"nameservers,omitempty"`
+	SearchDomains []string `json:"searchDomains,omitempty"`
+	// Ref identifies the reservation to the provider, it is all Release needs
+	Ref string `json:"ref"`
+}
+
+// IPAM reserves and releases node addresses
+type IPAM interface {
+	// Allocate reserves an address for the machine name
+	Allocate(name string) (*Address, error)
+	// Release frees the reservation ref, releasing a reservation that no longer exists is not an error
+	Release(ref string) error
+}
+
+// Providers are the IPAM providers that can be selected
+func Providers() []types.IPAMProvider {
+	return []types.IPAMProvider{types.DHCP, types.MNodeIPService, types.Infoblox}
+}
+
+// New returns the IPAM of the config, nil when machines use DHCP
+func New(c types.IPAMConfig) (IPAM, error) {
+	switch c.Provider {
+	case "", types.DHCP:
+		return nil, nil
+	case types.MNodeIPService:
+		return NewMNode(c.MNode)
+	case types.Infoblox:
+		return NewInfoblox(c.Infoblox)
+	}
+	return nil, fmt.Errorf("unknown IPAM provider %s, supported are %v", c.Provider, Providers())
+}
+
+func newHTTPClient(insecure bool) *http.Client {
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+		},
+	}
+}
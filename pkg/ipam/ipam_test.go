@@ -0,0 +1,37 @@
+package ipam
+
+import (
+	"testing"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+func TestNew(t *testing.T) {
+	i, err := New(types.IPAMConfig{Provider: types.DHCP})
+	if err != nil || i != nil {
+		t.Errorf("DHCP should have no IPAM, got %v, %v", i, err)
+	}
+	i, err = New(types.IPAMConfig{})
+	if err != nil || i != nil {
+		t.Errorf("no provider should have no IPAM, got %v, %v", i, err)
+	}
+	_, err = New(types.IPAMConfig{Provider: "Other"})
+	if err == nil {
+		t.Error("expected an error for an unknown provider")
+	}
+	_, err = New(types.IPAMConfig{Provider: types.MNodeIPService})
+	if err == nil {
+		t.Error("expected an error for a missing MNodeConfig")
+	}
+	i, err = New(types.IPAMConfig{Provider: types.Infoblox, Infoblox: types.InfobloxConfig{
+		Host:     "grid.example.com",
+		Port:     "8443",
+		Networks: []types.InfobloxNetwork{{NetworkCIDR: "10.0.0.0/24"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := i.(*Infoblox).BaseURL; got != "https://grid.example.com:8443/wapi/v2.7" {
+		t.Errorf("unexpected WAPI URL %v", got)
+	}
+}
@@ -0,0 +1,169 @@
+package ipam
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+const (
+	mnodeClientID  = "mnode-client"
+	mnodeTokenPath = "/auth/connect/token"
+)
+
+// MNode reserves addresses from the IP service of a NetApp HCI management node. Requests are authenticated with
+// a token of the mNode auth service, client mnode-client with AuthSecret
+type MNode struct {
+	// BaseURL is https://<IP>/<Path>/<Version>
+	BaseURL string
+	// TokenURL is <AuthHostURL>/auth/connect/token
+	TokenURL string
+	secret   types.Secret
+	http     *http.Client
+	mu       sync.Mutex
+	token    string
+}
+
+// mnodeAllocation is an allocation of the IP service
+type mnodeAllocation struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name,omitempty"`
+	Address       string   `json:"address"`
+	Prefix        int      `json:"prefix"`
+	Gateway       string   `json:"gateway,omitempty"`
+	DNSServers    []string `json:"dnsServers,omitempty"`
+	SearchDomains []string `json:"searchDomains,omitempty"`
+}
+
+// NewMNode returns a client for the IP service of c
+func NewMNode(c types.MNodeConfig) (*MNode, error) {
+	if c.IP == "" {
+		return nil, fmt.Errorf("MNodeConfig.IP is required")
+	}
+	if c.AuthHostURL == "" {
+		return nil, fmt.Errorf("MNodeConfig.AuthHostURL is required")
+	}
+	base := c.IP
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+	for _, p := range []string{c.Path, c.Version} {
+		if p = strings.Trim(p, "/"); p != "" {
+			base += "/" + p
+		}
+	}
+	return &MNode{
+		BaseURL:  base,
+		TokenURL: strings.TrimSuffix(c.AuthHostURL, "/") + mnodeTokenPath,
+		secret:   c.AuthSecret,
+		http:     newHTTPClient(c.TLSInsecure),
+	}, nil
+}
+
+// Allocate reserves the next free address of the IP service for name
+func (m *MNode) Allocate(name string) (*Address, error) {
+	body, err := json.Marshal(mnodeAllocation{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	out, err := m.do(http.MethodPost, "/allocations", body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to allocate an address for %s, %v", name, err)
+	}
+	var a mnodeAllocation
+	err = json.Unmarshal(out, &a)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the allocation for %s, %v", name, err)
+	}
+	if a.ID == "" || net.ParseIP(a.Address) == nil {
+		return nil, fmt.Errorf("IP service returned an invalid allocation for %s: %s", name, out)
+	}
+	return &Address{
+		Address:       fmt.Sprintf("%s/%v", a.Address, a.Prefix),
+		Gateway:       a.Gateway,
+		Nameservers:   a.DNSServers,
+		SearchDomains: a.SearchDomains,
+		Ref:           a.ID,
+	}, nil
+}
+
+// Release deletes the allocation ref
+func (m *MNode) Release(ref string) error {
+	_, err := m.do(http.MethodDelete, "/allocations/"+url.PathEscape(ref), nil)
+	if err != nil && err != errNotFound {
+		return fmt.Errorf("unable to release allocation %s, %v", ref, err)
+	}
+	return nil
+}
+
+// do sends a request to the IP service, a token is requested first and again when it expired
+func (m *MNode) do(method, uri string, body []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if m.token == "" {
+			err := m.login()
+			if err != nil {
+				return nil, err
+			}
+		}
+		req, err := http.NewRequest(method, m.BaseURL+uri, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+m.token)
+		resp, err := m.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		out, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 0:
+			m.token = ""
+			continue
+		case resp.StatusCode == http.StatusNotFound && method == http.MethodDelete:
+			return nil, errNotFound
+		case resp.StatusCode < 200 || resp.StatusCode > 299:
+			return nil, fmt.Errorf("%s %s failed, %v: %s", method, m.BaseURL+uri, resp.Status, bytes.TrimSpace(out))
+		}
+		return out, nil
+	}
+}
+
+func (m *MNode) login() error {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {mnodeClientID},
+		"client_secret": {m.secret.Reveal()},
+	}
+	resp, err := m.http.PostForm(m.TokenURL, form)
+	if err != nil {
+		return fmt.Errorf("unable to get a token from %s, %v", m.TokenURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to get a token from %s, %v", m.TokenURL, resp.Status)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil || token.AccessToken == "" {
+		return fmt.Errorf("no token in the response of %s, %v", m.TokenURL, err)
+	}
+	m.token = token.AccessToken
+	return nil
+}
@@ -0,0 +1,140 @@
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+// fakeIPService is a stand-in for the mNode auth and IP services
+type fakeIPService struct {
+	mu          sync.Mutex
+	tokens      int
+	allocations map[string]mnodeAllocation
+	next        int
+}
+
+func (f *fakeIPService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == mnodeTokenPath {
+		if r.FormValue("client_id") != mnodeClientID || r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.tokens++
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "token"})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/ip/v1/allocations":
+		var a mnodeAllocation
+		json.NewDecoder(r.Body).Decode(&a)
+		f.next++
+		a.ID = fmt.Sprintf("allocation-%v", f.next)
+		a.Address = fmt.Sprintf("10.0.0.%v", f.next)
+		a.Prefix = 24
+		a.Gateway = "10.0.0.254"
+		a.DNSServers = []string{"10.0.0.253"}
+		f.allocations[a.ID] = a
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(a)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/ip/v1/allocations/"):
+		id := strings.TrimPrefix(r.URL.Path, "/ip/v1/allocations/")
+		if _, ok := f.allocations[id]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.allocations, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newTestMNode(t *testing.T, secret string) (*MNode, *fakeIPService) {
+	f := &fakeIPService{allocations: map[string]mnodeAllocation{}}
+	server := httptest.NewTLSServer(f)
+	t.Cleanup(server.Close)
+	m, err := NewMNode(types.MNodeConfig{
+		IP:          server.URL,
+		Path:        "ip",
+		Version:     "v1",
+		AuthHostURL: server.URL,
+		AuthSecret:  types.Secret(secret),
+		TLSInsecure: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, f
+}
+
+func TestMNodeAllocateRelease(t *testing.T) {
+	m, f := newTestMNode(t, "secret")
+
+	a, err := m.Allocate("node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Address != "10.0.0.1/24" || a.Gateway != "10.0.0.254" || len(a.Nameservers) != 1 || a.Ref != "allocation-1" {
+		t.Errorf("unexpected address %+v", a)
+	}
+	if f.allocations["allocation-1"].Name != "node-1" {
+		t.Errorf("allocation not named after the node, %+v", f.allocations["allocation-1"])
+	}
+	b, err := m.Allocate("node-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Address != "10.0.0.2/24" {
+		t.Errorf("unexpected address %+v", b)
+	}
+	if f.tokens != 1 {
+		t.Errorf("expected the token to be reused, got %v tokens", f.tokens)
+	}
+
+	err = m.Release(a.Ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.allocations["allocation-1"]; ok {
+		t.Error("allocation was not released")
+	}
+	// releasing twice is not an error
+	err = m.Release(a.Ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an expired token is renewed
+	m.token = "expired"
+	err = m.Release(b.Ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.tokens != 2 {
+		t.Errorf("expected a new token, got %v tokens", f.tokens)
+	}
+}
+
+func TestMNodeAuthFailure(t *testing.T) {
+	m, _ := newTestMNode(t, "wrong")
+	_, err := m.Allocate("node-1")
+	if err == nil || !strings.Contains(err.Error(), "unable to get a token") {
+		t.Fatalf("expected a token error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "wrong") {
+		t.Errorf("error reveals the secret: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// URIMetrics is where the metrics are served
+const URIMetrics = "/metrics"
+
+// Tasks of the vSphere provider that are timed
+const (
+	TaskClone         = "clone"
+	TaskOVAImport     = "ova_import"
+	TaskLibraryDeploy = "library_deploy"
+	TaskPowerOn       = "power_on"
+)
+
+// Wait loops that count their retries
+const (
+	LoopSSH            = "ssh"
+	LoopCommand        = "command"
+	LoopProgressStream = "progress_stream"
+	LoopDomainIP       = "domain_ip"
+	LoopHostKeys       = "host_keys"
+)
+
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+// phases and vSphere tasks take from seconds to tens of minutes
+var longBuckets = prometheus.ExponentialBuckets(1, 2, 12)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	phaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "cake",
+		Name:      "phase_duration_seconds",
+		Help:      "Duration of the provider.Run and engine.Run phases.",
+		Buckets:   longBuckets,
+	}, []string{"phase", "result"})
+
+	commandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "cake",
+		Name:      "command_duration_seconds",
+		Help:      "Duration of external command executions by binary.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 14),
+	}, []string{"binary", "result"})
+
+	taskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "cake",
+		Name:      "vsphere_task_duration_seconds",
+		Help:      "Duration of vSphere tasks.",
+		Buckets:   longBuckets,
+	}, []string{"task", "result"})
+
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cake",
+		Name:      "wait_retries_total",
+		Help:      "Retries of the loops waiting on nodes and services to become ready.",
+	}, []string{"loop"})
+
+	success = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "cake",
+		Name:      "deploy_success",
+		Help:      "1 once the deployment completed successfully, 0 if it failed or is still running.",
+	})
+
+	inProgress = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "cake",
+		Name:      "deploy_in_progress",
+		Help:      "1 while the deployment is running, 0 once it finished.",
+	})
+)
+
+func init() {
+	registry.MustRegister(phaseDuration, commandDuration, taskDuration, retries, success, inProgress)
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultFailure
+	}
+	return resultSuccess
+}
+
+// ObservePhase records the duration of a phase that started at start
+func ObservePhase(phase string, start time.Time, err error) {
+	phaseDuration.WithLabelValues(phase, result(err)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveCommand records the duration of an external command, it is labelled with the binary name only
+func ObserveCommand(command string, start time.Time, err error) {
+	commandDuration.WithLabelValues(filepath.Base(command), result(err)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveTask records the duration of a vSphere task
+func ObserveTask(task string, start time.Time, err error) {
+	taskDuration.WithLabelValues(task, result(err)).Observe(time.Since(start).Seconds())
+}
+
+// Retry counts one more attempt of a wait loop
+func Retry(loop string) {
+	retries.WithLabelValues(loop).Inc()
+}
+
+// SetInProgress records that the deployment is running until SetSuccess records its outcome
+func SetInProgress() {
+	success.Set(0)
+	inProgress.Set(1)
+}
+
+// SetSuccess records the outcome of the deployment
+func SetSuccess(ok bool) {
+	inProgress.Set(0)
+	if ok {
+		success.Set(1)
+		return
+	}
+	success.Set(0)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Serve the metrics on address over plain http until the process exits
+func Serve(address string) error {
+	mux := http.NewServeMux()
+	mux.Handle(URIMetrics, Handler())
+	err := http.ListenAndServe(address, mux)
+	if err != nil {
+		return fmt.Errorf("unable to serve metrics on %s, %v", address, err)
+	}
+	return nil
+}
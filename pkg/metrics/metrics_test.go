@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	start := time.Now().Add(-3 * time.Second)
+	ObservePhase("Provision", start, nil)
+	ObserveCommand("/usr/local/bin/kubectl", start, errors.New("exit status 1"))
+	ObserveTask(TaskClone, start, nil)
+	Retry(LoopSSH)
+	Retry(LoopSSH)
+	SetInProgress()
+	if body := scrape(t); !strings.Contains(body, "cake_deploy_in_progress 1") || !strings.Contains(body, "cake_deploy_success 0") {
+		t.Fatalf("expected the deploy in progress in:\n%s", body)
+	}
+	SetSuccess(true)
+
+	body := scrape(t)
+	for _, expected := range []string{
+		`cake_phase_duration_seconds_count{phase="Provision",result="success"} 1`,
+		`cake_command_duration_seconds_count{binary="kubectl",result="failure"} 1`,
+		`cake_vsphere_task_duration_seconds_count{result="success",task="clone"} 1`,
+		`cake_wait_retries_total{loop="ssh"} 2`,
+		`cake_deploy_success 1`,
+		`cake_deploy_in_progress 0`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected: %s in:\n%s", expected, body)
+		}
+	}
+}
+
+// scrape returns the metrics served by Handler
+func scrape(t *testing.T) string {
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL + URIMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
@@ -0,0 +1,72 @@
+package progress
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// subscriberBuffer is how many events a slow subscriber can fall behind before its events are dropped
+const subscriberBuffer = 1024
+
+// Bus is an in-memory Events implementation for subscribers in the same process
+type Bus struct {
+	cluster     string
+	phase       string
+	subscribers []chan StatusEvent
+	// dropped counts the events a subscriber was too far behind for
+	dropped int
+	mutex   sync.Mutex
+}
+
+// NewBus returns a Bus that stamps events with cluster
+func NewBus(cluster string) *Bus {
+	return &Bus{cluster: cluster}
+}
+
+// Publish an event to every subscriber without blocking, events are stamped with the cluster and the current
+// phase. A subscriber that fell subscriberBuffer events behind misses the event
+func (b *Bus) Publish(p *StatusEvent) error {
+	b.mutex.Lock()
+	if p.startsLocalPhase() {
+		b.phase = p.Phase
+	}
+	p.withDefaults(b.cluster, b.phase)
+	subscribers := b.subscribers
+	b.mutex.Unlock()
+
+	// the lock is not held while sending so a subscriber can publish from its callback
+	for _, s := range subscribers {
+		select {
+		case s <- *p:
+		default:
+			b.drop()
+		}
+	}
+	return nil
+}
+
+func (b *Bus) drop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.dropped++
+	// one warning per buffer worth of drops keeps a stuck subscriber from flooding the log
+	if b.dropped%subscriberBuffer == 1 {
+		log.Warnf("an event subscriber is not keeping up, dropped %v events", b.dropped)
+	}
+}
+
+// Subscribe calls fn with a copy of every event published after it was subscribed, in publish order
+func (b *Bus) Subscribe(fn func(*StatusEvent)) error {
+	s := make(chan StatusEvent, subscriberBuffer)
+	b.mutex.Lock()
+	b.subscribers = append(b.subscribers, s)
+	b.mutex.Unlock()
+	go func() {
+		for e := range s {
+			e := e
+			fn(&e)
+		}
+	}()
+	return nil
+}
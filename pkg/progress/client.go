@@ -0,0 +1,196 @@
+package progress
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Client reads the progress endpoints of a bootstrap node
+type Client struct {
+	BaseURL string
+	token   string
+	http    *http.Client
+	// stream has no timeout, a stream stays open for the whole deployment
+	stream *http.Client
+}
+
+// NewClient returns a client for the progress server at address that only trusts the certificate in creds
+func NewClient(address string, creds Credentials) (*Client, error) {
+	tlsConfig, err := creds.clientTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	return &Client{
+		BaseURL: "https://" + address,
+		token:   creds.Token.Reveal(),
+		http: &http.Client{
+			Timeout:   5 * time.Minute,
+			Transport: transport,
+		},
+		stream: &http.Client{Transport: transport},
+	}, nil
+}
+
+// StreamError is returned by Stream when the event stream ends before the engine completes
+type StreamError struct {
+	Err       error
+	retriable bool
+}
+
+func (e *StreamError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// Retriable is false when resuming the stream can not succeed, the token or the certificate was rejected or fn failed
+func (e *StreamError) Retriable() bool {
+	return e.retriable
+}
+
+// responseError is returned for a response that is not 200 OK
+type responseError struct {
+	method     string
+	url        string
+	status     string
+	statusCode int
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("%s on: %v failed, %v", e.method, e.url, e.status)
+}
+
+// rejected tells whether the server or the pinned certificate refused the client, retrying can not succeed
+func rejected(err error) bool {
+	var re *responseError
+	if errors.As(err, &re) {
+		return re.statusCode == http.StatusUnauthorized || re.statusCode == http.StatusForbidden
+	}
+	return errors.Is(err, errCertificateMismatch)
+}
+
+func (c *Client) do(method, uri string) (*http.Response, error) {
+	return c.doWith(c.http, method, uri, nil)
+}
+
+func (c *Client) doWith(client *http.Client, method, uri string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.BaseURL+uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error with %s on: %v, err: %w", method, c.BaseURL+uri, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &responseError{method: method, url: c.BaseURL + uri, status: resp.Status, statusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// Get returns the body of uri
+func (c *Client) Get(uri string) ([]byte, error) {
+	resp, err := c.do(http.MethodGet, uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Download streams the body of uri to path with mode and returns its sha256 and size. The body is written next
+// to path first and only renamed once complete, an interrupted download never replaces path with a partial file
+func (c *Client) Download(uri string, path string, mode os.FileMode) (string, int64, error) {
+	resp, err := c.do(http.MethodGet, uri)
+	if err != nil {
+		return "", 0, fmt.Errorf("download failed, %v", err)
+	}
+	defer resp.Body.Close()
+
+	partial := path + ".part"
+	f, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return "", 0, fmt.Errorf("error writing file to disk: %v, err: %v", path, err)
+	}
+	defer os.Remove(partial)
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), resp.Body)
+	f.Close()
+	if err != nil {
+		return "", size, fmt.Errorf("download of %s failed, %v", uri, err)
+	}
+	// the umask or a leftover partial file may have left other permissions
+	err = os.Chmod(partial, mode)
+	if err != nil {
+		return "", size, err
+	}
+	err = os.Rename(partial, path)
+	if err != nil {
+		return "", size, fmt.Errorf("error writing file to disk: %v, err: %v", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// Finalize tells the server all deliverables were saved so it can shut down
+func (c *Client) Finalize() error {
+	resp, err := c.do(http.MethodPost, URIFinalize)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Stream calls fn for every event after seq and returns once the engine completes. When the connection drops
+// a *StreamError is returned with the sequence number of the last event received so the caller can resume from it
+func (c *Client) Stream(seq int, fn func(StreamEvent) error) (int, error) {
+	resp, err := c.doWith(c.stream, http.MethodGet, URIStream, http.Header{"Last-Event-ID": {strconv.Itoa(seq)}})
+	if err != nil {
+		return seq, &StreamError{Err: err, retriable: !rejected(err)}
+	}
+	defer resp.Body.Close()
+	var fnErr error
+	err = ReadStream(resp.Body, func(e StreamEvent) (bool, error) {
+		seq = e.Seq
+		fnErr = fn(e)
+		return e.Kind == KindComplete, fnErr
+	})
+	if fnErr != nil {
+		return seq, &StreamError{Err: fnErr}
+	}
+	if err != nil {
+		return seq, &StreamError{Err: err, retriable: true}
+	}
+	return seq, nil
+}
+
+// Progress returns the status messages after seq, pass Seq of the result to the next call to only get new messages
+func (c *Client) Progress(seq int) (Status, error) {
+	var status Status
+	body, err := c.Get(fmt.Sprintf("%s?since=%v", URIProgress, seq))
+	if err != nil {
+		return status, err
+	}
+	err = json.Unmarshal(body, &status)
+	if err != nil {
+		return status, fmt.Errorf("unable to parse progress, %v", err)
+	}
+	return status, nil
+}
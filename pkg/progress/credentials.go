@@ -0,0 +1,135 @@
+package progress
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+const (
+	tokenBytes   = 32
+	certValidity = 30 * 24 * time.Hour
+)
+
+// Credentials secure the progress endpoints of a single deployment
+type Credentials struct {
+	// Token is sent by clients as an Authorization: Bearer header
+	Token types.Secret `yaml:"Token" json:"token"`
+	// Certificate is the PEM encoded self-signed server certificate clients pin
+	Certificate string `yaml:"Certificate" json:"certificate"`
+	// Key is the PEM encoded private key of Certificate
+	Key types.Secret `yaml:"Key" json:"key"`
+}
+
+// NewCredentials generates a random bearer token and a self-signed certificate valid for hosts
+func NewCredentials(hosts ...string) (Credentials, error) {
+	token := make([]byte, tokenBytes)
+	_, err := rand.Read(token)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("unable to generate token, %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("unable to generate key, %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("unable to generate serial number, %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "cake progress"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if h != "" {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("unable to create certificate, %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("unable to marshal key, %v", err)
+	}
+
+	return Credentials{
+		Token:       types.Secret(hex.EncodeToString(token)),
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Key:         types.Secret(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}, nil
+}
+
+// IsZero is true when no credentials were generated
+func (c Credentials) IsZero() bool {
+	return c.Token == "" || c.Certificate == "" || c.Key == ""
+}
+
+// serverTLSConfig serves Certificate
+func (c Credentials) serverTLSConfig() (*tls.Config, error) {
+	cert, err := tls.X509KeyPair([]byte(c.Certificate), []byte(c.Key.Reveal()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load progress certificate, %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// clientTLSConfig only trusts a server presenting exactly Certificate, the address used to reach it is not checked
+// errCertificateMismatch fails the handshake with a server that does not present the pinned certificate
+var errCertificateMismatch = errors.New("progress server certificate does not match the pinned certificate")
+
+func (c Credentials) clientTLSConfig() (*tls.Config, error) {
+	block, _ := pem.Decode([]byte(c.Certificate))
+	if block == nil {
+		return nil, fmt.Errorf("unable to decode progress certificate")
+	}
+	pinned := block.Bytes
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// verification is done against the pinned certificate below
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 || subtle.ConstantTimeCompare(rawCerts[0], pinned) != 1 {
+				return errCertificateMismatch
+			}
+			return nil
+		},
+	}, nil
+}
+
+// requireToken rejects requests without the bearer token
+func (c Credentials) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.Token.Reveal())) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
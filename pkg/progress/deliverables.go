@@ -0,0 +1,125 @@
+package progress
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ManifestFileName lists the downloaded deliverables in the cluster directory
+const ManifestFileName = "manifest.json"
+
+// DeliverableInfo describes a file created by the deployment
+type DeliverableInfo struct {
+	Url     string `json:"url"`
+	FileExt string `json:"file_extension"`
+	// Name is unique among the deliverables of a deployment
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest is saved next to the downloaded deliverables
+type Manifest struct {
+	Cluster      string            `json:"cluster"`
+	Created      time.Time         `json:"created"`
+	Deliverables []DeliverableInfo `json:"deliverables"`
+}
+
+// deliverable is a file served by name
+type deliverable struct {
+	name string
+	path string
+}
+
+// newDeliverables names every file after its base name, a file whose name is already taken gets a numeric suffix
+func newDeliverables(paths []string) []deliverable {
+	var d []deliverable
+	taken := map[string]bool{}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		base := filepath.Base(p)
+		ext := filepath.Ext(base)
+		name := base
+		for x := 2; taken[name]; x++ {
+			name = fmt.Sprintf("%s-%v%s", strings.TrimSuffix(base, ext), x, ext)
+		}
+		taken[name] = true
+		d = append(d, deliverable{name: name, path: p})
+	}
+	return d
+}
+
+func (d deliverable) uri() string {
+	return URIDeliverable + "/" + d.name
+}
+
+// info describes the file as it is now, files are created during the deployment so this is read on every request
+func (d deliverable) info() (DeliverableInfo, error) {
+	f, err := os.Open(d.path)
+	if err != nil {
+		return DeliverableInfo{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return DeliverableInfo{}, err
+	}
+	return DeliverableInfo{
+		Url:     d.uri(),
+		FileExt: filepath.Ext(d.name),
+		Name:    d.name,
+		Size:    size,
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// contentType of a deliverable from its extension
+func contentType(name string) string {
+	switch filepath.Ext(name) {
+	case ".yml", ".yaml":
+		return "application/yaml"
+	case ".rkestate", ".json":
+		return "application/json"
+	case ".log", ".txt":
+		return "text/plain; charset=utf-8"
+	}
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// serveFile writes the file at path unmodified, a missing file is not found
+func serveFile(w http.ResponseWriter, r *http.Request, path, name string) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", contentType(name))
+	info, err := f.Stat()
+	if err != nil {
+		io.Copy(w, f)
+		return
+	}
+	// the log keeps growing while it is served, only send what was there when the length was set
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	io.CopyN(w, f, info.Size())
+}
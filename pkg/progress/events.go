@@ -2,27 +2,95 @@ package progress
 
 import (
 	"fmt"
+	"sync"
+	"time"
+
 	natsd "github.com/nats-io/nats-server/server"
 	"github.com/nats-io/nats.go"
 	"github.com/sirupsen/logrus"
-	"time"
 )
 
 // StatusEvent is type that is used for pub/sub of events
 type StatusEvent struct {
-	Type  string
-	Msg   string
-	Level string
+	Type  string `json:"type"`
+	Msg   string `json:"msg"`
+	Level string `json:"level"`
+	// Cluster is the name of the cluster being deployed
+	Cluster string `json:"cluster,omitempty"`
+	// Phase is the provider.Run or engine.Run step the event belongs to
+	Phase string `json:"phase,omitempty"`
+	// Step is a finer grained position within Phase
+	Step string `json:"step,omitempty"`
+	// Percent is the overall completion of the run when Phase started or ended
+	Percent int `json:"percent,omitempty"`
+	// Start is when the event happened, or when Phase started for the end of a phase
+	Start *time.Time `json:"start,omitempty"`
+	// End is only set for the end of a phase
+	End *time.Time `json:"end,omitempty"`
+	// ErrorCode identifies the failure for events with the error level
+	ErrorCode string            `json:"errorCode,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
 }
 
 // String of StatusEvent
 func (s StatusEvent) String() string {
-	return fmt.Sprintf("type: %v, msg: %v, level: %v", s.Type, s.Msg, s.Level)
+	str := fmt.Sprintf("type: %v, msg: %v, level: %v", s.Type, s.Msg, s.Level)
+	if s.Phase != "" {
+		str += fmt.Sprintf(", phase: %v", s.Phase)
+	}
+	if s.ErrorCode != "" {
+		str += fmt.Sprintf(", errorCode: %v", s.ErrorCode)
+	}
+	return str
 }
 
 // ToLogrusFields is a helper for the logrus library
 func (s StatusEvent) ToLogrusFields() logrus.Fields {
-	return logrus.Fields{"type": s.Type, "msg": s.Msg, "level": s.Level}
+	fields := logrus.Fields{"type": s.Type, "msg": s.Msg, "level": s.Level}
+	optional := map[string]string{
+		"cluster":   s.Cluster,
+		"phase":     s.Phase,
+		"step":      s.Step,
+		"errorCode": s.ErrorCode,
+	}
+	for key, value := range optional {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	if s.Percent > 0 {
+		fields["percent"] = s.Percent
+	}
+	if s.Start != nil && s.End != nil {
+		fields["duration"] = s.End.Sub(*s.Start).String()
+	}
+	for key, value := range s.Fields {
+		fields[key] = value
+	}
+	return fields
+}
+
+// startsLocalPhase reports whether the event starts a phase of this process. Events republished from the
+// bootstrap node already carry their cluster and keep their own phase without changing the current one
+func (s *StatusEvent) startsLocalPhase() bool {
+	return s.Type == TypePhase && s.Step == StepStart && s.Cluster == ""
+}
+
+// withDefaults fills in the cluster, phase, level and start time when the publisher left them empty
+func (s *StatusEvent) withDefaults(cluster, phase string) {
+	if s.Cluster == "" {
+		s.Cluster = cluster
+	}
+	if s.Phase == "" {
+		s.Phase = phase
+	}
+	if s.Level == "" {
+		s.Level = LevelInfo
+	}
+	if s.Start == nil {
+		now := time.Now().UTC()
+		s.Start = &now
+	}
 }
 
 // Events interface for publish/subscribing to events
@@ -33,10 +101,19 @@ type Events interface {
 type natsPubSub struct {
 	subj string
 	conn *nats.EncodedConn
+	// phase is the phase most recently started by a Phases on this connection
+	phase      string
+	phaseMutex sync.Mutex
 }
 
-// Publish an event to a subject
+// Publish an event to a subject, events are stamped with the cluster and the current phase
 func (n *natsPubSub) Publish(p *StatusEvent) error {
+	n.phaseMutex.Lock()
+	if p.startsLocalPhase() {
+		n.phase = p.Phase
+	}
+	p.withDefaults(n.subj, n.phase)
+	n.phaseMutex.Unlock()
 	return n.conn.Publish(n.subj, p)
 }
 
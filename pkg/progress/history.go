@@ -0,0 +1,170 @@
+package progress
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EndpointFileName is saved in the cluster directory while a bootstrap node serves the progress of a deployment
+const EndpointFileName = "progress-endpoint.yaml"
+
+// levels orders the event levels, unknown levels rank as info
+var levels = map[string]int{
+	LevelDebug: 0,
+	LevelInfo:  1,
+	LevelWarn:  2,
+	"warning":  2,
+	LevelError: 3,
+}
+
+func levelRank(level string) int {
+	rank, ok := levels[strings.ToLower(level)]
+	if !ok {
+		return levels[LevelInfo]
+	}
+	return rank
+}
+
+// Filter selects events, zero values match everything
+type Filter struct {
+	// Since drops events that started before it
+	Since time.Time
+	// Level is the lowest level to match
+	Level string
+	// Phase only matches events of the phase, case insensitive
+	Phase string
+}
+
+// Validate checks Level is a known level
+func (f Filter) Validate() error {
+	if _, ok := levels[strings.ToLower(f.Level)]; f.Level != "" && !ok {
+		return fmt.Errorf("unknown level %q, must be one of %s, %s, %s or %s", f.Level, LevelDebug, LevelInfo, LevelWarn, LevelError)
+	}
+	return nil
+}
+
+// Match reports whether e is selected by the filter
+func (f Filter) Match(e *StatusEvent) bool {
+	if !f.Since.IsZero() && e.Start != nil && e.Start.Before(f.Since) {
+		return false
+	}
+	if f.Level != "" && levelRank(e.Level) < levelRank(f.Level) {
+		return false
+	}
+	if f.Phase != "" && !strings.EqualFold(e.Phase, f.Phase) {
+		return false
+	}
+	return true
+}
+
+// ReadHistory calls fn for every event in the jsonl file at path after offset and returns the offset after
+// the last complete line, a line still being written is left for the next read
+func ReadHistory(path string, offset int64, fn func(*StatusEvent)) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return offset, err
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+		var e StatusEvent
+		if json.Unmarshal(line, &e) != nil {
+			continue
+		}
+		fn(&e)
+	}
+}
+
+// RunState follows the phase events of a history to tell when its latest run is over. A provider run ends with
+// its Finalize phase, or its Client phase when that fails, a run of only the engine ends with its last phase or
+// the first one that fails
+type RunState struct {
+	provider bool
+	done     bool
+}
+
+// Add updates the state with the next event of the history
+func (r *RunState) Add(e *StatusEvent) {
+	if e.Type != TypePhase {
+		return
+	}
+	if e.Step == StepStart {
+		switch {
+		case e.Phase == PhaseClient:
+			r.provider, r.done = true, false
+		case e.Phase == PhaseCreateBootstrap && (r.done || !r.provider):
+			r.provider, r.done = false, false
+		}
+		return
+	}
+	failed := e.ErrorCode != ""
+	switch e.Phase {
+	case PhaseFinalize:
+		r.done = true
+	case PhaseClient:
+		r.done = failed
+	case PhaseInstallAddons:
+		r.done = r.done || !r.provider
+	case PhaseCreateBootstrap, PhaseInstallControlPlane, PhaseCreatePermanent, PhasePivotControlPlane:
+		r.done = r.done || (!r.provider && failed)
+	}
+}
+
+// Done reports whether the latest run is over
+func (r *RunState) Done() bool {
+	return r.done
+}
+
+// Endpoint is where the progress of a deployment is served, saved so other cake commands can follow it
+type Endpoint struct {
+	Address     string      `yaml:"Address"`
+	Credentials Credentials `yaml:"Credentials"`
+}
+
+// SaveEndpoint writes the address and client credentials of a progress server to path, the private key is left out
+func SaveEndpoint(path, address string, creds Credentials) error {
+	creds.Key = ""
+	out, err := yaml.Marshal(Endpoint{Address: address, Credentials: creds})
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path, out, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to save progress endpoint, %v", err)
+	}
+	return nil
+}
+
+// LoadEndpoint reads an Endpoint saved by SaveEndpoint and returns a client for it
+func LoadEndpoint(path string) (*Client, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e Endpoint
+	err = yaml.Unmarshal(contents, &e)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse progress endpoint %s, %v", path, err)
+	}
+	return NewClient(e.Address, e.Credentials)
+}
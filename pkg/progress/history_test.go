@@ -0,0 +1,146 @@
+package progress
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Hour)
+	tests := []struct {
+		name     string
+		filter   Filter
+		event    StatusEvent
+		expected bool
+	}{
+		{"empty", Filter{}, StatusEvent{Level: LevelDebug}, true},
+		{"level below", Filter{Level: LevelWarn}, StatusEvent{Level: LevelInfo}, false},
+		{"level above", Filter{Level: "WARN"}, StatusEvent{Level: LevelError}, true},
+		{"unknown level ranks as info", Filter{Level: LevelInfo}, StatusEvent{Level: "notice"}, true},
+		{"phase", Filter{Phase: "provision"}, StatusEvent{Phase: PhaseProvision}, true},
+		{"other phase", Filter{Phase: PhaseProvision}, StatusEvent{Phase: PhasePrepare}, false},
+		{"too old", Filter{Since: now.Add(-time.Minute)}, StatusEvent{Start: &old}, false},
+		{"recent", Filter{Since: old.Add(-time.Minute)}, StatusEvent{Start: &now}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.filter.Match(&tt.event); actual != tt.expected {
+				t.Fatalf("expected: %v, actual: %v", tt.expected, actual)
+			}
+		})
+	}
+	if (Filter{Level: "loud"}).Validate() == nil {
+		t.Fatal("expected an unknown level to fail")
+	}
+}
+
+func TestReadHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cake-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, EventsFileName)
+	err = ioutil.WriteFile(path, []byte(`{"msg":"first"}`+"\n"+`{"msg":"sec`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msgs []string
+	fn := func(e *StatusEvent) { msgs = append(msgs, e.Msg) }
+	offset, err := ReadHistory(path, 0, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || offset != int64(len(`{"msg":"first"}`)+1) {
+		t.Fatalf("expected only the complete line to be read, actual: %v at %v", msgs, offset)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`ond"}` + "\n")
+	f.Close()
+	_, err = ReadHistory(path, offset, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[1] != "second" {
+		t.Fatalf("expected: [first second], actual: %v", msgs)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cake-endpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	creds, err := NewCredentials("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, EndpointFileName)
+	err = SaveEndpoint(path, "127.0.0.1:8081", creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected: %v, actual: %v", os.FileMode(0600), info.Mode().Perm())
+	}
+	contents, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(contents), "PRIVATE KEY") {
+		t.Fatal("expected the private key to be left out")
+	}
+	client, err := LoadEndpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.BaseURL != "https://127.0.0.1:8081" {
+		t.Fatalf("expected: https://127.0.0.1:8081, actual: %s", client.BaseURL)
+	}
+}
+
+func TestRunState(t *testing.T) {
+	start := func(phase string) StatusEvent { return StatusEvent{Type: TypePhase, Phase: phase, Step: StepStart} }
+	end := func(phase string) StatusEvent { return StatusEvent{Type: TypePhase, Phase: phase, Step: StepEnd} }
+	failed := func(phase string) StatusEvent {
+		return StatusEvent{Type: TypePhase, Phase: phase, Step: StepEnd, ErrorCode: phase + "Failed"}
+	}
+	tests := []struct {
+		name     string
+		events   []StatusEvent
+		expected bool
+	}{
+		{"empty", nil, false},
+		{"provider running", []StatusEvent{start(PhaseClient), end(PhaseClient), start(PhaseProvision)}, false},
+		{"engine failed under provider", []StatusEvent{start(PhaseClient), end(PhaseClient), start(PhaseCreateBootstrap), failed(PhaseCreateBootstrap)}, false},
+		{"provider finalized", []StatusEvent{start(PhaseClient), end(PhaseClient), start(PhaseCreateBootstrap), end(PhaseInstallAddons), start(PhaseFinalize), failed(PhaseFinalize)}, true},
+		{"client failed", []StatusEvent{start(PhaseClient), failed(PhaseClient)}, true},
+		{"next provider run", []StatusEvent{start(PhaseClient), failed(PhaseClient), start(PhaseClient)}, false},
+		{"engine failed", []StatusEvent{start(PhaseCreateBootstrap), failed(PhaseCreateBootstrap)}, true},
+		{"engine completed", []StatusEvent{start(PhaseCreateBootstrap), end(PhaseCreateBootstrap), start(PhaseInstallAddons), end(PhaseInstallAddons)}, true},
+		{"next engine run", []StatusEvent{start(PhaseClient), failed(PhaseClient), start(PhaseCreateBootstrap), end(PhaseCreateBootstrap)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r RunState
+			for x := range tt.events {
+				r.Add(&tt.events[x])
+			}
+			if r.Done() != tt.expected {
+				t.Fatalf("expected: %v, actual: %v", tt.expected, r.Done())
+			}
+		})
+	}
+}
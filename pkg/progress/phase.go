@@ -0,0 +1,125 @@
+package progress
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/netapp/cake/pkg/metrics"
+	"github.com/netapp/cake/pkg/tracing"
+)
+
+// Event types and levels
+const (
+	TypeProgress = "progress"
+	TypePhase    = "phase"
+	LevelDebug   = "debug"
+	LevelInfo    = "info"
+	LevelWarn    = "warn"
+	LevelError   = "error"
+)
+
+// Steps of a phase event
+const (
+	StepStart = "start"
+	StepEnd   = "end"
+)
+
+// Phases of provider.Run
+const (
+	PhaseClient    = "Client"
+	PhasePrepare   = "Prepare"
+	PhaseProvision = "Provision"
+	PhaseProgress  = "Progress"
+	PhaseFinalize  = "Finalize"
+)
+
+// Phases of engine.Run
+const (
+	PhaseCreateBootstrap     = "CreateBootstrap"
+	PhaseInstallControlPlane = "InstallControlPlane"
+	PhaseCreatePermanent     = "CreatePermanent"
+	PhasePivotControlPlane   = "PivotControlPlane"
+	PhaseInstallAddons       = "InstallAddons"
+)
+
+// Coder is implemented by errors that carry their own ErrorCode
+type Coder interface {
+	Code() string
+}
+
+// ErrorCode returns the code of err, errors without one are identified by the phase they failed in
+func ErrorCode(phase string, err error) string {
+	if c, ok := err.(Coder); ok {
+		return c.Code()
+	}
+	return phase + "Failed"
+}
+
+// Phases publishes the start and end of each phase of a run with the overall percent complete
+type Phases struct {
+	events Events
+	names  []string
+	mutex  sync.Mutex
+	done   int
+}
+
+// NewPhases tracks the phases of a run in the order they are expected to run
+func NewPhases(events Events, names ...string) *Phases {
+	return &Phases{events: events, names: names}
+}
+
+// percent is the share of phases that have ended
+func (p *Phases) percent() int {
+	if len(p.names) == 0 {
+		return 0
+	}
+	return p.done * 100 / len(p.names)
+}
+
+// Run publishes the start of phase with msg, runs fn with the span of the phase in ctx and publishes the end of
+// phase with its duration and any error
+func (p *Phases) Run(ctx context.Context, phase, msg string, fn func(context.Context) error) error {
+	start := time.Now().UTC()
+	p.mutex.Lock()
+	percent := p.percent()
+	p.mutex.Unlock()
+	p.events.Publish(&StatusEvent{
+		Type:    TypePhase,
+		Msg:     msg,
+		Level:   LevelInfo,
+		Phase:   phase,
+		Step:    StepStart,
+		Percent: percent,
+		Start:   &start,
+	})
+
+	ctx, span := tracing.Start(ctx, phase)
+	err := fn(ctx)
+	span.End(err)
+
+	end := time.Now().UTC()
+	p.mutex.Lock()
+	p.done++
+	percent = p.percent()
+	p.mutex.Unlock()
+	e := &StatusEvent{
+		Type:    TypePhase,
+		Msg:     fmt.Sprintf("%s completed", phase),
+		Level:   LevelInfo,
+		Phase:   phase,
+		Step:    StepEnd,
+		Percent: percent,
+		Start:   &start,
+		End:     &end,
+	}
+	if err != nil {
+		e.Msg = fmt.Sprintf("%s failed, %v", phase, err)
+		e.Level = LevelError
+		e.ErrorCode = ErrorCode(phase, err)
+	}
+	p.events.Publish(e)
+	metrics.ObservePhase(phase, start, err)
+	return err
+}
@@ -0,0 +1,112 @@
+package progress
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/netapp/cake/pkg/tracing"
+)
+
+type recordedEvents struct {
+	events []*StatusEvent
+}
+
+func (r *recordedEvents) Publish(e *StatusEvent) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recordedEvents) Subscribe(func(*StatusEvent)) error { return nil }
+
+type codedError struct{}
+
+func (codedError) Error() string { return "coded" }
+func (codedError) Code() string  { return "Coded" }
+
+func TestPhasesRun(t *testing.T) {
+	events := &recordedEvents{}
+	phases := NewPhases(events, PhaseClient, PhasePrepare)
+
+	err := phases.Run(context.Background(), PhaseClient, "Connecting to provider", func(context.Context) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedErr := errors.New("no capacity")
+	err = phases.Run(context.Background(), PhasePrepare, "Preparing environment", func(context.Context) error { return expectedErr })
+	if err != expectedErr {
+		t.Fatalf("expected: %v, actual: %v", expectedErr, err)
+	}
+
+	if len(events.events) != 4 {
+		t.Fatalf("expected: 4 events, actual: %v", len(events.events))
+	}
+	tests := []struct {
+		step      string
+		phase     string
+		percent   int
+		level     string
+		errorCode string
+	}{
+		{StepStart, PhaseClient, 0, LevelInfo, ""},
+		{StepEnd, PhaseClient, 50, LevelInfo, ""},
+		{StepStart, PhasePrepare, 50, LevelInfo, ""},
+		{StepEnd, PhasePrepare, 100, LevelError, "PrepareFailed"},
+	}
+	for x, tt := range tests {
+		e := events.events[x]
+		if e.Type != TypePhase || e.Step != tt.step || e.Phase != tt.phase || e.Percent != tt.percent || e.Level != tt.level || e.ErrorCode != tt.errorCode {
+			t.Fatalf("expected: %+v, actual: %+v", tt, e)
+		}
+		if e.Start == nil {
+			t.Fatalf("expected a start time: %+v", e)
+		}
+		if tt.step == StepEnd && (e.End == nil || e.End.Before(*e.Start)) {
+			t.Fatalf("expected an end time after the start time: %+v", e)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	if code := ErrorCode(PhaseProvision, codedError{}); code != "Coded" {
+		t.Fatalf("expected: Coded, actual: %v", code)
+	}
+	if code := ErrorCode(PhaseProvision, errors.New("failed")); code != "ProvisionFailed" {
+		t.Fatalf("expected: ProvisionFailed, actual: %v", code)
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	e := &StatusEvent{Type: TypeProgress, Msg: "hello"}
+	e.withDefaults("mgmt", PhaseCreatePermanent)
+	if e.Cluster != "mgmt" || e.Phase != PhaseCreatePermanent || e.Level != LevelInfo || e.Start == nil {
+		t.Fatalf("expected defaults to be set: %+v", e)
+	}
+
+	e = &StatusEvent{Type: TypeProgress, Msg: "hello", Level: LevelDebug, Phase: PhaseClient}
+	e.withDefaults("mgmt", PhaseCreatePermanent)
+	if e.Level != LevelDebug || e.Phase != PhaseClient {
+		t.Fatalf("expected set fields to be kept: %+v", e)
+	}
+}
+
+func TestPhasesSpans(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	tracing.SetExporter(exporter)
+	defer tracing.SetExporter(nil)
+
+	ctx, root := tracing.StartRoot(context.Background(), "deploy", "")
+	phases := NewPhases(&recordedEvents{}, PhaseClient)
+	phases.Run(ctx, PhaseClient, "Connecting to provider", func(ctx context.Context) error {
+		_, span := tracing.Start(ctx, "govc")
+		span.End(nil)
+		return nil
+	})
+	root.End(nil)
+	tracing.Flush()
+
+	spans := exporter.Spans()
+	if len(spans) != 3 || spans[0].ParentSpanID != spans[1].SpanID || spans[1].Name != PhaseClient || spans[1].ParentSpanID != spans[2].SpanID {
+		t.Fatalf("expected the command span under the phase span under the root span, actual: %+v", spans)
+	}
+}
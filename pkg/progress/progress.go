@@ -1,13 +1,14 @@
 package progress
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path/filepath"
-	"strings"
+	"strconv"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -17,105 +18,131 @@ const (
 	URIProgress    = "/progress"
 	URILogs        = "/log"
 	URIDeliverable = "/deliverable"
+	URIFinalize    = "/finalize"
+	URIStream      = "/stream"
 )
 
-var responseBody *Status
+// finalized is closed once the deliverables have been downloaded
+var finalized = make(chan struct{})
+var finalizeOnce sync.Once
 
 type Status struct {
-	Complete              bool     `json:"complete"`
-	CompletedSuccessfully bool     `json:"completedSuccessfully"`
-	Messages              []string `json:"messages"`
-}
-
-type DeliverableInfo struct {
-	Url     string `json:"url"`
-	FileExt string `json:"file_extension"`
+	Complete              bool          `json:"complete"`
+	CompletedSuccessfully bool          `json:"completedSuccessfully"`
+	Messages              []StatusEvent `json:"messages"`
+	// Seq is the sequence number of the last event read, pass it as since to only get newer messages
+	Seq int `json:"seq"`
+	// Truncated is set when messages after since were dropped to bound memory
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 func UpdateProgressComplete(complete bool) {
-	responseBody.Complete = complete
+	events.setComplete(complete)
 }
 
 func UpdateProgressCompletedSuccessfully(completedSuccessfully bool) {
-	responseBody.CompletedSuccessfully = completedSuccessfully
+	events.setCompletedSuccessfully(completedSuccessfully)
 }
 
-func init() {
-	responseBody = new(Status)
-	responseBody.Messages = []string{}
-}
-
-func Serve(logfile string, ip, port string, status Events, fileDeliverables []string) {
-	fullURL := url.URL{Scheme: "http", Host: ip + ":" + port, Path: ""}
+// Serve the progress endpoints over TLS to clients presenting the bearer token in creds, the credentials are
+// generated by the provider for the deploy and it exits without them. The server shuts down once a client calls
+// the finalize endpoint
+func Serve(logfile string, ip, port string, status Events, fileDeliverables []string, creds Credentials) {
+	// no client could authenticate to credentials generated here
+	if creds.IsZero() {
+		log.Fatal("no progress endpoint credentials in the config, they are generated by the provider")
+	}
+	tlsConfig, err := creds.serverTLSConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	fullURL := url.URL{Scheme: "https", Host: ip + ":" + port, Path: ""}
 	fn := func(p *StatusEvent) {
-		responseBody.Messages = append(responseBody.Messages, fmt.Sprintf("%v", p.String()))
+		events.add(StreamEvent{Kind: KindStatus, Status: p})
 	}
 	if status != nil {
 		status.Subscribe(fn)
 	}
+	// the endpoints are served without a status stream as well, the messages about them are only logged then
+	publish := func(p *StatusEvent) {
+		if status == nil {
+			log.Debug(p.Msg)
+			return
+		}
+		status.Publish(p)
+	}
 
-	http.HandleFunc(URIProgress, func(w http.ResponseWriter, r *http.Request) {
-		json.NewEncoder(w).Encode(responseBody)
+	mux.HandleFunc(URIProgress, func(w http.ResponseWriter, r *http.Request) {
+		since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+		json.NewEncoder(w).Encode(events.status(since))
 	})
-	http.HandleFunc(URILogs, func(w http.ResponseWriter, r *http.Request) {
-		logs, _ := ioutil.ReadFile(logfile)
-		fmt.Fprintf(w, string(logs))
+	mux.HandleFunc(URILogs, func(w http.ResponseWriter, r *http.Request) {
+		serveFile(w, r, logfile, filepath.Base(logfile))
 	})
+	mux.HandleFunc(URIStream, events.serveStream)
+	go events.followLog(logfile, finalized)
 	fullURL.Path = URILogs
-	status.Publish(&StatusEvent{
+	publish(&StatusEvent{
 		Type:  "progress",
 		Msg:   fmt.Sprintf("serving file: %v at %v", logfile, fullURL.String()),
 		Level: "debug",
 	})
 
-	var dv []DeliverableInfo
-	for _, elem := range fileDeliverables {
-		var f string
-		if elem != "" {
-			f = elem
-			base := strings.TrimSuffix(filepath.Base(elem), filepath.Ext(elem))
-			uri := fmt.Sprintf("%s/%s", URIDeliverable, base)
-			http.HandleFunc(uri, func(w http.ResponseWriter, r *http.Request) {
-				file, _ := ioutil.ReadFile(f)
-				fmt.Fprintf(w, string(file))
-			})
-			dv = append(dv, DeliverableInfo{
-				Url:     uri,
-				FileExt: filepath.Ext(elem),
-			})
-			fullURL.Path = uri
-			status.Publish(&StatusEvent{
-				Type:  "progress",
-				Msg:   fmt.Sprintf("serving file: %v at %v", elem, fullURL.String()),
-				Level: "debug",
-			})
-		}
+	deliverables := newDeliverables(fileDeliverables)
+	for _, d := range deliverables {
+		d := d
+		mux.HandleFunc(d.uri(), func(w http.ResponseWriter, r *http.Request) {
+			serveFile(w, r, d.path, d.name)
+		})
+		fullURL.Path = d.uri()
+		publish(&StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("serving file: %v at %v", d.path, fullURL.String()),
+			Level: "debug",
+		})
 	}
-	http.HandleFunc(URIDeliverable, func(w http.ResponseWriter, r *http.Request) {
+	// deliverables that were not created are left out of the index
+	mux.HandleFunc(URIDeliverable, func(w http.ResponseWriter, r *http.Request) {
+		dv := []DeliverableInfo{}
+		for _, d := range deliverables {
+			info, err := d.info()
+			if err != nil {
+				continue
+			}
+			dv = append(dv, info)
+		}
 		json.NewEncoder(w).Encode(dv)
 	})
-	log.Fatal(http.ListenAndServe(":"+port, nil))
-}
+	mux.HandleFunc(URIFinalize, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		finalizeOnce.Do(func() { close(finalized) })
+	})
 
-func ServeDuration() {
-	for x := 0; x <= 24; x++ {
-		time.Sleep(1 * time.Hour)
+	srv := &http.Server{
+		Addr:      ":" + port,
+		Handler:   creds.requireToken(mux),
+		TLSConfig: tlsConfig,
+	}
+	go func() {
+		<-finalized
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+	err = srv.ListenAndServeTLS("", "")
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
 	}
 }
 
-func DownloadTxtFile(url string, downloadLocation string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("error with GET on: %v, err: %v", url, err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed, %v", resp.StatusCode)
-	}
-	responseData, _ := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	err = ioutil.WriteFile(downloadLocation, responseData, 0644)
-	if err != nil {
-		return fmt.Errorf("error writing file to disk: %v, err: %v", downloadLocation, err)
+// WaitForFinalize blocks until a client has called the finalize endpoint or max has passed
+func WaitForFinalize(max time.Duration) {
+	select {
+	case <-finalized:
+	case <-time.After(max):
 	}
-	return nil
 }
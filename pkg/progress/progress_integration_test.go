@@ -7,12 +7,12 @@ import (
 	"fmt"
 	"github.com/nats-io/go-nats"
 	"io/ioutil"
-	"net/http"
 	"os"
-	"path/filepath"
 	"testing"
 )
 
+var creds Credentials
+
 func TestMain(m *testing.M) {
 	files := setup()
 	code := m.Run()
@@ -67,7 +67,12 @@ func setup() []*os.File {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	go Serve(logfile.Name(), "localhost", "8081", events, deliverables)
+	creds, err = NewCredentials("localhost")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	go Serve(logfile.Name(), "localhost", "8081", events, deliverables, creds)
 	return files
 }
 
@@ -86,7 +91,11 @@ func shutdown(files []*os.File) {
 }
 
 func TestDownloadTxtFile(t *testing.T) {
-	err := DownloadTxtFile("http://localhost:8081/log", "./cake_test.log")
+	client, err := NewClient("localhost:8081", creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = client.Download(URILogs, "./cake_test.log", 0600)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -96,11 +105,7 @@ func TestDownloadTxtFile(t *testing.T) {
 		t.Fatal("file not written to disk")
 	}
 
-	r, err := http.Get("http://localhost:8081/deliverable")
-	if err != nil {
-		t.Fatal(err)
-	}
-	resp, err := ioutil.ReadAll(r.Body)
+	resp, err := client.Get(URIDeliverable)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -108,8 +113,8 @@ func TestDownloadTxtFile(t *testing.T) {
 	json.Unmarshal(resp, &deliverables)
 	for _, elem := range deliverables {
 		fmt.Printf("%+v\n", elem)
-		fname := fmt.Sprintf("%s%s", filepath.Base(elem.Url), elem.FileExt)
-		err := DownloadTxtFile(fmt.Sprintf("http://localhost:8081%s", elem.Url), fname)
+		fname := elem.Name
+		_, _, err := client.Download(elem.Url, fname, 0600)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -0,0 +1,195 @@
+package progress
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestServeRequiresPinnedCertificateAndToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cake-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logfile := filepath.Join(dir, "cake.log")
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	ioutil.WriteFile(logfile, []byte("this is the log file"), 0600)
+	// format verbs and binary content must survive unchanged
+	kubeconfigContents := "this is the kubeconfig %s %v %%\x00\xff"
+	ioutil.WriteFile(kubeconfig, []byte(kubeconfigContents), 0600)
+	os.Mkdir(filepath.Join(dir, "other"), 0700)
+	otherKubeconfig := filepath.Join(dir, "other", "kubeconfig")
+	ioutil.WriteFile(otherKubeconfig, []byte("another kubeconfig"), 0600)
+	missing := filepath.Join(dir, "missing.yml")
+
+	creds, err := NewCredentials("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := freePort(t)
+	address := "127.0.0.1:" + port
+	// the endpoints are served without a status stream too
+	go Serve(logfile, "127.0.0.1", port, nil, []string{kubeconfig, otherKubeconfig, missing}, creds)
+
+	client, err := NewClient(address, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body []byte
+	for x := 0; x < 50; x++ {
+		body, err = client.Get(URILogs)
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "this is the log file" {
+		t.Fatalf("expected: this is the log file, actual: %s", body)
+	}
+	body, err = client.Get(URIDeliverable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deliverables []DeliverableInfo
+	err = json.Unmarshal(body, &deliverables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliverables) != 2 || deliverables[0].Name != "kubeconfig" || deliverables[1].Name != "kubeconfig-2" {
+		t.Fatalf("expected unique names for both kubeconfigs and no missing file, actual: %+v", deliverables)
+	}
+	sum := sha256.Sum256([]byte(kubeconfigContents))
+	if deliverables[0].SHA256 != hex.EncodeToString(sum[:]) || deliverables[0].Size != int64(len(kubeconfigContents)) {
+		t.Fatalf("expected the size and sha256 of the kubeconfig, actual: %+v", deliverables[0])
+	}
+	download := filepath.Join(dir, "downloaded")
+	digest, size, err := client.Download(deliverables[0].Url, download, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != deliverables[0].SHA256 || size != deliverables[0].Size {
+		t.Fatalf("expected: %s (%v bytes), actual: %s (%v bytes)", deliverables[0].SHA256, deliverables[0].Size, digest, size)
+	}
+	downloaded, _ := ioutil.ReadFile(download)
+	if string(downloaded) != kubeconfigContents {
+		t.Fatalf("expected: %q, actual: %q", kubeconfigContents, downloaded)
+	}
+	info, err := os.Stat(download)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected: %v, actual: %v", os.FileMode(0600), info.Mode().Perm())
+	}
+	_, _, err = client.Download(URIDeliverable+"/missing.yml", filepath.Join(dir, "missing"), 0600)
+	if err == nil {
+		t.Fatal("expected a deliverable that was not created to fail")
+	}
+
+	// no token
+	insecure := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := insecure.Get("https://" + address + URIDeliverable + "/kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected: %v, actual: %v", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	// the right token but a different certificate pinned
+	other, err := NewCredentials("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Token = creds.Token
+	wrongPin, err := NewClient(address, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wrongPin.Get(URIProgress)
+	if err == nil {
+		t.Fatal("expected a certificate that is not pinned to be rejected")
+	}
+	_, err = wrongPin.Stream(0, func(StreamEvent) error { return nil })
+	if retriable(err) {
+		t.Fatalf("expected a stream with a certificate that is not pinned to fail for good, actual: %v", err)
+	}
+	wrongToken, err := NewClient(address, Credentials{Certificate: creds.Certificate, Token: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wrongToken.Stream(0, func(StreamEvent) error { return nil })
+	if retriable(err) {
+		t.Fatalf("expected a stream with a rejected token to fail for good, actual: %v", err)
+	}
+
+	UpdateProgressCompletedSuccessfully(true)
+	UpdateProgressComplete(true)
+	status, err := client.Progress(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Complete || status.Seq == 0 {
+		t.Fatalf("expected a complete status with a cursor, actual: %+v", status)
+	}
+	var completed bool
+	_, err = client.Stream(0, func(e StreamEvent) error {
+		completed = e.Kind == KindComplete && e.CompletedSuccessfully
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !completed {
+		t.Fatal("expected the stream to end with a successful complete event")
+	}
+	_, err = client.Stream(0, func(StreamEvent) error { return errors.New("disk full") })
+	if retriable(err) {
+		t.Fatalf("expected a failing callback to end the stream for good, actual: %v", err)
+	}
+
+	err = client.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		WaitForFinalize(time.Minute)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected WaitForFinalize to return after finalize")
+	}
+}
+
+// retriable fails closed, an error that is not a *StreamError counts as retriable
+func retriable(err error) bool {
+	var streamErr *StreamError
+	return !errors.As(err, &streamErr) || streamErr.Retriable()
+}
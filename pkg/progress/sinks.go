@@ -0,0 +1,194 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	natsd "github.com/nats-io/nats-server/server"
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+// Sink types for the EventSinks section of the spec
+const (
+	// SinkMemory only delivers events to subscribers in the same process, every Events does this
+	SinkMemory = "memory"
+	// SinkJSONL appends events to a file, one json object per line
+	SinkJSONL = "jsonl"
+	// SinkWebhook POSTs every event to a URL
+	SinkWebhook = "webhook"
+	// SinkNATS publishes events to a nats subject named after the cluster
+	SinkNATS = "nats"
+)
+
+// EventsFileName is the default jsonl sink file in the cluster directory
+const EventsFileName = "events.jsonl"
+
+// SinkConfig is one destination progress events are published to
+type SinkConfig struct {
+	Type string `yaml:"Type" json:"type"`
+	// URL of the webhook or the nats server, an embedded nats server on a free port is started when empty
+	URL string `yaml:"URL,omitempty" json:"url,omitempty"`
+	// Path of the jsonl file, defaults to events.jsonl in the cluster directory
+	Path string `yaml:"Path,omitempty" json:"path,omitempty"`
+	// Secret signs webhook requests, see Signature
+	Secret types.Secret `yaml:"Secret,omitempty" json:"secret,omitempty"`
+	// Retries is how many times a failed webhook request is retried
+	Retries int `yaml:"Retries,omitempty" json:"retries,omitempty"`
+}
+
+// DefaultSinks are used when the spec has no EventSinks
+var DefaultSinks = []SinkConfig{{Type: SinkJSONL}}
+
+// fanOut delivers events to the in-memory bus and every configured sink
+type fanOut struct {
+	*Bus
+	sinks []Events
+	// closeOnce closes the sinks a single time, cake closes the events on exit and when a run returns
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Publish an event to the bus and then to every sink, a failing sink does not stop delivery to the others
+func (f *fanOut) Publish(p *StatusEvent) error {
+	err := f.Bus.Publish(p)
+	var failed []string
+	for _, s := range f.sinks {
+		e := *p
+		if sErr := s.Publish(&e); sErr != nil {
+			failed = append(failed, sErr.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to publish event, %v", strings.Join(failed, "; "))
+	}
+	return err
+}
+
+// Close flushes and closes every sink, Events that need it are io.Closers. Only the first call closes them
+func (f *fanOut) Close() error {
+	f.closeOnce.Do(func() {
+		f.closeErr = f.closeSinks()
+	})
+	return f.closeErr
+}
+
+func (f *fanOut) closeSinks() error {
+	var failed []string
+	for _, s := range f.sinks {
+		c, ok := s.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to close event sinks, %v", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// NewEvents returns Events that fan out to sinks, DefaultSinks are used when sinks is empty.
+// Subscribers are always served by an in-memory Bus and dir is the cluster directory relative sink paths are resolved in
+func NewEvents(sinks []SinkConfig, cluster, dir string) (Events, error) {
+	if len(sinks) == 0 {
+		sinks = DefaultSinks
+	}
+	f := &fanOut{Bus: NewBus(cluster)}
+	for _, c := range sinks {
+		var s Events
+		var err error
+		switch strings.ToLower(c.Type) {
+		case SinkMemory:
+			continue
+		case SinkJSONL:
+			path := c.Path
+			if path == "" {
+				path = EventsFileName
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			s, err = NewJSONLSink(path)
+		case SinkWebhook:
+			s, err = NewWebhookSink(c.URL, c.Secret.Reveal(), c.Retries)
+		case SinkNATS:
+			url := c.URL
+			if url == "" {
+				url, err = runEmbeddedServer()
+				if err != nil {
+					return nil, err
+				}
+			}
+			s, err = NewNatsPubSub(url, cluster)
+		default:
+			err = fmt.Errorf("unknown event sink type %q, must be one of %s, %s, %s or %s", c.Type, SinkMemory, SinkJSONL, SinkWebhook, SinkNATS)
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.sinks = append(f.sinks, s)
+	}
+	return f, nil
+}
+
+// jsonlSink appends every event to a file
+type jsonlSink struct {
+	path    string
+	file    *os.File
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+// NewJSONLSink returns Events that append to path, one json object per line
+func NewJSONLSink(path string) (Events, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create events directory, %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open events file, %v", err)
+	}
+	return &jsonlSink{path: path, file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Publish appends the event to the file
+func (j *jsonlSink) Publish(p *StatusEvent) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	err := j.encoder.Encode(p)
+	if err != nil {
+		return fmt.Errorf("unable to write event to %s, %v", j.path, err)
+	}
+	return nil
+}
+
+// Close closes the file
+func (j *jsonlSink) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.file.Close()
+}
+
+// Subscribe is not supported, the file is only written to
+func (j *jsonlSink) Subscribe(func(*StatusEvent)) error {
+	return fmt.Errorf("subscribing to %s is not supported", j.path)
+}
+
+// runEmbeddedServer starts a nats server on a free loopback port and returns its url
+func runEmbeddedServer() (string, error) {
+	ns := natsd.New(&natsd.Options{Host: "127.0.0.1", Port: natsd.RANDOM_PORT})
+	go ns.Start()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		return "", fmt.Errorf("unable to start embedded nats server")
+	}
+	return fmt.Sprintf("nats://%s", ns.Addr().String()), nil
+}
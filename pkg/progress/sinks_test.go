@@ -0,0 +1,319 @@
+package progress
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus("mgmt")
+	received := make(chan *StatusEvent, 3)
+	bus.Subscribe(func(e *StatusEvent) { received <- e })
+
+	bus.Publish(&StatusEvent{Type: TypePhase, Step: StepStart, Phase: PhasePrepare, Msg: "preparing"})
+	bus.Publish(&StatusEvent{Type: TypeProgress, Msg: "first"})
+	bus.Publish(&StatusEvent{Type: TypeProgress, Msg: "second"})
+
+	for _, msg := range []string{"preparing", "first", "second"} {
+		select {
+		case e := <-received:
+			if e.Msg != msg || e.Cluster != "mgmt" || e.Phase != PhasePrepare || e.Level != LevelInfo {
+				t.Fatalf("expected: %s stamped with mgmt and %s, actual: %+v", msg, PhasePrepare, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", msg)
+		}
+	}
+}
+
+func TestBusRemotePhase(t *testing.T) {
+	bus := NewBus("mgmt")
+	received := make(chan *StatusEvent, 3)
+	bus.Subscribe(func(e *StatusEvent) { received <- e })
+
+	bus.Publish(&StatusEvent{Type: TypePhase, Step: StepStart, Phase: PhaseProgress, Msg: "watching"})
+	// the bootstrap node stamped its events before WatchProgress republishes them
+	bus.Publish(&StatusEvent{Type: TypePhase, Step: StepStart, Phase: PhaseCreatePermanent, Cluster: "mgmt", Msg: "remote"})
+	bus.Publish(&StatusEvent{Type: TypeProgress, Msg: "local"})
+
+	for _, want := range []struct{ msg, phase string }{{"watching", PhaseProgress}, {"remote", PhaseCreatePermanent}, {"local", PhaseProgress}} {
+		select {
+		case e := <-received:
+			if e.Msg != want.msg || e.Phase != want.phase {
+				t.Fatalf("expected: %s in %s, actual: %+v", want.msg, want.phase, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", want.msg)
+		}
+	}
+}
+
+func TestBusSlowSubscriber(t *testing.T) {
+	bus := NewBus("mgmt")
+	held := make(chan struct{})
+	release := make(chan struct{})
+	bus.Subscribe(func(e *StatusEvent) {
+		if e.Msg == "first" {
+			close(held)
+			<-release
+		}
+	})
+	republished := make(chan *StatusEvent, 1)
+	bus.Subscribe(func(e *StatusEvent) {
+		// publishing from a callback must not deadlock
+		if e.Msg == "first" {
+			bus.Publish(&StatusEvent{Type: TypeProgress, Msg: "republished"})
+		}
+		if e.Msg == "republished" {
+			republished <- e
+		}
+	})
+
+	bus.Publish(&StatusEvent{Type: TypeProgress, Msg: "first"})
+	<-held
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for x := 0; x < subscriberBuffer+10; x++ {
+			bus.Publish(&StatusEvent{Type: TypeProgress, Msg: "more"})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a slow subscriber not to block Publish")
+	}
+	close(release)
+	select {
+	case <-republished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the republished event")
+	}
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	if bus.dropped < 10 {
+		t.Fatalf("expected the events the slow subscriber missed to be counted, actual: %v", bus.dropped)
+	}
+}
+
+func TestNewEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cake-events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	events, err := NewEvents(nil, "mgmt", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan *StatusEvent, 1)
+	events.Subscribe(func(e *StatusEvent) { received <- e })
+	err = events.Publish(&StatusEvent{Type: TypeProgress, Msg: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the subscriber")
+	}
+
+	// a second run appends to the same history
+	events, err = NewEvents([]SinkConfig{{Type: SinkMemory}, {Type: SinkJSONL}}, "mgmt", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events.Publish(&StatusEvent{Type: TypeProgress, Msg: "again"})
+
+	path := filepath.Join(dir, EventsFileName)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected: %v, actual: %v", os.FileMode(0600), info.Mode().Perm())
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var msgs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e StatusEvent
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Cluster != "mgmt" {
+			t.Fatalf("expected: mgmt, actual: %s", e.Cluster)
+		}
+		msgs = append(msgs, e.Msg)
+	}
+	if len(msgs) != 2 || msgs[0] != "hello" || msgs[1] != "again" {
+		t.Fatalf("expected: [hello again], actual: %v", msgs)
+	}
+
+	// cake closes the events on exit and when the run returns
+	for x := 0; x < 2; x++ {
+		err = events.(io.Closer).Close()
+		if err != nil {
+			t.Fatalf("expected closing twice to succeed, actual: %v", err)
+		}
+	}
+
+	_, err = NewEvents([]SinkConfig{{Type: "kafka"}}, "mgmt", dir)
+	if err == nil {
+		t.Fatal("expected an unknown sink type to fail")
+	}
+	_, err = NewEvents([]SinkConfig{{Type: SinkWebhook}}, "mgmt", dir)
+	if err == nil {
+		t.Fatal("expected a webhook without a URL to fail")
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	secret := []byte("s3cret")
+	received := make(chan *StatusEvent, 2)
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Signature(secret, body) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		var e StatusEvent
+		json.Unmarshal(body, &e)
+		received <- &e
+	}))
+	defer srv.Close()
+
+	events, err := NewWebhookSink(srv.URL, string(secret), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events.(*webhookSink).backoff = time.Millisecond
+	events.Publish(&StatusEvent{Type: TypeProgress, Msg: "retried"})
+	events.Publish(&StatusEvent{Type: TypeProgress, Msg: "next"})
+
+	for _, msg := range []string{"retried", "next"} {
+		select {
+		case e := <-received:
+			if e.Msg != msg {
+				t.Fatalf("expected: %s, actual: %s", msg, e.Msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", msg)
+		}
+	}
+}
+
+func TestEmbeddedServers(t *testing.T) {
+	// concurrent runs on the same machine must not collide on the default nats port
+	first, err := NewEvents([]SinkConfig{{Type: SinkNATS}}, "first", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewEvents([]SinkConfig{{Type: SinkNATS}}, "second", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, events := range []Events{first, second} {
+		err = events.Publish(&StatusEvent{Type: TypeProgress, Msg: "hello"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWebhookSinkFull(t *testing.T) {
+	release := make(chan struct{})
+	held := make(chan struct{}, webhookQueueSize+2)
+	received := make(chan string, webhookQueueSize+2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		held <- struct{}{}
+		<-release
+		var e StatusEvent
+		json.NewDecoder(r.Body).Decode(&e)
+		received <- e.Msg
+	}))
+	defer srv.Close()
+
+	events, err := NewWebhookSink(srv.URL, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := events.(*webhookSink)
+	w.drain = 5 * time.Second
+
+	// the endpoint holds the first request, the next ones fill the queue and the last one is dropped
+	events.Publish(&StatusEvent{Type: TypeProgress, Msg: "held"})
+	<-held
+	done := make(chan struct{})
+	go func() {
+		for x := 0; x < webhookQueueSize+1; x++ {
+			events.Publish(&StatusEvent{Type: TypeProgress, Msg: "queued"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Publish not to block on a full queue")
+	}
+
+	close(release)
+	err = w.Close()
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 events") {
+		t.Fatalf("expected the dropped event to be reported, actual: %v", err)
+	}
+	if len(received) != webhookQueueSize+1 {
+		t.Errorf("expected the queue to be drained on Close, received: %v", len(received))
+	}
+	if events.Publish(&StatusEvent{Type: TypeProgress, Msg: "late"}) == nil {
+		t.Error("expected Publish after Close to fail")
+	}
+}
+
+func TestWebhookSinkDrainTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	events, err := NewWebhookSink(srv.URL, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := events.(*webhookSink)
+	w.drain = 50 * time.Millisecond
+	events.Publish(&StatusEvent{Type: TypeProgress, Msg: "stuck"})
+	events.Publish(&StatusEvent{Type: TypeProgress, Msg: "queued"})
+
+	start := time.Now()
+	err = w.Close()
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected Close to time out, actual: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected Close to give up after the drain timeout, took %v", time.Since(start))
+	}
+}
@@ -0,0 +1,146 @@
+package progress
+
+import (
+	"sort"
+	"sync"
+)
+
+// defaultStoreCapacity bounds the memory used by the events of very long runs, older events are dropped first. The
+// status events and the log lines each get a buffer of this size so a verbose log never drops the phase history
+const defaultStoreCapacity = 50000
+
+// ring is a buffer of the latest events of one kind in sequence order
+type ring struct {
+	buf      []StreamEvent
+	capacity int
+	// head is the index of the oldest event once the buffer is full
+	head int
+	// dropped is the sequence number of the latest event that was dropped
+	dropped int
+}
+
+func (r *ring) add(e StreamEvent) {
+	if len(r.buf) < r.capacity {
+		r.buf = append(r.buf, e)
+		return
+	}
+	r.dropped = r.buf[r.head].Seq
+	r.buf[r.head] = e
+	r.head = (r.head + 1) % r.capacity
+}
+
+func (r *ring) at(x int) StreamEvent {
+	return r.buf[(r.head+x)%len(r.buf)]
+}
+
+// after returns the index of the oldest event after seq
+func (r *ring) after(seq int) int {
+	return sort.Search(len(r.buf), func(x int) bool {
+		return r.at(x).Seq > seq
+	})
+}
+
+// store keeps the events of a run with monotonically increasing sequence numbers, safe for concurrent use
+type store struct {
+	mutex sync.Mutex
+	// statusRing keeps the status and complete events, logRing the log lines
+	statusRing ring
+	logRing    ring
+	// next is the sequence number given to the next event, the first event is 1
+	next                  int
+	complete              bool
+	completedSuccessfully bool
+	// notify is closed and replaced whenever an event is added
+	notify chan struct{}
+}
+
+var events = newStore(defaultStoreCapacity)
+
+func newStore(capacity int) *store {
+	return &store{
+		statusRing: ring{capacity: capacity},
+		logRing:    ring{capacity: capacity},
+		next:       1,
+		notify:     make(chan struct{}),
+	}
+}
+
+func (s *store) add(e StreamEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.addLocked(e)
+}
+
+func (s *store) addLocked(e StreamEvent) {
+	e.Seq = s.next
+	s.next++
+	if e.Kind == KindLog {
+		s.logRing.add(e)
+	} else {
+		s.statusRing.add(e)
+	}
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// since returns the events after seq, whether events after seq were already dropped,
+// and a channel that is closed when more events are added
+func (s *store) since(seq int) ([]StreamEvent, bool, <-chan struct{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var result []StreamEvent
+	x, y := s.statusRing.after(seq), s.logRing.after(seq)
+	for x < len(s.statusRing.buf) || y < len(s.logRing.buf) {
+		if y == len(s.logRing.buf) || (x < len(s.statusRing.buf) && s.statusRing.at(x).Seq < s.logRing.at(y).Seq) {
+			result = append(result, s.statusRing.at(x))
+			x++
+		} else {
+			result = append(result, s.logRing.at(y))
+			y++
+		}
+	}
+	truncated := s.statusRing.dropped > seq || s.logRing.dropped > seq
+	return result, truncated, s.notify
+}
+
+// setCompletedSuccessfully records the outcome reported by the complete event
+func (s *store) setCompletedSuccessfully(completedSuccessfully bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.completedSuccessfully = completedSuccessfully
+}
+
+// setComplete marks the run as complete and adds the complete event once
+func (s *store) setComplete(complete bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if complete && !s.complete {
+		s.addLocked(StreamEvent{Kind: KindComplete, CompletedSuccessfully: s.completedSuccessfully})
+	}
+	s.complete = complete
+}
+
+// status returns the status events after seq, Seq of the result is the cursor for the next call
+func (s *store) status(seq int) Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := Status{
+		Complete:              s.complete,
+		CompletedSuccessfully: s.completedSuccessfully,
+		Messages:              []StatusEvent{},
+		Seq:                   seq,
+		Truncated:             s.statusRing.dropped > seq,
+	}
+	for x := s.statusRing.after(seq); x < len(s.statusRing.buf); x++ {
+		e := s.statusRing.at(x)
+		if e.Kind == KindStatus && e.Status != nil {
+			result.Messages = append(result.Messages, *e.Status)
+		}
+		result.Seq = e.Seq
+	}
+	// the cursor also moves past the log lines after the last status event
+	if last := s.next - 1; last > result.Seq {
+		result.Seq = last
+	}
+	return result
+}
@@ -0,0 +1,160 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func statusEvent(msg string) StreamEvent {
+	return StreamEvent{Kind: KindStatus, Status: &StatusEvent{Type: TypeProgress, Msg: msg, Level: LevelInfo}}
+}
+
+func TestStoreSince(t *testing.T) {
+	s := newStore(3)
+	for x := 1; x <= 5; x++ {
+		s.add(statusEvent(strconv.Itoa(x)))
+	}
+
+	// only the last 3 are kept
+	pending, truncated, _ := s.since(0)
+	if !truncated || len(pending) != 3 || pending[0].Seq != 3 || pending[2].Seq != 5 {
+		t.Fatalf("expected events 3-5 and truncated, actual: %+v, %v", pending, truncated)
+	}
+	pending, truncated, _ = s.since(3)
+	if truncated || len(pending) != 2 || pending[0].Seq != 4 {
+		t.Fatalf("expected events 4-5, actual: %+v, %v", pending, truncated)
+	}
+	pending, truncated, _ = s.since(5)
+	if truncated || len(pending) != 0 {
+		t.Fatalf("expected no events, actual: %+v, %v", pending, truncated)
+	}
+}
+
+func TestStoreLogsKeepStatus(t *testing.T) {
+	s := newStore(3)
+	s.add(statusEvent("one"))
+	for x := 0; x < 10; x++ {
+		s.add(StreamEvent{Kind: KindLog, Line: strconv.Itoa(x)})
+	}
+	s.add(statusEvent("two"))
+
+	// the log lines only drop older log lines
+	pending, truncated, _ := s.since(0)
+	if !truncated || len(pending) != 5 || pending[0].Seq != 1 || pending[1].Seq != 9 || pending[4].Seq != 12 {
+		t.Fatalf("expected the status events and the last 3 log lines, actual: %+v, %v", pending, truncated)
+	}
+	status := s.status(0)
+	if status.Truncated || len(status.Messages) != 2 || status.Seq != 12 {
+		t.Fatalf("expected both status events, actual: %+v", status)
+	}
+	pending, truncated, _ = s.since(10)
+	if truncated || len(pending) != 2 || pending[0].Seq != 11 {
+		t.Fatalf("expected events 11-12, actual: %+v, %v", pending, truncated)
+	}
+}
+
+func TestStoreStatus(t *testing.T) {
+	s := newStore(defaultStoreCapacity)
+	s.add(statusEvent("one"))
+	s.add(StreamEvent{Kind: KindLog, Line: "a log line"})
+	s.add(statusEvent("two"))
+
+	status := s.status(0)
+	if len(status.Messages) != 2 || status.Seq != 3 || status.Complete {
+		t.Fatalf("expected 2 messages up to seq 3, actual: %+v", status)
+	}
+	status = s.status(status.Seq)
+	if len(status.Messages) != 0 || status.Seq != 3 {
+		t.Fatalf("expected no new messages, actual: %+v", status)
+	}
+
+	s.setCompletedSuccessfully(true)
+	s.setComplete(true)
+	s.setComplete(true)
+	status = s.status(3)
+	if !status.Complete || !status.CompletedSuccessfully || status.Seq != 4 {
+		t.Fatalf("expected a single complete event, actual: %+v", status)
+	}
+}
+
+// run with -race, writers from the event subscription and the log follower race with HTTP readers
+func TestStoreConcurrency(t *testing.T) {
+	const writers = 8
+	const perWriter = 500
+	s := newStore(1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+		json.NewEncoder(w).Encode(s.status(since))
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for x := 0; x < writers; x++ {
+		wg.Add(1)
+		go func(x int) {
+			defer wg.Done()
+			for y := 0; y < perWriter; y++ {
+				s.add(statusEvent(fmt.Sprintf("%v-%v", x, y)))
+			}
+		}(x)
+	}
+	done := make(chan struct{})
+	readErrs := make(chan error, 1)
+	go func() {
+		defer close(readErrs)
+		var seq int
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			resp, err := http.Get(fmt.Sprintf("%s?since=%v", server.URL, seq))
+			if err != nil {
+				readErrs <- err
+				return
+			}
+			var status Status
+			err = json.NewDecoder(resp.Body).Decode(&status)
+			resp.Body.Close()
+			if err != nil {
+				readErrs <- err
+				return
+			}
+			if status.Seq < seq {
+				readErrs <- fmt.Errorf("cursor went backwards from %v to %v", seq, status.Seq)
+				return
+			}
+			seq = status.Seq
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.setCompletedSuccessfully(true)
+		s.setComplete(true)
+	}()
+	wg.Wait()
+	close(done)
+	if err := <-readErrs; err != nil {
+		t.Fatal(err)
+	}
+
+	pending, _, _ := s.since(0)
+	if len(pending) != 1000 {
+		t.Fatalf("expected the store to be bounded to 1000 events, actual: %v", len(pending))
+	}
+	for x := 1; x < len(pending); x++ {
+		if pending[x].Seq != pending[x-1].Seq+1 {
+			t.Fatalf("expected consecutive sequence numbers, actual: %v then %v", pending[x-1].Seq, pending[x].Seq)
+		}
+	}
+	if last := pending[len(pending)-1].Seq; last != writers*perWriter+1 {
+		t.Fatalf("expected: %v events, actual: %v", writers*perWriter+1, last)
+	}
+}
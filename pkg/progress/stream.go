@@ -0,0 +1,137 @@
+package progress
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of StreamEvent
+const (
+	KindStatus   = "status"
+	KindLog      = "log"
+	KindComplete = "complete"
+)
+
+const (
+	keepAliveInterval = 15 * time.Second
+	logPollInterval   = 500 * time.Millisecond
+)
+
+// StreamEvent is a single message pushed on the stream endpoint, Seq increases by one for every event
+type StreamEvent struct {
+	Seq                   int          `json:"seq"`
+	Kind                  string       `json:"kind"`
+	Status                *StatusEvent `json:"status,omitempty"`
+	Line                  string       `json:"line,omitempty"`
+	CompletedSuccessfully bool         `json:"completedSuccessfully,omitempty"`
+}
+
+// serveStream pushes events as Server-Sent Events, starting after the Last-Event-ID header or the since query parameter
+func (s *store) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("since")
+	}
+	seq, _ := strconv.Atoi(last)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		pending, _, notify := s.since(seq)
+		for _, e := range pending {
+			data, _ := json.Marshal(e)
+			_, err := fmt.Fprintf(w, "id: %v\nevent: %s\ndata: %s\n\n", e.Seq, e.Kind, data)
+			if err != nil {
+				return
+			}
+			seq = e.Seq
+		}
+		flusher.Flush()
+		select {
+		case <-notify:
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// followLog adds every line written to logfile to the stream until stop is closed
+func (s *store) followLog(logfile string, stop <-chan struct{}) {
+	var offset int64
+	var partial string
+	for {
+		f, err := os.Open(logfile)
+		if err == nil {
+			f.Seek(offset, io.SeekStart)
+			reader := bufio.NewReader(f)
+			for {
+				chunk, err := reader.ReadString('\n')
+				offset += int64(len(chunk))
+				if err != nil {
+					// keep an unterminated line until the rest of it is written
+					partial += chunk
+					break
+				}
+				s.add(StreamEvent{Kind: KindLog, Line: strings.TrimRight(partial+chunk, "\r\n")})
+				partial = ""
+			}
+			f.Close()
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(logPollInterval):
+		}
+	}
+}
+
+// ReadStream parses Server-Sent Events from r and calls fn for each until fn returns done or an error
+func ReadStream(r io.Reader, fn func(StreamEvent) (done bool, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			var e StreamEvent
+			err := json.Unmarshal([]byte(data.String()), &e)
+			data.Reset()
+			if err != nil {
+				return fmt.Errorf("unable to parse stream event, %v", err)
+			}
+			done, err := fn(e)
+			if done || err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data: "):
+			data.WriteString(strings.TrimPrefix(line, "data: "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
@@ -0,0 +1,101 @@
+package progress
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func readEvents(t *testing.T, url string, lastEventID int, until int) []StreamEvent {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", strconv.Itoa(lastEventID))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var received []StreamEvent
+	err = ReadStream(resp.Body, func(e StreamEvent) (bool, error) {
+		received = append(received, e)
+		return e.Seq == until, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return received
+}
+
+func TestStreamResume(t *testing.T) {
+	s := newStore(defaultStoreCapacity)
+	server := httptest.NewServer(http.HandlerFunc(s.serveStream))
+	defer server.Close()
+
+	s.add(StreamEvent{Kind: KindStatus, Status: &StatusEvent{Type: "progress", Msg: "one", Level: "info"}})
+	s.add(StreamEvent{Kind: KindLog, Line: "two"})
+	go func() {
+		// pushed to connected clients as it happens
+		time.Sleep(100 * time.Millisecond)
+		s.add(StreamEvent{Kind: KindComplete, CompletedSuccessfully: true})
+	}()
+
+	received := readEvents(t, server.URL, 0, 3)
+	if len(received) != 3 {
+		t.Fatalf("expected: 3 events, actual: %v", received)
+	}
+	if received[0].Status.Msg != "one" || received[1].Line != "two" || !received[2].CompletedSuccessfully {
+		t.Fatalf("unexpected events: %+v", received)
+	}
+
+	resumed := readEvents(t, server.URL, 2, 3)
+	if len(resumed) != 1 || resumed[0].Seq != 3 || resumed[0].Kind != KindComplete {
+		t.Fatalf("expected to resume at event 3, actual: %+v", resumed)
+	}
+}
+
+func TestFollowLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cake-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logfile := filepath.Join(dir, "cake.log")
+	err = ioutil.WriteFile(logfile, []byte("first\nsec"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newStore(defaultStoreCapacity)
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.followLog(logfile, stop)
+
+	time.Sleep(2 * logPollInterval)
+	f, err := os.OpenFile(logfile, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("ond\n")
+	f.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		lines, _, _ := s.since(0)
+		if len(lines) == 2 {
+			if lines[0].Line != "first" || lines[1].Line != "second" {
+				t.Fatalf("expected: [first second], actual: %+v", lines)
+			}
+			return
+		}
+		time.Sleep(logPollInterval)
+	}
+	lines, _, _ := s.since(0)
+	t.Fatalf("expected 2 log lines, actual: %+v", lines)
+}
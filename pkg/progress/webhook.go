@@ -0,0 +1,158 @@
+package progress
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the request body when the webhook has a secret
+	SignatureHeader       = "X-Cake-Signature"
+	defaultWebhookRetries = 3
+	webhookQueueSize      = 1024
+	webhookDrainTimeout   = 10 * time.Second
+)
+
+// webhookSink POSTs events to a url in publish order from a background queue so slow endpoints do not stall a deploy,
+// events published while the queue is full are dropped
+type webhookSink struct {
+	url     string
+	secret  []byte
+	retries int
+	backoff time.Duration
+	drain   time.Duration
+	client  *http.Client
+	queue   chan []byte
+	done    chan struct{}
+	// mutex guards closed and dropped, Publish never sends on a closed queue
+	mutex   sync.Mutex
+	closed  bool
+	dropped int
+}
+
+// NewWebhookSink returns Events that POST every event as json to url, failed requests are retried with an
+// exponential backoff and requests are signed with secret when it is set
+func NewWebhookSink(url, secret string, retries int) (Events, error) {
+	if url == "" {
+		return nil, fmt.Errorf("webhook event sink requires a URL")
+	}
+	if retries <= 0 {
+		retries = defaultWebhookRetries
+	}
+	w := &webhookSink{
+		url:     url,
+		secret:  []byte(secret),
+		retries: retries,
+		backoff: time.Second,
+		drain:   webhookDrainTimeout,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		queue:   make(chan []byte, webhookQueueSize),
+		done:    make(chan struct{}),
+	}
+	go w.deliver()
+	return w, nil
+}
+
+// Signature is the SignatureHeader value for body signed with secret
+func Signature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish queues the event for delivery without blocking, the event is dropped when the queue is full or closed
+func (w *webhookSink) Publish(p *StatusEvent) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("unable to marshal event, %v", err)
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return fmt.Errorf("webhook %s is closed", w.url)
+	}
+	select {
+	case w.queue <- body:
+	default:
+		w.dropped++
+		// one warning per queue worth of drops keeps a dead endpoint from flooding the log
+		if w.dropped%webhookQueueSize == 1 {
+			log.Warnf("webhook %s is not keeping up, dropped %v events", w.url, w.dropped)
+		}
+	}
+	return nil
+}
+
+// Close stops accepting events and waits up to the drain timeout for the queued ones to be delivered
+func (w *webhookSink) Close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.queue)
+	dropped := w.dropped
+	w.mutex.Unlock()
+
+	select {
+	case <-w.done:
+	case <-time.After(w.drain):
+		dropped += len(w.queue)
+		return fmt.Errorf("timed out delivering events to webhook %s, %v events were dropped", w.url, dropped)
+	}
+	if dropped > 0 {
+		return fmt.Errorf("dropped %v events for webhook %s while its queue was full", dropped, w.url)
+	}
+	return nil
+}
+
+// Subscribe is not supported, events are only sent to the webhook
+func (w *webhookSink) Subscribe(func(*StatusEvent)) error {
+	return fmt.Errorf("subscribing to webhook %s is not supported", w.url)
+}
+
+func (w *webhookSink) deliver() {
+	defer close(w.done)
+	for body := range w.queue {
+		err := w.post(body)
+		backoff := w.backoff
+		for attempt := 1; err != nil && attempt <= w.retries; attempt++ {
+			time.Sleep(backoff)
+			backoff *= 2
+			err = w.post(body)
+		}
+		if err != nil {
+			log.Warnf("dropping event after %v retries, %v", w.retries, err)
+		}
+	}
+}
+
+func (w *webhookSink) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		req.Header.Set(SignatureHeader, Signature(w.secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to post event to %s, %v", w.url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unable to post event to %s, status: %v", w.url, resp.Status)
+	}
+	return nil
+}
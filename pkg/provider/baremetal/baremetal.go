@@ -0,0 +1,204 @@
+package baremetal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/netapp/cake/pkg/config"
+	baremetalConfig "github.com/netapp/cake/pkg/config/baremetal"
+	"github.com/netapp/cake/pkg/config/cluster"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider"
+	"github.com/netapp/cake/pkg/util/ssh"
+	"golang.org/x/sync/errgroup"
+)
+
+// MgmtBootstrap spec for pre-existing hosts
+type MgmtBootstrap struct {
+	provider.Spec                     `yaml:",inline" json:",inline" mapstructure:",squash"`
+	baremetalConfig.ProviderBaremetal `yaml:",inline" json:",inline" mapstructure:",squash"`
+	Prerequisites                     string `yaml:"-" json:"-" mapstructure:"-"`
+	nodes                             []node
+	clientsMutex                      sync.Mutex
+}
+
+// MgmtBootstrapRKE is the spec for bootstrapping a RKE management cluster on pre-existing hosts
+type MgmtBootstrapRKE struct {
+	MgmtBootstrap `yaml:",inline" json:",inline" mapstructure:",squash"`
+	BootstrapIP   string            `yaml:"BootstrapIP" json:"bootstrapIP"`
+	Nodes         map[string]string `yaml:"Nodes" json:"nodes"`
+	RKEConfigPath string            `yaml:"RKEConfigPath"`
+	Hostname      string            `yaml:"Hostname" json:"hostname"`
+	Backup        cluster.Backup    `yaml:"Backup,omitempty" json:"backup,omitempty"`
+}
+
+// node is a host with the cluster node name it was given and its ssh connection
+type node struct {
+	name   string
+	host   baremetalConfig.Host
+	client *ssh.Client
+}
+
+// ip returns the address of the node without the ssh port
+func (n node) ip() string {
+	host, _, err := net.SplitHostPort(n.host.Address)
+	if err != nil {
+		return n.host.Address
+	}
+	return host
+}
+
+// NewMgmtBootstrapRKE is a new rke provider
+func NewMgmtBootstrapRKE(full *MgmtBootstrapRKE) *MgmtBootstrapRKE {
+	r := new(MgmtBootstrapRKE)
+	r = full
+	return r
+}
+
+// assignNodes names every host after its role, the first control plane node is the bootstrap node
+func (v *MgmtBootstrap) assignNodes() error {
+	var controlPlane, workers []node
+	for _, h := range v.Hosts {
+		if h.Address == "" {
+			return fmt.Errorf("host address is required")
+		}
+		if h.Username == "" {
+			h.Username = v.SSH.Username
+		}
+		switch strings.ToLower(h.Role) {
+		case config.ControlNode:
+			controlPlane = append(controlPlane, node{
+				name: fmt.Sprintf("%s-%s-%v", v.ClusterName, config.ControlNode, len(controlPlane)+1),
+				host: h,
+			})
+		case config.WorkerNode:
+			workers = append(workers, node{
+				name: fmt.Sprintf("%s-%s-%v", v.ClusterName, config.WorkerNode, len(workers)+1),
+				host: h,
+			})
+		default:
+			return fmt.Errorf("host %s has unknown role %q, must be %s or %s", h.Address, h.Role, config.ControlNode, config.WorkerNode)
+		}
+	}
+	if len(controlPlane) == 0 {
+		return fmt.Errorf("at least one host with the %s role is required", config.ControlNode)
+	}
+	v.nodes = append(controlPlane, workers...)
+	return nil
+}
+
+func (v *MgmtBootstrap) bootstrapNode() node {
+	return v.nodes[0]
+}
+
+// Client checks every host is reachable over ssh
+func (v *MgmtBootstrap) Client(ctx context.Context) error {
+	err := v.assignNodes()
+	if err != nil {
+		return err
+	}
+	inv := v.NewInventory()
+	for x, n := range v.nodes {
+		node := inv.Node(n.name)
+		node.Address = n.ip()
+		node.Bootstrap = x == 0
+		node.HostKeys = n.host.HostKeys
+	}
+	err = v.SaveInventory(inv)
+	if err != nil {
+		return err
+	}
+	var g errgroup.Group
+	for x := range v.nodes {
+		n := &v.nodes[x]
+		g.Go(func() error {
+			auth := ssh.Auth{
+				Username:   n.host.Username,
+				Password:   n.host.Password.Reveal(),
+				HostKeys:   n.host.HostKeys,
+				KnownHosts: v.SSH.KnownHosts,
+			}
+			if n.host.KeyPath != "" {
+				keyAuth, err := ssh.AuthFromKeyFile(n.host.Username, n.host.KeyPath)
+				if err != nil {
+					return err
+				}
+				auth.PrivateKey = keyAuth.PrivateKey
+			}
+			c, err := ssh.NewClient(n.host.Address, auth)
+			if err != nil {
+				return err
+			}
+			_, _, err = c.Run("sudo -n true")
+			if err != nil {
+				c.Close()
+				return fmt.Errorf("passwordless sudo is required on %s, %v", n.host.Address, err)
+			}
+			v.clientsMutex.Lock()
+			n.client = c
+			v.clientsMutex.Unlock()
+			v.EventStream.Publish(&progress.StatusEvent{
+				Type:  "progress",
+				Msg:   fmt.Sprintf("connected to %s (%s)", n.name, n.host.Address),
+				Level: "info",
+			})
+			return nil
+		})
+	}
+	err = g.Wait()
+	if err != nil {
+		v.closeClients()
+	}
+	return err
+}
+
+// Progress monitors the of the management cluster bootstrapping process
+func (v *MgmtBootstrap) Progress(ctx context.Context) error {
+	return v.WatchProgress()
+}
+
+// Finalize saves the deliverables and closes all ssh connections, pre-existing hosts are left as is
+func (v *MgmtBootstrap) Finalize(ctx context.Context, succeeded bool) error {
+	defer v.closeClients()
+	return v.DownloadDeliverables()
+}
+
+// Events returns the channel of progress messages
+func (v *MgmtBootstrap) Events() progress.Events {
+	return v.EventStream
+}
+
+func (v *MgmtBootstrap) closeClients() {
+	v.clientsMutex.Lock()
+	defer v.clientsMutex.Unlock()
+	for x := range v.nodes {
+		if v.nodes[x].client != nil {
+			v.nodes[x].client.Close()
+			v.nodes[x].client = nil
+		}
+	}
+}
+
+// runScript runs a bash script as root on every node concurrently
+func (v *MgmtBootstrap) runScript(nodes []node, script string) error {
+	var g errgroup.Group
+	for _, n := range nodes {
+		n := n
+		g.Go(func() error {
+			_, _, err := n.client.RunWithInput("sudo -n bash -s", strings.NewReader(script))
+			if err != nil {
+				return fmt.Errorf("prerequisites failed on %s (%s), %v", n.name, n.host.Address, err)
+			}
+			v.EventStream.Publish(&progress.StatusEvent{
+				Type:  "progress",
+				Msg:   fmt.Sprintf("prerequisites installed on %s", n.name),
+				Level: "info",
+			})
+			return nil
+		})
+	}
+	return g.Wait()
+}
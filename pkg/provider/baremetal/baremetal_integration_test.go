@@ -0,0 +1,59 @@
+// +build integration
+
+package baremetal
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	baremetalConfig "github.com/netapp/cake/pkg/config/baremetal"
+	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider"
+)
+
+// Run against a local container running sshd with passwordless sudo, for example:
+//   docker run -d -p 2222:2222 -e USER_NAME=cake -e USER_PASSWORD=cake -e PASSWORD_ACCESS=true -e SUDO_ACCESS=true linuxserver/openssh-server
+//   CAKE_TEST_SSH_ADDRESS=127.0.0.1:2222 CAKE_TEST_SSH_USER=cake CAKE_TEST_SSH_PASSWORD=cake make integration
+func TestClientAndScripts(t *testing.T) {
+	address := os.Getenv("CAKE_TEST_SSH_ADDRESS")
+	if address == "" {
+		t.Skip("CAKE_TEST_SSH_ADDRESS not set")
+	}
+	v := newTestBootstrap(baremetalConfig.Host{
+		Address:  address,
+		Role:     "controlplane",
+		Username: os.Getenv("CAKE_TEST_SSH_USER"),
+		Password: types.Secret(os.Getenv("CAKE_TEST_SSH_PASSWORD")),
+	})
+	v.EventStream = new(discardEvents)
+
+	err := v.Client(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.closeClients()
+
+	err = v.runScript(v.nodes, scriptHeader+"\ntouch /root/cake-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.bootstrapNode().client.Upload(strings.NewReader("ClusterName: bm"), provider.RemoteConfig, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, err := v.bootstrapNode().client.Run("stat -c %a " + provider.RemoteConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(stdout)) != "600" {
+		t.Fatalf("expected: 600, actual: %s", stdout)
+	}
+}
+
+type discardEvents struct{}
+
+func (discardEvents) Publish(*progress.StatusEvent) error        { return nil }
+func (discardEvents) Subscribe(func(*progress.StatusEvent)) error { return nil }
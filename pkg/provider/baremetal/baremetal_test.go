@@ -0,0 +1,71 @@
+package baremetal
+
+import (
+	"testing"
+
+	baremetalConfig "github.com/netapp/cake/pkg/config/baremetal"
+	"github.com/netapp/cake/pkg/config/cluster"
+	"github.com/netapp/cake/pkg/provider"
+)
+
+func newTestBootstrap(hosts ...baremetalConfig.Host) *MgmtBootstrap {
+	return &MgmtBootstrap{
+		Spec: provider.Spec{
+			K8sConfig: cluster.K8sConfig{ClusterName: "bm"},
+			SSH:       cluster.SSH{Username: "ubuntu"},
+		},
+		ProviderBaremetal: baremetalConfig.ProviderBaremetal{Hosts: hosts},
+	}
+}
+
+func TestAssignNodes(t *testing.T) {
+	v := newTestBootstrap(
+		baremetalConfig.Host{Address: "10.0.0.3", Role: "worker"},
+		baremetalConfig.Host{Address: "10.0.0.1:2222", Role: "controlplane", Username: "root"},
+		baremetalConfig.Host{Address: "10.0.0.2", Role: "ControlPlane"},
+	)
+	err := v.assignNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		name     string
+		ip       string
+		username string
+	}{
+		{"bm-controlplane-1", "10.0.0.1", "root"},
+		{"bm-controlplane-2", "10.0.0.2", "ubuntu"},
+		{"bm-worker-1", "10.0.0.3", "ubuntu"},
+	}
+	if len(v.nodes) != len(expected) {
+		t.Fatalf("expected: %v nodes, actual: %v", len(expected), len(v.nodes))
+	}
+	for x, e := range expected {
+		n := v.nodes[x]
+		if n.name != e.name || n.ip() != e.ip || n.host.Username != e.username {
+			t.Fatalf("expected: %+v, actual: {name:%v ip:%v username:%v}", e, n.name, n.ip(), n.host.Username)
+		}
+	}
+	if v.bootstrapNode().name != "bm-controlplane-1" {
+		t.Fatalf("expected bootstrap node: bm-controlplane-1, actual: %v", v.bootstrapNode().name)
+	}
+}
+
+func TestAssignNodesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		hosts []baremetalConfig.Host
+	}{
+		{"no hosts", nil},
+		{"no control plane", []baremetalConfig.Host{{Address: "10.0.0.1", Role: "worker"}}},
+		{"unknown role", []baremetalConfig.Host{{Address: "10.0.0.1", Role: "etcd"}}},
+		{"missing address", []baremetalConfig.Host{{Role: "controlplane"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := newTestBootstrap(tt.hosts...).assignNodes(); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
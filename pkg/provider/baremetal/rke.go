@@ -0,0 +1,76 @@
+package baremetal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider"
+	"github.com/netapp/cake/pkg/util/ssh"
+)
+
+const (
+	scriptHeader      string = "#!/usr/bin/env bash"
+	defaultRKEKeyPath string = "/root/.ssh/id_rsa"
+	authorizeKeyCmd   string = `home=$(getent passwd %[1]s | cut -d: -f6)
+mkdir -p $home/.ssh && echo "%[2]s" >> $home/.ssh/authorized_keys
+chmod 700 $home/.ssh && chmod 600 $home/.ssh/authorized_keys
+chown -R %[1]s $home/.ssh`
+	privateKeyToPathCmd string = `mkdir -p $(dirname %[1]s)
+(umask 177 && cat > %[1]s <<'EOF'
+%[2]s
+EOF
+)`
+)
+
+// Prepare installs the RKE prerequisites on every host and the bootstrap tools on the bootstrap host
+func (v *MgmtBootstrapRKE) Prepare(ctx context.Context) error {
+	privateKey, publicKey, err := ssh.GenerateRSAKeyPair()
+	if err != nil {
+		return err
+	}
+	if v.SSH.KeyPath == "" {
+		v.SSH.KeyPath = defaultRKEKeyPath
+	}
+	v.Prerequisites = fmt.Sprintf(provider.RKEPrereqs, v.SSH.Username)
+
+	nodeScript := []string{
+		scriptHeader,
+		v.Prerequisites,
+		fmt.Sprintf(authorizeKeyCmd, v.SSH.Username, publicKey),
+	}
+	err = v.runScript(v.nodes[1:], strings.Join(nodeScript, "\n"))
+	if err != nil {
+		return err
+	}
+
+	bootstrapScript := append(nodeScript,
+		fmt.Sprintf(provider.HelmInstall, provider.HelmVersion),
+		provider.RKEBinaryInstall,
+		fmt.Sprintf(privateKeyToPathCmd, v.SSH.KeyPath, privateKey),
+	)
+	return v.runScript(v.nodes[:1], strings.Join(bootstrapScript, "\n"))
+}
+
+// Provision uploads cake and its config to the bootstrap host and starts the RKE engine there
+func (v *MgmtBootstrapRKE) Provision(ctx context.Context) error {
+	bootstrap := v.bootstrapNode()
+	v.BootstrapIP = bootstrap.ip()
+	v.BootstrapperIP = bootstrap.ip()
+	v.Nodes = map[string]string{}
+	for _, n := range v.nodes {
+		v.Nodes[n.name] = n.ip()
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("IP for %s: %s", n.name, n.ip()),
+			Level: "info",
+		})
+	}
+
+	err := v.UploadFilesToBootstrap(ctx, bootstrap.client, v)
+	if err != nil {
+		return err
+	}
+	return v.StartRemoteCake(bootstrap.client)
+}
@@ -0,0 +1,37 @@
+package provider
+
+import "fmt"
+
+// CleanupPolicy decides when Finalize removes the infrastructure only needed while bootstrapping
+type CleanupPolicy string
+
+// Cleanup policies for the Cleanup setting of the spec
+const (
+	// CleanupAlways removes the bootstrap infrastructure whatever the outcome of the deploy
+	CleanupAlways CleanupPolicy = "always"
+	// CleanupOnSuccess keeps the bootstrap infrastructure of a failed deploy for debugging, it is the default
+	CleanupOnSuccess CleanupPolicy = "on-success"
+	// CleanupNever keeps the bootstrap infrastructure
+	CleanupNever CleanupPolicy = "never"
+)
+
+// CleanupPolicy returns the Cleanup setting of the spec, on-success when it is not set
+func (s *Spec) CleanupPolicy() (CleanupPolicy, error) {
+	switch s.Cleanup {
+	case "":
+		return CleanupOnSuccess, nil
+	case CleanupAlways, CleanupOnSuccess, CleanupNever:
+		return s.Cleanup, nil
+	}
+	return "", fmt.Errorf("invalid Cleanup %q, expected %s, %s or %s", s.Cleanup, CleanupAlways, CleanupOnSuccess, CleanupNever)
+}
+
+// RemoveBootstrap reports whether Finalize removes the bootstrap infrastructure of a deploy, nothing is
+// removed with an invalid policy
+func (s *Spec) RemoveBootstrap(succeeded bool) bool {
+	policy, err := s.CleanupPolicy()
+	if err != nil {
+		return false
+	}
+	return policy == CleanupAlways || (policy == CleanupOnSuccess && succeeded)
+}
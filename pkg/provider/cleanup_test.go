@@ -0,0 +1,36 @@
+package provider
+
+import "testing"
+
+func TestRemoveBootstrap(t *testing.T) {
+	tests := []struct {
+		policy    CleanupPolicy
+		succeeded bool
+		remove    bool
+	}{
+		{"", true, true},
+		{"", false, false},
+		{CleanupOnSuccess, true, true},
+		{CleanupOnSuccess, false, false},
+		{CleanupAlways, true, true},
+		{CleanupAlways, false, true},
+		{CleanupNever, true, false},
+		{CleanupNever, false, false},
+		{"sometimes", true, false},
+	}
+	for _, tt := range tests {
+		s := Spec{Cleanup: tt.policy}
+		if s.RemoveBootstrap(tt.succeeded) != tt.remove {
+			t.Fatalf("expected Cleanup %q of a deploy that succeeded: %v to remove: %v", tt.policy, tt.succeeded, tt.remove)
+		}
+	}
+
+	_, err := (&Spec{Cleanup: "sometimes"}).CleanupPolicy()
+	if err == nil {
+		t.Fatal("expected an invalid Cleanup policy to be rejected")
+	}
+	policy, err := (&Spec{}).CleanupPolicy()
+	if err != nil || policy != CleanupOnSuccess {
+		t.Fatalf("expected: %s, actual: %s, %v", CleanupOnSuccess, policy, err)
+	}
+}
@@ -0,0 +1,37 @@
+package provider
+
+// Node prerequisites and remote cake settings shared by all providers
+const (
+	// RemoteExecutable is where the cake binary is uploaded on the bootstrap node
+	RemoteExecutable string = "/tmp/cake"
+	// RemoteConfig is where the cake config is uploaded on the bootstrap node over sftp
+	RemoteConfig string = "/tmp/cake.yaml"
+	// RemoteLog is where the output of the remote cake process is written
+	RemoteLog string = "/tmp/cake.out"
+	// RunLocalCakeCmd runs the engine on the bootstrap node, args are executable, deployment type and config
+	RunLocalCakeCmd string = "%s deploy --local --deployment-type %s --spec-file %s --progress"
+	// CakeLinuxBinaryPkgerLocation is the location of the embedded linux cake binary
+	CakeLinuxBinaryPkgerLocation string = "/cake-linux-embedded"
+	// ProgressPort is the port the bootstrap node serves progress and deliverables on
+	ProgressPort string = "8081"
+	// RKEBinaryInstall installs the rke cli
+	RKEBinaryInstall string = `wget -O /usr/local/bin/rke https://github.com/rancher/rke/releases/download/v1.1.1/rke_linux-amd64 && chmod +x /usr/local/bin/rke`
+	// RKEPrereqs installs docker, loads the kernel modules and sets the sysctls needed by RKE, arg is the ssh user
+	RKEPrereqs string = `curl https://releases.rancher.com/install-docker/18.09.2.sh | sh
+for module in br_netfilter ip6_udp_tunnel ip_set ip_set_hash_ip ip_set_hash_net iptable_filter iptable_nat iptable_mangle iptable_raw nf_conntrack_netlink nf_conntrack nf_conntrack_ipv4   nf_defrag_ipv4 nf_nat nf_nat_ipv4 nf_nat_masquerade_ipv4 nfnetlink udp_tunnel veth vxlan x_tables xt_addrtype xt_conntrack xt_comment xt_mark xt_multiport xt_nat xt_recent xt_set  xt_statistic xt_tcpudp;
+do
+	if ! lsmod | grep -q $module; then
+	echo "module $module is not present, installing now...";
+		modprobe $module
+	fi;
+done
+
+echo "net.bridge.bridge-nf-call-iptables=1" >> /etc/sysctl.conf
+usermod -aG docker %s`
+	// HelmInstall installs the helm cli, arg is the helm version
+	HelmInstall string = `curl -fsSL -o get_helm.sh https://raw.githubusercontent.com/helm/helm/master/scripts/get-helm-3
+chmod 700 get_helm.sh
+./get_helm.sh --version %s`
+	// HelmVersion is the version of helm installed on the bootstrap node
+	HelmVersion string = "v3.2.1"
+)
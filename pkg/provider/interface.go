@@ -1,27 +1,33 @@
 package provider
 
 import (
+	"context"
+
 	"github.com/netapp/cake/pkg/config/cluster"
 	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/metrics"
 	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/tracing"
 )
 
-// Bootstrapper is the interface for creating infrastructure to run a cake engine against
+// Bootstrapper is the interface for creating infrastructure to run a cake engine against, ctx carries the
+// tracing span of the phase a method runs in
 type Bootstrapper interface {
 	// Client setups up any client connections to remote provider
-	Client() error
+	Client(ctx context.Context) error
 	// Prepare setups up any needed infrastructure
-	Prepare() error
+	Prepare(ctx context.Context) error
 	// Provision runs the management cluster creation steps
-	Provision() error
+	Provision(ctx context.Context) error
 	// Progress watches the cluster creation for progress. One node will make the following HTTP endpoints available. The progress method will read all progress events from /progress
 	// /progress - all events messages, overall complete status and overall success status
 	// /log - the stdout of all commands run
 	// /deliverable - is the URI discovery endpoint for all files that were created as part of the deploy
 	// /deliverable/<file_name> - engines will implement any number of endpoints here where the file_name is an engine specific file created during the deployment process
-	Progress() error
+	Progress(ctx context.Context) error
 	// Finalize saves in the .cake/<cluster-name>/ directory /log and all /deliverable/<file_name> files and removes any created bootstrap infrastructure
-	Finalize() error
+	// as the Cleanup policy allows for a deploy that succeeded or not
+	Finalize(ctx context.Context, succeeded bool) error
 	// Events are status messages from the implementation
 	Events() progress.Events
 }
@@ -29,59 +35,51 @@ type Bootstrapper interface {
 // Spec for the Provider
 type Spec struct {
 	cluster.K8sConfig `yaml:",inline" json:",inline" mapstructure:",squash"`
-	EventStream       progress.Events  `yaml:"-" json:"-" mapstructure:"-"`
-	EngineType        types.EngineType `yaml:"EngineType" json:"enginetype"`
-	LogFile           string           `yaml:"LogFile" json:"logfile"`
-	LogDir            string           `yaml:"LogDir" json:"logdir"`
-	SSH               cluster.SSH      `yaml:"SSH" json:"ssh"`
-	BootstrapperIP    string           `yaml:"-" json:"-" mapstructure:"-"`
+	EventStream       progress.Events       `yaml:"-" json:"-" mapstructure:"-"`
+	EngineType        types.EngineType      `yaml:"EngineType" json:"enginetype"`
+	LogFile           string                `yaml:"LogFile" json:"logfile"`
+	LogDir            string                `yaml:"LogDir" json:"logdir"`
+	SSH               cluster.SSH           `yaml:"SSH" json:"ssh"`
+	BootstrapperIP    string                `yaml:"-" json:"-" mapstructure:"-"`
+	ProgressEndpoint  progress.Credentials  `yaml:"ProgressEndpoint,omitempty" json:"progressendpoint,omitempty"`
+	EventSinks        []progress.SinkConfig `yaml:"EventSinks,omitempty" json:"eventsinks,omitempty"`
+	Tracing           tracing.Config        `yaml:"Tracing,omitempty" json:"tracing,omitempty"`
+	Cleanup           CleanupPolicy         `yaml:"Cleanup,omitempty" json:"cleanup,omitempty"`
+	MetricsAddress    string                `yaml:"MetricsAddress,omitempty" json:"metricsaddress,omitempty"`
 }
 
-// Run provider bootstrap process
-func Run(b Bootstrapper) error {
-	log := b.Events()
-	log.Publish(&progress.StatusEvent{
-		Type:  "progress",
-		Msg:   "Connecting to provider",
-		Level: "info",
-	})
-	err := b.Client()
+// Run provider bootstrap process, the phases are traced as children of the span of ctx
+func Run(ctx context.Context, b Bootstrapper) (err error) {
+	metrics.SetInProgress()
+	defer func() { metrics.SetSuccess(err == nil) }()
+	phases := progress.NewPhases(b.Events(),
+		progress.PhaseClient,
+		progress.PhasePrepare,
+		progress.PhaseProvision,
+		progress.PhaseProgress,
+		progress.PhaseFinalize,
+	)
+	err = phases.Run(ctx, progress.PhaseClient, "Connecting to provider", b.Client)
 	if err != nil {
 		return err
 	}
-	log.Publish(&progress.StatusEvent{
-		Type:  "progress",
-		Msg:   "Preparing environment",
-		Level: "info",
-	})
-	defer b.Finalize()
-	err = b.Prepare()
+	// a deploy that only failed to finalize, ie its cleanup or the download of its deliverables, failed as well
+	defer func() {
+		succeeded := err == nil
+		finalizeErr := phases.Run(ctx, progress.PhaseFinalize, "Finalizing", func(ctx context.Context) error {
+			return b.Finalize(ctx, succeeded)
+		})
+		if err == nil {
+			err = finalizeErr
+		}
+	}()
+	err = phases.Run(ctx, progress.PhasePrepare, "Preparing environment", b.Prepare)
 	if err != nil {
 		return err
 	}
-	log.Publish(&progress.StatusEvent{
-		Type:  "progress",
-		Msg:   "Provisioning cluster",
-		Level: "info",
-	})
-	err = b.Provision()
+	err = phases.Run(ctx, progress.PhaseProvision, "Provisioning cluster", b.Provision)
 	if err != nil {
 		return err
 	}
-	log.Publish(&progress.StatusEvent{
-		Type:  "progress",
-		Msg:   "Provision Progress",
-		Level: "info",
-	})
-	err = b.Progress()
-	if err != nil {
-		return err
-	}
-	log.Publish(&progress.StatusEvent{
-		Type:  "progress",
-		Msg:   "Finalizing",
-		Level: "info",
-	})
-
-	return nil
+	return phases.Run(ctx, progress.PhaseProgress, "Provision Progress", b.Progress)
 }
@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/netapp/cake/pkg/progress"
+)
+
+// fakeBootstrapper fails the step of its error fields and records what Finalize was called with
+type fakeBootstrapper struct {
+	provisionErr error
+	finalizeErr  error
+	finalized    []bool
+	events       recordedEvents
+}
+
+func (f *fakeBootstrapper) Client(context.Context) error    { return nil }
+func (f *fakeBootstrapper) Prepare(context.Context) error   { return nil }
+func (f *fakeBootstrapper) Provision(context.Context) error { return f.provisionErr }
+func (f *fakeBootstrapper) Progress(context.Context) error  { return nil }
+func (f *fakeBootstrapper) Events() progress.Events         { return &f.events }
+func (f *fakeBootstrapper) Finalize(_ context.Context, succeeded bool) error {
+	f.finalized = append(f.finalized, succeeded)
+	return f.finalizeErr
+}
+
+func TestRunFinalize(t *testing.T) {
+	teardown := fmt.Errorf("unable to remove the bootstrap VM")
+	provision := fmt.Errorf("unable to clone the nodes")
+	tests := []struct {
+		name string
+		fake *fakeBootstrapper
+		err  error
+	}{
+		{"succeeded", &fakeBootstrapper{}, nil},
+		{"finalize failed", &fakeBootstrapper{finalizeErr: teardown}, teardown},
+		{"provision failed", &fakeBootstrapper{provisionErr: provision}, provision},
+		{"both failed", &fakeBootstrapper{provisionErr: provision, finalizeErr: teardown}, provision},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Run(context.Background(), tt.fake)
+			if err != tt.err {
+				t.Fatalf("expected: %v, actual: %v", tt.err, err)
+			}
+			succeeded := tt.fake.provisionErr == nil
+			if len(tt.fake.finalized) != 1 || tt.fake.finalized[0] != succeeded {
+				t.Fatalf("expected Finalize(%v) once, actual: %v", succeeded, tt.fake.finalized)
+			}
+		})
+	}
+}
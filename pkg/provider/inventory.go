@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+const (
+	// InventoryFileName records what a deploy created, it is saved to LogDir as resources are created
+	InventoryFileName = "inventory.json"
+	// SSHKeyFileName is the private key generated for a deploy, saved to LogDir
+	SSHKeyFileName = "id_rsa"
+)
+
+// InventoryNode is a machine of the deployment
+type InventoryNode struct {
+	Name string `json:"name"`
+	// Address is empty until the node has an IP
+	Address string `json:"address,omitempty"`
+	// VM is the inventory path or domain name of the machine, empty for pre-existing hosts
+	VM        string `json:"vm,omitempty"`
+	Bootstrap bool   `json:"bootstrap,omitempty"`
+	// IPAMRef is the reservation of Address in the IPAM, it has to be released once the node is destroyed
+	IPAMRef string `json:"ipamRef,omitempty"`
+	// HostKeys are the ssh host keys pinned for the node, empty when it is verified with known_hosts
+	HostKeys []string `json:"hostKeys,omitempty"`
+}
+
+// Inventory lists the infrastructure of a deployment, it is written as soon as a resource exists so a failed
+// deploy can still be inspected
+type Inventory struct {
+	Cluster string           `json:"cluster"`
+	Engine  types.EngineType `json:"engine"`
+	// Deployment identifies the deploy that wrote the inventory, it is tagged on the objects it created
+	Deployment string          `json:"deployment,omitempty"`
+	Updated    time.Time       `json:"updated"`
+	SSHUser    string          `json:"sshUser,omitempty"`
+	SSHKey     string          `json:"sshKey,omitempty"`
+	Nodes      []InventoryNode `json:"nodes"`
+	Templates  []string        `json:"templates,omitempty"`
+	Folders    []string        `json:"folders,omitempty"`
+	// Rules are the DRS rules of the compute cluster by name
+	Rules []string `json:"rules,omitempty"`
+}
+
+// Node returns the node with the given name, it is added when it is not in the inventory yet
+func (i *Inventory) Node(name string) *InventoryNode {
+	for x := range i.Nodes {
+		if i.Nodes[x].Name == name {
+			return &i.Nodes[x]
+		}
+	}
+	i.Nodes = append(i.Nodes, InventoryNode{Name: name})
+	return &i.Nodes[len(i.Nodes)-1]
+}
+
+// NewInventory returns the inventory of the spec, an inventory saved by an earlier call is not read
+func (s *Spec) NewInventory() *Inventory {
+	inv := &Inventory{Cluster: s.ClusterName, Engine: s.EngineType, SSHUser: s.SSH.Username}
+	keyPath := path.Join(s.LogDir, SSHKeyFileName)
+	if _, err := os.Stat(keyPath); err == nil {
+		inv.SSHKey = keyPath
+	}
+	return inv
+}
+
+// SaveInventory writes inv to LogDir, nodes are sorted by name
+func (s *Spec) SaveInventory(inv *Inventory) error {
+	inv.Updated = time.Now().UTC()
+	sort.Slice(inv.Nodes, func(i, j int) bool { return inv.Nodes[i].Name < inv.Nodes[j].Name })
+	out, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path.Join(s.LogDir, InventoryFileName), out, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write inventory, %v", err)
+	}
+	return nil
+}
+
+// SaveSSHKey writes the private key generated for the deploy to LogDir, it stays authorized on the nodes
+func (s *Spec) SaveSSHKey(privateKey string) error {
+	err := ioutil.WriteFile(path.Join(s.LogDir, SSHKeyFileName), []byte(privateKey), 0600)
+	if err != nil {
+		return fmt.Errorf("unable to write ssh key, %v", err)
+	}
+	return nil
+}
+
+// LoadInventory reads an inventory saved by SaveInventory
+func LoadInventory(path string) (*Inventory, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var inv Inventory
+	err = json.Unmarshal(in, &inv)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse inventory %s, %v", path, err)
+	}
+	return &inv, nil
+}
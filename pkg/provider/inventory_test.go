@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/netapp/cake/pkg/config/cluster"
+)
+
+func TestInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cake-inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := Spec{LogDir: dir, EngineType: "rke", SSH: cluster.SSH{Username: "ubuntu"}}
+	s.ClusterName = "test"
+
+	inv := s.NewInventory()
+	if inv.SSHKey != "" {
+		t.Fatalf("expected no key before one is saved, actual: %s", inv.SSHKey)
+	}
+	err = s.SaveSSHKey("private")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path.Join(dir, SSHKeyFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, actual: %v", info.Mode().Perm())
+	}
+
+	inv = s.NewInventory()
+	inv.Node("worker").VM = "/dc/vm/worker"
+	inv.Node("bootstrap").Bootstrap = true
+	inv.Node("worker").Address = "10.0.0.2"
+	inv.Node("worker").HostKeys = []string{"ssh-rsa AAAA"}
+	err = s.SaveInventory(inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadInventory(path.Join(dir, InventoryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Cluster != "test" || loaded.Engine != "rke" || loaded.SSHUser != "ubuntu" || loaded.SSHKey != path.Join(dir, SSHKeyFileName) {
+		t.Fatalf("unexpected inventory %+v", loaded)
+	}
+	expected := []InventoryNode{
+		{Name: "bootstrap", Bootstrap: true},
+		{Name: "worker", Address: "10.0.0.2", VM: "/dc/vm/worker", HostKeys: []string{"ssh-rsa AAAA"}},
+	}
+	if len(loaded.Nodes) != len(expected) {
+		t.Fatalf("expected: %+v, actual: %+v", expected, loaded.Nodes)
+	}
+	for x := range expected {
+		if !reflect.DeepEqual(loaded.Nodes[x], expected[x]) {
+			t.Fatalf("expected: %+v, actual: %+v", expected[x], loaded.Nodes[x])
+		}
+	}
+}
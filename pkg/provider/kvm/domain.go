@@ -0,0 +1,95 @@
+package kvm
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+const (
+	domainTypeKVM     = "kvm"
+	defaultVCPUs      = 2
+	defaultMemoryMB   = 4096
+	defaultDiskGB     = 40
+	defaultPool       = "default"
+	defaultNetwork    = "default"
+	defaultURI        = "qemu:///system"
+	diskVolumeSuffix  = ".qcow2"
+	seedVolumeSuffix  = "-seed.iso"
+	domainXMLTemplate = `<domain type='{{ .Type }}'>
+  <name>{{ .Name }}</name>
+  <memory unit='MiB'>{{ .MemoryMB }}</memory>
+  <vcpu>{{ .VCPUs }}</vcpu>
+  <os>
+    <type arch='x86_64'>hvm</type>
+    <boot dev='hd'/>
+  </os>
+  <features>
+    <acpi/>
+    <apic/>
+  </features>
+  <devices>
+    <disk type='volume' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source pool='{{ .Pool }}' volume='{{ .DiskVolume }}'/>
+      <target dev='vda' bus='virtio'/>
+    </disk>
+    <disk type='volume' device='cdrom'>
+      <driver name='qemu' type='raw'/>
+      <source pool='{{ .Pool }}' volume='{{ .SeedVolume }}'/>
+      <target dev='sda' bus='sata'/>
+      <readonly/>
+    </disk>
+    <interface type='network'>
+      <source network='{{ .Network }}'/>
+      <model type='virtio'/>
+    </interface>
+    <channel type='unix'>
+      <target type='virtio' name='org.qemu.guest_agent.0'/>
+    </channel>
+    <serial type='pty'/>
+    <console type='pty'/>
+  </devices>
+</domain>
+`
+)
+
+// domainSpec is the libvirt domain created for a cluster node
+type domainSpec struct {
+	Type       string
+	Name       string
+	VCPUs      int
+	MemoryMB   int
+	Pool       string
+	Network    string
+	DiskVolume string
+	SeedVolume string
+}
+
+// newDomainSpec returns the domain for a node with its disk and cloud-init seed volumes in pool
+func newDomainSpec(name, pool, network string, vcpus, memoryMB int) domainSpec {
+	return domainSpec{
+		Type:       domainTypeKVM,
+		Name:       name,
+		VCPUs:      vcpus,
+		MemoryMB:   memoryMB,
+		Pool:       pool,
+		Network:    network,
+		DiskVolume: name + diskVolumeSuffix,
+		SeedVolume: name + seedVolumeSuffix,
+	}
+}
+
+// XML renders the libvirt domain definition
+func (d domainSpec) XML() ([]byte, error) {
+	textTemplate, err := template.New("domain").Parse(domainXMLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse domain template, %v", err)
+	}
+	out := new(bytes.Buffer)
+	err = textTemplate.Execute(out, d)
+	if err != nil {
+		return nil, fmt.Errorf("unable to template domain %s, %v", d.Name, err)
+	}
+	return out.Bytes(), nil
+}
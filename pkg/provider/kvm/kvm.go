@@ -0,0 +1,363 @@
+package kvm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netapp/cake/pkg/config/cluster"
+	kvmConfig "github.com/netapp/cake/pkg/config/kvm"
+	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/metrics"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider"
+	"github.com/netapp/cake/pkg/provider/vsphere/cloudinit"
+)
+
+const ipTimeout = 10 * time.Minute
+
+// TrackedResources are libvirt objects created during the bootstrap process
+type TrackedResources struct {
+	// Domains are the names of the defined domains
+	Domains []string
+	// Volumes are the names of the volumes created in the storage pool
+	Volumes []string
+	mutex   sync.Mutex
+}
+
+// GeneratedKey is the key pair generated for the run
+type GeneratedKey struct {
+	PrivateKey types.Secret
+	PublicKey  string
+	// HostKey is the ssh host key of the domains of the run, it is pinned when connecting to them
+	HostKey cloudinit.HostKey
+}
+
+// MgmtBootstrap spec for libvirt
+type MgmtBootstrap struct {
+	provider.Spec         `yaml:",inline" json:",inline" mapstructure:",squash"`
+	kvmConfig.ProviderKVM `yaml:",inline" json:",inline" mapstructure:",squash"`
+	TrackedResources      TrackedResources `yaml:"-" json:"-" mapstructure:"-"`
+	Prerequisites         string           `yaml:"-" json:"-" mapstructure:"-"`
+	virsh                 virsh
+}
+
+// MgmtBootstrapRKE is the spec for bootstrapping a RKE management cluster on libvirt
+type MgmtBootstrapRKE struct {
+	MgmtBootstrap `yaml:",inline" json:",inline" mapstructure:",squash"`
+	BootstrapIP   string            `yaml:"BootstrapIP" json:"bootstrapIP"`
+	Nodes         map[string]string `yaml:"Nodes" json:"nodes"`
+	RKEConfigPath string            `yaml:"RKEConfigPath"`
+	Hostname      string            `yaml:"Hostname" json:"hostname"`
+	Backup        cluster.Backup    `yaml:"Backup,omitempty" json:"backup,omitempty"`
+	GeneratedKey  GeneratedKey      `yaml:"-" json:"-" mapstructure:"-"`
+}
+
+// setDefaults fills in the libvirt settings that were not configured
+func (v *MgmtBootstrap) setDefaults() {
+	if v.URI == "" {
+		v.URI = defaultURI
+	}
+	if v.StoragePool == "" {
+		v.StoragePool = defaultPool
+	}
+	if v.Network == "" {
+		v.Network = defaultNetwork
+	}
+	if v.VCPUs == 0 {
+		v.VCPUs = defaultVCPUs
+	}
+	if v.MemoryMB == 0 {
+		v.MemoryMB = defaultMemoryMB
+	}
+	if v.DiskGB == 0 {
+		v.DiskGB = defaultDiskGB
+	}
+}
+
+// Client checks libvirt is reachable and the storage pool and network exist
+func (v *MgmtBootstrap) Client(ctx context.Context) error {
+	_, err := v.CleanupPolicy()
+	if err != nil {
+		return err
+	}
+	v.setDefaults()
+	v.virsh = virsh{uri: v.URI}
+	if !v.virsh.exists() {
+		return fmt.Errorf("%s is required to manage libvirt", virshCommand)
+	}
+	_, err = v.virsh.run(ctx, "uri")
+	if err != nil {
+		return fmt.Errorf("unable to connect to %s, %v", v.URI, err)
+	}
+	if !v.virsh.poolExists(ctx, v.StoragePool) {
+		return fmt.Errorf("storage pool %s not found on %s", v.StoragePool, v.URI)
+	}
+	if !v.virsh.networkExists(ctx, v.Network) {
+		return fmt.Errorf("network %s not found on %s", v.Network, v.URI)
+	}
+	return nil
+}
+
+// Progress monitors the of the management cluster bootstrapping process
+func (v *MgmtBootstrap) Progress(ctx context.Context) error {
+	return v.WatchProgress()
+}
+
+// Finalize saves the deliverables, the domains of a failed deploy are removed as the Cleanup policy allows
+func (v *MgmtBootstrap) Finalize(ctx context.Context, succeeded bool) error {
+	err := v.DownloadDeliverables()
+	cleanupErr := v.cleanup(ctx, succeeded)
+	if err != nil {
+		return err
+	}
+	return cleanupErr
+}
+
+// Events returns the channel of progress messages
+func (v *MgmtBootstrap) Events() progress.Events {
+	return v.EventStream
+}
+
+// cleanup removes the domains and volumes of a failed deploy as the Cleanup policy allows, the domains of a
+// successful deploy are the cluster nodes and are kept, resources left in place are reported with the commands
+// that remove them later
+func (v *MgmtBootstrap) cleanup(ctx context.Context, succeeded bool) error {
+	if succeeded {
+		return nil
+	}
+	policy, err := v.CleanupPolicy()
+	if err != nil {
+		v.reportLeftovers("the Cleanup policy is invalid")
+		return err
+	}
+	if !v.RemoveBootstrap(succeeded) {
+		v.reportLeftovers(fmt.Sprintf("Cleanup is %s", policy))
+		return nil
+	}
+	err = v.Cleanup(ctx)
+	if err != nil {
+		v.reportLeftovers("they could not be removed")
+		return err
+	}
+	return nil
+}
+
+// reportLeftovers tells the user which tracked domains and volumes still exist and how to remove them
+func (v *MgmtBootstrap) reportLeftovers(reason string) {
+	v.TrackedResources.mutex.Lock()
+	defer v.TrackedResources.mutex.Unlock()
+	var commands []string
+	for _, name := range v.TrackedResources.Domains {
+		commands = append(commands, fmt.Sprintf("virsh -c %s undefine %s", v.URI, name))
+	}
+	for _, name := range v.TrackedResources.Volumes {
+		commands = append(commands, fmt.Sprintf("virsh -c %s vol-delete --pool %s %s", v.URI, v.StoragePool, name))
+	}
+	if len(commands) == 0 {
+		return
+	}
+	v.EventStream.Publish(&progress.StatusEvent{
+		Type:  "progress",
+		Msg:   fmt.Sprintf("libvirt resources were left in place because %s, remove them once they are no longer needed", reason),
+		Level: progress.LevelWarn,
+	})
+	for _, c := range commands {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("remove it with: %s", c),
+			Level: progress.LevelWarn,
+		})
+	}
+}
+
+// Cleanup removes all tracked domains and volumes, the ones that could not be removed stay tracked
+func (v *MgmtBootstrap) Cleanup(ctx context.Context) error {
+	var errs []string
+	v.TrackedResources.mutex.Lock()
+	defer v.TrackedResources.mutex.Unlock()
+	var domains []string
+	for _, name := range v.TrackedResources.Domains {
+		err := v.virsh.removeDomain(ctx, name)
+		if err != nil {
+			domains = append(domains, name)
+			errs = append(errs, fmt.Sprintf("unable to remove domain %s, %v", name, err))
+			continue
+		}
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("removed domain %s", name),
+			Level: "info",
+		})
+	}
+	v.TrackedResources.Domains = domains
+	var volumes []string
+	for _, name := range v.TrackedResources.Volumes {
+		err := v.virsh.deleteVolume(ctx, v.StoragePool, name)
+		if err != nil {
+			volumes = append(volumes, name)
+			errs = append(errs, fmt.Sprintf("unable to delete volume %s, %v", name, err))
+		}
+	}
+	v.TrackedResources.Volumes = volumes
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to remove all resources, %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (tr *TrackedResources) addDomain(name string) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.Domains = append(tr.Domains, name)
+}
+
+func (tr *TrackedResources) addVolume(name string) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.Volumes = append(tr.Volumes, name)
+}
+
+// baseImageVolume is the name of the volume the base image is imported as
+func baseImageVolume(image string) string {
+	return path.Base(image)
+}
+
+// importBaseImage uploads the qcow2 base image to the storage pool, an image already in the pool is reused
+func (v *MgmtBootstrap) importBaseImage(ctx context.Context) (string, error) {
+	name := baseImageVolume(v.Image)
+	if v.virsh.volumeExists(ctx, v.StoragePool, name) {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("base image %s already in storage pool %s", name, v.StoragePool),
+			Level: "info",
+		})
+		return name, nil
+	}
+
+	localPath := v.Image
+	if strings.HasPrefix(v.Image, "http://") || strings.HasPrefix(v.Image, "https://") {
+		downloaded, err := downloadImage(v.Image)
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(downloaded)
+		localPath = downloaded
+	}
+	err := v.virsh.importVolume(ctx, v.StoragePool, name, localPath, "qcow2")
+	if err != nil {
+		return "", fmt.Errorf("unable to import base image %s, %v", v.Image, err)
+	}
+	v.EventStream.Publish(&progress.StatusEvent{
+		Type:  "progress",
+		Msg:   fmt.Sprintf("base image %s imported to storage pool %s", name, v.StoragePool),
+		Level: "info",
+	})
+	return name, nil
+}
+
+func downloadImage(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("unable to download %s, %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to download %s, status: %s", url, resp.Status)
+	}
+	f, err := ioutil.TempFile("", "cake-image-*.qcow2")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("unable to download %s, %v", url, err)
+	}
+	return f.Name(), nil
+}
+
+// nodeSpec is a cluster node to create from the base image
+type nodeSpec struct {
+	name       string
+	bootScript string
+	publicKeys []string
+	osUser     string
+	hostKey    *cloudinit.HostKey
+}
+
+// createNode creates the disk and seed volumes for a node, defines its domain and starts it
+func (v *MgmtBootstrap) createNode(ctx context.Context, baseImage string, n nodeSpec) error {
+	domain := newDomainSpec(n.name, v.StoragePool, v.Network, v.VCPUs, v.MemoryMB)
+
+	err := v.virsh.createBackedVolume(ctx, v.StoragePool, domain.DiskVolume, baseImage, v.DiskGB)
+	if err != nil {
+		return err
+	}
+	v.TrackedResources.addVolume(domain.DiskVolume)
+
+	dir, err := ioutil.TempDir("", "cake-seed")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	files, err := seedFiles(n.name, n.bootScript, n.publicKeys, n.osUser, n.hostKey)
+	if err != nil {
+		return err
+	}
+	seed, err := writeSeedISO(ctx, dir, files)
+	if err != nil {
+		return err
+	}
+	err = v.virsh.importVolume(ctx, v.StoragePool, domain.SeedVolume, seed, "raw")
+	if err != nil {
+		return err
+	}
+	v.TrackedResources.addVolume(domain.SeedVolume)
+
+	domainXML, err := domain.XML()
+	if err != nil {
+		return err
+	}
+	err = v.virsh.defineDomain(ctx, domainXML)
+	if err != nil {
+		return err
+	}
+	v.TrackedResources.addDomain(n.name)
+	err = v.virsh.startDomain(ctx, n.name)
+	if err != nil {
+		return err
+	}
+	v.EventStream.Publish(&progress.StatusEvent{
+		Type:  "progress",
+		Msg:   fmt.Sprintf("domain %s started", n.name),
+		Level: "info",
+	})
+	return nil
+}
+
+// waitForIP polls the DHCP leases of the network and then the guest agent until the domain reports an address
+func (v *MgmtBootstrap) waitForIP(ctx context.Context, name string) (string, error) {
+	var err error
+	var ip string
+	deadline := time.Now().Add(ipTimeout)
+	for time.Now().Before(deadline) {
+		for _, source := range []string{sourceLease, sourceAgent} {
+			ip, err = v.virsh.domainIP(ctx, name, source)
+			if err == nil {
+				return ip, nil
+			}
+		}
+		metrics.Retry(metrics.LoopDomainIP)
+		time.Sleep(5 * time.Second)
+	}
+	return "", fmt.Errorf("timed out after %s waiting for an IP for %s, %v", ipTimeout, name, err)
+}
@@ -0,0 +1,182 @@
+package kvm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/netapp/cake/pkg/config"
+	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider"
+	"github.com/netapp/cake/pkg/provider/vsphere/cloudinit"
+	"github.com/netapp/cake/pkg/util/ssh"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	scriptHeader   string = "#!/usr/bin/env bash"
+	bootstrapIndex        = 0
+)
+
+// NewMgmtBootstrapRKE is a new rke provider
+func NewMgmtBootstrapRKE(full *MgmtBootstrapRKE) *MgmtBootstrapRKE {
+	r := new(MgmtBootstrapRKE)
+	r = full
+	return r
+}
+
+// saveInventory records the domains with the node IPs known so far
+func (v *MgmtBootstrapRKE) saveInventory() {
+	inv := v.NewInventory()
+	for x, name := range v.nodeNames() {
+		n := inv.Node(name)
+		n.VM = name
+		n.Address = v.Nodes[name]
+		n.Bootstrap = x == bootstrapIndex
+		if v.GeneratedKey.HostKey.Public != "" {
+			n.HostKeys = []string{v.GeneratedKey.HostKey.Public}
+		}
+	}
+	err := v.SaveInventory(inv)
+	if err != nil {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   err.Error(),
+			Level: progress.LevelWarn,
+		})
+	}
+}
+
+// nodeNames returns the domain names for the cluster, the first control plane node is the bootstrap node
+func (v *MgmtBootstrapRKE) nodeNames() []string {
+	var names []string
+	for vm := 1; vm <= v.ControlPlaneCount; vm++ {
+		names = append(names, fmt.Sprintf("%s-%s-%v", v.ClusterName, config.ControlNode, vm))
+	}
+	for vm := 1; vm <= v.WorkerCount; vm++ {
+		names = append(names, fmt.Sprintf("%s-%s-%v", v.ClusterName, config.WorkerNode, vm))
+	}
+	return names
+}
+
+// Prepare imports the base image and creates a domain for every node
+func (v *MgmtBootstrapRKE) Prepare(ctx context.Context) error {
+	if v.ControlPlaneCount < 1 {
+		return fmt.Errorf("at least one %s node is required", config.ControlNode)
+	}
+	privateKey, publicKey, err := ssh.GenerateRSAKeyPair()
+	if err != nil {
+		return err
+	}
+	v.SSH.AuthorizedKeys = append(v.SSH.AuthorizedKeys, publicKey)
+	v.GeneratedKey.PrivateKey = types.Secret(privateKey)
+	v.GeneratedKey.PublicKey = publicKey
+	hostPrivateKey, hostPublicKey, err := ssh.GenerateRSAKeyPair()
+	if err != nil {
+		return err
+	}
+	v.GeneratedKey.HostKey = cloudinit.HostKey{Private: hostPrivateKey, Public: hostPublicKey}
+	err = v.SaveSSHKey(privateKey)
+	if err != nil {
+		return err
+	}
+	v.Prerequisites = fmt.Sprintf(provider.RKEPrereqs, v.SSH.Username)
+
+	baseImage, err := v.importBaseImage(ctx)
+	if err != nil {
+		return err
+	}
+
+	nodeScript := []string{scriptHeader, v.Prerequisites}
+	bootstrapScript := append(nodeScript,
+		fmt.Sprintf(provider.HelmInstall, provider.HelmVersion),
+		provider.RKEBinaryInstall,
+	)
+
+	var g errgroup.Group
+	for x, name := range v.nodeNames() {
+		n := nodeSpec{
+			name:       name,
+			bootScript: strings.Join(nodeScript, "\n"),
+			publicKeys: v.SSH.AuthorizedKeys,
+			osUser:     v.SSH.Username,
+			hostKey:    &v.GeneratedKey.HostKey,
+		}
+		if x == bootstrapIndex {
+			n.bootScript = strings.Join(bootstrapScript, "\n")
+		}
+		g.Go(func() error {
+			return v.createNode(ctx, baseImage, n)
+		})
+	}
+	return g.Wait()
+}
+
+// Provision waits for every node to finish cloud-init, uploads cake and its config to the bootstrap node and starts the RKE engine there
+func (v *MgmtBootstrapRKE) Provision(ctx context.Context) error {
+	auth := ssh.Auth{
+		Username:   v.SSH.Username,
+		PrivateKey: []byte(v.GeneratedKey.PrivateKey.Reveal()),
+		HostKeys:   []string{v.GeneratedKey.HostKey.Public},
+	}
+	names := v.nodeNames()
+	clients := make([]*ssh.Client, len(names))
+	defer func() {
+		for _, c := range clients {
+			if c != nil {
+				c.Close()
+			}
+		}
+	}()
+
+	v.Nodes = map[string]string{}
+	for _, name := range names {
+		ip, err := v.waitForIP(ctx, name)
+		if err != nil {
+			v.saveInventory()
+			return err
+		}
+		v.Nodes[name] = ip
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("IP received for %s: %s", name, ip),
+			Level: "info",
+		})
+	}
+	v.BootstrapIP = v.Nodes[names[bootstrapIndex]]
+	v.BootstrapperIP = v.BootstrapIP
+	v.saveInventory()
+
+	var g errgroup.Group
+	for x, name := range names {
+		x, name := x, name
+		g.Go(func() error {
+			c, err := provider.WaitForCloudInit(v.Nodes[name], auth)
+			if err != nil {
+				return err
+			}
+			clients[x] = c
+			v.EventStream.Publish(&progress.StatusEvent{
+				Type:  "progress",
+				Msg:   fmt.Sprintf("prerequisites installed on %s", name),
+				Level: "info",
+			})
+			return nil
+		})
+	}
+	err := g.Wait()
+	if err != nil {
+		return err
+	}
+
+	err = provider.InstallPrivateKey(clients[bootstrapIndex], v.GeneratedKey.PrivateKey.Reveal())
+	if err != nil {
+		return err
+	}
+	err = v.UploadFilesToBootstrap(ctx, clients[bootstrapIndex], v)
+	if err != nil {
+		return err
+	}
+	return v.StartRemoteCake(clients[bootstrapIndex])
+}
@@ -0,0 +1,68 @@
+package kvm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/netapp/cake/pkg/provider/vsphere/cloudinit"
+	"github.com/netapp/cake/pkg/util/cmd"
+)
+
+// NoCloud reads its data from a volume labeled cidata
+const seedVolumeLabel = "cidata"
+
+// isoTools are tried in order to build the seed iso, xorriso needs to be put in mkisofs mode
+var isoTools = [][]string{
+	{"genisoimage"},
+	{"mkisofs"},
+	{"xorriso", "-as", "mkisofs"},
+}
+
+// seedFiles returns the NoCloud user-data and meta-data for a node, a hostKey replaces the host keys of the image
+func seedFiles(hostname, bootScript string, publicKeys []string, osUser string, hostKey *cloudinit.HostKey) (map[string][]byte, error) {
+	userData, err := cloudinit.GetUserData(&cloudinit.UserDataValues{
+		User:              osUser,
+		SSHAuthorizedKeys: publicKeys,
+		BootScript:        bootScript,
+		HostKey:           hostKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	metaData, err := cloudinit.GetMetadata(&cloudinit.MetadataValues{Hostname: hostname})
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		"user-data": userData,
+		"meta-data": metaData,
+	}, nil
+}
+
+// writeSeedISO writes files to dir and packs them into a NoCloud iso, the path to the iso is returned
+func writeSeedISO(ctx context.Context, dir string, files map[string][]byte) (string, error) {
+	args := []string{"-output", filepath.Join(dir, "seed.iso"), "-volid", seedVolumeLabel, "-joliet", "-rock"}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, contents, 0600)
+		if err != nil {
+			return "", fmt.Errorf("unable to write %s, %v", path, err)
+		}
+		args = append(args, path)
+	}
+
+	for _, tool := range isoTools {
+		c := cmd.NewCommandLine(nil, tool[0], append(tool[1:], args...), &ctx).Program()
+		if !c.Exists() {
+			continue
+		}
+		_, stderr, err := c.Execute()
+		if err != nil {
+			return "", fmt.Errorf("unable to create seed iso with %s, %v, stderr: %s", tool[0], err, stderr)
+		}
+		return filepath.Join(dir, "seed.iso"), nil
+	}
+	return "", fmt.Errorf("one of genisoimage, mkisofs or xorriso is required to create the cloud-init seed iso")
+}
@@ -0,0 +1,155 @@
+package kvm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/netapp/cake/pkg/util/cmd"
+)
+
+const virshCommand = "virsh"
+
+// IP address sources understood by virsh domifaddr
+const (
+	sourceLease = "lease"
+	sourceAgent = "agent"
+)
+
+// virsh runs libvirt commands against a single connection URI
+type virsh struct {
+	uri string
+}
+
+func (c virsh) command(ctx context.Context, args ...string) cmd.Command {
+	return cmd.NewCommandLine(nil, virshCommand, append([]string{"--connect", c.uri}, args...), &ctx).Program()
+}
+
+func (c virsh) run(ctx context.Context, args ...string) (string, error) {
+	stdout, stderr, err := c.command(ctx, args...).Execute()
+	if err != nil {
+		return string(stdout), fmt.Errorf("virsh %s failed, %v, stderr: %s", strings.Join(args, " "), err, strings.TrimSpace(string(stderr)))
+	}
+	return string(stdout), nil
+}
+
+// exists checks virsh is in the $PATH
+func (c virsh) exists() bool {
+	return c.command(context.Background()).Exists()
+}
+
+func (c virsh) poolExists(ctx context.Context, pool string) bool {
+	_, err := c.run(ctx, "pool-info", pool)
+	return err == nil
+}
+
+func (c virsh) networkExists(ctx context.Context, network string) bool {
+	_, err := c.run(ctx, "net-info", network)
+	return err == nil
+}
+
+func (c virsh) volumeExists(ctx context.Context, pool, name string) bool {
+	_, err := c.run(ctx, "vol-info", "--pool", pool, name)
+	return err == nil
+}
+
+// importVolume creates a volume in pool with the contents of the local file at path
+func (c virsh) importVolume(ctx context.Context, pool, name, path, format string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	_, err = c.run(ctx, "vol-create-as", pool, name, strconv.FormatInt(info.Size(), 10), "--format", format)
+	if err != nil {
+		return err
+	}
+	_, err = c.run(ctx, "vol-upload", "--pool", pool, name, path)
+	if err != nil {
+		return err
+	}
+	// refresh so the pool reports the capacity stored in the uploaded image
+	_, err = c.run(ctx, "pool-refresh", pool)
+	return err
+}
+
+// createBackedVolume creates a qcow2 volume of capacityGB with backing as its copy on write base
+func (c virsh) createBackedVolume(ctx context.Context, pool, name, backing string, capacityGB int) error {
+	_, err := c.run(ctx, "vol-create-as", pool, name, fmt.Sprintf("%vG", capacityGB),
+		"--format", "qcow2", "--backing-vol", backing, "--backing-vol-format", "qcow2")
+	return err
+}
+
+func (c virsh) deleteVolume(ctx context.Context, pool, name string) error {
+	_, err := c.run(ctx, "vol-delete", "--pool", pool, name)
+	return err
+}
+
+// defineDomain registers the domain described by domainXML
+func (c virsh) defineDomain(ctx context.Context, domainXML []byte) error {
+	f, err := ioutil.TempFile("", "cake-domain-*.xml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(domainXML)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	_, err = c.run(ctx, "define", f.Name())
+	return err
+}
+
+func (c virsh) startDomain(ctx context.Context, name string) error {
+	_, err := c.run(ctx, "start", name)
+	return err
+}
+
+// removeDomain powers off and undefines a domain, a domain that is already off is only undefined
+func (c virsh) removeDomain(ctx context.Context, name string) error {
+	state, err := c.run(ctx, "domstate", name)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(state) != "shut off" {
+		_, err = c.run(ctx, "destroy", name)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = c.run(ctx, "undefine", name)
+	return err
+}
+
+// domainIP returns the first IPv4 address of the domain reported by source
+func (c virsh) domainIP(ctx context.Context, name, source string) (string, error) {
+	out, err := c.run(ctx, "domifaddr", name, "--source", source)
+	if err != nil {
+		return "", err
+	}
+	ip := parseDomIfAddr(out)
+	if ip == "" {
+		return "", fmt.Errorf("no IPv4 address reported by %s for %s", source, name)
+	}
+	return ip, nil
+}
+
+// parseDomIfAddr returns the first non loopback IPv4 address from the table printed by virsh domifaddr,
+// the guest agent prints "-" for the name and MAC of every address after the first on an interface
+func parseDomIfAddr(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[len(fields)-2] != "ipv4" {
+			continue
+		}
+		ip := strings.Split(fields[len(fields)-1], "/")[0]
+		if strings.HasPrefix(ip, "127.") {
+			continue
+		}
+		return ip
+	}
+	return ""
+}
@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/netapp/cake/pkg/metrics"
+	"github.com/netapp/cake/pkg/progress"
+)
+
+const (
+	// deliverableMode keeps kubeconfigs, cluster state with private keys and configs readable by the user only
+	deliverableMode     os.FileMode = 0600
+	downloadAttempts                = 3
+	streamRetryInterval             = 2 * time.Second
+	// streamRetryTimeout bounds how long the stream may keep failing without delivering a new event
+	streamRetryTimeout = 15 * time.Minute
+)
+
+// progressClient connects to the progress endpoint of the bootstrap node with the credentials of the deployment
+func (s *Spec) progressClient() (*progress.Client, error) {
+	if s.ProgressEndpoint.IsZero() {
+		return nil, fmt.Errorf("no credentials for the progress endpoint of %s", s.BootstrapperIP)
+	}
+	return progress.NewClient(s.BootstrapperIP+":"+ProgressPort, s.ProgressEndpoint)
+}
+
+// WatchProgress follows the event stream of the bootstrap node until the engine completes. Status events are
+// published to the EventStream and log lines are written to the cluster log in LogDir as they arrive. A rejected
+// token or certificate and failed writes end the watch at once, other failures are retried for streamRetryTimeout
+func (s *Spec) WatchProgress() error {
+	var seq int
+	var completedSuccessfully bool
+
+	client, err := s.progressClient()
+	if err != nil {
+		return err
+	}
+	// lets cake events follow the deployment from another terminal
+	err = progress.SaveEndpoint(s.endpointPath(), s.BootstrapperIP+":"+ProgressPort, s.ProgressEndpoint)
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(s.logPath(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	deadline := time.Now().Add(streamRetryTimeout)
+	for {
+		last := seq
+		seq, err = client.Stream(seq, func(e progress.StreamEvent) error {
+			switch e.Kind {
+			case progress.KindStatus:
+				if e.Status != nil {
+					s.EventStream.Publish(e.Status)
+				}
+			case progress.KindLog:
+				_, err := fmt.Fprintln(logFile, e.Line)
+				return err
+			case progress.KindComplete:
+				completedSuccessfully = e.CompletedSuccessfully
+			}
+			return nil
+		})
+		if err == nil {
+			break
+		}
+		var streamErr *progress.StreamError
+		if errors.As(err, &streamErr) && !streamErr.Retriable() {
+			return fmt.Errorf("unable to follow the progress of %s, %v", s.BootstrapperIP, err)
+		}
+		if seq != last {
+			deadline = time.Now().Add(streamRetryTimeout)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no progress from %s for %v, %v", s.BootstrapperIP, streamRetryTimeout, err)
+		}
+		// the bootstrap node is not serving yet or the connection dropped, resume after the last event
+		metrics.Retry(metrics.LoopProgressStream)
+		time.Sleep(streamRetryInterval)
+	}
+	if !completedSuccessfully {
+		return fmt.Errorf("didnt complete successfully")
+	}
+	return nil
+}
+
+func (s *Spec) logPath() string {
+	return path.Join(s.LogDir, s.ClusterName+".log")
+}
+
+// downloadVerified saves a deliverable to LogDir until it matches the size and sha256 listed by the bootstrap node
+func (s *Spec) downloadVerified(client *progress.Client, d progress.DeliverableInfo) error {
+	name := d.Name
+	if name == "" {
+		name = filepath.Base(d.Url)
+	}
+	loc := path.Join(s.LogDir, name)
+	var err error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		var sum string
+		var size int64
+		sum, size, err = client.Download(d.Url, loc, deliverableMode)
+		if err != nil {
+			return err
+		}
+		if sum == d.SHA256 && size == d.Size {
+			return nil
+		}
+		os.Remove(loc)
+		integrityErr := &IntegrityError{Path: loc, Expected: d.SHA256, Output: fmt.Sprintf("downloaded %v bytes with sha256 %s", size, sum)}
+		err = integrityErr
+		s.EventStream.Publish(&progress.StatusEvent{
+			Type:      "progress",
+			Msg:       fmt.Sprintf("download attempt %v/%v, %v", attempt, downloadAttempts, integrityErr),
+			Level:     "error",
+			ErrorCode: integrityErr.Code(),
+		})
+	}
+	return err
+}
+
+func (s *Spec) endpointPath() string {
+	return path.Join(s.LogDir, progress.EndpointFileName)
+}
+
+// DownloadDeliverables saves the log and all deliverables from the bootstrap node to LogDir,
+// once everything is saved the bootstrap node is told to stop serving them
+func (s *Spec) DownloadDeliverables() error {
+	client, err := s.progressClient()
+	if err != nil {
+		return err
+	}
+	downloadDir := s.LogDir
+	// save log file to disk
+	client.Download(progress.URILogs, s.logPath(), 0644)
+
+	resp, err := client.Get(progress.URIDeliverable)
+	if err != nil {
+		return err
+	}
+	var deliverables []progress.DeliverableInfo
+	err = json.Unmarshal(resp, &deliverables)
+	if err != nil {
+		return fmt.Errorf("unable to parse deliverables, %v", err)
+	}
+	manifest := progress.Manifest{Cluster: s.ClusterName, Created: time.Now().UTC()}
+	for _, elem := range deliverables {
+		err := s.downloadVerified(client, elem)
+		if err != nil {
+			return err
+		}
+		manifest.Deliverables = append(manifest.Deliverables, elem)
+	}
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path.Join(downloadDir, progress.ManifestFileName), out, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write manifest, %v", err)
+	}
+
+	s.EventStream.Publish(&progress.StatusEvent{
+		Type:  "progress",
+		Msg:   fmt.Sprintf("all files from the cluster deployment can be found here: %s/", downloadDir),
+		Level: "info",
+	})
+	err = client.Finalize()
+	if err != nil {
+		return err
+	}
+	// the bootstrap node stops serving once finalized
+	os.Remove(s.endpointPath())
+	return nil
+}
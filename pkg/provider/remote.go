@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/tracing"
+	"github.com/netapp/cake/pkg/util/ssh"
+	"github.com/rakyll/statik/fs"
+	"gopkg.in/yaml.v3"
+	// for embedded binary
+	_ "github.com/netapp/cake/pkg/util/statik"
+)
+
+const (
+	// SSHTimeout is how long to wait for sshd on a freshly created node
+	SSHTimeout = 10 * time.Minute
+	// cloudInitWait blocks until cloud-init has run the boot script and exits non-zero if it failed
+	cloudInitWait string = "sudo -n cloud-init status --wait"
+	// digestSuffix is appended to the remote path of an artifact for its sha256sum file
+	digestSuffix string = ".sha256"
+	// verifyDigestsCmd checks the artifacts against their sha256sum files, args are the digest files
+	verifyDigestsCmd string = "sha256sum --check %s"
+	// installPrivateKeyCmd writes the key read from stdin for root, the engine runs as root
+	installPrivateKeyCmd string = "sudo -n sh -c 'umask 077 && mkdir -p /root/.ssh && cat > /root/.ssh/id_rsa'"
+	uploadAttempts              = 3
+)
+
+// IntegrityError is returned when an uploaded artifact or a downloaded deliverable does not match its digest
+type IntegrityError struct {
+	Path     string
+	Expected string
+	Output   string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("integrity check failed for %s, expected sha256 %s, %s", e.Path, e.Expected, e.Output)
+}
+
+// Code identifies integrity failures in progress events
+func (e *IntegrityError) Code() string {
+	return "IntegrityCheckFailed"
+}
+
+// Retriable is always true, a corrupt or truncated transfer can be fixed by transferring again
+func (e *IntegrityError) Retriable() bool {
+	return true
+}
+
+// artifact is a file uploaded to the bootstrap node, open is called again for every upload attempt
+type artifact struct {
+	open       func() (io.ReadCloser, error)
+	remotePath string
+	mode       os.FileMode
+}
+
+// WaitForCloudInit connects to a freshly created node once sshd is up and waits for cloud-init to finish
+func WaitForCloudInit(address string, auth ssh.Auth) (*ssh.Client, error) {
+	c, err := ssh.WaitForClient(address, auth, SSHTimeout)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = c.Run(cloudInitWait)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("cloud-init failed on %s, %v", address, err)
+	}
+	return c, nil
+}
+
+// UploadFilesToBootstrap copies the embedded cake binary and config, the yaml of spec, to the bootstrap node over sftp.
+// Each is sent with its sha256 digest and verified on the node. The progress endpoint credentials for the
+// deployment are generated and added to the config first, along with the span of ctx for the trace to continue from
+func (s *Spec) UploadFilesToBootstrap(ctx context.Context, client *ssh.Client, spec interface{}) error {
+	var err error
+	s.ProgressEndpoint, err = progress.NewCredentials(s.BootstrapperIP)
+	if err != nil {
+		return err
+	}
+	// the cake on the bootstrap node continues the trace of this deploy
+	if span := tracing.FromContext(ctx); span != nil {
+		s.Tracing.Parent = span.TraceParent()
+	}
+	configYAML, err := yaml.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	binary := artifact{
+		open: func() (io.ReadCloser, error) {
+			statikFS, err := fs.New()
+			if err != nil {
+				return nil, err
+			}
+			return statikFS.Open(CakeLinuxBinaryPkgerLocation)
+		},
+		remotePath: RemoteExecutable,
+		mode:       0755,
+	}
+	// the config contains credentials, only the ssh user and root can read it
+	config := artifact{
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(configYAML)), nil
+		},
+		remotePath: RemoteConfig,
+		mode:       0600,
+	}
+	for _, a := range []artifact{binary, config} {
+		err := s.uploadVerified(client, a)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadVerified uploads a until the node agrees with its digest, integrity errors are reported to the EventStream
+func (s *Spec) uploadVerified(client *ssh.Client, a artifact) error {
+	var err error
+	for attempt := 1; attempt <= uploadAttempts; attempt++ {
+		err = uploadWithDigest(client, a)
+		integrityErr, ok := err.(*IntegrityError)
+		if !ok {
+			return err
+		}
+		s.EventStream.Publish(&progress.StatusEvent{
+			Type:      "progress",
+			Msg:       fmt.Sprintf("upload attempt %v/%v, %v", attempt, uploadAttempts, integrityErr),
+			Level:     "error",
+			ErrorCode: integrityErr.Code(),
+		})
+	}
+	return err
+}
+
+// uploadWithDigest hashes the artifact while uploading it, writes the digest next to it and has the node check it
+func uploadWithDigest(client *ssh.Client, a artifact) error {
+	src, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	hash := sha256.New()
+	_, err = client.Upload(io.TeeReader(src, hash), a.remotePath, a.mode)
+	if err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	_, err = client.Upload(strings.NewReader(digestLine(sum, a.remotePath)), a.remotePath+digestSuffix, 0644)
+	if err != nil {
+		return err
+	}
+	stdout, _, err := client.Run(fmt.Sprintf(verifyDigestsCmd, a.remotePath+digestSuffix))
+	if err != nil {
+		return &IntegrityError{Path: a.remotePath, Expected: sum, Output: strings.TrimSpace(string(stdout))}
+	}
+	return nil
+}
+
+// digestLine is a line in the format read by sha256sum --check
+func digestLine(sum, path string) string {
+	return fmt.Sprintf("%s  %s\n", sum, path)
+}
+
+// InstallPrivateKey sends the private key generated for the deploy to the bootstrap node over ssh, the RKE engine
+// connects to the other nodes with it. It is never put in the cloud-init data of a node, which anyone with read
+// access to the VM can see
+func InstallPrivateKey(client *ssh.Client, privateKey string) error {
+	_, _, err := client.RunWithInput(installPrivateKeyCmd, strings.NewReader(privateKey))
+	if err != nil {
+		return fmt.Errorf("unable to install private key on %s, %v", client.Address, err)
+	}
+	return nil
+}
+
+// StartRemoteCake verifies the uploaded artifacts one last time and runs the engine on the bootstrap node in the background as root
+func (s *Spec) StartRemoteCake(client *ssh.Client) error {
+	digests := RemoteExecutable + digestSuffix + " " + RemoteConfig + digestSuffix
+	stdout, _, err := client.Run(fmt.Sprintf(verifyDigestsCmd, digests))
+	if err != nil {
+		integrityErr := &IntegrityError{Path: RemoteExecutable + ", " + RemoteConfig, Output: strings.TrimSpace(string(stdout))}
+		s.EventStream.Publish(&progress.StatusEvent{
+			Type:      "progress",
+			Msg:       integrityErr.Error(),
+			Level:     "error",
+			ErrorCode: integrityErr.Code(),
+		})
+		return integrityErr
+	}
+	cakeCmd := fmt.Sprintf(RunLocalCakeCmd, RemoteExecutable, string(s.EngineType), RemoteConfig)
+	return client.RunAsync("sudo -n "+cakeCmd, RemoteLog)
+}
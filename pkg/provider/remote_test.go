@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/util/ssh"
+	"github.com/netapp/cake/pkg/util/ssh/sshtest"
+)
+
+type recordedEvents struct {
+	events []*progress.StatusEvent
+}
+
+func (r *recordedEvents) Publish(e *progress.StatusEvent) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recordedEvents) Subscribe(func(*progress.StatusEvent)) error { return nil }
+
+func newTestClient(t *testing.T) *ssh.Client {
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		t.Skip("sha256sum not found in $PATH")
+	}
+	address, hostKey := sshtest.NewServer(t)
+	c, err := ssh.NewClient(address, ssh.Auth{Username: "cake", Password: sshtest.Password, HostKeys: []string{hostKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestUploadWithDigest(t *testing.T) {
+	c := newTestClient(t)
+	dir, err := ioutil.TempDir("", "cake-provider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := []byte("ClusterName: mgmt\n")
+	a := artifact{
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(contents)), nil
+		},
+		remotePath: filepath.Join(dir, "cake.yaml"),
+		mode:       0600,
+	}
+	err = uploadWithDigest(c, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := ioutil.ReadFile(a.remotePath + digestSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(contents)
+	expected := digestLine(hex.EncodeToString(sum[:]), a.remotePath)
+	if string(digest) != expected {
+		t.Fatalf("expected: %s, actual: %s", expected, digest)
+	}
+
+	// a truncated artifact no longer matches the digest sent with it
+	err = ioutil.WriteFile(a.remotePath, contents[:5], 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = c.Run(fmt.Sprintf(verifyDigestsCmd, a.remotePath+digestSuffix))
+	if err == nil {
+		t.Fatal("expected the truncated artifact to fail verification")
+	}
+}
+
+func TestStartRemoteCakeIntegrityError(t *testing.T) {
+	c := newTestClient(t)
+	events := &recordedEvents{}
+	s := &Spec{EventStream: events}
+
+	// nothing was uploaded, so the digests cannot be checked and cake must not start
+	err := s.StartRemoteCake(c)
+	integrityErr, ok := err.(*IntegrityError)
+	if !ok {
+		t.Fatalf("expected an IntegrityError, actual: %v", err)
+	}
+	if !integrityErr.Retriable() {
+		t.Fatal("expected integrity errors to be retriable")
+	}
+	if len(events.events) != 1 || events.events[0].Level != "error" || events.events[0].ErrorCode != integrityErr.Code() {
+		t.Fatalf("expected one error event with the integrity error code, actual: %v", events.events)
+	}
+}
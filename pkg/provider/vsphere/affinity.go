@@ -0,0 +1,241 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// computeCluster returns the compute cluster of the resource pool, nil when the pool belongs to a standalone host
+func (s *Session) computeCluster() (*object.ClusterComputeResource, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var pool mo.ResourcePool
+	err := s.ResourcePool.Properties(ctx, s.ResourcePool.Reference(), []string{"owner"}, &pool)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to get resource pool properties, %v", err)
+	}
+	var owner mo.ComputeResource
+	err = s.ResourcePool.Properties(ctx, pool.Owner, []string{"host"}, &owner)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to get the hosts of the resource pool, %v", err)
+	}
+	if pool.Owner.Type != "ClusterComputeResource" {
+		return nil, len(owner.Host), nil
+	}
+	return object.NewClusterComputeResource(s.Conn.Client, pool.Owner), len(owner.Host), nil
+}
+
+// checkHosts warns when the compute cluster has fewer hosts than nodes that should be kept apart
+func (v *MgmtBootstrap) checkHosts(role string, nodes int) error {
+	if nodes < 2 {
+		return nil
+	}
+	cluster, hosts, err := v.Session.computeCluster()
+	if err != nil {
+		return err
+	}
+	var warning string
+	if cluster == nil {
+		warning = fmt.Sprintf("resource pool %s is not in a compute cluster, the %v %s nodes all run on one host", v.Session.ResourcePool.InventoryPath, nodes, role)
+	} else if hosts < nodes {
+		warning = fmt.Sprintf("the compute cluster of resource pool %s has %v hosts, fewer than the %v %s nodes, some of them share a host", v.Session.ResourcePool.InventoryPath, hosts, nodes, role)
+	}
+	if warning != "" {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   warning,
+			Level: progress.LevelWarn,
+		})
+	}
+	return nil
+}
+
+// createAntiAffinityRule adds a DRS rule that runs vms on different hosts of cluster
+func (s *Session) createAntiAffinityRule(cluster *object.ClusterComputeResource, name string, mandatory bool, vms []*object.VirtualMachine) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	var refs []types.ManagedObjectReference
+	for _, vm := range vms {
+		refs = append(refs, vm.Reference())
+	}
+	enabled := true
+	spec := &types.ClusterConfigSpecEx{
+		RulesSpec: []types.ClusterRuleSpec{{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationAdd},
+			Info: &types.ClusterAntiAffinityRuleSpec{
+				ClusterRuleInfo: types.ClusterRuleInfo{
+					Name:      name,
+					Enabled:   &enabled,
+					Mandatory: &mandatory,
+				},
+				Vm: refs,
+			},
+		}},
+	}
+	task, err := cluster.Reconfigure(ctx, spec, true)
+	if err != nil {
+		return fmt.Errorf("unable to create DRS rule %s, %v", name, err)
+	}
+	err = task.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("create task for DRS rule %s failed, %v", name, err)
+	}
+	return nil
+}
+
+// removeAntiAffinityRule deletes the DRS rule name of cluster, a rule that does not exist is not an error
+func (s *Session) removeAntiAffinityRule(cluster *object.ClusterComputeResource, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	config, err := cluster.Configuration(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get the configuration of the compute cluster, %v", err)
+	}
+	for _, rule := range config.Rule {
+		info := rule.GetClusterRuleInfo()
+		if info.Name != name {
+			continue
+		}
+		spec := &types.ClusterConfigSpecEx{
+			RulesSpec: []types.ClusterRuleSpec{{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{
+					Operation: types.ArrayUpdateOperationRemove,
+					RemoveKey: info.Key,
+				},
+			}},
+		}
+		task, err := cluster.Reconfigure(ctx, spec, true)
+		if err != nil {
+			return fmt.Errorf("unable to remove DRS rule %s, %v", name, err)
+		}
+		err = task.Wait(ctx)
+		if err != nil {
+			return fmt.Errorf("remove task for DRS rule %s failed, %v", name, err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// antiAffinityRuleName is unique per cluster name and role
+func antiAffinityRuleName(clusterName string, role string) string {
+	return fmt.Sprintf("cake-%s-%s", clusterName, role)
+}
+
+// addAntiAffinityRule keeps the cloned VMs in names on different hosts, the rule is tracked as soon as it exists.
+// VMs that were not cloned are left out and a rule needs at least two VMs
+func (v *MgmtBootstrap) addAntiAffinityRule(role string, names ...string) error {
+	var vms []*object.VirtualMachine
+	for _, name := range names {
+		if vm, ok := v.TrackedResources.VMs[name]; ok {
+			vms = append(vms, vm)
+		}
+	}
+	if len(vms) < 2 {
+		return nil
+	}
+	cluster, _, err := v.Session.computeCluster()
+	if err != nil {
+		return err
+	}
+	if cluster == nil {
+		return nil
+	}
+	name := antiAffinityRuleName(v.ClusterName, role)
+	err = v.Session.createAntiAffinityRule(cluster, name, v.AntiAffinity.Mandatory, vms)
+	if err != nil {
+		return err
+	}
+	v.TrackedResources.Rules[name] = cluster
+	v.EventStream.Publish(&progress.StatusEvent{
+		Type:  "progress",
+		Msg:   fmt.Sprintf("created DRS anti-affinity rule %s for %v", name, names),
+		Level: "info",
+	})
+	return nil
+}
+
+// removeAntiAffinityRules deletes the tracked DRS rules
+func (v *MgmtBootstrap) removeAntiAffinityRules() error {
+	var names []string
+	for name := range v.TrackedResources.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := v.Session.removeAntiAffinityRule(v.TrackedResources.Rules[name], name)
+		if err != nil {
+			return err
+		}
+		delete(v.TrackedResources.Rules, name)
+	}
+	return nil
+}
+
+// cleanupRules removes the DRS rules of a failed deploy as the Cleanup policy allows so that a retry can create
+// them again, rules left in place are reported with the commands that remove them later
+func (v *MgmtBootstrap) cleanupRules(succeeded bool) error {
+	if succeeded || len(v.TrackedResources.Rules) == 0 {
+		return nil
+	}
+	policy, err := v.CleanupPolicy()
+	if err != nil {
+		v.reportRules("the Cleanup policy is invalid")
+		return err
+	}
+	if !v.RemoveBootstrap(succeeded) {
+		v.reportRules(fmt.Sprintf("Cleanup is %s", policy))
+		return nil
+	}
+	err = v.removeAntiAffinityRules()
+	if err != nil {
+		v.reportRules("they could not be removed")
+		return err
+	}
+	v.EventStream.Publish(&progress.StatusEvent{
+		Type:  "progress",
+		Msg:   "removed the DRS anti-affinity rules of the failed deploy",
+		Level: "info",
+	})
+	return nil
+}
+
+// reportRules tells the user which tracked DRS rules still exist and how to remove them
+func (v *MgmtBootstrap) reportRules(reason string) {
+	var names []string
+	for name := range v.TrackedResources.Rules {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	v.EventStream.Publish(&progress.StatusEvent{
+		Type:  "progress",
+		Msg:   fmt.Sprintf("DRS anti-affinity rules were left in place because %s, remove them before deploying the cluster again", reason),
+		Level: progress.LevelWarn,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, name := range names {
+		cluster, err := v.TrackedResources.Rules[name].ObjectName(ctx)
+		if err != nil {
+			cluster = v.TrackedResources.Rules[name].Reference().Value
+		}
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("left DRS rule %s in place, remove it with: govc cluster.rule.remove -cluster '%s' -name '%s'", name, cluster, name),
+			Level: progress.LevelWarn,
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package vsphere
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/netapp/cake/pkg/config"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider"
+)
+
+func TestCheckHosts(t *testing.T) {
+	v := newFixture(t, withClusterPool())
+	events := v.EventStream.(*recordedEvents)
+
+	err := v.checkHosts("control plane", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.events) != 0 {
+		t.Errorf("expected no warning for 3 nodes on 3 hosts, got %+v", events.events)
+	}
+	err = v.checkHosts("control plane", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.events) != 1 || events.events[0].Level != progress.LevelWarn || !strings.Contains(events.events[0].Msg, "has 3 hosts, fewer than the 5 control plane nodes") {
+		t.Errorf("expected a warning for 5 nodes on 3 hosts, got %+v", events.events)
+	}
+
+	events.events = nil
+	v.Session.ResourcePool, err = v.Session.GetResourcePool("/DC0/host/DC0_H0/Resources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.checkHosts("control plane", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.events) != 1 || !strings.Contains(events.events[0].Msg, "not in a compute cluster") {
+		t.Errorf("expected a warning for a standalone host, got %+v", events.events)
+	}
+}
+
+func TestAntiAffinityRule(t *testing.T) {
+	v := newFixture(t, withClusterPool())
+	for _, name := range []string{"DC0_C0_RP0_VM1", "DC0_H0_VM1"} {
+		vm, err := v.Session.GetVM(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.TrackedResources.VMs[name] = vm
+	}
+
+	// a rule needs two VMs that were cloned
+	err := v.addAntiAffinityRule(config.WorkerNode, "DC0_C0_RP0_VM1", "missing")
+	if err != nil || len(v.TrackedResources.Rules) != 0 {
+		t.Fatalf("expected no rule, got %v, %v", v.TrackedResources.Rules, err)
+	}
+	err = v.addAntiAffinityRule("controlplane", "DC0_C0_RP0_VM1", "DC0_H0_VM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := v.TrackedResources.Rules["cake-mgmt-controlplane"]
+	if !ok {
+		t.Fatalf("rule is not tracked, %v", v.TrackedResources.Rules)
+	}
+	cfg, err := c.Configuration(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, rule := range cfg.Rule {
+		if rule.GetClusterRuleInfo().Name == "cake-mgmt-controlplane" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("rule was not created")
+	}
+
+	err = v.removeAntiAffinityRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = c.Configuration(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range cfg.Rule {
+		if rule.GetClusterRuleInfo().Name == "cake-mgmt-controlplane" {
+			t.Error("rule was not removed")
+		}
+	}
+	if len(v.TrackedResources.Rules) != 0 {
+		t.Errorf("removed rule is still tracked, %v", v.TrackedResources.Rules)
+	}
+	// removing a rule that is gone is not an error
+	err = v.Session.removeAntiAffinityRule(c, "cake-mgmt-controlplane")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCleanupRules(t *testing.T) {
+	v := newFixture(t, withClusterPool())
+	events := v.EventStream.(*recordedEvents)
+	for _, name := range []string{"DC0_C0_RP0_VM1", "DC0_H0_VM1"} {
+		vm, err := v.Session.GetVM(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.TrackedResources.VMs[name] = vm
+	}
+	err := v.addAntiAffinityRule(config.ControlNode, "DC0_C0_RP0_VM1", "DC0_H0_VM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rules of a successful deploy keep the nodes apart, a failed one keeps them for debugging by default
+	for _, succeeded := range []bool{true, false} {
+		err = v.cleanupRules(succeeded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(v.TrackedResources.Rules) != 1 {
+			t.Fatalf("expected the rule to be kept, actual: %v", v.TrackedResources.Rules)
+		}
+	}
+	last := events.events[len(events.events)-1]
+	if last.Level != progress.LevelWarn || !strings.Contains(last.Msg, "govc cluster.rule.remove -cluster 'DC0_C0' -name 'cake-mgmt-controlplane'") {
+		t.Errorf("expected the rule to be reported, actual: %+v", last)
+	}
+
+	v.Cleanup = provider.CleanupAlways
+	err = v.cleanupRules(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.TrackedResources.Rules) != 0 {
+		t.Errorf("expected the rule of the failed deploy to be removed, actual: %v", v.TrackedResources.Rules)
+	}
+}
@@ -0,0 +1,503 @@
+package vsphere
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/netapp/cake/pkg/progress"
+)
+
+const (
+	// cacheDir is where OVAs are downloaded to, relative to the home directory
+	cacheDir = ".cake/cache"
+	// transferAttempts bounds the attempts of a download or of the upload of one file
+	transferAttempts = 3
+	// sumSuffix is added to the name of a cached OVA for the file with its verified SHA-256
+	sumSuffix = ".sha256"
+)
+
+// transferRetryDelay is the wait between two attempts of a transfer
+var transferRetryDelay = 5 * time.Second
+
+// OVACache keeps the OVAs downloaded over HTTP in Dir, an OVA is downloaded once and an interrupted download is
+// resumed. An OVA is only used once it matches its checksum or, without one, the manifest in the OVA
+type OVACache struct {
+	Dir string
+	// Checksums are the SHA-256 of OVAs by URL
+	Checksums map[string]string
+
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// cacheEntry is an OVA of the cache, it is looked up once per run
+type cacheEntry struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// NewOVACache returns the cache in ~/.cake/cache
+func NewOVACache(checksums map[string]string) (*OVACache, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the home directory for the OVA cache, %v", err)
+	}
+	return &OVACache{Dir: filepath.Join(home, cacheDir), Checksums: checksums}, nil
+}
+
+// publish sends a progress event when the session has an event stream
+func (s *Session) publish(msg string, level string) {
+	if s.Events == nil {
+		return
+	}
+	s.Events.Publish(&progress.StatusEvent{
+		Type:  "progress",
+		Msg:   msg,
+		Level: level,
+	})
+}
+
+// httpClient is the HTTP client of the vSphere connection, OVAs are downloaded with its TLS settings
+func (s *Session) httpClient() *http.Client {
+	return &s.Conn.Client.Client.Client
+}
+
+// cachedOVA returns the local path of the OVA at link, it is downloaded and verified the first time it is used
+func (s *Session) cachedOVA(link string) (string, error) {
+	c := s.Cache
+	c.mutex.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]*cacheEntry)
+	}
+	e, ok := c.entries[link]
+	if !ok {
+		e = &cacheEntry{}
+		c.entries[link] = e
+	}
+	c.mutex.Unlock()
+
+	e.once.Do(func() {
+		e.path, e.err = s.downloadOVA(link)
+	})
+	return e.path, e.err
+}
+
+// downloadOVA returns the cached OVA of link when it is still current, otherwise the OVA is downloaded and verified.
+// OVAs are cached by the digest of their URL with the SHA-256 they were verified with, an OVA that changed upstream
+// or no longer matches its checksum is downloaded again
+func (s *Session) downloadOVA(link string) (string, error) {
+	ctx := context.TODO()
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing url %s, %w", link, err)
+	}
+	digest := sha256.Sum256([]byte(link))
+	dir := filepath.Join(s.Cache.Dir, hex.EncodeToString(digest[:])[:16])
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", fmt.Errorf("unable to create the OVA cache, %v", err)
+	}
+	name := path.Base(u.Path)
+	cached := filepath.Join(dir, name)
+	checksum := s.Cache.Checksums[link]
+
+	size, modified, headErr := s.remoteFileInfo(ctx, link)
+	var sum string
+	info, err := os.Stat(cached)
+	if err == nil {
+		sum = cachedSum(cached)
+		switch {
+		case sum == "":
+			// the OVA was not verified when it was cached
+		case checksum != "":
+			// an OVA that matches its checksum is current no matter what the server reports
+			if strings.EqualFold(sum, checksum) {
+				return cached, nil
+			}
+		case headErr == nil && (size < 0 || info.Size() == size) && !modified.IsZero() && info.ModTime().Equal(modified):
+			return cached, nil
+		}
+	}
+	if headErr != nil {
+		// a copy verified when it was cached beats no OVA while the server can not be reached
+		if sum != "" && checksum == "" {
+			s.publish(fmt.Sprintf("unable to check whether %s changed, using the cached copy, %v", name, headErr), progress.LevelWarn)
+			return cached, nil
+		}
+		return "", headErr
+	}
+	if info != nil {
+		err = removeCached(cached)
+		if err != nil {
+			return "", fmt.Errorf("unable to remove outdated %s from the OVA cache, %v", name, err)
+		}
+	}
+
+	part := cached + ".part"
+	for attempt := 1; ; attempt++ {
+		err = s.fetch(ctx, link, part, modified, size)
+		if err == nil || attempt == transferAttempts {
+			break
+		}
+		s.publish(fmt.Sprintf("download of %s failed, resuming, %v", name, err), progress.LevelWarn)
+		time.Sleep(transferRetryDelay)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to download %s, %v", link, err)
+	}
+
+	sum, err = s.verifyOVA(part, checksum)
+	if err != nil {
+		_ = os.Remove(part)
+		return "", fmt.Errorf("unable to verify %s, %v", link, err)
+	}
+	err = ioutil.WriteFile(cached+sumSuffix, []byte(fmt.Sprintf("%s  %s\n", sum, name)), 0600)
+	if err != nil {
+		return "", fmt.Errorf("unable to add the SHA-256 of %s to the OVA cache, %v", name, err)
+	}
+	if !modified.IsZero() {
+		err = os.Chtimes(part, modified, modified)
+		if err != nil {
+			return "", fmt.Errorf("unable to set the time of %s, %v", part, err)
+		}
+	}
+	err = os.Rename(part, cached)
+	if err != nil {
+		return "", fmt.Errorf("unable to add %s to the OVA cache, %v", name, err)
+	}
+	return cached, nil
+}
+
+// cachedSum returns the SHA-256 a cached OVA was verified with, it is empty when there is none
+func cachedSum(cached string) string {
+	b, err := ioutil.ReadFile(cached + sumSuffix)
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// removeCached removes a cached OVA and its SHA-256
+func removeCached(cached string) error {
+	err := os.Remove(cached + sumSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(cached)
+}
+
+// remoteFileInfo returns the size and last modification of the file at link, size is -1 and modified is zero when
+// the server does not tell
+func (s *Session) remoteFileInfo(ctx context.Context, link string) (int64, time.Time, error) {
+	var modified time.Time
+	req, err := http.NewRequest(http.MethodHead, link, nil)
+	if err != nil {
+		return 0, modified, err
+	}
+	resp, err := s.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, modified, fmt.Errorf("unable to reach %s, %v", link, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, modified, fmt.Errorf("unable to get %s, %s", link, resp.Status)
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		modified = t
+	}
+	return resp.ContentLength, modified, nil
+}
+
+// fetch downloads link to part, the bytes part already has are requested with a range request. The server sends
+// the whole file when it changed since modified or does not support ranges. Without a modification time it can not
+// be told whether part is of the same file, it is downloaded again. size is the size reported by HEAD, -1 when unknown
+func (s *Session) fetch(ctx context.Context, link string, part string, modified time.Time, size int64) error {
+	flags := os.O_CREATE | os.O_WRONLY
+	if modified.IsZero() {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(part, flags, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", modified.UTC().Format(http.TimeFormat))
+	}
+	resp, err := s.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		offset = 0
+		err = f.Truncate(0)
+		if err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// part already has every byte unless it is larger or the size of the file is not known
+		if remote := rangeSize(resp.Header.Get("Content-Range"), size); remote >= 0 && offset == remote {
+			return nil
+		}
+		err = f.Truncate(0)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("the partial download of %s does not match the size of %s", path.Base(part), link)
+	default:
+		return fmt.Errorf("unable to get %s, %s", link, resp.Status)
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	p := s.newTransferProgress("downloading", path.Base(part[:len(part)-len(".part")]), offset, total)
+	_, err = io.Copy(f, io.TeeReader(resp.Body, p))
+	return err
+}
+
+// rangeSize returns the complete length of a Content-Range header like bytes */1234, fallback when it has none
+func rangeSize(contentRange string, fallback int64) int64 {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return fallback
+	}
+	n, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// verifyOVA checks the OVA at p against checksum, the SHA-256 of the whole OVA. Without a checksum the files of the
+// OVA are checked against its manifest, an OVA without either is used with a warning. The SHA-256 of the OVA is
+// returned, it is computed while the OVA is read
+func (s *Session) verifyOVA(p string, checksum string) (string, error) {
+	var manifest map[string]*manifestEntry
+	if checksum == "" {
+		var err error
+		manifest, err = readManifest(p)
+		if err != nil {
+			return "", err
+		}
+		if len(manifest) == 0 {
+			s.publish(fmt.Sprintf("%s has neither a checksum nor a manifest, it is used without being verified", path.Base(p)), progress.LevelWarn)
+		}
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	digest := sha256.New()
+	ova := io.TeeReader(f, digest)
+	if len(manifest) > 0 {
+		r := tar.NewReader(ova)
+		for {
+			header, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			name := path.Base(header.Name)
+			entry, ok := manifest[name]
+			if !ok {
+				continue
+			}
+			_, err = io.Copy(entry.hash, r)
+			if err != nil {
+				return "", err
+			}
+			if sum := hex.EncodeToString(entry.hash.Sum(nil)); !strings.EqualFold(sum, entry.sum) {
+				return "", fmt.Errorf("%s of %s is %s, the manifest has %s", entry.algorithm, name, sum, entry.sum)
+			}
+			delete(manifest, name)
+		}
+		if len(manifest) > 0 {
+			missing := make(map[string]bool, len(manifest))
+			for name := range manifest {
+				missing[name] = true
+			}
+			return "", fmt.Errorf("files %v of the manifest are missing", sortedKeys(missing))
+		}
+	}
+	// the tar reader stops at the end-of-archive marker, the padding after it is part of the OVA as well
+	_, err = io.Copy(ioutil.Discard, ova)
+	if err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(digest.Sum(nil))
+	if checksum != "" && !strings.EqualFold(sum, checksum) {
+		return "", fmt.Errorf("SHA-256 is %s, expected %s", sum, checksum)
+	}
+	return sum, nil
+}
+
+// manifestEntry is a file of an OVA manifest
+type manifestEntry struct {
+	algorithm string
+	sum       string
+	hash      hash.Hash
+}
+
+// readManifest returns the entries of the .mf of the OVA at p by file name, lines look like
+// SHA256(disk.vmdk)= <hex>
+func readManifest(p string) (map[string]*manifestEntry, error) {
+	h := &handler{}
+	f, _, err := h.openOva("*.mf", p)
+	if err == os.ErrNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the manifest, %v", err)
+	}
+	defer f.Close()
+
+	manifest := make(map[string]*manifestEntry)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		open := strings.Index(line, "(")
+		closing := strings.LastIndex(line, ")=")
+		if open < 0 || closing < open {
+			return nil, fmt.Errorf("invalid manifest line %q", line)
+		}
+		e := &manifestEntry{
+			algorithm: strings.ToUpper(line[:open]),
+			sum:       strings.TrimSpace(line[closing+2:]),
+		}
+		switch e.algorithm {
+		case "SHA1":
+			e.hash = sha1.New()
+		case "SHA256":
+			e.hash = sha256.New()
+		case "SHA512":
+			e.hash = sha512.New()
+		default:
+			return nil, fmt.Errorf("unsupported manifest algorithm %s", e.algorithm)
+		}
+		manifest[line[open+1:closing]] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read the manifest, %v", err)
+	}
+	return manifest, nil
+}
+
+// retryTransfer runs transfer of the file name up to transferAttempts times, a failed attempt is published as a
+// warning
+func (s *Session) retryTransfer(name string, transfer func() error) error {
+	var err error
+	for attempt := 1; attempt <= transferAttempts; attempt++ {
+		err = transfer()
+		if err == nil {
+			return nil
+		}
+		if attempt < transferAttempts {
+			s.publish(fmt.Sprintf("upload of %s failed, retrying, %v", name, err), progress.LevelWarn)
+			time.Sleep(transferRetryDelay)
+		}
+	}
+	return err
+}
+
+// transferProgress publishes the bytes of a transfer as they are written to it, every 10 percent or every 10
+// seconds when the size is not known
+type transferProgress struct {
+	s      *Session
+	action string
+	name   string
+	done   int64
+	total  int64
+	next   int64
+	last   time.Time
+}
+
+func (s *Session) newTransferProgress(action string, name string, done int64, total int64) *transferProgress {
+	p := &transferProgress{s: s, action: action, name: name, done: done, total: total, last: time.Now()}
+	p.next = p.step()
+	return p
+}
+
+// step is the next amount of bytes that is published
+func (p *transferProgress) step() int64 {
+	if p.total <= 0 {
+		return 0
+	}
+	return (p.done*10/p.total + 1) * p.total / 10
+}
+
+func (p *transferProgress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	switch {
+	case p.total > 0 && p.done >= p.next:
+		p.s.publish(fmt.Sprintf("%s %s: %v%% (%s of %s)", p.action, p.name, p.done*100/p.total, formatBytes(p.done), formatBytes(p.total)), "info")
+		p.next = p.step()
+	case p.total <= 0 && time.Since(p.last) > 10*time.Second:
+		p.s.publish(fmt.Sprintf("%s %s: %s", p.action, p.name, formatBytes(p.done)), "info")
+		p.last = time.Now()
+	}
+	return len(b), nil
+}
+
+// formatBytes returns n in the largest unit that keeps it above 1
+func formatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
@@ -0,0 +1,298 @@
+package vsphere
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netapp/cake/pkg/progress"
+)
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// ovaServer serves the OVA at p with range requests and records the Range header of every GET. A zero modified
+// sends no Last-Modified, a HEAD without length sends no Content-Length
+func ovaServer(t *testing.T, p string, modified time.Time, headLength bool, ranges *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			*ranges = append(*ranges, r.Header.Get("Range"))
+		}
+		if r.Method == http.MethodHead && !headLength {
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			return
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer f.Close()
+		http.ServeContent(w, r, filepath.Base(p), modified, f)
+	}))
+}
+
+func TestCachedOVA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cake-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := fmt.Sprintf("SHA256(tiny.ovf)= %s\nSHA256(tiny-disk1.vmdk)= %s\n", sha256Hex([]byte(tinyOVF)), sha256Hex([]byte("disk")))
+	ova := writeOVA(t, dir, "tiny.ova", manifest)
+	var ranges []string
+	server := ovaServer(t, ova, time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC), true, &ranges)
+	defer server.Close()
+	link := server.URL + "/images/tiny.ova"
+
+	v := newFixture(t, withCache(dir))
+	s, events := v.Session, recorded(v)
+	p, err := s.cachedOVA(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := ioutil.ReadFile(ova)
+	got, err := ioutil.ReadFile(p)
+	if err != nil || string(got) != string(want) {
+		t.Fatalf("expected the OVA in the cache, got %v", err)
+	}
+	var downloading bool
+	for _, e := range events.events {
+		downloading = downloading || strings.Contains(e.Msg, "downloading tiny.ova: 100%")
+	}
+	if !downloading {
+		t.Errorf("expected the download progress to be published, got %v", events.events)
+	}
+
+	// a later run uses the cached OVA while it is current
+	s = newFixture(t, withCache(dir)).Session
+	again, err := s.cachedOVA(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != p || len(ranges) != 1 {
+		t.Errorf("expected %s to be reused without a download, got %s after %v downloads", p, again, len(ranges))
+	}
+
+	// an interrupted download is resumed
+	err = os.Remove(p)
+	if err == nil {
+		err = ioutil.WriteFile(p+".part", want[:1000], 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = newFixture(t, withCache(dir)).Session
+	_, err = s.cachedOVA(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = ioutil.ReadFile(p)
+	if ranges[len(ranges)-1] != "bytes=1000-" || string(got) != string(want) {
+		t.Errorf("expected the download to resume at byte 1000, got range %q", ranges[len(ranges)-1])
+	}
+
+	// a checksum added later is checked against the cached OVA
+	s = newFixture(t, withCache(dir)).Session
+	s.Cache.Checksums[link] = sha256Hex(nil)
+	_, err = s.cachedOVA(link)
+	if err == nil || !strings.Contains(err.Error(), "SHA-256") || len(ranges) != 3 {
+		t.Errorf("expected the OVA to be downloaded again and not to match, got %v after %v downloads", err, len(ranges))
+	}
+	s = newFixture(t, withCache(dir)).Session
+	s.Cache.Checksums[link] = sha256Hex(want)
+	_, err = s.cachedOVA(link)
+	if err != nil || len(ranges) != 4 {
+		t.Fatalf("expected the OVA to be downloaded for its checksum, got %v after %v downloads", err, len(ranges))
+	}
+
+	// an OVA that matches its checksum is used when the server is gone
+	server.Close()
+	s = newFixture(t, withCache(dir)).Session
+	s.Cache.Checksums[link] = sha256Hex(want)
+	_, err = s.cachedOVA(link)
+	if err != nil {
+		t.Errorf("expected the OVA of the checksum to be used offline, got %v", err)
+	}
+	// a verified OVA without checksum is used with a warning when the server can not tell whether it is current
+	v = newFixture(t, withCache(dir))
+	s, events = v.Session, recorded(v)
+	offline, err := s.cachedOVA(link)
+	if err != nil || offline != p {
+		t.Errorf("expected the cached OVA to be used while the server is gone, got %s, %v", offline, err)
+	}
+	if len(events.events) != 1 || events.events[0].Level != progress.LevelWarn {
+		t.Errorf("expected a warning for the cached OVA, got %v", events.events)
+	}
+	s = newFixture(t, withCache(dir)).Session
+	s.Cache.Checksums[link] = sha256Hex(nil)
+	_, err = s.cachedOVA(link)
+	if err == nil {
+		t.Error("expected an OVA that does not match its checksum not to be used while the server is gone")
+	}
+}
+
+func TestCachedOVALargerPart(t *testing.T) {
+	delay := transferRetryDelay
+	transferRetryDelay = 0
+	defer func() { transferRetryDelay = delay }()
+	dir, err := ioutil.TempDir("", "cake-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ova := writeOVA(t, dir, "tiny.ova", "")
+	want, _ := ioutil.ReadFile(ova)
+	var ranges []string
+	server := ovaServer(t, ova, time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC), true, &ranges)
+	defer server.Close()
+	link := server.URL + "/tiny.ova"
+
+	// a partial download with more bytes than the OVA is not mistaken for a complete one
+	v := newFixture(t, withCache(dir))
+	s, events := v.Session, recorded(v)
+	digest := sha256.Sum256([]byte(link))
+	part := filepath.Join(s.Cache.Dir, hex.EncodeToString(digest[:])[:16], "tiny.ova.part")
+	err = os.MkdirAll(filepath.Dir(part), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(part, append(append([]byte{}, want...), "garbage"...), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.cachedOVA(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadFile(p)
+	if string(got) != string(want) || len(ranges) != 2 || ranges[1] != "" {
+		t.Errorf("expected the OVA to be downloaded again, got ranges %q", ranges)
+	}
+	var resumed bool
+	for _, e := range events.events {
+		resumed = resumed || strings.Contains(e.Msg, "does not match the size")
+	}
+	if !resumed {
+		t.Errorf("expected the oversized partial download to be reported, got %v", events.events)
+	}
+}
+
+func TestCachedOVAUnknownVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cake-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ova := writeOVA(t, dir, "tiny.ova", "")
+
+	// without Content-Length the modification time tells that the OVA is current
+	var ranges []string
+	modified := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	server := ovaServer(t, ova, modified, false, &ranges)
+	defer server.Close()
+	for x := 0; x < 2; x++ {
+		s := newFixture(t, withCache(dir)).Session
+		_, err = s.cachedOVA(server.URL + "/tiny.ova")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ranges) != 1 {
+		t.Errorf("expected the OVA to be downloaded once, got %v downloads", len(ranges))
+	}
+
+	// without Last-Modified it can not be told whether the OVA changed
+	ranges = nil
+	unknown := ovaServer(t, ova, time.Time{}, true, &ranges)
+	defer unknown.Close()
+	for x := 0; x < 2; x++ {
+		s := newFixture(t, withCache(dir)).Session
+		_, err = s.cachedOVA(unknown.URL + "/tiny.ova")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ranges) != 2 {
+		t.Errorf("expected the OVA to be downloaded on every run, got %v downloads", len(ranges))
+	}
+}
+
+func TestVerifyOVA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cake-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	v := newFixture(t, withCache(dir))
+	s, events := v.Session, recorded(v)
+
+	corrupt := writeOVA(t, dir, "corrupt.ova", fmt.Sprintf("SHA256(tiny.ovf)= %s\nSHA1(tiny-disk1.vmdk)= 0000\n", sha256Hex([]byte(tinyOVF))))
+	_, err = s.verifyOVA(corrupt, "")
+	if err == nil || !strings.Contains(err.Error(), "SHA1 of tiny-disk1.vmdk") {
+		t.Errorf("expected the disk not to match the manifest, got %v", err)
+	}
+	missing := writeOVA(t, dir, "missing.ova", "SHA256(tiny-disk2.vmdk)= 00\n")
+	_, err = s.verifyOVA(missing, "")
+	if err == nil || !strings.Contains(err.Error(), "tiny-disk2.vmdk") {
+		t.Errorf("expected the missing file to be reported, got %v", err)
+	}
+
+	b, _ := ioutil.ReadFile(corrupt)
+	sum, err := s.verifyOVA(corrupt, strings.ToUpper(sha256Hex(b)))
+	if err != nil || sum != sha256Hex(b) {
+		t.Errorf("expected the checksum to be used instead of the manifest, got %v and %s", err, sum)
+	}
+	_, err = s.verifyOVA(corrupt, sha256Hex(nil))
+	if err == nil || !strings.Contains(err.Error(), "SHA-256") {
+		t.Errorf("expected the checksum not to match, got %v", err)
+	}
+
+	unverified := writeOVA(t, dir, "unverified.ova", "")
+	sum, err = s.verifyOVA(unverified, "")
+	if err != nil || len(events.events) != 1 || !strings.Contains(events.events[0].Msg, "without being verified") {
+		t.Errorf("expected a warning for the OVA without a manifest, got %v and %v", err, events.events)
+	}
+	b, _ = ioutil.ReadFile(unverified)
+	if sum != sha256Hex(b) {
+		t.Errorf("expected the SHA-256 of the whole OVA, got %s", sum)
+	}
+}
+
+func TestRetryTransfer(t *testing.T) {
+	delay := transferRetryDelay
+	transferRetryDelay = 0
+	defer func() { transferRetryDelay = delay }()
+	dir, err := ioutil.TempDir("", "cake-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	v := newFixture(t, withCache(dir))
+	s, events := v.Session, recorded(v)
+
+	attempts := 0
+	err = s.retryTransfer("disk.vmdk", func() error {
+		attempts++
+		if attempts < transferAttempts {
+			return fmt.Errorf("connection reset")
+		}
+		return nil
+	})
+	if err != nil || attempts != transferAttempts || len(events.events) != transferAttempts-1 {
+		t.Errorf("expected the upload to succeed on the last attempt, got %v after %v attempts", err, attempts)
+	}
+	err = s.retryTransfer("disk.vmdk", func() error { return fmt.Errorf("connection reset") })
+	if err == nil {
+		t.Error("expected the upload to fail once every attempt failed")
+	}
+}
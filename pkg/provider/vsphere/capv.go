@@ -1,10 +1,9 @@
 package vsphere
 
 import (
+	"context"
 	"fmt"
 	"github.com/netapp/cake/pkg/progress"
-
-	"gopkg.in/yaml.v3"
 )
 
 // NewMgmtBootstrapCAPV is a new rke provider
@@ -15,12 +14,12 @@ func NewMgmtBootstrapCAPV(full *MgmtBootstrapCAPV) *MgmtBootstrapCAPV {
 }
 
 // Prepare bootstrap VM for capv deployment
-func (v *MgmtBootstrapCAPV) Prepare() error {
+func (v *MgmtBootstrapCAPV) Prepare(ctx context.Context) error {
 	err := v.createFolders()
 	if err != nil {
 		return err
 	}
-	configYAML, err := yaml.Marshal(v)
+	err = v.generateKey()
 	if err != nil {
 		return err
 	}
@@ -31,76 +30,87 @@ func (v *MgmtBootstrapCAPV) Prepare() error {
 	curl https://get.docker.com/ | bash`, capvClusterctlVersion, capvKindVersion)
 	v.Prerequisites = prereqs
 
-	return v.MgmtBootstrap.prepare(configYAML)
+	return v.MgmtBootstrap.prepare(ctx)
 }
 
 // Prepare the environment for bootstrapping
-func (v *MgmtBootstrap) prepare(configYAML []byte) error {
+func (v *MgmtBootstrap) prepare(ctx context.Context) error {
+	bootstrapSize := vmSize(v.VMSizes.Bootstrap)
+	err := v.checkSizes(bootstrapSize)
+	if err != nil {
+		return err
+	}
 	v.Session.Folder = v.TrackedResources.Folders[templatesFolder]
-	ovas, err := v.Session.DeployOVATemplates(v.OVA.BootstrapTemplate, v.OVA.NodeTemplate, v.OVA.LoadbalancerTemplate)
+	paths := []string{v.OVA.BootstrapTemplate, v.OVA.NodeTemplate, v.OVA.LoadbalancerTemplate}
+	if v.OVA.ContentLibrary.Name != "" {
+		// CAPV clones the machines of the management cluster from the node and load balancer templates by name, they
+		// are deployed from the content library as classic templates
+		ovas, err := v.Session.DeployLibraryTemplates(ctx, v.OVA.ContentLibrary, v.OVA.NodeTemplate, v.OVA.LoadbalancerTemplate)
+		v.TrackedResources.addTrackedTemplate(ovas)
+		v.tagTemplates(ovas)
+		if err != nil {
+			v.saveInventory(nil, bootstrapVMName)
+			return err
+		}
+		paths = paths[:1]
+	}
+	templates, err := v.deployTemplates(ctx, paths...)
+	v.saveInventory(nil, bootstrapVMName)
 	if err != nil {
 		return err
 	}
-	v.TrackedResources.addTrackedVM(ovas)
+	// the management cluster keeps cloning its machines from the node and load balancer templates
+	if v.CleanupTemplates && v.OVA.BootstrapTemplate != v.OVA.NodeTemplate && v.OVA.BootstrapTemplate != v.OVA.LoadbalancerTemplate {
+		v.TrackedResources.markBootstrap(v.OVA.BootstrapTemplate)
+	}
 	v.Session.Folder = v.TrackedResources.Folders[bootstrapFolder]
 
 	script := fmt.Sprintf(`#!/bin/bash
 
-# install socat, needed for TCP listeners
-wget -O /usr/local/bin/socat https://github.com/andrew-d/static-binaries/raw/master/binaries/linux/x86_64/socat
-chmod +x /usr/local/bin/socat
-
-# TCP listener for uploading cake binary
-%s
-
-# TCP listener for running cake binary
-%s
-
 # engine specific prereqs to run
 %s
-
-# write cake config file to disk
-cat <<EOF> %s
-%s
-EOF
-
-`, fmt.Sprintf(uploadFileCmd, uploadPort, remoteExecutable), fmt.Sprintf(runRemoteCmd, commandPort), v.Prerequisites, remoteConfig, configYAML)
-	bootstrapVM, err := v.Session.CloneTemplate(ovas[v.OVA.BootstrapTemplate], bootstrapVMName, script, v.SSH.AuthorizedKeys, v.SSH.Username)
+`, v.Prerequisites)
+	// the management cluster creates its own machines, only the bootstrap VM is cloned by cake
+	v.warnUnusedStaticIPs(bootstrapVMName)
+	err = v.reserveAddresses(bootstrapVMName)
+	if err != nil {
+		v.rollbackAddresses(bootstrapVMName)
+		v.saveInventory(nil, bootstrapVMName)
+		return err
+	}
+	// the reservation is recorded before cloning in case cake is interrupted
+	v.saveInventory(nil, bootstrapVMName)
+	bootstrapVM, err := v.Session.CloneTemplate(ctx, templates[v.OVA.BootstrapTemplate], bootstrapVMName, script, v.SSH.AuthorizedKeys, v.SSH.Username, v.vmNICs(bootstrapVMName, v.bootstrapNetwork(), v.Networks.Bootstrap), bootstrapSize)
 	if err != nil {
+		v.rollbackAddresses(bootstrapVMName)
+		v.saveInventory(nil, bootstrapVMName)
 		return err
 	}
 	v.TrackedResources.VMs[bootstrapVMName] = bootstrapVM
+	v.tag(bootstrapVM.Reference(), bootstrapVMName, roleBootstrap)
+	v.TrackedResources.markBootstrap(bootstrapVMName)
+	v.saveInventory(nil, bootstrapVMName)
 
 	return err
 }
 
 // Provision calls the process to create the management cluster for CAPV
-func (v *MgmtBootstrapCAPV) Provision() error {
-	bootstrapVMIP, err := GetVMIP(v.TrackedResources.VMs[bootstrapVMName])
+func (v *MgmtBootstrapCAPV) Provision(ctx context.Context) error {
+	bootstrapVMIP, err := v.vmIP(bootstrapVMName, v.TrackedResources.VMs[bootstrapVMName])
+	if err != nil {
+		return err
+	}
+	v.BootstrapperIP = bootstrapVMIP
+	err = v.pinHostKeys(bootstrapVMName, v.TrackedResources.VMs[bootstrapVMName])
 	if err != nil {
 		return err
 	}
+	v.saveInventory(map[string]string{bootstrapVMName: bootstrapVMIP}, bootstrapVMName)
 	v.EventStream.Publish(&progress.StatusEvent{
 		Type:  "progress",
 		Msg:   fmt.Sprintf("bootstrap VM IP: %v", bootstrapVMIP),
 		Level: "info",
 	})
 
-	configYAML, err := yaml.Marshal(v)
-	if err != nil {
-		return err
-	}
-	err = uploadFilesToBootstrap(bootstrapVMIP, string(configYAML))
-	if err != nil {
-		return err
-	}
-
-	cakeCmd := fmt.Sprintf(runLocalCakeCmd, remoteExecutable, string(v.EngineType), remoteConfigRoot)
-	tcp, err := newTCPConn(bootstrapVMIP + ":" + commandPort)
-	if err != nil {
-		return err
-	}
-	tcp.runAsyncCommand(cakeCmd)
-
-	return err
+	return v.startBootstrap(ctx, bootstrapVMName, bootstrapVMIP, v, "")
 }
@@ -0,0 +1,167 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/vmware/govmomi/object"
+)
+
+// bootstrapResource is a tracked object only needed while bootstrapping
+type bootstrapResource struct {
+	name   string
+	vm     *object.VirtualMachine
+	folder *object.Folder
+}
+
+func (r bootstrapResource) path() string {
+	if r.vm != nil {
+		return r.vm.InventoryPath
+	}
+	return r.folder.InventoryPath
+}
+
+// markBootstrap marks tracked VMs, templates or folders by name as only needed while bootstrapping
+func (tr *TrackedResources) markBootstrap(names ...string) {
+	for _, name := range names {
+		tr.Bootstrap[name] = true
+	}
+}
+
+// bootstrapResources returns the tracked objects marked as bootstrap-only in the order they can be removed,
+// VMs before templates before folders
+func (tr *TrackedResources) bootstrapResources() []bootstrapResource {
+	var vms, templates, folders []bootstrapResource
+	for _, name := range sortedKeys(tr.Bootstrap) {
+		if vm, ok := tr.VMs[name]; ok {
+			vms = append(vms, bootstrapResource{name: name, vm: vm})
+		}
+		if template, ok := tr.Templates[name]; ok {
+			templates = append(templates, bootstrapResource{name: name, vm: template})
+		}
+		if folder, ok := tr.Folders[name]; ok {
+			folders = append(folders, bootstrapResource{name: name, folder: folder})
+		}
+	}
+	// nested folders go before their parents
+	sort.SliceStable(folders, func(i, j int) bool {
+		return strings.Count(folders[i].path(), "/") > strings.Count(folders[j].path(), "/")
+	})
+	return append(append(vms, templates...), folders...)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cleanup removes the bootstrap-only resources as the Cleanup policy allows, resources left in place are
+// reported with the commands that remove them later
+func (v *MgmtBootstrap) cleanup(succeeded bool) error {
+	resources := v.TrackedResources.bootstrapResources()
+	if len(resources) == 0 {
+		return nil
+	}
+	policy, err := v.CleanupPolicy()
+	if err != nil {
+		v.reportLeftovers(resources, "the Cleanup policy is invalid")
+		return err
+	}
+	if !v.RemoveBootstrap(succeeded) {
+		v.reportLeftovers(resources, fmt.Sprintf("Cleanup is %s", policy))
+		return nil
+	}
+
+	var leftovers []bootstrapResource
+	var errs []string
+	for _, r := range resources {
+		removed, err := v.Session.removeBootstrapResource(r)
+		if err != nil {
+			leftovers = append(leftovers, r)
+			errs = append(errs, err.Error())
+			continue
+		}
+		if !removed {
+			continue
+		}
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("removed bootstrap resource %s", r.path()),
+			Level: "info",
+		})
+		if r.vm != nil {
+			err = v.releaseAddresses(r.name)
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		v.reportLeftovers(leftovers, "they could not be removed")
+		return fmt.Errorf("unable to remove all bootstrap resources, %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// reportLeftovers tells the user which bootstrap VMs and templates still exist and how to remove them, folders
+// are not reported since destroying one by hand destroys anything else put in it
+func (v *MgmtBootstrap) reportLeftovers(resources []bootstrapResource, reason string) {
+	var vms []bootstrapResource
+	for _, r := range resources {
+		if r.vm != nil {
+			vms = append(vms, r)
+		}
+	}
+	if len(vms) == 0 {
+		return
+	}
+	v.EventStream.Publish(&progress.StatusEvent{
+		Type:  "progress",
+		Msg:   fmt.Sprintf("bootstrap resources were left in place because %s, remove them once they are no longer needed", reason),
+		Level: progress.LevelWarn,
+	})
+	for _, r := range vms {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("left %s in place, remove it with: govc vm.destroy '%s'", r.path(), r.path()),
+			Level: progress.LevelWarn,
+		})
+	}
+}
+
+// removeBootstrapResource deletes a VM or template, a folder is only deleted when it is empty since
+// destroying a folder destroys everything in it
+func (s *Session) removeBootstrapResource(r bootstrapResource) (bool, error) {
+	if r.vm != nil {
+		return true, DeleteVM(r.vm)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	children, err := r.folder.Children(ctx)
+	if err != nil {
+		return false, fmt.Errorf("unable to list the contents of folder %s, %v", r.path(), err)
+	}
+	if len(children) > 0 {
+		return false, nil
+	}
+	task, err := s.DeleteVMFolder(r.folder)
+	if err != nil {
+		return false, fmt.Errorf("unable to delete folder %s, %v", r.path(), err)
+	}
+	if task == nil {
+		return false, nil
+	}
+	err = task.Wait(ctx)
+	if err != nil {
+		return false, fmt.Errorf("delete task for folder %s failed, %v", r.path(), err)
+	}
+	return true, nil
+}
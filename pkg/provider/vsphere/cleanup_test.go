@@ -0,0 +1,143 @@
+package vsphere
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/netapp/cake/pkg/ipam"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+type recordedEvents struct {
+	events []*progress.StatusEvent
+}
+
+func (r *recordedEvents) Publish(e *progress.StatusEvent) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recordedEvents) Subscribe(func(*progress.StatusEvent)) error { return nil }
+
+func TestCleanup(t *testing.T) {
+	vm, err := sim.conn.GetVM("DC0_C0_RP0_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bootstrap, err := sim.conn.CreateVMFolders("cleanup/bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := sim.conn.CreateVMFolders("cleanup/shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a folder marked bootstrap-only that something else was put in is left alone
+	other, err := sim.conn.GetVM("DC0_C0_RP0_VM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := shared["shared"].MoveInto(context.TODO(), []types.ManagedObjectReference{other.Reference()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = task.Wait(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := &recordedEvents{}
+	v := &MgmtBootstrap{Session: sim.conn}
+	v.EventStream = events
+	v.TrackedResources = TrackedResources{
+		Folders:   map[string]*object.Folder{"bootstrap": bootstrap["bootstrap"], "shared": shared["shared"]},
+		VMs:       map[string]*object.VirtualMachine{bootstrapVMName: vm},
+		Templates: map[string]*object.VirtualMachine{},
+		Bootstrap: map[string]bool{},
+		Addresses: map[string]*ipam.Address{bootstrapVMName: {Address: "10.0.0.11/24", Ref: "bootstrap"}},
+	}
+	addresses := &fakeIPAM{released: map[string]bool{}}
+	v.AddressManager = addresses
+	v.TrackedResources.markBootstrap(bootstrapVMName, "bootstrap", "shared")
+
+	// a failed deploy keeps the bootstrap VM and tells how to remove it
+	err = v.cleanup(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err := vmExists(vm)
+	if err != nil || !exists {
+		t.Fatalf("expected the bootstrap VM to be left in place, actual: %v, %v", exists, err)
+	}
+	var reported bool
+	for _, e := range events.events {
+		if e.Level == progress.LevelWarn && strings.Contains(e.Msg, "govc vm.destroy '"+vm.InventoryPath+"'") {
+			reported = true
+		}
+	}
+	if !reported {
+		t.Fatalf("expected the bootstrap VM to be reported, actual: %+v", events.events)
+	}
+	if addresses.released["bootstrap"] {
+		t.Fatal("expected the address of the bootstrap VM to stay reserved")
+	}
+
+	v.Cleanup = provider.CleanupOnSuccess
+	err = v.cleanup(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err = vmExists(vm)
+	if err != nil || exists {
+		t.Fatalf("expected the bootstrap VM to be removed, actual: %v, %v", exists, err)
+	}
+	if !addresses.released["bootstrap"] || len(v.TrackedResources.Addresses) != 0 {
+		t.Fatal("expected the address of the bootstrap VM to be released")
+	}
+	_, err = sim.conn.GetFolder("cleanup/bootstrap")
+	if err == nil {
+		t.Fatal("expected the empty bootstrap folder to be removed")
+	}
+	_, err = sim.conn.GetFolder("cleanup/shared")
+	if err != nil {
+		t.Fatalf("expected a folder that is not empty to be kept, %v", err)
+	}
+}
+
+func TestFinalizeReleasesAddresses(t *testing.T) {
+	vm, err := sim.conn.GetVM("DC0_H0_VM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses := &fakeIPAM{released: map[string]bool{}}
+	v := &MgmtBootstrap{Session: sim.conn, AddressManager: addresses}
+	v.EventStream = &recordedEvents{}
+	// Prepare reserved both addresses but only DC0_H0_VM1 still exists when Provision fails
+	v.TrackedResources = TrackedResources{
+		VMs:       map[string]*object.VirtualMachine{"DC0_H0_VM1": vm},
+		Bootstrap: map[string]bool{},
+		Addresses: map[string]*ipam.Address{
+			"DC0_H0_VM1":    {Address: "10.0.1.2/24", Ref: "DC0_H0_VM1"},
+			"mgmt-worker-1": {Address: "10.0.1.3/24", Ref: "mgmt-worker-1"},
+		},
+	}
+
+	// a failed deploy keeps everything for debugging by default, the deliverables of the test can not be downloaded
+	v.Finalize(context.Background(), false)
+	if len(addresses.released) != 0 {
+		t.Fatalf("expected the reservations to be kept, released: %v", addresses.released)
+	}
+
+	v.Cleanup = provider.CleanupAlways
+	v.Finalize(context.Background(), false)
+	if !addresses.released["mgmt-worker-1"] || addresses.released["DC0_H0_VM1"] {
+		t.Fatalf("expected only the reservation of the missing VM to be released, released: %v", addresses.released)
+	}
+	if _, ok := v.TrackedResources.Addresses["DC0_H0_VM1"]; !ok {
+		t.Fatal("expected the address of an existing VM to stay tracked")
+	}
+}
@@ -1,13 +1,21 @@
 package vsphere
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
+	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
+	"github.com/netapp/cake/pkg/ipam"
+	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/simulator"
+	_ "github.com/vmware/govmomi/vapi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
 )
 
 var sim struct {
@@ -57,6 +65,8 @@ func setupSimulator() error {
 	model.Service.TLS = &tls.Config{
 		RootCAs: roots,
 	}
+	// the vAPI endpoint serves the tagging service
+	model.Service.RegisterEndpoints = true
 	server := model.Service.NewServer()
 	username := server.URL.User.Username()
 	password, _ := server.URL.User.Password()
@@ -71,6 +81,115 @@ func setupSimulator() error {
 	return nil
 }
 
+// fixtureOption configures the bootstrap returned by newFixture
+type fixtureOption func(t *testing.T, v *MgmtBootstrap)
+
+// newFixture returns a bootstrap of the cluster mgmt on a copy of the simulator session that records its events,
+// opts are applied in order
+func newFixture(t *testing.T, opts ...fixtureOption) *MgmtBootstrap {
+	s := *sim.conn
+	v := &MgmtBootstrap{Session: &s}
+	v.ClusterName = "mgmt"
+	v.EventStream = &recordedEvents{}
+	v.TrackedResources.VMs = map[string]*object.VirtualMachine{}
+	v.TrackedResources.Rules = map[string]*object.ClusterComputeResource{}
+	v.TrackedResources.Addresses = map[string]*ipam.Address{}
+	for _, opt := range opts {
+		opt(t, v)
+	}
+	return v
+}
+
+// recorded returns the events published by a fixture
+func recorded(v *MgmtBootstrap) *recordedEvents {
+	return v.EventStream.(*recordedEvents)
+}
+
+// withClusterPool places VMs in the resource pool of the simulator cluster with its 3 hosts
+func withClusterPool() fixtureOption {
+	return func(t *testing.T, v *MgmtBootstrap) {
+		var err error
+		v.Session.ResourcePool, err = v.Session.GetResourcePool("/DC0/host/DC0_C0/Resources")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// withHostPool clones to a new resource pool of a single host with a memory limit in MB, -1 for none
+func withHostPool(limit int64) fixtureOption {
+	return func(t *testing.T, v *MgmtBootstrap) {
+		s := v.Session
+		parent, err := s.GetResourcePool("/DC0/host/DC0_H0/Resources")
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec := types.DefaultResourceConfigSpec()
+		spec.MemoryAllocation.Limit = &limit
+		s.ResourcePool, err = parent.Create(context.TODO(), t.Name(), spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Datastore, err = s.GetDatastore("/DC0/datastore/LocalDS_0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Network, err = s.GetNetwork("/DC0/network/VM Network")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Folder, err = s.GetFolder("/DC0/vm")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// withLogin logs in to the vAPI endpoint of the simulator that serves tags and content libraries
+func withLogin() fixtureOption {
+	return func(t *testing.T, v *MgmtBootstrap) {
+		password, _ := sim.server.URL.User.Password()
+		err := v.Session.LoginTags(sim.server.URL.User.Username(), password)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// withTags names the cluster what the bootstrap creates is tagged with and saves its inventory to a LogDir
+func withTags(cluster string) fixtureOption {
+	return func(t *testing.T, v *MgmtBootstrap) {
+		var err error
+		v.ClusterName = cluster
+		v.DeploymentID = newDeploymentID()
+		v.LogDir, err = ioutil.TempDir("", "cake-tags")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(v.LogDir) })
+	}
+}
+
+// withCache downloads OVAs to an empty cache in dir, the session publishes to the events of the fixture
+func withCache(dir string) fixtureOption {
+	return func(t *testing.T, v *MgmtBootstrap) {
+		v.Session.Events = v.EventStream
+		v.Session.Cache = &OVACache{Dir: filepath.Join(dir, "cache"), Checksums: map[string]string{}}
+	}
+}
+
+// withStaticIPs gives the VMs in nodes a static address on 10.0.0.0/24
+func withStaticIPs(nodes map[string]vsphereConfig.NodeNetwork) fixtureOption {
+	return func(t *testing.T, v *MgmtBootstrap) {
+		v.StaticIPs = &vsphereConfig.StaticIPs{
+			Gateway:       "10.0.0.1",
+			Nameservers:   []string{"10.0.0.2"},
+			SearchDomains: []string{"example.com"},
+			Nodes:         nodes,
+		}
+	}
+}
+
 func shutdown() {
 	sim.server.Close()
 }
@@ -4,14 +4,140 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"net"
 	"text/template"
 
 	"github.com/vmware/govmomi/vim25/types"
+	"gopkg.in/yaml.v3"
 )
 
 // MetadataValues for cloudinit
 type MetadataValues struct {
 	Hostname string
+	// Networks are rendered as the network config of the metadata in the order of the NICs, the template
+	// configures the network when there are none
+	Networks []NetworkConfig
+}
+
+// NetworkConfig is the address of a NIC of a node, a NIC without an Address uses DHCP
+type NetworkConfig struct {
+	// Address is IP/prefix
+	Address       string
+	Gateway       string
+	Nameservers   []string
+	SearchDomains []string
+	// MAC selects the NIC, it is required when a node has more than one
+	MAC string
+	MTU int
+	// Optional NICs are not waited on while booting
+	Optional bool
+}
+
+// netplan is the network config version 2 read by cloud-init, it is passed to netplan as is
+type netplan struct {
+	Network struct {
+		Version   int                        `yaml:"version"`
+		Ethernets map[string]netplanEthernet `yaml:"ethernets"`
+	} `yaml:"network"`
+}
+
+type netplanEthernet struct {
+	// the name of a NIC depends on the template, NICs are matched by MAC or any name when there is one
+	Match       map[string]string   `yaml:"match"`
+	DHCP4       bool                `yaml:"dhcp4"`
+	DHCP6       bool                `yaml:"dhcp6"`
+	Addresses   []string            `yaml:"addresses,omitempty"`
+	Gateway4    string              `yaml:"gateway4,omitempty"`
+	Gateway6    string              `yaml:"gateway6,omitempty"`
+	Nameservers *netplanNameservers `yaml:"nameservers,omitempty"`
+	MTU         int                 `yaml:"mtu,omitempty"`
+	Optional    bool                `yaml:"optional,omitempty"`
+}
+
+type netplanNameservers struct {
+	Addresses []string `yaml:"addresses,omitempty"`
+	Search    []string `yaml:"search,omitempty"`
+}
+
+// IP returns the address without its prefix
+func (n *NetworkConfig) IP() string {
+	ip, _, err := net.ParseCIDR(n.Address)
+	if err != nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// Validate checks the address, gateway and nameservers are IPs
+func (n *NetworkConfig) Validate() error {
+	if n.MTU != 0 && (n.MTU < 68 || n.MTU > 9000) {
+		return fmt.Errorf("MTU %v is not between 68 and 9000", n.MTU)
+	}
+	for _, ns := range n.Nameservers {
+		if net.ParseIP(ns) == nil {
+			return fmt.Errorf("nameserver %q is not an IP", ns)
+		}
+	}
+	if n.Address == "" {
+		if n.Gateway != "" {
+			return fmt.Errorf("gateway %s needs a static address", n.Gateway)
+		}
+		return nil
+	}
+	ip, network, err := net.ParseCIDR(n.Address)
+	if err != nil {
+		return fmt.Errorf("address %q is not IP/prefix, %v", n.Address, err)
+	}
+	if n.Gateway != "" {
+		gw := net.ParseIP(n.Gateway)
+		if gw == nil {
+			return fmt.Errorf("gateway %q is not an IP", n.Gateway)
+		}
+		if !network.Contains(gw) && !gw.IsLinkLocalUnicast() {
+			return fmt.Errorf("gateway %s is not in the network of %s", n.Gateway, n.Address)
+		}
+		if (gw.To4() == nil) != (ip.To4() == nil) {
+			return fmt.Errorf("gateway %s and address %s are not of the same IP version", n.Gateway, n.Address)
+		}
+	}
+	return nil
+}
+
+func (n *NetworkConfig) ethernet() netplanEthernet {
+	eth := netplanEthernet{
+		Match:    map[string]string{"name": "e*"},
+		DHCP4:    n.Address == "",
+		MTU:      n.MTU,
+		Optional: n.Optional,
+	}
+	if n.MAC != "" {
+		eth.Match = map[string]string{"macaddress": n.MAC}
+	}
+	if n.Address != "" {
+		eth.Addresses = []string{n.Address}
+	}
+	if n.Gateway != "" && net.ParseIP(n.Gateway).To4() != nil {
+		eth.Gateway4 = n.Gateway
+	} else if n.Gateway != "" {
+		eth.Gateway6 = n.Gateway
+	}
+	if len(n.Nameservers) > 0 || len(n.SearchDomains) > 0 {
+		eth.Nameservers = &netplanNameservers{Addresses: n.Nameservers, Search: n.SearchDomains}
+	}
+	return eth
+}
+
+func renderNetplan(networks []NetworkConfig) ([]byte, error) {
+	var config netplan
+	config.Network.Version = 2
+	config.Network.Ethernets = map[string]netplanEthernet{}
+	for x := range networks {
+		if len(networks) > 1 && networks[x].MAC == "" {
+			return nil, fmt.Errorf("NIC %v has no MAC address", x)
+		}
+		config.Network.Ethernets[fmt.Sprintf("id%v", x)] = networks[x].ethernet()
+	}
+	return yaml.Marshal(config)
 }
 
 // SetCloudInitMetadata sets the cloud init user data at the key
@@ -42,14 +168,22 @@ func GetMetadata(metadataValues *MetadataValues) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to template cloud init metadata, %v", err)
 	}
+	if len(metadataValues.Networks) > 0 {
+		network, err := renderNetplan(metadataValues.Networks)
+		if err != nil {
+			return nil, fmt.Errorf("unable to render cloud init network config, %v", err)
+		}
+		returnScript.Write(network)
+	}
 
 	return returnScript.Bytes(), nil
 }
 
-// GenerateMetaData creates the meta data
-func GenerateMetaData(hostname string) (Config, error) {
+// GenerateMetaData creates the meta data, networks are the NICs of the node in order or empty to keep the network config of the template
+func GenerateMetaData(hostname string, networks []NetworkConfig) (Config, error) {
 	metadataValues := &MetadataValues{
 		Hostname: hostname,
+		Networks: networks,
 	}
 
 	metadata, err := GetMetadata(metadataValues)
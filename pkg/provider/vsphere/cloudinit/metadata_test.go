@@ -0,0 +1,114 @@
+package cloudinit
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestGetMetadata(t *testing.T) {
+	out, err := GetMetadata(&MetadataValues{Hostname: "node1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dhcp map[string]interface{}
+	err = yaml.Unmarshal(out, &dhcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dhcp["local-hostname"] != "node1" || dhcp["network"] != nil {
+		t.Fatalf("expected only the hostname without a network config, actual:\n%s", out)
+	}
+
+	out, err = GetMetadata(&MetadataValues{
+		Hostname: "node1",
+		Networks: []NetworkConfig{{
+			Address:       "10.0.0.11/24",
+			Gateway:       "10.0.0.1",
+			Nameservers:   []string{"10.0.0.2", "10.0.0.3"},
+			SearchDomains: []string{"example.com"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var static netplan
+	err = yaml.Unmarshal(out, &static)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth := static.Network.Ethernets["id0"]
+	if !strings.Contains(string(out), `local-hostname: "node1"`) || static.Network.Version != 2 {
+		t.Fatalf("unexpected metadata:\n%s", out)
+	}
+	if eth.DHCP4 || len(eth.Addresses) != 1 || eth.Addresses[0] != "10.0.0.11/24" || eth.Gateway4 != "10.0.0.1" || eth.Gateway6 != "" {
+		t.Fatalf("unexpected network config:\n%s", out)
+	}
+	if eth.Nameservers == nil || len(eth.Nameservers.Addresses) != 2 || eth.Nameservers.Search[0] != "example.com" {
+		t.Fatalf("unexpected nameservers:\n%s", out)
+	}
+	if eth.Match["name"] != "e*" {
+		t.Fatalf("expected a single NIC to match any name:\n%s", out)
+	}
+}
+
+func TestGetMetadataNICs(t *testing.T) {
+	out, err := GetMetadata(&MetadataValues{
+		Hostname: "node1",
+		Networks: []NetworkConfig{
+			{MAC: "00:50:56:00:00:01"},
+			{Address: "10.1.0.11/24", MAC: "00:50:56:00:00:02", MTU: 9000, Optional: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config netplan
+	err = yaml.Unmarshal(out, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	management, storage := config.Network.Ethernets["id0"], config.Network.Ethernets["id1"]
+	if !management.DHCP4 || len(management.Addresses) != 0 || management.Match["macaddress"] != "00:50:56:00:00:01" || management.Optional {
+		t.Fatalf("unexpected management NIC:\n%s", out)
+	}
+	if storage.DHCP4 || storage.Addresses[0] != "10.1.0.11/24" || storage.Match["macaddress"] != "00:50:56:00:00:02" || storage.MTU != 9000 || !storage.Optional {
+		t.Fatalf("unexpected storage NIC:\n%s", out)
+	}
+
+	_, err = GetMetadata(&MetadataValues{Hostname: "node1", Networks: []NetworkConfig{{}, {}}})
+	if err == nil {
+		t.Fatal("expected an error for NICs that can not be told apart")
+	}
+}
+
+func TestNetworkConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  NetworkConfig
+		wantErr bool
+	}{
+		{"valid", NetworkConfig{Address: "10.0.0.11/24", Gateway: "10.0.0.1", Nameservers: []string{"8.8.8.8"}}, false},
+		{"no gateway", NetworkConfig{Address: "10.0.0.11/24"}, false},
+		{"ipv6", NetworkConfig{Address: "fd00::11/64", Gateway: "fe80::1"}, false},
+		{"no prefix", NetworkConfig{Address: "10.0.0.11", Gateway: "10.0.0.1"}, true},
+		{"gateway outside network", NetworkConfig{Address: "10.0.0.11/24", Gateway: "10.0.1.1"}, true},
+		{"invalid gateway", NetworkConfig{Address: "10.0.0.11/24", Gateway: "gateway"}, true},
+		{"invalid nameserver", NetworkConfig{Address: "10.0.0.11/24", Nameservers: []string{"dns.example.com"}}, true},
+		{"dhcp", NetworkConfig{MTU: 9000}, false},
+		{"dhcp with gateway", NetworkConfig{Gateway: "10.0.0.1"}, true},
+		{"mtu", NetworkConfig{Address: "10.0.0.11/24", MTU: 9001}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %v, actual: %v", tt.wantErr, err)
+			}
+		})
+	}
+	if ip := (&NetworkConfig{Address: "10.0.0.11/24"}).IP(); ip != "10.0.0.11" {
+		t.Fatalf("expected 10.0.0.11, actual: %s", ip)
+	}
+}
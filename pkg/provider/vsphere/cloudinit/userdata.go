@@ -18,7 +18,13 @@ users:
     sudo: ALL=(ALL) NOPASSWD:ALL
 {{if .SSHAuthorizedKeys}}    ssh_authorized_keys:{{range .SSHAuthorizedKeys}}
     - "{{.}}"{{end}}{{end}}
-
+{{if .HostKey}}
+ssh_deletekeys: true
+ssh_keys:
+  rsa_private: |
+{{Indent 4 .HostKey.Private}}
+  rsa_public: "{{.HostKey.Public}}"
+{{end}}
 write_files:
 -   path: /etc/hostname
     owner: root:root
@@ -43,9 +49,15 @@ write_files:
 
 runcmd:
   - [hostname, {{HostNameLookup}}]
-  - /tmp/netapp-boot.sh
+{{if .PublishHostKeys}}  - [sh, -c, 'vmware-rpctool "info-set {{HostKeysKey}} $(cat /etc/ssh/ssh_host_*_key.pub | base64 -w0)"']
+{{end}}  - /tmp/netapp-boot.sh
 `
 
+// HostKeysKey is the guestinfo variable a VM publishes the public ssh host keys cloud-init generated for it to, base64
+// encoded in authorized_keys format. Only public keys are exchanged through guestinfo, which anyone with read access
+// to the VM can see
+const HostKeysKey = "guestinfo.hostkeys"
+
 // Config for base options
 type Config []types.BaseOptionValue
 
@@ -54,6 +66,19 @@ type UserDataValues struct {
 	User              string
 	SSHAuthorizedKeys []string
 	BootScript        string
+	// HostKey replaces the ssh host keys of the machine, nil keeps the keys cloud-init generates. It is only for
+	// user data that stays on the hypervisor, like a NoCloud seed, never for guestinfo
+	HostKey *HostKey
+	// PublishHostKeys sets the public host keys at HostKeysKey through VMware Tools
+	PublishHostKeys bool
+}
+
+// HostKey is an RSA ssh host key generated by cake, the public key is pinned when connecting to the machine
+type HostKey struct {
+	// Private is the PEM encoded private key
+	Private string
+	// Public is the public key in authorized_keys format
+	Public string
 }
 
 // SetCloudInitUserData sets the cloud init user data at the key
@@ -103,16 +128,18 @@ func defaultFuncMap() template.FuncMap {
 		"Base64Encode":   templateBase64Encode,
 		"Indent":         templateYAMLIndent,
 		"HostNameLookup": func() string { return "{{ ds.meta_data.hostname }}" },
+		"HostKeysKey":    func() string { return HostKeysKey },
 	}
 }
 
-// GenerateUserData creates the user data
+// GenerateUserData creates the user data for guestinfo, the VM publishes its host keys at HostKeysKey
 func GenerateUserData(bootScript string, publicKey []string, osUser string) (Config, error) {
 	// Create user data
 	userdataValues := &UserDataValues{
 		User:              osUser,
 		SSHAuthorizedKeys: publicKey,
 		BootScript:        bootScript,
+		PublishHostKeys:   true,
 	}
 
 	userdata, err := GetUserData(userdataValues)
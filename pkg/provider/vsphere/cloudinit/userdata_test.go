@@ -0,0 +1,29 @@
+package cloudinit
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestGenerateUserData(t *testing.T) {
+	config, err := GenerateUserData("echo hello", []string{"ssh-rsa AAAA"}, "ubuntu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config) != 2 || config[0].GetOptionValue().Key != "guestinfo.userdata" {
+		t.Fatalf("expected the userdata and its encoding, actual: %+v", config)
+	}
+	out, err := base64.StdEncoding.DecodeString(config[0].GetOptionValue().Value.(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// guestinfo can be read by anyone with read access to the VM, the host keys are only published from it
+	if strings.Contains(string(out), "ssh_keys:") || strings.Contains(string(out), "PRIVATE KEY") {
+		t.Fatalf("expected no host keys in the userdata, actual:\n%s", out)
+	}
+	publish := strings.Index(string(out), "info-set "+HostKeysKey)
+	if publish < 0 || publish > strings.Index(string(out), "  - /tmp/netapp-boot.sh") {
+		t.Fatalf("expected the host keys to be published before the boot script, actual:\n%s", out)
+	}
+}
@@ -0,0 +1,314 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/config"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// taggedInventory lists the VMs, templates, folders and DRS rules of the cluster found by their tags, the tags of
+// every object are returned by inventory path
+func (v *MgmtBootstrap) taggedInventory() (*provider.Inventory, map[string][]string, error) {
+	inv := v.NewInventory()
+	tagged := map[string][]string{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cluster, _, err := v.Session.computeCluster()
+	if err != nil {
+		return nil, nil, err
+	}
+	if cluster != nil {
+		clusterConfig, err := cluster.Configuration(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to get the configuration of the compute cluster, %v", err)
+		}
+		rules := map[string]bool{
+			antiAffinityRuleName(v.ClusterName, config.ControlNode): true,
+			antiAffinityRuleName(v.ClusterName, config.WorkerNode):  true,
+		}
+		for _, rule := range clusterConfig.Rule {
+			if name := rule.GetClusterRuleInfo().Name; rules[name] {
+				inv.Rules = append(inv.Rules, name)
+			}
+		}
+	}
+
+	if v.Session.Tags == nil {
+		return inv, tagged, nil
+	}
+	objects, err := v.Session.taggedObjects(clusterTag(v.ClusterName))
+	if err != nil {
+		return nil, nil, err
+	}
+	var ipamKey int32 = -1
+	if fields, err := object.GetCustomFieldsManager(v.Session.Conn.Client); err == nil {
+		if key, err := fields.FindKey(ctx, attributeIPAMRef); err == nil {
+			ipamKey = key
+		}
+	}
+	finder := find.NewFinder(v.Session.Conn.Client, false)
+	for ref, names := range objects {
+		o, err := finder.ObjectReference(ctx, ref)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to find tagged object %s, %v", ref.Value, err)
+		}
+		switch o := o.(type) {
+		case *object.Folder:
+			inv.Folders = append(inv.Folders, o.InventoryPath)
+			tagged[o.InventoryPath] = names
+		case *object.VirtualMachine:
+			var vm mo.VirtualMachine
+			err = o.Properties(ctx, ref, []string{"config.template", "guest.ipAddress", "customValue"}, &vm)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to get virtual machine properties of %s, %v", o.InventoryPath, err)
+			}
+			tagged[o.InventoryPath] = names
+			if vm.Config != nil && vm.Config.Template {
+				inv.Templates = append(inv.Templates, o.InventoryPath)
+				continue
+			}
+			n := inv.Node(path.Base(o.InventoryPath))
+			n.VM = o.InventoryPath
+			if vm.Guest != nil {
+				n.Address = vm.Guest.IpAddress
+			}
+			for _, role := range names {
+				n.Bootstrap = n.Bootstrap || role == roleTag(roleBootstrap)
+			}
+			for _, value := range vm.CustomValue {
+				if s, ok := value.(*types.CustomFieldStringValue); ok && s.Key == ipamKey {
+					n.IPAMRef = s.Value
+				}
+			}
+			// templates and folders can be reused by a later deploy, the VMs are from the last one
+			if id, ok := tagValue(names, deploymentTag("")); ok {
+				inv.Deployment = id
+			}
+		}
+	}
+	sort.Strings(inv.Templates)
+	sort.Strings(inv.Folders)
+	return inv, tagged, nil
+}
+
+// mergeInventory adds what only local knows to inv, ie objects that could not be tagged
+func mergeInventory(inv *provider.Inventory, local *provider.Inventory) {
+	for _, n := range local.Nodes {
+		merged := inv.Node(n.Name)
+		if merged.VM == "" {
+			merged.VM = n.VM
+		}
+		if merged.Address == "" {
+			merged.Address = n.Address
+		}
+		if merged.IPAMRef == "" {
+			merged.IPAMRef = n.IPAMRef
+		}
+		merged.Bootstrap = merged.Bootstrap || n.Bootstrap
+	}
+	inv.Templates = union(inv.Templates, local.Templates)
+	inv.Folders = union(inv.Folders, local.Folders)
+	inv.Rules = union(inv.Rules, local.Rules)
+	if inv.Deployment == "" {
+		inv.Deployment = local.Deployment
+	}
+}
+
+// union returns the sorted items of a and b without duplicates
+func union(a []string, b []string) []string {
+	set := map[string]bool{}
+	for _, s := range append(append([]string{}, a...), b...) {
+		set[s] = true
+	}
+	return sortedKeys(set)
+}
+
+// otherClusters returns the clusters other than name tagged on an object
+func otherClusters(tags []string, name string) []string {
+	var others []string
+	for _, t := range tags {
+		if strings.HasPrefix(t, clusterTag("")) && t != clusterTag(name) {
+			others = append(others, strings.TrimPrefix(t, clusterTag("")))
+		}
+	}
+	return others
+}
+
+// RebuildInventory saves the inventory of the cluster found by its tags, for a deploy whose inventory.json was lost
+func (v *MgmtBootstrap) RebuildInventory() (*provider.Inventory, error) {
+	if v.Session.Tags == nil {
+		return nil, fmt.Errorf("the inventory can not be rebuilt without the vSphere tagging service")
+	}
+	inv, _, err := v.taggedInventory()
+	if err != nil {
+		return nil, err
+	}
+	err = v.SaveInventory(inv)
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Destroy removes the VMs, DRS rules and folders of the cluster found by their tags and in inventory.json and
+// releases the addresses reserved for its VMs. Templates are only removed with CleanupTemplates and when no other
+// cluster is tagged on them, folders only when they are empty
+func (v *MgmtBootstrap) Destroy() error {
+	inv, tagged, err := v.taggedInventory()
+	if err != nil {
+		return err
+	}
+	local, err := provider.LoadInventory(filepath.Join(v.LogDir, provider.InventoryFileName))
+	if err == nil {
+		mergeInventory(inv, local)
+	} else if !os.IsNotExist(err) {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   err.Error(),
+			Level: progress.LevelWarn,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	finder := find.NewFinder(v.Session.Conn.Client, false)
+	var errs []string
+	remove := func(p string, r bootstrapResource) bool {
+		removed, err := v.Session.removeBootstrapResource(r)
+		if err != nil {
+			errs = append(errs, err.Error())
+			return false
+		}
+		if removed {
+			v.EventStream.Publish(&progress.StatusEvent{
+				Type:  "progress",
+				Msg:   fmt.Sprintf("removed %s", p),
+				Level: "info",
+			})
+		}
+		return true
+	}
+
+	for _, n := range inv.Nodes {
+		if n.VM != "" {
+			vm, err := finder.VirtualMachine(ctx, n.VM)
+			if _, ok := err.(*find.NotFoundError); err != nil && !ok {
+				errs = append(errs, err.Error())
+				continue
+			}
+			// a VM that is still there keeps its address
+			if err == nil && !remove(n.VM, bootstrapResource{name: n.Name, vm: vm}) {
+				continue
+			}
+		}
+		if n.IPAMRef == "" || v.AddressManager == nil {
+			continue
+		}
+		err = v.AddressManager.Release(n.IPAMRef)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("released the address of %s", n.Name),
+			Level: "info",
+		})
+	}
+
+	if len(inv.Rules) > 0 {
+		cluster, _, err := v.Session.computeCluster()
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		for _, name := range inv.Rules {
+			if cluster != nil {
+				v.TrackedResources.Rules[name] = cluster
+			}
+		}
+		err = v.removeAntiAffinityRules()
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	var kept []string
+	for _, t := range inv.Templates {
+		if !v.CleanupTemplates || len(otherClusters(tagged[t], v.ClusterName)) > 0 {
+			kept = append(kept, t)
+			continue
+		}
+		vm, err := finder.VirtualMachine(ctx, t)
+		if err == nil {
+			remove(t, bootstrapResource{name: path.Base(t), vm: vm})
+		}
+	}
+	if len(kept) > 0 {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("templates %v are left in place since CleanupTemplates is not set or other clusters clone from them", kept),
+			Level: "info",
+		})
+	}
+
+	// nested folders go before their parents
+	folders := append([]string{}, inv.Folders...)
+	sort.SliceStable(folders, func(i, j int) bool {
+		return strings.Count(folders[i], "/") > strings.Count(folders[j], "/")
+	})
+	for _, f := range folders {
+		if len(otherClusters(tagged[f], v.ClusterName)) > 0 {
+			continue
+		}
+		folder, err := finder.Folder(ctx, f)
+		if err == nil {
+			remove(f, bootstrapResource{name: path.Base(f), folder: folder})
+		}
+	}
+
+	if v.Session.Tags != nil {
+		names := []string{clusterTag(v.ClusterName)}
+		if inv.Deployment != "" {
+			names = append(names, deploymentTag(inv.Deployment))
+		}
+		for _, tags := range tagged {
+			if id, ok := tagValue(tags, deploymentTag("")); ok {
+				names = append(names, deploymentTag(id))
+			}
+		}
+		for _, name := range union(names, nil) {
+			err = v.Session.deleteUnusedTag(name)
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to destroy cluster %s, %v", v.ClusterName, strings.Join(errs, "; "))
+	}
+	if len(kept) > 0 {
+		return nil
+	}
+	// nothing is left that the inventory could point to
+	err = os.Remove(filepath.Join(v.LogDir, provider.InventoryFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
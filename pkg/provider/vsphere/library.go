@@ -0,0 +1,362 @@
+package vsphere
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
+	"github.com/netapp/cake/pkg/metrics"
+	"github.com/netapp/cake/pkg/tracing"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/vapi/library"
+	"github.com/vmware/govmomi/vapi/vcenter"
+	"github.com/vmware/govmomi/vim25/soap"
+	"golang.org/x/sync/errgroup"
+)
+
+// isOVAPath tells whether a template entry is an OVA, other entries name a content library item
+func isOVAPath(templatePath string) bool {
+	return strings.HasSuffix(templatePath, ".ova")
+}
+
+// libraryItemName is the basename of the OVA and its version, a new OVA with the same filename gets a new item
+func libraryItemName(ovaPath string, version string) string {
+	return fmt.Sprintf("%s-%s", strings.TrimSuffix(path.Base(ovaPath), ".ova"), version)
+}
+
+// ovaVersion returns the short SHA-256 of the OVF descriptor and manifest of an OVA. The manifest has the checksums
+// of the disks, the whole OVA does not have to be read to tell two OVAs apart
+func (h *handler) ovaVersion(ovaPath string) (string, error) {
+	descriptor, err := h.readOvf("*.ovf", ovaPath)
+	if err != nil {
+		return "", fmt.Errorf("unable to read OVF file from %s, %v", ovaPath, err)
+	}
+	digest := sha256.New()
+	digest.Write(descriptor)
+	manifest, _, err := h.openOva("*.mf", ovaPath)
+	if err == nil {
+		defer manifest.Close()
+		_, err = io.Copy(digest, manifest)
+	}
+	if err != nil && err != os.ErrNotExist {
+		return "", fmt.Errorf("unable to read the manifest of %s, %v", ovaPath, err)
+	}
+	return hex.EncodeToString(digest.Sum(nil))[:12], nil
+}
+
+// contentLibrary returns the library of spec, it is created on the datastore when it does not exist and spec
+// publishes to it
+func (s *Session) contentLibrary(ctx context.Context, m *library.Manager, spec vsphereConfig.ContentLibrary) (*library.Library, error) {
+	ids, err := m.FindLibrary(ctx, library.Find{Name: spec.Name})
+	if err != nil {
+		return nil, fmt.Errorf("unable to find content library %s, %v", spec.Name, err)
+	}
+	if len(ids) == 0 && !spec.Publish {
+		return nil, fmt.Errorf("content library %s does not exist", spec.Name)
+	}
+	if len(ids) == 0 {
+		id, err := m.CreateLibrary(ctx, library.Library{
+			Name:        spec.Name,
+			Description: "OVAs published by cake",
+			Type:        "LOCAL",
+			Storage: []library.StorageBackings{{
+				DatastoreID: s.Datastore.Reference().Value,
+				Type:        "DATASTORE",
+			}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to create content library %s, %v", spec.Name, err)
+		}
+		ids = []string{id}
+	}
+	lib, err := m.GetLibraryByID(ctx, ids[0])
+	if err != nil {
+		return nil, fmt.Errorf("unable to get content library %s, %v", spec.Name, err)
+	}
+	return lib, nil
+}
+
+// DeployLibraryItems returns the items of the OVAs in the content library of spec keyed by template path, OVAs
+// the library has no item for are published when spec allows it
+func (s *Session) DeployLibraryItems(ctx context.Context, spec vsphereConfig.ContentLibrary, templatePaths ...string) (map[string]*library.Item, error) {
+	if s.REST == nil {
+		return nil, fmt.Errorf("content library %s can not be used without the vAPI endpoint", spec.Name)
+	}
+	m := library.NewManager(s.REST)
+	lib, err := s.contentLibrary(ctx, m, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	templatePaths = sliceDedup(templatePaths)
+	result := make(map[string]*library.Item, len(templatePaths))
+	resultMutex := sync.Mutex{}
+
+	var g errgroup.Group
+	for _, template := range templatePaths {
+		if template == "" {
+			continue
+		}
+		template := template
+		g.Go(func() error {
+			item, err := s.libraryItem(ctx, m, lib, template, spec.Publish)
+			if err != nil {
+				return err
+			}
+			resultMutex.Lock()
+			result[template] = item
+			resultMutex.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// libraryItem finds the item of a template entry in lib, an OVA is published as a new item when publish is set
+func (s *Session) libraryItem(ctx context.Context, m *library.Manager, lib *library.Library, templatePath string, publish bool) (*library.Item, error) {
+	h := &handler{session: s}
+	name := templatePath
+	if isOVAPath(templatePath) {
+		version, err := h.ovaVersion(templatePath)
+		if err != nil {
+			return nil, err
+		}
+		name = libraryItemName(templatePath, version)
+	}
+	ids, err := m.FindLibraryItems(ctx, library.FindItem{LibraryID: lib.ID, Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("unable to find item %s in content library %s, %v", name, lib.Name, err)
+	}
+	if len(ids) > 0 {
+		item, err := m.GetLibraryItem(ctx, ids[0])
+		if err != nil {
+			return nil, fmt.Errorf("unable to get item %s of content library %s, %v", name, lib.Name, err)
+		}
+		return item, nil
+	}
+	if !publish || !isOVAPath(templatePath) {
+		return nil, fmt.Errorf("content library %s has no item %s", lib.Name, name)
+	}
+
+	_, span := tracing.Start(ctx, metrics.TaskOVAImport)
+	span.SetAttribute("ova.path", templatePath)
+	start := time.Now()
+	item, err := h.publish(ctx, m, lib, name, templatePath)
+	metrics.ObserveTask(metrics.TaskOVAImport, start, err)
+	span.End(err)
+	if err != nil {
+		return nil, fmt.Errorf("unable to publish %s to content library %s, %v", templatePath, lib.Name, err)
+	}
+	return item, nil
+}
+
+// publish uploads the descriptor of an OVA and the files it references to a new OVF item name of lib, the item
+// is removed again when an upload fails
+func (h *handler) publish(ctx context.Context, m *library.Manager, lib *library.Library, name string, ovaPath string) (*library.Item, error) {
+	descriptor, err := h.readOvf("*.ovf", ovaPath)
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := ovf.Unmarshal(bytes.NewReader(descriptor))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the OVF descriptor, %v", err)
+	}
+
+	id, err := m.CreateLibraryItem(ctx, library.Item{
+		Name:        name,
+		Description: ovaPath,
+		Type:        library.ItemTypeOVF,
+		LibraryID:   lib.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create item %s, %v", name, err)
+	}
+	session, err := m.CreateLibraryItemUpdateSession(ctx, library.Session{LibraryItemID: id})
+	if err == nil {
+		files := []string{"*.ovf"}
+		for _, r := range envelope.References {
+			files = append(files, r.Href)
+		}
+		for _, f := range files {
+			err = h.uploadLibraryFile(ctx, m, session, f, ovaPath)
+			if err != nil {
+				_ = m.FailLibraryItemUpdateSession(ctx, session)
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = m.CompleteLibraryItemUpdateSession(ctx, session)
+	}
+	if err != nil {
+		_ = m.DeleteLibraryItem(ctx, &library.Item{ID: id})
+		return nil, err
+	}
+	return m.GetLibraryItem(ctx, id)
+}
+
+// uploadLibraryFile pushes the file name of an OVA to the update session of an item
+func (h *handler) uploadLibraryFile(ctx context.Context, m *library.Manager, session string, name string, ovaPath string) error {
+	f, size, err := h.openOva(name, ovaPath)
+	if err != nil {
+		return fmt.Errorf("unable to open %s in OVA, %v", name, err)
+	}
+	defer f.Close()
+	if e, ok := f.(*tapeArchiveEntry); ok {
+		name = e.name
+	}
+
+	update, err := m.AddLibraryItemFile(ctx, session, library.UpdateFile{
+		Name:       name,
+		SourceType: "PUSH",
+		Size:       size,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to add %s to the item, %v", name, err)
+	}
+	u, err := url.Parse(update.UploadEndpoint.URI)
+	if err != nil {
+		return fmt.Errorf("unable to parse the upload endpoint of %s, %v", name, err)
+	}
+
+	return h.session.retryTransfer(name, func() error {
+		f, size, err := h.openOva(name, ovaPath)
+		if err != nil {
+			return fmt.Errorf("unable to open %s in OVA, %v", name, err)
+		}
+		defer f.Close()
+		opts := soap.DefaultUpload
+		opts.Headers = map[string]string{"vmware-api-session-id": session}
+		opts.ContentLength = size
+		p := h.session.newTransferProgress("uploading", name, 0, size)
+		err = h.session.Conn.Client.Upload(ctx, io.TeeReader(f, p), u, &opts)
+		if err != nil {
+			return fmt.Errorf("unable to upload %s, %v", name, err)
+		}
+		return nil
+	})
+}
+
+// deployLibraryItem creates a powered off VM name from an OVF item in the folder, resource pool and datastore of the
+// session. The networks of the OVF are mapped to the management network, the NICs are replaced like for a clone
+func (s *Session) deployLibraryItem(ctx context.Context, item *library.Item, name string) (*object.VirtualMachine, error) {
+	m := vcenter.NewManager(s.REST)
+	target := vcenter.Target{
+		ResourcePoolID: s.ResourcePool.Reference().Value,
+		FolderID:       s.Folder.Reference().Value,
+	}
+	filter, err := m.FilterLibraryItem(ctx, item.ID, vcenter.FilterRequest{Target: target})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the networks of library item %s, %v", item.Name, err)
+	}
+	var networks []vcenter.NetworkMapping
+	for _, n := range filter.Networks {
+		networks = append(networks, vcenter.NetworkMapping{Key: n, Value: s.Network.Reference().Value})
+	}
+	deploy := vcenter.Deploy{
+		DeploymentSpec: vcenter.DeploymentSpec{
+			Name:                name,
+			AcceptAllEULA:       true,
+			NetworkMappings:     networks,
+			StorageProvisioning: "thin",
+			DefaultDatastoreID:  s.Datastore.Reference().Value,
+		},
+		Target: target,
+	}
+
+	_, span := tracing.Start(ctx, metrics.TaskLibraryDeploy)
+	span.SetAttribute("vm.name", name)
+	start := time.Now()
+	ref, err := m.DeployLibraryItem(ctx, item.ID, deploy)
+	metrics.ObserveTask(metrics.TaskLibraryDeploy, start, err)
+	span.End(err)
+	if err != nil {
+		return nil, fmt.Errorf("unable to deploy library item %s, %v", item.Name, err)
+	}
+	return object.NewVirtualMachine(s.Conn.Client, *ref), nil
+}
+
+// DeployLibraryTemplates returns classic templates of the OVAs keyed by template path for consumers that clone
+// templates by name, like CAPV. They are deployed from the items of the content library of spec into the folder of
+// the session and named after the OVA, a template with the name that already exists is reused
+func (s *Session) DeployLibraryTemplates(ctx context.Context, spec vsphereConfig.ContentLibrary, templatePaths ...string) (map[string]*object.VirtualMachine, error) {
+	finder := find.NewFinder(s.Conn.Client, true)
+	finder.SetDatacenter(s.Datacenter)
+	result := make(map[string]*object.VirtualMachine)
+	var missing []string
+	for _, p := range sliceDedup(templatePaths) {
+		if p == "" {
+			continue
+		}
+		vm, err := finder.VirtualMachine(ctx, templateName(p))
+		if err == nil {
+			result[p] = vm
+			continue
+		}
+		missing = append(missing, p)
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+	items, err := s.DeployLibraryItems(ctx, spec, missing...)
+	if err != nil {
+		return result, err
+	}
+	for _, p := range missing {
+		vm, err := s.deployLibraryItem(ctx, items[p], templateName(p))
+		if err != nil {
+			return result, err
+		}
+		// the NICs are added when the template is cloned
+		err = removeNICs(ctx, vm)
+		if err == nil {
+			err = vm.MarkAsTemplate(ctx)
+		}
+		if err != nil {
+			_ = DeleteVM(vm)
+			return result, fmt.Errorf("unable to make library item %s a template, %v", items[p].Name, err)
+		}
+		result[p] = vm
+	}
+	return result, nil
+}
+
+// templateName is the name of the classic template of a template path, the basename without the .ova extension
+func templateName(templatePath string) string {
+	return strings.TrimSuffix(path.Base(templatePath), ".ova")
+}
+
+// deployTemplates returns the templates of the OVAs keyed by template path. They are items of the content library
+// when one is set, otherwise the OVAs are imported as classic templates that are tracked and tagged
+func (v *MgmtBootstrap) deployTemplates(ctx context.Context, templatePaths ...string) (map[string]Template, error) {
+	templates := make(map[string]Template)
+	if v.OVA.ContentLibrary.Name != "" {
+		items, err := v.Session.DeployLibraryItems(ctx, v.OVA.ContentLibrary, templatePaths...)
+		for p, item := range items {
+			templates[p] = Template{Item: item}
+		}
+		return templates, err
+	}
+	ovas, err := v.Session.DeployOVATemplates(ctx, templatePaths...)
+	v.TrackedResources.addTrackedTemplate(ovas)
+	v.tagTemplates(ovas)
+	for p, vm := range ovas {
+		templates[p] = Template{VM: vm}
+	}
+	return templates, err
+}
@@ -0,0 +1,228 @@
+package vsphere
+
+import (
+	"archive/tar"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
+	"github.com/netapp/cake/pkg/provider/vsphere/cloudinit"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/library"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const tinyOVF = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData">
+  <References>
+    <File ovf:href="tiny-disk1.vmdk" ovf:id="file1"/>
+  </References>
+  <VirtualSystem ovf:id="tiny">
+    <Info>A tiny VM</Info>
+    <Name>tiny</Name>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemType>vmx-13</vssd:VirtualSystemType>
+      </System>
+      <Item>
+        <rasd:AllocationUnits>hertz * 10^6</rasd:AllocationUnits>
+        <rasd:ElementName>1 virtual CPU(s)</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>1</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AllocationUnits>byte * 2^20</rasd:AllocationUnits>
+        <rasd:ElementName>512MB of memory</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceType>4</rasd:ResourceType>
+        <rasd:VirtualQuantity>512</rasd:VirtualQuantity>
+      </Item>
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>
+`
+
+// writeOVA creates an OVA of the tiny OVF in dir, manifest is the content of its .mf
+func writeOVA(t *testing.T, dir string, name string, manifest string) string {
+	p := filepath.Join(dir, name)
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := tar.NewWriter(f)
+	files := []struct{ name, content string }{
+		{"tiny.ovf", tinyOVF},
+		{"tiny.mf", manifest},
+		{"tiny-disk1.vmdk", "disk"},
+	}
+	for _, file := range files {
+		err = w.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content))})
+		if err == nil {
+			_, err = w.Write([]byte(file.content))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestDeployLibraryItems(t *testing.T) {
+	s := newFixture(t, withHostPool(-1), withLogin()).Session
+	dir, err := ioutil.TempDir("", "cake-library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ova := writeOVA(t, dir, "tiny.ova", "SHA256(tiny-disk1.vmdk)= 01")
+
+	_, err = s.DeployLibraryItems(context.Background(), vsphereConfig.ContentLibrary{Name: "cake"}, ova)
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected the missing library not to be created without Publish, got %v", err)
+	}
+
+	spec := vsphereConfig.ContentLibrary{Name: "cake", Publish: true}
+	items, err := s.DeployLibraryItems(context.Background(), spec, ova)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := items[ova]
+	if item == nil || !strings.HasPrefix(item.Name, "tiny-") || item.Type != library.ItemTypeOVF {
+		t.Fatalf("expected an OVF item named after the OVA, got %+v", item)
+	}
+
+	// the same OVA is found in the library, also without Publish
+	spec.Publish = false
+	again, err := s.DeployLibraryItems(context.Background(), spec, ova)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[ova].ID != item.ID {
+		t.Errorf("expected item %s to be reused, got %s", item.ID, again[ova].ID)
+	}
+	named, err := s.DeployLibraryItems(context.Background(), spec, item.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if named[item.Name].ID != item.ID {
+		t.Errorf("expected item %s by name, got %s", item.ID, named[item.Name].ID)
+	}
+
+	// an updated OVA with the same filename gets a new item
+	updated := writeOVA(t, dir, "tiny.ova", "SHA256(tiny-disk1.vmdk)= 02")
+	_, err = s.DeployLibraryItems(context.Background(), spec, updated)
+	if err == nil || !strings.Contains(err.Error(), "has no item") {
+		t.Errorf("expected the updated OVA to be missing without Publish, got %v", err)
+	}
+	spec.Publish = true
+	newer, err := s.DeployLibraryItems(context.Background(), spec, updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newer[updated].ID == item.ID || newer[updated].Name == item.Name {
+		t.Errorf("expected a new item for the updated OVA, got %+v", newer[updated])
+	}
+}
+
+func TestCloneTemplateLibraryItem(t *testing.T) {
+	s := newFixture(t, withHostPool(-1), withLogin()).Session
+	dir, err := ioutil.TempDir("", "cake-library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ova := writeOVA(t, dir, "node.ova", "SHA256(tiny-disk1.vmdk)= 03")
+	items, err := s.DeployLibraryItems(context.Background(), vsphereConfig.ContentLibrary{Name: "cake-nodes", Publish: true}, ova)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nics := []NIC{{Network: s.Network, Config: &cloudinit.NetworkConfig{Address: "10.0.0.12/24", Gateway: "10.0.0.1"}}}
+	size := vsphereConfig.VMSize{VCPUs: 2, MemoryMB: 1024}
+	vm, err := s.CloneTemplate(context.Background(), Template{Item: items[ova]}, "deployed", "#!/bin/bash", nil, "ubuntu", nics, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteVM(vm)
+
+	props, err := getProperties(vm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOn {
+		t.Errorf("expected the VM to be powered on, got %v", props.Runtime.PowerState)
+	}
+	if props.Config.Hardware.NumCPU != 2 || props.Config.Hardware.MemoryMB != 1024 {
+		t.Errorf("expected the VM to be sized, got %v CPUs and %v MB", props.Config.Hardware.NumCPU, props.Config.Hardware.MemoryMB)
+	}
+	devices, err := vm.Device(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cards := devices.SelectByType((*types.VirtualEthernetCard)(nil)); len(cards) != 1 {
+		t.Errorf("expected 1 NIC, got %v", len(cards))
+	}
+	var metadata bool
+	for _, o := range props.Config.ExtraConfig {
+		if o.GetOptionValue().Key == "guestinfo.metadata" {
+			metadata = true
+		}
+	}
+	if !metadata {
+		t.Error("expected the cloud-init metadata in the extra config")
+	}
+}
+
+func TestDeployLibraryTemplates(t *testing.T) {
+	s := newFixture(t, withHostPool(-1), withLogin()).Session
+	dir, err := ioutil.TempDir("", "cake-library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ova := writeOVA(t, dir, "capv-node.ova", "SHA256(tiny-disk1.vmdk)= 04")
+	spec := vsphereConfig.ContentLibrary{Name: "cake-capv", Publish: true}
+
+	templates, err := s.DeployLibraryTemplates(context.Background(), spec, ova)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := templates[ova]
+	if len(templates) != 1 || template == nil {
+		t.Fatalf("expected a template for %s, got %+v", ova, templates)
+	}
+	defer DeleteVM(template)
+	props, err := getProperties(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props.Name != "capv-node" || !props.Config.Template {
+		t.Errorf("expected the template capv-node, got %v, template: %v", props.Name, props.Config.Template)
+	}
+	devices := object.VirtualDeviceList(props.Config.Hardware.Device)
+	if cards := devices.SelectByType((*types.VirtualEthernetCard)(nil)); len(cards) != 0 {
+		t.Errorf("expected the NICs to be removed, got %v", len(cards))
+	}
+
+	// CAPV finds the template by name, it is only deployed once
+	again, err := s.DeployLibraryTemplates(context.Background(), spec, ova)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[ova] == nil || again[ova].Reference() != template.Reference() {
+		t.Errorf("expected the template to be reused, got %+v", again)
+	}
+}
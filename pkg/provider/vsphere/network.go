@@ -0,0 +1,301 @@
+package vsphere
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider/vsphere/cloudinit"
+	"github.com/vmware/govmomi/object"
+)
+
+// staticNetwork returns the static address of the VM name with the defaults of StaticIPs applied, nil when the VM uses DHCP
+func (v *MgmtBootstrap) staticNetwork(name string) *cloudinit.NetworkConfig {
+	if v.StaticIPs == nil {
+		return nil
+	}
+	n, ok := v.StaticIPs.Nodes[name]
+	if !ok {
+		return nil
+	}
+	c := &cloudinit.NetworkConfig{
+		Address:       n.Address,
+		Gateway:       n.Gateway,
+		Nameservers:   n.Nameservers,
+		SearchDomains: n.SearchDomains,
+	}
+	if c.Gateway == "" {
+		c.Gateway = v.StaticIPs.Gateway
+	}
+	if len(c.Nameservers) == 0 {
+		c.Nameservers = v.StaticIPs.Nameservers
+	}
+	if len(c.SearchDomains) == 0 {
+		c.SearchDomains = v.StaticIPs.SearchDomains
+	}
+	return c
+}
+
+// validateStaticIPs checks every static address before anything is created, an address can only be used once
+func (v *MgmtBootstrap) validateStaticIPs() error {
+	if v.StaticIPs == nil {
+		return nil
+	}
+	var names []string
+	for name := range v.StaticIPs.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	used := map[string]string{}
+	for _, name := range names {
+		c := v.staticNetwork(name)
+		err := c.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid static IP for %s, %v", name, err)
+		}
+		if other, ok := used[c.IP()]; ok {
+			return fmt.Errorf("%s and %s have the same static IP %s", other, name, c.IP())
+		}
+		used[c.IP()] = name
+	}
+	return nil
+}
+
+// warnUnusedStaticIPs reports static addresses for VMs that are not created, names are the VMs cloned by cake
+func (v *MgmtBootstrap) warnUnusedStaticIPs(names ...string) {
+	if v.StaticIPs == nil {
+		return
+	}
+	cloned := map[string]bool{}
+	for _, name := range names {
+		cloned[name] = true
+	}
+	var unused []string
+	for name := range v.StaticIPs.Nodes {
+		if !cloned[name] {
+			unused = append(unused, name)
+		}
+	}
+	if len(unused) == 0 {
+		return
+	}
+	sort.Strings(unused)
+	v.EventStream.Publish(&progress.StatusEvent{
+		Type:  "progress",
+		Msg:   fmt.Sprintf("static IPs for %v are not used, the VMs cake creates are %v", unused, names),
+		Level: progress.LevelWarn,
+	})
+}
+
+// nodeNetwork returns the static or reserved address of the VM name, nil when the VM uses DHCP
+func (v *MgmtBootstrap) nodeNetwork(name string) *cloudinit.NetworkConfig {
+	if c := v.staticNetwork(name); c != nil {
+		return c
+	}
+	a, ok := v.TrackedResources.Addresses[name]
+	if !ok {
+		return nil
+	}
+	return &cloudinit.NetworkConfig{
+		Address:       a.Address,
+		Gateway:       a.Gateway,
+		Nameservers:   a.Nameservers,
+		SearchDomains: a.SearchDomains,
+	}
+}
+
+// reserveAddresses reserves an address from the IPAM for every VM in names that has no static or reserved one yet.
+// Reservations are tracked as soon as they are made so a failed deploy can release them
+func (v *MgmtBootstrap) reserveAddresses(names ...string) error {
+	if v.AddressManager == nil {
+		return nil
+	}
+	for _, name := range names {
+		if v.nodeNetwork(name) != nil {
+			continue
+		}
+		a, err := v.AddressManager.Allocate(name)
+		if err != nil {
+			return err
+		}
+		v.TrackedResources.Addresses[name] = a
+		err = v.nodeNetwork(name).Validate()
+		if err != nil {
+			return fmt.Errorf("IPAM reserved an unusable address for %s, %v", name, err)
+		}
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("reserved %s for %s", a.Address, name),
+			Level: "info",
+		})
+	}
+	return nil
+}
+
+// releaseAddresses frees the reserved addresses of the VMs in names, a reservation that could not be released
+// stays tracked and is listed in the inventory
+func (v *MgmtBootstrap) releaseAddresses(names ...string) error {
+	var errs []string
+	for _, name := range names {
+		a, ok := v.TrackedResources.Addresses[name]
+		if !ok {
+			continue
+		}
+		err := v.AddressManager.Release(a.Ref)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		delete(v.TrackedResources.Addresses, name)
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("released %s of %s", a.Address, name),
+			Level: "info",
+		})
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to release reserved addresses, %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// rollbackAddresses releases the reserved addresses of the VMs in names that were not cloned, a VM that exists
+// keeps its address since it is configured with it
+func (v *MgmtBootstrap) rollbackAddresses(names ...string) {
+	var unused []string
+	for _, name := range names {
+		if _, ok := v.TrackedResources.Addresses[name]; !ok {
+			continue
+		}
+		if _, err := v.Session.GetVM(name); err == nil {
+			continue
+		}
+		unused = append(unused, name)
+	}
+	err := v.releaseAddresses(unused...)
+	if err != nil {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   err.Error(),
+			Level: progress.LevelWarn,
+		})
+	}
+}
+
+// reservedNames returns the names of the VMs with a reserved address
+func (tr *TrackedResources) reservedNames() []string {
+	var names []string
+	for name := range tr.Addresses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// vmIP returns the static or reserved address of the VM, VMs using DHCP are waited on until VMware Tools reports their address
+func (v *MgmtBootstrap) vmIP(name string, vm *object.VirtualMachine) (string, error) {
+	if c := v.nodeNetwork(name); c != nil {
+		return c.IP(), nil
+	}
+	return GetVMIP(vm)
+}
+
+// roleNetworks are the additional networks of every role, in the order they are validated
+func (v *MgmtBootstrap) roleNetworks() map[string][]vsphereConfig.VMNetwork {
+	return map[string][]vsphereConfig.VMNetwork{
+		"Bootstrap":    v.Networks.Bootstrap,
+		"ControlPlane": v.Networks.ControlPlane,
+		"Worker":       v.Networks.Worker,
+	}
+}
+
+// validateNetworks checks the additional networks before anything is created, an address can only be used once
+// across them and the static IPs
+func (v *MgmtBootstrap) validateNetworks() error {
+	used := map[string]string{}
+	if v.StaticIPs != nil {
+		for name := range v.StaticIPs.Nodes {
+			used[v.staticNetwork(name).IP()] = name
+		}
+	}
+	roles := v.roleNetworks()
+	for _, role := range []string{"Bootstrap", "ControlPlane", "Worker"} {
+		attached := map[string]bool{}
+		for _, n := range roles[role] {
+			if n.Name == "" {
+				return fmt.Errorf("invalid Networks.%s, a network has no name", role)
+			}
+			if attached[n.Name] {
+				return fmt.Errorf("invalid Networks.%s, %s is attached twice", role, n.Name)
+			}
+			attached[n.Name] = true
+			err := (&cloudinit.NetworkConfig{MTU: n.MTU}).Validate()
+			if err != nil {
+				return fmt.Errorf("invalid Networks.%s %s, %v", role, n.Name, err)
+			}
+			var names []string
+			for name := range n.Addresses {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				c := &cloudinit.NetworkConfig{Address: n.Addresses[name]}
+				err := c.Validate()
+				if err == nil && c.Address == "" {
+					err = fmt.Errorf("address is empty")
+				}
+				if err != nil {
+					return fmt.Errorf("invalid Networks.%s %s address for %s, %v", role, n.Name, name, err)
+				}
+				if other, ok := used[c.IP()]; ok {
+					return fmt.Errorf("%s and %s on %s have the same IP %s", other, name, n.Name, c.IP())
+				}
+				used[c.IP()] = name
+			}
+		}
+	}
+	return nil
+}
+
+// bootstrapNetwork is the network of the CAPV BootstrapVM
+func (v *MgmtBootstrap) bootstrapNetwork() string {
+	if v.BootstrapNetwork != "" {
+		return v.BootstrapNetwork
+	}
+	return v.ManagementNetwork
+}
+
+// networkNames are the vSphere networks the VMs cake clones are attached to
+func (v *MgmtBootstrap) networkNames() []string {
+	names := []string{v.ManagementNetwork, v.bootstrapNetwork()}
+	roles := v.roleNetworks()
+	for _, role := range []string{"Bootstrap", "ControlPlane", "Worker"} {
+		for _, n := range roles[role] {
+			names = append(names, n.Name)
+		}
+	}
+	return names
+}
+
+// vmNICs returns the NICs of the VM name, the first is attached to primary with the static or reserved address of
+// the VM and the additional networks follow by Order. Only the first NIC gets a default route
+func (v *MgmtBootstrap) vmNICs(name string, primary string, networks []vsphereConfig.VMNetwork) []NIC {
+	nics := []NIC{{Network: v.Session.Networks[primary], Config: v.nodeNetwork(name)}}
+	ordered := append([]vsphereConfig.VMNetwork{}, networks...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Order < ordered[j].Order
+	})
+	for _, n := range ordered {
+		nics = append(nics, NIC{
+			Network: v.Session.Networks[n.Name],
+			Config: &cloudinit.NetworkConfig{
+				Address:  n.Addresses[name],
+				MTU:      n.MTU,
+				Optional: true,
+			},
+		})
+	}
+	return nics
+}
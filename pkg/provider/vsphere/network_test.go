@@ -0,0 +1,288 @@
+package vsphere
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
+	"github.com/netapp/cake/pkg/ipam"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider/vsphere/cloudinit"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// fakeIPAM hands out 10.0.1.x addresses, names in fail can not get one
+type fakeIPAM struct {
+	next     int
+	fail     map[string]bool
+	released map[string]bool
+}
+
+func (f *fakeIPAM) Allocate(name string) (*ipam.Address, error) {
+	if f.fail[name] {
+		return nil, fmt.Errorf("no address left for %s", name)
+	}
+	f.next++
+	return &ipam.Address{
+		Address: fmt.Sprintf("10.0.1.%v/24", f.next),
+		Gateway: "10.0.1.1",
+		Ref:     name,
+	}, nil
+}
+
+func (f *fakeIPAM) Release(ref string) error {
+	f.released[ref] = true
+	return nil
+}
+
+func TestStaticNetwork(t *testing.T) {
+	v := newFixture(t, withStaticIPs(map[string]vsphereConfig.NodeNetwork{
+		"mgmt-controlplane-1": {Address: "10.0.0.11/24"},
+		"mgmt-worker-1":       {Address: "10.0.1.11/24", Gateway: "10.0.1.1", Nameservers: []string{"10.0.1.2"}, SearchDomains: []string{"workers.example.com"}},
+	}))
+
+	got := v.staticNetwork("mgmt-controlplane-1")
+	want := &cloudinit.NetworkConfig{Address: "10.0.0.11/24", Gateway: "10.0.0.1", Nameservers: []string{"10.0.0.2"}, SearchDomains: []string{"example.com"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("defaults not applied, got %+v, want %+v", got, want)
+	}
+	got = v.staticNetwork("mgmt-worker-1")
+	want = &cloudinit.NetworkConfig{Address: "10.0.1.11/24", Gateway: "10.0.1.1", Nameservers: []string{"10.0.1.2"}, SearchDomains: []string{"workers.example.com"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("node settings not kept, got %+v, want %+v", got, want)
+	}
+	if got := v.staticNetwork("mgmt-worker-2"); got != nil {
+		t.Errorf("a VM without a static IP should use DHCP, got %+v", got)
+	}
+	if got := (&MgmtBootstrap{}).staticNetwork(bootstrapVMName); got != nil {
+		t.Errorf("no StaticIPs should use DHCP, got %+v", got)
+	}
+}
+
+func TestValidateStaticIPs(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   map[string]vsphereConfig.NodeNetwork
+		wantErr string
+	}{
+		{"valid", map[string]vsphereConfig.NodeNetwork{
+			"a": {Address: "10.0.0.11/24"},
+			"b": {Address: "10.0.0.12/24"},
+		}, ""},
+		{"duplicate", map[string]vsphereConfig.NodeNetwork{
+			"a": {Address: "10.0.0.11/24"},
+			"b": {Address: "10.0.0.11/24"},
+		}, "a and b have the same static IP 10.0.0.11"},
+		{"no prefix", map[string]vsphereConfig.NodeNetwork{
+			"a": {Address: "10.0.0.11"},
+		}, "invalid static IP for a"},
+		{"gateway outside", map[string]vsphereConfig.NodeNetwork{
+			"a": {Address: "10.0.5.11/24"},
+		}, "invalid static IP for a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newFixture(t, withStaticIPs(tt.nodes)).validateStaticIPs()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWarnUnusedStaticIPs(t *testing.T) {
+	events := &recordedEvents{}
+	v := newFixture(t, withStaticIPs(map[string]vsphereConfig.NodeNetwork{
+		bootstrapVMName: {Address: "10.0.0.11/24"},
+		"typo":          {Address: "10.0.0.12/24"},
+	}))
+	v.EventStream = events
+
+	v.warnUnusedStaticIPs(bootstrapVMName)
+	if len(events.events) != 1 {
+		t.Fatalf("expected one event, got %v", len(events.events))
+	}
+	e := events.events[0]
+	if e.Level != progress.LevelWarn || !strings.Contains(e.Msg, "[typo]") {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	events.events = nil
+	v.warnUnusedStaticIPs(bootstrapVMName, "typo")
+	if len(events.events) != 0 {
+		t.Errorf("expected no event, got %+v", events.events)
+	}
+}
+
+func TestVMIPStatic(t *testing.T) {
+	v := newFixture(t, withStaticIPs(map[string]vsphereConfig.NodeNetwork{
+		bootstrapVMName: {Address: "10.0.0.11/24"},
+	}))
+	// the VM is not needed to know a static address
+	ip, err := v.vmIP(bootstrapVMName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "10.0.0.11" {
+		t.Errorf("got %v, want 10.0.0.11", ip)
+	}
+}
+
+func TestReserveAddresses(t *testing.T) {
+	addresses := &fakeIPAM{fail: map[string]bool{}, released: map[string]bool{}}
+	v := newFixture(t, withStaticIPs(map[string]vsphereConfig.NodeNetwork{
+		"mgmt-controlplane-1": {Address: "10.0.0.11/24"},
+	}))
+	v.AddressManager = addresses
+
+	// static addresses are not reserved
+	err := v.reserveAddresses("mgmt-controlplane-1", "DC0_H0_VM1", "mgmt-worker-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.TrackedResources.Addresses["mgmt-controlplane-1"]; ok {
+		t.Error("a VM with a static IP should not get a reservation")
+	}
+	want := &cloudinit.NetworkConfig{Address: "10.0.1.2/24", Gateway: "10.0.1.1"}
+	if got := v.nodeNetwork("mgmt-worker-1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	ip, err := v.vmIP("mgmt-worker-1", nil)
+	if err != nil || ip != "10.0.1.2" {
+		t.Errorf("expected the reserved IP, got %v, %v", ip, err)
+	}
+	// a reservation is only made once
+	err = v.reserveAddresses("mgmt-worker-1")
+	if err != nil || addresses.next != 2 {
+		t.Errorf("expected no new reservation, got %v, %v", addresses.next, err)
+	}
+
+	// only VMs that were not cloned give their address back
+	v.rollbackAddresses("DC0_H0_VM1", "mgmt-worker-1")
+	if addresses.released["DC0_H0_VM1"] || !addresses.released["mgmt-worker-1"] {
+		t.Errorf("unexpected releases %v", addresses.released)
+	}
+	if _, ok := v.TrackedResources.Addresses["mgmt-worker-1"]; ok {
+		t.Error("a released address should no longer be tracked")
+	}
+
+	addresses.fail["mgmt-worker-2"] = true
+	err = v.reserveAddresses("mgmt-worker-2")
+	if err == nil {
+		t.Error("expected an error when no address is left")
+	}
+}
+
+func TestValidateNetworks(t *testing.T) {
+	tests := []struct {
+		name     string
+		networks vsphereConfig.VMNetworks
+		wantErr  string
+	}{
+		{"valid", vsphereConfig.VMNetworks{
+			ControlPlane: []vsphereConfig.VMNetwork{{Name: "storage", MTU: 9000, Addresses: map[string]string{"mgmt-controlplane-1": "10.1.0.11/24"}}},
+			Worker:       []vsphereConfig.VMNetwork{{Name: "storage"}, {Name: "workload"}},
+		}, ""},
+		{"no name", vsphereConfig.VMNetworks{
+			Worker: []vsphereConfig.VMNetwork{{MTU: 9000}},
+		}, "Networks.Worker, a network has no name"},
+		{"twice", vsphereConfig.VMNetworks{
+			Bootstrap: []vsphereConfig.VMNetwork{{Name: "storage"}, {Name: "storage"}},
+		}, "storage is attached twice"},
+		{"mtu", vsphereConfig.VMNetworks{
+			Worker: []vsphereConfig.VMNetwork{{Name: "storage", MTU: 10000}},
+		}, "MTU 10000"},
+		{"no prefix", vsphereConfig.VMNetworks{
+			Worker: []vsphereConfig.VMNetwork{{Name: "storage", Addresses: map[string]string{"mgmt-worker-1": "10.1.0.21"}}},
+		}, "address for mgmt-worker-1"},
+		{"static IP", vsphereConfig.VMNetworks{
+			Worker: []vsphereConfig.VMNetwork{{Name: "storage", Addresses: map[string]string{"mgmt-worker-1": "10.0.0.11/24"}}},
+		}, "mgmt-controlplane-1 and mgmt-worker-1 on storage have the same IP 10.0.0.11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newFixture(t, withStaticIPs(map[string]vsphereConfig.NodeNetwork{
+				"mgmt-controlplane-1": {Address: "10.0.0.11/24"},
+			}))
+			v.Networks = tt.networks
+			err := v.validateNetworks()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCloneTemplateNICs(t *testing.T) {
+	v := newFixture(t, withHostPool(-1), withStaticIPs(map[string]vsphereConfig.NodeNetwork{
+		"nics": {Address: "10.0.0.11/24"},
+	}))
+	s := v.Session
+	storage, err := s.GetNetwork("DC0_DVPG0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Networks = map[string]object.NetworkReference{"VM Network": s.Network, "DC0_DVPG0": storage}
+
+	nics := v.vmNICs("nics", "VM Network", []vsphereConfig.VMNetwork{
+		{Name: "DC0_DVPG0", Order: 1, MTU: 9000, Addresses: map[string]string{"nics": "10.1.0.11/24"}},
+	})
+	if len(nics) != 2 || nics[0].Config.Address != "10.0.0.11/24" || nics[0].Config.Optional || !nics[1].Config.Optional {
+		t.Fatalf("unexpected NICs %+v", nics)
+	}
+
+	template, err := s.GetVM("DC0_H0_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := s.CloneTemplate(context.Background(), Template{VM: template}, "nics", "#!/bin/bash", nil, "ubuntu", nics, vsphereConfig.VMSize{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteVM(vm)
+
+	props, err := getProperties(vm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards := object.VirtualDeviceList(props.Config.Hardware.Device).SelectByType((*types.VirtualEthernetCard)(nil))
+	if len(cards) != 2 {
+		t.Fatalf("expected 2 NICs, got %v", len(cards))
+	}
+	var metadata string
+	for _, o := range props.Config.ExtraConfig {
+		if o.GetOptionValue().Key == "guestinfo.metadata" {
+			metadata = o.GetOptionValue().Value.(string)
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, card := range cards {
+		mac := card.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard().MacAddress
+		if mac == "" || !strings.Contains(string(decoded), mac) {
+			t.Errorf("NIC %s is not in the network config:\n%s", mac, decoded)
+		}
+	}
+	if !strings.Contains(string(decoded), "mtu: 9000") {
+		t.Errorf("expected the MTU of the storage network:\n%s", decoded)
+	}
+}
@@ -12,11 +12,13 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/netapp/cake/pkg/metrics"
+	"github.com/netapp/cake/pkg/tracing"
 	pkgerrors "github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 
-	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/nfc"
 	"github.com/vmware/govmomi/object"
@@ -27,7 +29,7 @@ import (
 )
 
 // DeployOVATemplates deploys multiple OVAs asynchronously
-func (s *Session) DeployOVATemplates(templatePaths ...string) (map[string]*object.VirtualMachine, error) {
+func (s *Session) DeployOVATemplates(ctx context.Context, templatePaths ...string) (map[string]*object.VirtualMachine, error) {
 	templatePaths = sliceDedup(templatePaths)
 	numOVAs := len(templatePaths)
 	result := make(map[string]*object.VirtualMachine, numOVAs)
@@ -40,7 +42,7 @@ func (s *Session) DeployOVATemplates(templatePaths ...string) (map[string]*objec
 		}
 		template := template
 		g.Go(func() error {
-			r, err := s.deployOVATemplate(template)
+			r, err := s.deployOVATemplate(ctx, template)
 			if err != nil {
 				return err
 			}
@@ -58,13 +60,12 @@ func (s *Session) DeployOVATemplates(templatePaths ...string) (map[string]*objec
 }
 
 // deployOVATemplate uploads ova and makes it a template
-func (s *Session) deployOVATemplate(templatePath string) (*object.VirtualMachine, error) {
-	templateName := strings.TrimSuffix(path.Base(templatePath), ".ova")
-	ctx := context.TODO()
+func (s *Session) deployOVATemplate(ctx context.Context, templatePath string) (*object.VirtualMachine, error) {
+	name := templateName(templatePath)
 	vSphereClient := s.Conn
 	finder := find.NewFinder(vSphereClient.Client, true)
 	finder.SetDatacenter(s.Datacenter)
-	foundTemplate, err := finder.VirtualMachine(ctx, templateName)
+	foundTemplate, err := finder.VirtualMachine(ctx, name)
 	if err == nil {
 		return foundTemplate, nil
 	}
@@ -76,7 +77,7 @@ func (s *Session) deployOVATemplate(templatePath string) (*object.VirtualMachine
 	}
 	cisp := types.OvfCreateImportSpecParams{
 		DiskProvisioning:   "thin",
-		EntityName:         templateName,
+		EntityName:         name,
 		IpAllocationPolicy: "dhcpPolicy",
 		IpProtocol:         "IPv4",
 		OvfManagerCommonParams: types.OvfManagerCommonParams{
@@ -88,7 +89,12 @@ func (s *Session) deployOVATemplate(templatePath string) (*object.VirtualMachine
 		NetworkMapping: networks,
 	}
 
+	_, span := tracing.Start(ctx, metrics.TaskOVAImport)
+	span.SetAttribute("ova.path", templatePath)
+	start := time.Now()
 	vm, err := createVirtualMachine(ctx, cisp, templatePath, s)
+	metrics.ObserveTask(metrics.TaskOVAImport, start, err)
+	span.End(err)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create virtual machine, %v", err)
 	}
@@ -109,7 +115,7 @@ func (s *Session) deployOVATemplate(templatePath string) (*object.VirtualMachine
 func createVirtualMachine(ctx context.Context, cisp types.OvfCreateImportSpecParams, ovaPath string, vSphere *Session) (*object.VirtualMachine, error) {
 	vSphereClient := vSphere.Conn
 
-	ovaClient, err := newOVA(vSphereClient, ovaPath)
+	ovaClient, err := newOVA(vSphere, ovaPath)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create ova client, %v", err)
 	}
@@ -186,6 +192,8 @@ func isRemotePath(path string) bool {
 type tapeArchiveEntry struct {
 	io.Reader
 	f io.Closer
+	// name is the file in the archive
+	name string
 }
 
 func (t *tapeArchiveEntry) Close() error {
@@ -198,23 +206,23 @@ type ova interface {
 }
 
 type handler struct {
-	client *govmomi.Client
+	session *Session
 }
 
 // newOVA returns a new ova client
-func newOVA(client *govmomi.Client, basePath string) (ova, error) {
+func newOVA(session *Session, basePath string) (ova, error) {
 	_, err := url.Parse(basePath)
 	if err != nil {
 		return nil, fmt.Errorf("Error parsing url %s, %w", basePath, err)
 	}
 
 	return &handler{
-		client: client,
+		session: session,
 	}, nil
 }
 
 func (h *handler) getImportSpec(ctx context.Context, ovaPath string, resourcePool mo.Reference, datastore mo.Reference, cisp types.OvfCreateImportSpecParams) (*types.OvfCreateImportSpecResult, error) {
-	m := ovf.NewManager(h.client.Client)
+	m := ovf.NewManager(h.session.Conn.Client)
 
 	o, err := h.readOvf("*.ovf", ovaPath)
 	if err != nil {
@@ -229,20 +237,24 @@ func (h *handler) getImportSpec(ctx context.Context, ovaPath string, resourcePoo
 	return m.CreateImportSpec(ctx, string(o), resourcePool, datastore, cisp)
 }
 
+// upload sends the file of item to the lease, a failed upload is retried
 func (h *handler) upload(ctx context.Context, lease *nfc.Lease, item nfc.FileItem, ovaPath string) error {
 	file := item.Path
 
-	f, size, err := h.openOva(file, ovaPath)
-	if err != nil {
-		return fmt.Errorf("unable to open OVA, %v", err)
-	}
-	defer f.Close()
+	return h.session.retryTransfer(file, func() error {
+		f, size, err := h.openOva(file, ovaPath)
+		if err != nil {
+			return fmt.Errorf("unable to open OVA, %v", err)
+		}
+		defer f.Close()
 
-	opts := soap.Upload{
-		ContentLength: size,
-	}
+		opts := soap.Upload{
+			ContentLength: size,
+		}
+		p := h.session.newTransferProgress("uploading", file, 0, size)
 
-	return lease.Upload(ctx, item, f, opts)
+		return lease.Upload(ctx, item, io.TeeReader(f, p), opts)
+	})
 }
 
 func (h *handler) readOvf(name string, ovaPath string) ([]byte, error) {
@@ -278,7 +290,7 @@ func (h *handler) openOva(name string, ovaPath string) (io.ReadCloser, int64, er
 		}
 
 		if matched {
-			return &tapeArchiveEntry{tarReader, f}, h.Size, nil
+			return &tapeArchiveEntry{tarReader, f, path.Base(h.Name)}, h.Size, nil
 		}
 	}
 
@@ -294,13 +306,22 @@ func (h *handler) openFile(path string) (io.ReadCloser, int64, error) {
 	return openLocal(path)
 }
 
+// openRemote opens the cached OVA of link, without a cache the OVA is streamed from link
 func (h *handler) openRemote(link string) (io.ReadCloser, int64, error) {
+	if h.session.Cache != nil {
+		p, err := h.session.cachedOVA(link)
+		if err != nil {
+			return nil, 0, err
+		}
+		return openLocal(p)
+	}
+
 	u, err := url.Parse(link)
 	if err != nil {
 		return nil, 0, fmt.Errorf("Error parsing url %s, %w", link, err)
 	}
 
-	return h.client.Client.Download(context.TODO(), u, &soap.DefaultDownload)
+	return h.session.Conn.Client.Download(context.TODO(), u, &soap.DefaultDownload)
 
 }
 
@@ -1,6 +1,7 @@
 package vsphere
 
 import (
+	"context"
 	"testing"
 )
 
@@ -87,7 +88,7 @@ func TestDeployOVATemplate(t *testing.T) {
 	//templateOVA = "https://storage.googleapis.com/capv-images/release/v1.17.3/ubuntu-1804-kube-v1.17.3.ova"
 	templateOVA := "https://communities.vmware.com/servlet/JiveServlet/downloadBody/21621-102-3-28798/Tiny Linux VM.ova"
 
-	_, err = sim.conn.deployOVATemplate(templateOVA)
+	_, err = sim.conn.deployOVATemplate(context.Background(), templateOVA)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -1,12 +1,12 @@
 package vsphere
 
 import (
+	"context"
 	"fmt"
 	"github.com/netapp/cake/pkg/config"
+	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
 	"github.com/netapp/cake/pkg/progress"
-	"github.com/netapp/cake/pkg/util/ssh"
 	"github.com/vmware/govmomi/object"
-	"gopkg.in/yaml.v3"
 )
 
 // NewMgmtBootstrapRKE is a new rke provider
@@ -17,97 +17,175 @@ func NewMgmtBootstrapRKE(full *MgmtBootstrapRKE) *MgmtBootstrapRKE {
 }
 
 // Prepare bootstrap VM for rke deployment
-func (v *MgmtBootstrapRKE) Prepare() error {
+func (v *MgmtBootstrapRKE) Prepare(ctx context.Context) error {
 	err := v.createFolders()
 	if err != nil {
 		return err
 	}
-	// generate key pair
-	privateKey, publicKey, err := ssh.GenerateRSAKeyPair()
-	if err != nil {
-		return err
-	}
-	v.SSH.AuthorizedKeys = append(v.SSH.AuthorizedKeys, publicKey)
-	v.GeneratedKey.PrivateKey = privateKey
-	v.GeneratedKey.PublicKey = publicKey
-	configYAML, err := yaml.Marshal(v)
+	err = v.generateKey()
 	if err != nil {
 		return err
 	}
 	// TODO make prereqs less hacky than this
 	v.Prerequisites = fmt.Sprintf(rkePrereqs, v.SSH.Username)
-	return v.prepareRKE(configYAML)
+	return v.prepareRKE(ctx)
 }
 
 // Prepare the environment for bootstrapping
-func (v *MgmtBootstrapRKE) prepareRKE(configYAML []byte) error {
+func (v *MgmtBootstrapRKE) prepareRKE(ctx context.Context) error {
+	controlPlaneSize := vmSize(v.VMSizes.ControlPlane)
+	workerSize := vmSize(v.VMSizes.Worker)
+	// the first control plane node is always cloned, it runs the engine
+	sizes := []vsphereConfig.VMSize{controlPlaneSize}
+	for vm := 2; vm <= v.ControlPlaneCount; vm++ {
+		sizes = append(sizes, controlPlaneSize)
+	}
+	for vm := 1; vm <= v.WorkerCount; vm++ {
+		sizes = append(sizes, workerSize)
+	}
+	err := v.checkSizes(sizes...)
+	if err != nil {
+		return err
+	}
+	// etcd runs on the control plane nodes, a host failure must not take down its quorum
+	controlPlaneCount := len(sizes) - v.WorkerCount
+	err = v.checkHosts("control plane", controlPlaneCount)
+	if err != nil {
+		return err
+	}
+	if v.AntiAffinity.Workers {
+		err = v.checkHosts("worker", v.WorkerCount)
+		if err != nil {
+			return err
+		}
+	}
 	mFolder := v.Session.Folder
 	v.Session.Folder = v.TrackedResources.Folders[templatesFolder]
-	ovas, err := v.Session.DeployOVATemplates(v.OVA.BootstrapTemplate, v.OVA.NodeTemplate, v.OVA.LoadbalancerTemplate)
+	templates, err := v.deployTemplates(ctx, v.OVA.BootstrapTemplate, v.OVA.NodeTemplate, v.OVA.LoadbalancerTemplate)
 	if err != nil {
+		v.saveInventory(nil, "")
 		return err
 	}
-	// TODO save ova templates to TrackedResources?
+	// nodes are full clones, nothing needs the templates once the nodes exist
+	if v.CleanupTemplates {
+		for name := range templates {
+			v.TrackedResources.markBootstrap(name)
+		}
+	}
 	v.Session.Folder = mFolder
 
-	baseNodeScript := newNodeBaseScript(v.Prerequisites, string(v.EngineType)).ToString()
-	bootstrapperScript := newNodeBaseScript(v.Prerequisites, string(v.EngineType))
+	baseNodeScript := newNodeBaseScript(v.Prerequisites).ToString()
+	bootstrapperScript := newNodeBaseScript(v.Prerequisites)
 	bootstrapperScript.MakeNodeBootstrapper()
 	bootstrapperScript.AddLines(
 		fmt.Sprintf(helmInstall, helmVersion),
 		rkeBinaryInstall,
-		fmt.Sprintf(privateKeyToDisk, v.GeneratedKey.PrivateKey),
 	)
 
 	nodes := []cloneSpec{}
 	bootstrapNode := cloneSpec{
-		template:   ovas[v.OVA.NodeTemplate],
+		template:   templates[v.OVA.NodeTemplate],
 		name:       fmt.Sprintf("%s-%s-1", v.ClusterName, config.ControlNode),
 		bootScript: bootstrapperScript.ToString(),
 		publicKey:  v.SSH.AuthorizedKeys,
 		osUser:     v.SSH.Username,
+		size:       controlPlaneSize,
 	}
 	nodes = append(nodes, bootstrapNode)
 	for vm := 2; vm <= v.ControlPlaneCount; vm++ {
 		vmName := fmt.Sprintf("%s-%s-%v", v.ClusterName, config.ControlNode, vm)
 		spec := cloneSpec{
-			template:   ovas[v.OVA.NodeTemplate],
+			template:   templates[v.OVA.NodeTemplate],
 			name:       vmName,
 			bootScript: baseNodeScript,
 			publicKey:  v.SSH.AuthorizedKeys,
 			osUser:     v.SSH.Username,
+			size:       controlPlaneSize,
 		}
 		nodes = append(nodes, spec)
 	}
 	for vm := 1; vm <= v.WorkerCount; vm++ {
 		vmName := fmt.Sprintf("%s-%s-%v", v.ClusterName, config.WorkerNode, vm)
 		spec := cloneSpec{
-			template:   ovas[v.OVA.NodeTemplate],
+			template:   templates[v.OVA.NodeTemplate],
 			name:       vmName,
 			bootScript: baseNodeScript,
 			publicKey:  v.SSH.AuthorizedKeys,
 			osUser:     v.SSH.Username,
+			size:       workerSize,
 		}
 		nodes = append(nodes, spec)
 	}
-	vmsCreated, err := v.Session.CloneTemplates(nodes...)
-	for name, vm := range vmsCreated {
+	var names []string
+	for x := range nodes {
+		names = append(names, nodes[x].name)
+	}
+	v.warnUnusedStaticIPs(names...)
+	err = v.reserveAddresses(names...)
+	if err != nil {
+		v.rollbackAddresses(names...)
+		v.saveInventory(nil, bootstrapNode.name)
+		return err
+	}
+	// the reservations are recorded before cloning in case cake is interrupted
+	v.saveInventory(nil, bootstrapNode.name)
+	for x := range nodes {
+		// the control plane nodes come first, starting with the bootstrap node
+		networks := v.Networks.Worker
+		if x < controlPlaneCount {
+			networks = v.Networks.ControlPlane
+		}
+		nodes[x].nics = v.vmNICs(nodes[x].name, v.ManagementNetwork, networks)
+	}
+	vmsCreated, err := v.Session.CloneTemplates(ctx, nodes...)
+	for x, name := range names {
+		vm, ok := vmsCreated[name]
+		if !ok {
+			continue
+		}
 		v.TrackedResources.addTrackedVM(map[string]*object.VirtualMachine{name: vm})
+		switch {
+		case x == 0:
+			v.tag(vm.Reference(), name, config.ControlNode, roleBootstrap)
+		case x < controlPlaneCount:
+			v.tag(vm.Reference(), name, config.ControlNode)
+		default:
+			v.tag(vm.Reference(), name, config.WorkerNode)
+		}
+	}
+	if err != nil {
+		v.rollbackAddresses(names...)
+		v.saveInventory(nil, bootstrapNode.name)
+		return err
 	}
+	if !v.AntiAffinity.DisableControlPlane {
+		err = v.addAntiAffinityRule(config.ControlNode, names[:controlPlaneCount]...)
+	}
+	if err == nil && v.AntiAffinity.Workers {
+		err = v.addAntiAffinityRule(config.WorkerNode, names[controlPlaneCount:]...)
+	}
+	v.saveInventory(nil, bootstrapNode.name)
 
 	return err
 }
 
-// Provision calls the process to create the management cluster for RKE
-func (v *MgmtBootstrapRKE) Provision() error {
+// Provision waits for every node to be ready and starts the RKE engine on the bootstrap VM
+func (v *MgmtBootstrapRKE) Provision(ctx context.Context) error {
 	var bootstrapVMIP string
+	bootstrapName := fmt.Sprintf("%s-%s-1", v.ClusterName, config.ControlNode)
 	v.Nodes = map[string]string{}
 	for name, vm := range v.TrackedResources.VMs {
-		vmIP, err := GetVMIP(vm)
+		vmIP, err := v.vmIP(name, vm)
+		if err != nil {
+			v.saveInventory(v.Nodes, bootstrapName)
+			return err
+		}
+		err = v.pinHostKeys(name, vm)
 		if err != nil {
+			v.saveInventory(v.Nodes, bootstrapName)
 			return err
 		}
-		if name == fmt.Sprintf("%s-%s-1", v.ClusterName, config.ControlNode) {
+		if name == bootstrapName {
 			bootstrapVMIP = vmIP
 			v.BootstrapIP = vmIP
 			v.BootstrapperIP = vmIP
@@ -120,13 +198,11 @@ func (v *MgmtBootstrapRKE) Provision() error {
 		})
 	}
 
-	configYAML, err := yaml.Marshal(v)
-	if err != nil {
-		return err
-	}
-	err = uploadFilesToBootstrap(bootstrapVMIP, string(configYAML))
+	v.saveInventory(v.Nodes, bootstrapName)
+
+	err := v.waitForNodes(v.Nodes)
 	if err != nil {
 		return err
 	}
-	return nil
+	return v.startBootstrap(ctx, bootstrapName, bootstrapVMIP, v, v.GeneratedKey.PrivateKey.Reveal())
 }
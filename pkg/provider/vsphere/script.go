@@ -1,26 +1,21 @@
 package vsphere
 
 import (
-	"fmt"
 	"strings"
 )
 
-func newNodeBaseScript(base, deploymentType string) *baseScript {
+func newNodeBaseScript(base string) *baseScript {
 	lines := []string{
 		baseNodeCommandsHeader,
 		base,
 	}
-	result := baseScript{script: strings.Join(lines, "\n"), deploymentType: deploymentType}
+	result := baseScript{script: strings.Join(lines, "\n")}
 	return &result
 }
 
 func (b *baseScript) MakeNodeBootstrapper() {
 	lines := []string{
 		bootstrapNodeCommandsHeader,
-		installSocatCmd,
-		fmt.Sprintf(uploadFileCmd, uploadPort, remoteExecutable),
-		fmt.Sprintf(uploadFileCmd, uploadConfigPort, remoteConfigRoot),
-		fmt.Sprintf(runRemoteCmd, commandPort),
 		b.script,
 	}
 	b.script = strings.Join(lines, "\n")
@@ -41,7 +36,6 @@ func (b *baseScript) ToString() string {
 	result := []string{
 		baseScriptHeader,
 		b.script,
-		fmt.Sprintf(runCake, remoteConfigRoot, remoteExecutable, fmt.Sprintf(runLocalCakeCmd, remoteExecutable, b.deploymentType, remoteConfigRoot)),
 	}
 	return strings.Join(result, "\n")
 }
@@ -7,7 +7,7 @@ import (
 
 func TestNewBoostrapBaseScript(t *testing.T) {
 	lineTwo := "do this seconds"
-	v := newNodeBaseScript(rkePrereqs, "rke")
+	v := newNodeBaseScript(rkePrereqs)
 	v.MakeNodeBootstrapper()
 	v.AddLines(rkeBinaryInstall, lineTwo)
 	s := v.ToString()
@@ -19,7 +19,7 @@ func TestNewBoostrapBaseScript(t *testing.T) {
 
 func TestNewNodeBaseScript(t *testing.T) {
 	lineTwo := "do this seconds"
-	v := newNodeBaseScript(rkePrereqs, "rke")
+	v := newNodeBaseScript(rkePrereqs)
 	v.AddLines(rkeBinaryInstall, lineTwo)
 	s := v.ToString()
 
@@ -27,3 +27,15 @@ func TestNewNodeBaseScript(t *testing.T) {
 		t.Fatalf("expected: %s to contain: [%s, %s]", s, rkeBinaryInstall, lineTwo)
 	}
 }
+
+func TestBootstrapScriptHasNoListeners(t *testing.T) {
+	v := newNodeBaseScript(rkePrereqs)
+	v.MakeNodeBootstrapper()
+	s := v.ToString()
+
+	for _, unexpected := range []string{"socat", "TCP-LISTEN", "EXEC:"} {
+		if strings.Contains(s, unexpected) {
+			t.Fatalf("expected: %s to not contain: %s", s, unexpected)
+		}
+	}
+}
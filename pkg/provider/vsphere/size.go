@@ -0,0 +1,199 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const defaultVMMemoryInMB = 8 * 1024 // = 8192 or 8 GB in MB
+
+// namedSizes are the sizes a VMSize can name
+var namedSizes = map[string]vsphereConfig.VMSize{
+	"small":  {VCPUs: 2, MemoryMB: 4 * 1024, DiskGB: 40},
+	"medium": {VCPUs: 4, MemoryMB: 8 * 1024, DiskGB: 60},
+	"large":  {VCPUs: 8, MemoryMB: 16 * 1024, DiskGB: 100},
+	"xlarge": {VCPUs: 16, MemoryMB: 32 * 1024, DiskGB: 200},
+}
+
+// resolveSize returns the explicit resources of size, resources that are not set stay 0 except memory
+func resolveSize(size vsphereConfig.VMSize) (vsphereConfig.VMSize, error) {
+	var resolved vsphereConfig.VMSize
+	if size.Size != "" {
+		named, ok := namedSizes[strings.ToLower(size.Size)]
+		if !ok {
+			return resolved, fmt.Errorf("unknown size %q, supported are small, medium, large and xlarge", size.Size)
+		}
+		resolved = named
+	}
+	if size.VCPUs < 0 || size.MemoryMB < 0 || size.DiskGB < 0 {
+		return resolved, fmt.Errorf("VCPUs, MemoryMB and DiskGB can not be negative")
+	}
+	// vSphere only accepts memory in multiples of 4 MB
+	if size.MemoryMB%4 != 0 {
+		return resolved, fmt.Errorf("MemoryMB %v is not a multiple of 4", size.MemoryMB)
+	}
+	if size.VCPUs > 0 {
+		resolved.VCPUs = size.VCPUs
+	}
+	if size.MemoryMB > 0 {
+		resolved.MemoryMB = size.MemoryMB
+	}
+	if size.DiskGB > 0 {
+		resolved.DiskGB = size.DiskGB
+	}
+	if resolved.MemoryMB == 0 {
+		resolved.MemoryMB = defaultVMMemoryInMB
+	}
+	return resolved, nil
+}
+
+// validateVMSizes resolves the size of every role before anything is created
+func (v *MgmtBootstrap) validateVMSizes() error {
+	roles := map[string]vsphereConfig.VMSize{
+		"Bootstrap":    v.VMSizes.Bootstrap,
+		"ControlPlane": v.VMSizes.ControlPlane,
+		"Worker":       v.VMSizes.Worker,
+	}
+	for _, role := range []string{"Bootstrap", "ControlPlane", "Worker"} {
+		_, err := resolveSize(roles[role])
+		if err != nil {
+			return fmt.Errorf("invalid VMSizes.%s, %v", role, err)
+		}
+	}
+	return nil
+}
+
+// vmSize returns the resolved size, sizes are validated by Client
+func vmSize(size vsphereConfig.VMSize) vsphereConfig.VMSize {
+	resolved, _ := resolveSize(size)
+	return resolved
+}
+
+// checkResourcePool fails when a VM of sizes is larger than every host of the resource pool or when together they
+// exceed its memory limit. Exceeding the CPU limit only slows the VMs down, it is returned as a warning
+func (s *Session) checkResourcePool(sizes ...vsphereConfig.VMSize) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var pool mo.ResourcePool
+	err := s.ResourcePool.Properties(ctx, s.ResourcePool.Reference(), []string{"config", "owner"}, &pool)
+	if err != nil {
+		return "", fmt.Errorf("unable to get resource pool properties, %v", err)
+	}
+	var owner mo.ComputeResource
+	err = s.ResourcePool.Properties(ctx, pool.Owner, []string{"host"}, &owner)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the hosts of the resource pool, %v", err)
+	}
+	var hosts []mo.HostSystem
+	if len(owner.Host) > 0 {
+		err = property.DefaultCollector(s.Conn.Client).Retrieve(ctx, owner.Host, []string{"summary.hardware"}, &hosts)
+		if err != nil {
+			return "", fmt.Errorf("unable to get the hardware of the hosts, %v", err)
+		}
+	}
+	var maxThreads, maxMemoryMB, mhz int64
+	for _, h := range hosts {
+		hw := h.Summary.Hardware
+		if hw == nil {
+			continue
+		}
+		if int64(hw.NumCpuThreads) > maxThreads {
+			maxThreads = int64(hw.NumCpuThreads)
+		}
+		if hw.MemorySize/1024/1024 > maxMemoryMB {
+			maxMemoryMB = hw.MemorySize / 1024 / 1024
+		}
+		if int64(hw.CpuMhz) > mhz {
+			mhz = int64(hw.CpuMhz)
+		}
+	}
+
+	name := s.ResourcePool.InventoryPath
+	var vcpus, memoryMB int64
+	for _, size := range sizes {
+		if maxThreads > 0 && int64(size.VCPUs) > maxThreads {
+			return "", fmt.Errorf("a VM with %v vCPUs does not fit on a host of resource pool %s, the largest has %v CPU threads", size.VCPUs, name, maxThreads)
+		}
+		if maxMemoryMB > 0 && int64(size.MemoryMB) > maxMemoryMB {
+			return "", fmt.Errorf("a VM with %v MB of memory does not fit on a host of resource pool %s, the largest has %v MB", size.MemoryMB, name, maxMemoryMB)
+		}
+		vcpus += int64(size.VCPUs)
+		memoryMB += int64(size.MemoryMB)
+	}
+	if pool.Config.MemoryAllocation.Limit != nil && *pool.Config.MemoryAllocation.Limit >= 0 && memoryMB > *pool.Config.MemoryAllocation.Limit {
+		return "", fmt.Errorf("the VMs need %v MB of memory, resource pool %s is limited to %v MB", memoryMB, name, *pool.Config.MemoryAllocation.Limit)
+	}
+	if pool.Config.CpuAllocation.Limit != nil && *pool.Config.CpuAllocation.Limit >= 0 && vcpus*mhz > *pool.Config.CpuAllocation.Limit {
+		return fmt.Sprintf("the %v vCPUs of the VMs can use up to %v MHz, resource pool %s is limited to %v MHz", vcpus, vcpus*mhz, name, *pool.Config.CpuAllocation.Limit), nil
+	}
+	return "", nil
+}
+
+// checkSizes checks the resolved sizes of the VMs cake clones against the resource pool before anything is cloned
+func (v *MgmtBootstrap) checkSizes(sizes ...vsphereConfig.VMSize) error {
+	warning, err := v.Session.checkResourcePool(sizes...)
+	if err != nil {
+		return err
+	}
+	if warning != "" {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   warning,
+			Level: progress.LevelWarn,
+		})
+	}
+	return nil
+}
+
+// firstDisk returns the disk cloud-init grows the root filesystem on
+func firstDisk(devices object.VirtualDeviceList) (*types.VirtualDisk, error) {
+	disks := devices.SelectByType((*types.VirtualDisk)(nil))
+	if len(disks) == 0 {
+		return nil, fmt.Errorf("no disk found")
+	}
+	return disks[0].(*types.VirtualDisk), nil
+}
+
+// growDisk resizes the first disk of vm to sizeGB, a disk that is at least as large is left alone
+func growDisk(ctx context.Context, vm *object.VirtualMachine, sizeGB int) error {
+	devices, err := vm.Device(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get the devices of %s, %v", vm.InventoryPath, err)
+	}
+	disk, err := firstDisk(devices)
+	if err != nil {
+		return fmt.Errorf("unable to grow the disk of %s, %v", vm.InventoryPath, err)
+	}
+	capacityKB := int64(sizeGB) * 1024 * 1024
+	if disk.CapacityInKB >= capacityKB {
+		return nil
+	}
+	disk.CapacityInKB = capacityKB
+	disk.CapacityInBytes = capacityKB * 1024
+	task, err := vm.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+		DeviceChange: []types.BaseVirtualDeviceConfigSpec{
+			&types.VirtualDeviceConfigSpec{
+				Operation: types.VirtualDeviceConfigSpecOperationEdit,
+				Device:    disk,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to grow the disk of %s, %v", vm.InventoryPath, err)
+	}
+	err = task.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("grow disk task for %s failed, %v", vm.InventoryPath, err)
+	}
+	return nil
+}
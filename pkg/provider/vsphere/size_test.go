@@ -0,0 +1,159 @@
+package vsphere
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
+	"github.com/netapp/cake/pkg/provider/vsphere/cloudinit"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestResolveSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    vsphereConfig.VMSize
+		want    vsphereConfig.VMSize
+		wantErr bool
+	}{
+		{"default", vsphereConfig.VMSize{}, vsphereConfig.VMSize{MemoryMB: defaultVMMemoryInMB}, false},
+		{"named", vsphereConfig.VMSize{Size: "Large"}, vsphereConfig.VMSize{VCPUs: 8, MemoryMB: 16384, DiskGB: 100}, false},
+		{"override", vsphereConfig.VMSize{Size: "small", MemoryMB: 6144}, vsphereConfig.VMSize{VCPUs: 2, MemoryMB: 6144, DiskGB: 40}, false},
+		{"explicit", vsphereConfig.VMSize{VCPUs: 6, DiskGB: 80}, vsphereConfig.VMSize{VCPUs: 6, MemoryMB: defaultVMMemoryInMB, DiskGB: 80}, false},
+		{"unknown", vsphereConfig.VMSize{Size: "huge"}, vsphereConfig.VMSize{}, true},
+		{"negative", vsphereConfig.VMSize{VCPUs: -1}, vsphereConfig.VMSize{}, true},
+		{"memory", vsphereConfig.VMSize{MemoryMB: 1001}, vsphereConfig.VMSize{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveSize(tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	v := &MgmtBootstrap{}
+	v.VMSizes.Worker = vsphereConfig.VMSize{Size: "tiny"}
+	err := v.validateVMSizes()
+	if err == nil || !strings.Contains(err.Error(), "VMSizes.Worker") {
+		t.Errorf("expected the invalid role to be named, got %v", err)
+	}
+}
+
+func TestCheckResourcePool(t *testing.T) {
+	s := newFixture(t, withHostPool(3072)).Session
+
+	// the simulator hosts have 2 CPU threads and 4 GB of memory
+	_, err := s.checkResourcePool(vsphereConfig.VMSize{VCPUs: 2, MemoryMB: 2048}, vsphereConfig.VMSize{MemoryMB: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.checkResourcePool(vsphereConfig.VMSize{VCPUs: 2, MemoryMB: 2048}, vsphereConfig.VMSize{MemoryMB: 2048})
+	if err == nil || !strings.Contains(err.Error(), "limited to 3072 MB") {
+		t.Errorf("expected the memory limit to be exceeded, got %v", err)
+	}
+	_, err = s.checkResourcePool(vsphereConfig.VMSize{VCPUs: 4, MemoryMB: 1024})
+	if err == nil || !strings.Contains(err.Error(), "2 CPU threads") {
+		t.Errorf("expected the VM not to fit on a host, got %v", err)
+	}
+}
+
+func TestCloneTemplateSize(t *testing.T) {
+	s := newFixture(t, withHostPool(-1)).Session
+	template, err := s.GetVM("DC0_H0_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	props, err := getProperties(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk, err := firstDisk(object.VirtualDeviceList(props.Config.Hardware.Device))
+	if err != nil {
+		t.Fatal(err)
+	}
+	templateGB := int(disk.CapacityInKB / 1024 / 1024)
+
+	nics := []NIC{{Network: s.Network, Config: &cloudinit.NetworkConfig{Address: "10.0.0.11/24", Gateway: "10.0.0.1"}}}
+	size := vsphereConfig.VMSize{VCPUs: 2, MemoryMB: 2048, DiskGB: templateGB + 10}
+	vm, err := s.CloneTemplate(context.Background(), Template{VM: template}, "sized", "#!/bin/bash", []string{"ssh-rsa AAAA"}, "ubuntu", nics, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteVM(vm)
+
+	props, err = getProperties(vm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk, err = firstDisk(object.VirtualDeviceList(props.Config.Hardware.Device))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disk.CapacityInKB != int64(templateGB+10)*1024*1024 {
+		t.Errorf("expected the disk to be grown to %v GB, got %v KB", templateGB+10, disk.CapacityInKB)
+	}
+	var metadata bool
+	for _, o := range props.Config.ExtraConfig {
+		if o.GetOptionValue().Key == "guestinfo.metadata" {
+			metadata = true
+		}
+	}
+	if !metadata {
+		t.Error("expected the cloud-init metadata in the extra config")
+	}
+
+	// a disk can not shrink
+	size.DiskGB = templateGB + 5
+	_, err = s.CloneTemplate(context.Background(), Template{VM: vm}, "shrunk", "#!/bin/bash", nil, "ubuntu", nil, size)
+	if err == nil || !strings.Contains(err.Error(), "smaller than") {
+		t.Errorf("expected the disk size to be rejected, got %v", err)
+	}
+}
+
+// poweredOnTask marks the VM name powered on once its power on task is created, the task fails
+type poweredOnTask struct{ name string }
+
+func (h poweredOnTask) Reference() types.ManagedObjectReference {
+	return types.ManagedObjectReference{Type: "poweredOnTask", Value: h.name}
+}
+
+func (h poweredOnTask) PutObject(o mo.Reference) {
+	task, ok := o.(*simulator.Task)
+	if !ok || task.Info.Name != "PowerOn" {
+		return
+	}
+	if vm, ok := simulator.Map.Get(*task.Info.Entity).(*simulator.VirtualMachine); ok && vm.Name == h.name {
+		vm.Runtime.PowerState = types.VirtualMachinePowerStatePoweredOn
+		vm.Summary.Runtime.PowerState = types.VirtualMachinePowerStatePoweredOn
+	}
+}
+
+func (poweredOnTask) UpdateObject(mo.Reference, []types.PropertyChange) {}
+func (poweredOnTask) RemoveObject(types.ManagedObjectReference)         {}
+
+func TestCloneTemplatePowerOnFailed(t *testing.T) {
+	s := newFixture(t, withHostPool(-1)).Session
+	template, err := s.GetVM("DC0_H0_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulator.Map.AddHandler(poweredOnTask{name: "unpowered"})
+
+	_, err = s.CloneTemplate(context.Background(), Template{VM: template}, "unpowered", "#!/bin/bash", nil, "ubuntu", nil, vsphereConfig.VMSize{})
+	if err == nil || !strings.Contains(err.Error(), "power on") {
+		t.Fatalf("expected the VM not to power on, got %v", err)
+	}
+	// the VM is not returned, the caller can not track it
+	if _, err := s.GetVM("unpowered"); err == nil {
+		t.Error("expected the VM to be deleted after it failed to power on")
+	}
+}
@@ -0,0 +1,155 @@
+package vsphere
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/metrics"
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/provider"
+	"github.com/netapp/cake/pkg/provider/vsphere/cloudinit"
+	"github.com/netapp/cake/pkg/util/ssh"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/sync/errgroup"
+)
+
+// generateKey creates the key pair for the run and authorizes it for the ssh user on every VM
+func (v *MgmtBootstrap) generateKey() error {
+	privateKey, publicKey, err := ssh.GenerateRSAKeyPair()
+	if err != nil {
+		return err
+	}
+	v.SSH.AuthorizedKeys = append(v.SSH.AuthorizedKeys, publicKey)
+	v.GeneratedKey.PrivateKey = types.Secret(privateKey)
+	v.GeneratedKey.PublicKey = publicKey
+	v.GeneratedKey.HostKeys = make(map[string][]string)
+	// lets cake support-bundle connect to the VMs after the deploy
+	return v.SaveSSHKey(privateKey)
+}
+
+// sshAuth connects to the VM name with the generated key, its host keys are pinned by pinHostKeys first
+func (v *MgmtBootstrap) sshAuth(name string) ssh.Auth {
+	return ssh.Auth{
+		Username:   v.SSH.Username,
+		PrivateKey: []byte(v.GeneratedKey.PrivateKey.Reveal()),
+		HostKeys:   v.GeneratedKey.HostKeys[name],
+	}
+}
+
+// pinHostKeys waits for the VM name to publish the ssh host keys cloud-init generated for it and pins them
+func (v *MgmtBootstrap) pinHostKeys(name string, vm *object.VirtualMachine) error {
+	keys, err := hostKeys(vm)
+	if err != nil {
+		return fmt.Errorf("unable to get the ssh host keys of %s, %v", name, err)
+	}
+	v.GeneratedKey.HostKeys[name] = keys
+	return nil
+}
+
+// hostKeysPollInterval is how often the guestinfo of a VM is read while waiting for its host keys
+var hostKeysPollInterval = 5 * time.Second
+
+// hostKeys waits for the public ssh host keys a VM sets at cloudinit.HostKeysKey with VMware Tools, only the guest
+// and users allowed to reconfigure the VM can set the variable
+func hostKeys(vm *object.VirtualMachine) ([]string, error) {
+	const timeout = 10 * time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		var props mo.VirtualMachine
+		err := vm.Properties(ctx, vm.Reference(), []string{"config.extraConfig"}, &props)
+		if err != nil {
+			return nil, err
+		}
+		if props.Config != nil {
+			for _, o := range props.Config.ExtraConfig {
+				option := o.GetOptionValue()
+				if option.Key != cloudinit.HostKeysKey {
+					continue
+				}
+				value, _ := option.Value.(string)
+				if value != "" {
+					return parseHostKeys(value)
+				}
+			}
+		}
+		metrics.Retry(metrics.LoopHostKeys)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out after %s while waiting for %s", timeout, cloudinit.HostKeysKey)
+		case <-time.After(hostKeysPollInterval):
+		}
+	}
+}
+
+// parseHostKeys decodes the base64 encoded authorized_keys lines a VM published
+func parseHostKeys(value string) ([]string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, %v", cloudinit.HostKeysKey, err)
+	}
+	var keys []string
+	for _, line := range strings.Split(string(decoded), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		_, _, _, _, err := gossh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("invalid host key in %s, %v", cloudinit.HostKeysKey, err)
+		}
+		keys = append(keys, line)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no host keys in %s", cloudinit.HostKeysKey)
+	}
+	return keys, nil
+}
+
+// waitForNodes waits for cloud-init to finish on every node, the ssh connections are closed afterwards
+func (v *MgmtBootstrap) waitForNodes(nodes map[string]string) error {
+	var g errgroup.Group
+	for name, ip := range nodes {
+		name, ip := name, ip
+		g.Go(func() error {
+			c, err := provider.WaitForCloudInit(ip, v.sshAuth(name))
+			if err != nil {
+				return fmt.Errorf("%s not ready, %v", name, err)
+			}
+			c.Close()
+			v.EventStream.Publish(&progress.StatusEvent{
+				Type:  "progress",
+				Msg:   fmt.Sprintf("prerequisites installed on %s", name),
+				Level: "info",
+			})
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// startBootstrap uploads cake and spec as its config to the bootstrap VM over sftp and starts the engine there.
+// A privateKey the engine needs to reach the other nodes is installed for root first
+func (v *MgmtBootstrap) startBootstrap(ctx context.Context, name, bootstrapVMIP string, spec interface{}, privateKey string) error {
+	c, err := provider.WaitForCloudInit(bootstrapVMIP, v.sshAuth(name))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if privateKey != "" {
+		err = provider.InstallPrivateKey(c, privateKey)
+		if err != nil {
+			return err
+		}
+	}
+	err = v.UploadFilesToBootstrap(ctx, c, spec)
+	if err != nil {
+		return err
+	}
+	return v.StartRemoteCake(c)
+}
@@ -0,0 +1,88 @@
+package vsphere
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vmware/govmomi/event"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const maxSupportEvents int32 = 1000
+
+// EventLog returns one line per event of the datacenter since the given time, oldest first. Only warnings,
+// errors and events about the VMs in names are included
+func (s *Session) EventLog(since time.Time, names []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	m := event.NewManager(s.Conn.Client)
+	events, err := m.QueryEvents(ctx, types.EventFilterSpec{
+		Entity: &types.EventFilterSpecByEntity{
+			Entity:    s.Datacenter.Reference(),
+			Recursion: types.EventFilterSpecRecursionOptionAll,
+		},
+		Time:     &types.EventFilterSpecByTime{BeginTime: &since},
+		MaxCount: maxSupportEvents,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query events, %v", err)
+	}
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var out bytes.Buffer
+	// events are returned newest first
+	for x := len(events) - 1; x >= 0; x-- {
+		e := events[x].GetEvent()
+		category, err := m.EventCategory(ctx, events[x])
+		if err != nil {
+			category = "unknown"
+		}
+		var vm string
+		if e.Vm != nil {
+			vm = e.Vm.Name
+		}
+		if category != string(types.EventEventSeverityError) && category != string(types.EventEventSeverityWarning) && !wanted[vm] {
+			continue
+		}
+		fmt.Fprintf(&out, "%s %s %s: %s\n", e.CreatedTime.UTC().Format(time.RFC3339), category, vm, e.FullFormattedMessage)
+	}
+	return out.Bytes(), nil
+}
+
+// TaskErrors returns one line per recent task of the VMs at paths that failed, VMs that do not exist are skipped
+func (s *Session) TaskErrors(paths []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	finder := find.NewFinder(s.Conn.Client, true)
+	finder.SetDatacenter(s.Datacenter)
+	var out bytes.Buffer
+	for _, path := range paths {
+		vm, err := finder.VirtualMachine(ctx, path)
+		if _, ok := err.(*find.NotFoundError); ok {
+			fmt.Fprintf(&out, "%s: not found\n", path)
+			continue
+		}
+		if err != nil {
+			return out.Bytes(), err
+		}
+		tasks, err := getTasksForVM(vm)
+		if err != nil {
+			return out.Bytes(), err
+		}
+		for _, t := range tasks {
+			if t.State != types.TaskInfoStateError || t.Error == nil {
+				continue
+			}
+			fmt.Fprintf(&out, "%s %s %s: %s\n", t.QueueTime.UTC().Format(time.RFC3339), path, t.DescriptionId, t.Error.LocalizedMessage)
+		}
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,285 @@
+package vsphere
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/progress"
+	"github.com/netapp/cake/pkg/version"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const (
+	// tagCategory holds the tags of everything cake creates, an object has a cluster, deployment and role tag
+	tagCategory = "cake"
+
+	roleBootstrap = "bootstrap"
+	roleTemplate  = "template"
+	roleFolder    = "folder"
+
+	attributeVersion = "cake.version"
+	attributeCreated = "cake.created"
+	// attributeIPAMRef is the reservation of the address of a VM, it is released when the VM is destroyed
+	attributeIPAMRef = "cake.ipamRef"
+)
+
+func clusterTag(name string) string {
+	return "cluster:" + name
+}
+
+func deploymentTag(id string) string {
+	return "deployment:" + id
+}
+
+func roleTag(role string) string {
+	return "role:" + role
+}
+
+// newDeploymentID identifies the objects of one deploy
+func newDeploymentID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// LoginTags connects to the vAPI endpoint of vCenter for tags and content libraries, neither is available on a
+// standalone host
+func (s *Session) LoginTags(username string, password string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := rest.NewClient(s.Conn.Client)
+	err := c.Login(ctx, url.UserPassword(username, password))
+	if err != nil {
+		return fmt.Errorf("unable to login to the vSphere tagging service, %v", err)
+	}
+	s.REST = c
+	s.Tags = tags.NewManager(c)
+	return nil
+}
+
+// tagID returns the ID of the tag name in the cake category, the category and tag are created when create is set.
+// An empty ID means the tag does not exist
+func (s *Session) tagID(ctx context.Context, name string, create bool) (string, error) {
+	category, err := s.Tags.GetCategory(ctx, tagCategory)
+	if err != nil && !create {
+		return "", nil
+	}
+	if err != nil {
+		id, err := s.Tags.CreateCategory(ctx, &tags.Category{
+			Name:            tagCategory,
+			Description:     "Objects created by cake",
+			Cardinality:     "MULTIPLE",
+			AssociableTypes: []string{"VirtualMachine", "Folder"},
+		})
+		if err != nil {
+			return "", fmt.Errorf("unable to create tag category %s, %v", tagCategory, err)
+		}
+		category = &tags.Category{ID: id}
+	}
+	tag, err := s.Tags.GetTagForCategory(ctx, name, category.ID)
+	if err == nil {
+		return tag.ID, nil
+	}
+	if !create {
+		return "", nil
+	}
+	id, err := s.Tags.CreateTag(ctx, &tags.Tag{Name: name, CategoryID: category.ID})
+	if err != nil {
+		return "", fmt.Errorf("unable to create tag %s, %v", name, err)
+	}
+	return id, nil
+}
+
+// tagObject attaches the tags in names to ref and sets the custom attributes it does not have yet
+func (s *Session) tagObject(ref types.ManagedObjectReference, names []string, attributes map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	for _, name := range names {
+		id, err := s.tagID(ctx, name, true)
+		if err != nil {
+			return err
+		}
+		err = s.Tags.AttachTag(ctx, id, ref)
+		if err != nil {
+			return fmt.Errorf("unable to attach tag %s, %v", name, err)
+		}
+	}
+
+	if len(attributes) == 0 {
+		return nil
+	}
+	fields, err := object.GetCustomFieldsManager(s.Conn.Client)
+	if err != nil {
+		return fmt.Errorf("unable to set custom attributes, %v", err)
+	}
+	var entity mo.ManagedEntity
+	err = s.Conn.RetrieveOne(ctx, ref, []string{"customValue"}, &entity)
+	if err != nil {
+		return fmt.Errorf("unable to get custom attributes, %v", err)
+	}
+	set := map[int32]bool{}
+	for _, v := range entity.CustomValue {
+		set[v.GetCustomFieldValue().Key] = true
+	}
+	for name, value := range attributes {
+		key, err := fields.FindKey(ctx, name)
+		if err == object.ErrKeyNameNotFound {
+			var def *types.CustomFieldDef
+			def, err = fields.Add(ctx, name, "", nil, nil)
+			if def != nil {
+				key = def.Key
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("unable to add custom attribute %s, %v", name, err)
+		}
+		// a template reused by a later deploy keeps when it was created
+		if set[key] {
+			continue
+		}
+		err = fields.Set(ctx, ref, key, value)
+		if err != nil {
+			return fmt.Errorf("unable to set custom attribute %s, %v", name, err)
+		}
+	}
+	return nil
+}
+
+// tag marks ref as created by this deploy of the cluster, a VM name is given for the VMs cake clones. Tagging is
+// best effort, a failure is reported as a warning since destroy can still use the inventory
+func (v *MgmtBootstrap) tag(ref types.ManagedObjectReference, name string, roles ...string) {
+	if v.Session.Tags == nil {
+		return
+	}
+	names := []string{clusterTag(v.ClusterName), deploymentTag(v.DeploymentID)}
+	for _, role := range roles {
+		names = append(names, roleTag(role))
+	}
+	attributes := map[string]string{
+		attributeVersion: version.Version,
+		attributeCreated: time.Now().UTC().Format(time.RFC3339),
+	}
+	if a, ok := v.TrackedResources.Addresses[name]; ok {
+		attributes[attributeIPAMRef] = a.Ref
+	}
+	err := v.Session.tagObject(ref, names, attributes)
+	if err != nil {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("unable to tag %s, %v", ref.Value, err),
+			Level: progress.LevelWarn,
+		})
+	}
+}
+
+// tagTemplates tags the templates the cluster clones from, a template reused by another cluster gets the tags of both
+func (v *MgmtBootstrap) tagTemplates(templates map[string]*object.VirtualMachine) {
+	for _, t := range templates {
+		v.tag(t.Reference(), "", roleTemplate)
+	}
+}
+
+// tagFolders tags the folders cake created or reuses
+func (v *MgmtBootstrap) tagFolders(folders map[string]*object.Folder) {
+	for _, f := range folders {
+		v.tag(f.Reference(), "", roleFolder)
+	}
+}
+
+// taggedObjects returns the objects with the tag name and the names of all their tags by object
+func (s *Session) taggedObjects(name string) (map[types.ManagedObjectReference][]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	id, err := s.tagID(ctx, name, false)
+	if err != nil || id == "" {
+		return nil, err
+	}
+	refs, err := s.Tags.ListAttachedObjects(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the objects tagged %s, %v", name, err)
+	}
+	objects := map[types.ManagedObjectReference][]string{}
+	for _, ref := range refs {
+		exists, err := s.exists(ctx, ref.Reference())
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		attached, err := s.Tags.GetAttachedTags(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the tags of %s, %v", ref.Reference().Value, err)
+		}
+		var names []string
+		for _, t := range attached {
+			names = append(names, t.Name)
+		}
+		objects[ref.Reference()] = names
+	}
+	return objects, nil
+}
+
+// exists tells whether ref was not deleted, the tags of a deleted object can still list it for a while
+func (s *Session) exists(ctx context.Context, ref types.ManagedObjectReference) (bool, error) {
+	var entity mo.ManagedEntity
+	err := s.Conn.RetrieveOne(ctx, ref, []string{"name"}, &entity)
+	if err == nil {
+		return true, nil
+	}
+	if soap.IsSoapFault(err) {
+		if _, ok := soap.ToSoapFault(err).VimFault().(types.ManagedObjectNotFound); ok {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("unable to get %s, %v", ref.Value, err)
+}
+
+// tagValue returns the value of the first tag with prefix
+func tagValue(names []string, prefix string) (string, bool) {
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix), true
+		}
+	}
+	return "", false
+}
+
+// deleteUnusedTag removes the tag name once no object has it anymore
+func (s *Session) deleteUnusedTag(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	id, err := s.tagID(ctx, name, false)
+	if err != nil || id == "" {
+		return err
+	}
+	refs, err := s.Tags.ListAttachedObjects(ctx, id)
+	if err != nil {
+		return fmt.Errorf("unable to list the objects tagged %s, %v", name, err)
+	}
+	for _, ref := range refs {
+		exists, err := s.exists(ctx, ref.Reference())
+		if err != nil || exists {
+			return err
+		}
+	}
+	err = s.Tags.DeleteTag(ctx, &tags.Tag{ID: id})
+	if err != nil {
+		return fmt.Errorf("unable to delete tag %s, %v", name, err)
+	}
+	return nil
+}
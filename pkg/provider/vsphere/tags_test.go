@@ -0,0 +1,165 @@
+package vsphere
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
+	"github.com/netapp/cake/pkg/ipam"
+	"github.com/netapp/cake/pkg/provider"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func customValues(t *testing.T, v *MgmtBootstrap, ref types.ManagedObjectReference) map[string]string {
+	fields, err := object.GetCustomFieldsManager(v.Session.Conn.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defs, err := fields.Field(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entity mo.ManagedEntity
+	err = v.Session.Conn.RetrieveOne(context.TODO(), ref, []string{"customValue"}, &entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{}
+	for _, value := range entity.CustomValue {
+		s := value.(*types.CustomFieldStringValue)
+		values[defs.ByKey(s.Key).Name] = s.Value
+	}
+	return values
+}
+
+func TestTaggedInventory(t *testing.T) {
+	v := newFixture(t, withClusterPool(), withLogin(), withTags("tagged"))
+	vm, err := v.Session.GetVM("DC0_H0_VM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders, err := v.Session.CreateVMFolders("tagged/bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.TrackedResources.Addresses["DC0_H0_VM1"] = &ipam.Address{Ref: "ref-1"}
+	v.tag(vm.Reference(), "DC0_H0_VM1", "worker", roleBootstrap)
+	v.tagFolders(folders)
+	if events := v.EventStream.(*recordedEvents).events; len(events) != 0 {
+		t.Fatalf("unexpected events %+v", events[0])
+	}
+
+	values := customValues(t, v, vm.Reference())
+	created := values[attributeCreated]
+	if values[attributeVersion] != "dev" || created == "" || values[attributeIPAMRef] != "ref-1" {
+		t.Errorf("unexpected custom attributes %v", values)
+	}
+	// a second deploy does not change when the object was created
+	v.tag(vm.Reference(), "DC0_H0_VM1", "worker")
+	if got := customValues(t, v, vm.Reference())[attributeCreated]; got != created {
+		t.Errorf("created changed from %v to %v", created, got)
+	}
+
+	inv, tagged, err := v.taggedInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Nodes) != 1 {
+		t.Fatalf("expected one node, got %+v", inv.Nodes)
+	}
+	n := inv.Nodes[0]
+	if n.Name != "DC0_H0_VM1" || n.VM != vm.InventoryPath || n.IPAMRef != "ref-1" || !n.Bootstrap {
+		t.Errorf("unexpected node %+v", n)
+	}
+	if inv.Deployment != v.DeploymentID || len(inv.Folders) != 2 {
+		t.Errorf("unexpected inventory %+v", inv)
+	}
+	if role, _ := tagValue(tagged[vm.InventoryPath], "role:"); role == "" {
+		t.Errorf("no role tag in %v", tagged[vm.InventoryPath])
+	}
+
+	_, err = v.RebuildInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := provider.LoadInventory(filepath.Join(v.LogDir, provider.InventoryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Nodes) != 1 || saved.Nodes[0].IPAMRef != "ref-1" {
+		t.Errorf("unexpected rebuilt inventory %+v", saved)
+	}
+
+	// the VM is shared with other tests
+	for _, name := range []string{clusterTag("tagged"), deploymentTag(v.DeploymentID), roleTag("worker"), roleTag(roleBootstrap)} {
+		id, err := v.Session.tagID(context.TODO(), name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.Session.Tags.DetachTag(context.TODO(), id, vm.Reference())
+	}
+}
+
+func TestDestroy(t *testing.T) {
+	v := newFixture(t, withClusterPool(), withLogin(), withTags("destroyed"))
+	addresses := &fakeIPAM{fail: map[string]bool{}, released: map[string]bool{}}
+	v.AddressManager = addresses
+
+	folders, err := v.Session.CreateVMFolders("destroyed/mgmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.tagFolders(folders)
+	v.Session.Folder = folders["mgmt"]
+	v.Session.Datastore, err = v.Session.GetDatastore("/DC0/datastore/LocalDS_0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Session.Network, err = v.Session.GetNetwork("/DC0/network/VM Network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := v.Session.GetVM("DC0_C0_RP0_VM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := v.Session.CloneTemplate(context.Background(), Template{VM: template}, "destroyed-worker-1", "#!/bin/bash", nil, "ubuntu", nil, vsphereConfig.VMSize{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.TrackedResources.Addresses["destroyed-worker-1"] = &ipam.Address{Ref: "ref-worker"}
+	v.tag(vm.Reference(), "destroyed-worker-1", "worker")
+
+	// the VM that was never tagged is only known from the local inventory
+	err = v.SaveInventory(&provider.Inventory{
+		Cluster: "destroyed",
+		Nodes:   []provider.InventoryNode{{Name: "destroyed-worker-2", VM: "/DC0/vm/destroyed/mgmt/destroyed-worker-2", IPAMRef: "ref-lost"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = v.Destroy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Session.GetVM("destroyed-worker-1"); err == nil {
+		t.Error("VM was not destroyed")
+	}
+	if !addresses.released["ref-worker"] || !addresses.released["ref-lost"] {
+		t.Errorf("addresses were not released, %v", addresses.released)
+	}
+	if _, err := v.Session.GetFolder("/DC0/vm/destroyed"); err == nil {
+		t.Error("folder was not destroyed")
+	}
+	if id, _ := v.Session.tagID(context.TODO(), clusterTag("destroyed"), false); id != "" {
+		t.Error("cluster tag was not deleted")
+	}
+	if _, err := os.Stat(filepath.Join(v.LogDir, provider.InventoryFileName)); !os.IsNotExist(err) {
+		t.Errorf("inventory was not removed, %v", err)
+	}
+}
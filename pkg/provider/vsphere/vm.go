@@ -4,27 +4,39 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
+	"github.com/netapp/cake/pkg/metrics"
 	"github.com/netapp/cake/pkg/provider/vsphere/cloudinit"
+	"github.com/netapp/cake/pkg/tracing"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/library"
 	"github.com/vmware/govmomi/vim25/types"
 	"golang.org/x/sync/errgroup"
 )
 
-const defaultVMMemoryInMB int64 = 8 * 1024 // = 8192 or 8 GB in MB
-
 type cloneSpec struct {
-	template   *object.VirtualMachine
+	template   Template
 	name       string
 	bootScript string
 	publicKey  []string
 	osUser     string
+	nics       []NIC
+	size       vsphereConfig.VMSize
+}
+
+// NIC is a network adapter of a cloned VM
+type NIC struct {
+	Network object.NetworkReference
+	// Config is the address of the NIC, nil keeps the network config of the template
+	Config *cloudinit.NetworkConfig
 }
 
 // CloneTemplates clones multiple VMs asynchronously
-func (s *Session) CloneTemplates(clonesSpec ...cloneSpec) (map[string]*object.VirtualMachine, error) {
+func (s *Session) CloneTemplates(ctx context.Context, clonesSpec ...cloneSpec) (map[string]*object.VirtualMachine, error) {
 	numVMs := len(clonesSpec)
 	result := make(map[string]*object.VirtualMachine, numVMs)
 	resultMutex := sync.Mutex{}
@@ -42,7 +54,7 @@ func (s *Session) CloneTemplates(clonesSpec ...cloneSpec) (map[string]*object.Vi
 		for _, vm := range clonesSpec[i:j] {
 			vm := vm
 			g.Go(func() error {
-				r, err := s.CloneTemplate(vm.template, vm.name, vm.bootScript, vm.publicKey, vm.osUser)
+				r, err := s.CloneTemplate(ctx, vm.template, vm.name, vm.bootScript, vm.publicKey, vm.osUser, vm.nics, vm.size)
 				if err != nil {
 					return err
 				}
@@ -61,51 +73,140 @@ func (s *Session) CloneTemplates(clonesSpec ...cloneSpec) (map[string]*object.Vi
 
 }
 
-// CloneTemplate creates a VM from a template
-func (s *Session) CloneTemplate(template *object.VirtualMachine, name string, bootScript string, publicKeys []string, osUser string) (*object.VirtualMachine, error) {
+// Template is what VMs are created from, a classic VM template or an item of the content library
+type Template struct {
+	VM   *object.VirtualMachine
+	Item *library.Item
+}
+
+// CloneTemplate creates a VM from a template with a vmxnet3 adapter for every NIC in order, no NICs attach the
+// management network with the network config of the template. The VM gets the resources of the resolved size, its
+// disk is grown before it is powered on. The VM publishes its ssh host keys through guestinfo, see hostKeys
+func (s *Session) CloneTemplate(ctx context.Context, template Template, name string, bootScript string, publicKeys []string, osUser string, nics []NIC, size vsphereConfig.VMSize) (*object.VirtualMachine, error) {
 
 	// give whole clone process a 10 minute timeout
 	d := time.Now().Add(10 * time.Minute)
-	ctx, cancel := context.WithDeadline(context.Background(), d)
+	ctx, cancel := context.WithDeadline(ctx, d)
 	defer cancel()
 
+	if len(nics) == 0 {
+		nics = []NIC{{Network: s.Network}}
+	}
+
 	cloudinitUserDataConfig, err := cloudinit.GenerateUserData(bootScript, publicKeys, osUser)
 	if err != nil {
 		return nil, fmt.Errorf("unable to generate user data, %v", err)
 	}
-	cloudinitMetaDataConfig, err := cloudinit.GenerateMetaData(name)
+
+	var created *object.VirtualMachine
+	if template.Item != nil {
+		created, err = s.deployLibraryItem(ctx, template.Item, name)
+		if err != nil {
+			return nil, err
+		}
+		// the deployed VM is configured the same way a clone is
+		config, err := s.vmConfig(ctx, created, name, cloudinitUserDataConfig, nics, size)
+		if err == nil {
+			err = reconfigure(ctx, created, *config)
+		}
+		if err != nil {
+			_ = DeleteVM(created)
+			return nil, err
+		}
+	} else {
+		config, err := s.vmConfig(ctx, template.VM, name, cloudinitUserDataConfig, nics, size)
+		if err != nil {
+			return nil, err
+		}
+		created, err = s.cloneVM(ctx, template.VM, name, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the VM is looked up again for its inventory path
+	vm, err := s.GetVM(name)
 	if err != nil {
-		return nil, fmt.Errorf("unable to generate metadata, %v", err)
+		_ = DeleteVM(created)
+		return nil, fmt.Errorf("unable to find virtual machine, %v", err)
 	}
 
-	spec := types.VirtualMachineCloneSpec{}
-	spec.Config = &types.VirtualMachineConfigSpec{}
-	spec.Config.ExtraConfig = append(spec.Config.ExtraConfig, cloudinitUserDataConfig...)
-	spec.Config.ExtraConfig = append(spec.Config.ExtraConfig, cloudinitMetaDataConfig...)
-	/*
-		TODO make cpu and memory configurable
-		spec.Config.NumCPUs = int32
-		spec.Config.MemoryMB = int64
-	*/
-	spec.Config.MemoryMB = defaultVMMemoryInMB
-	spec.Location.Datastore = types.NewReference(s.Datastore.Reference())
-	spec.Location.Pool = types.NewReference(s.ResourcePool.Reference())
-	spec.PowerOn = false // Do not turn machine on until after metadata reconfiguration
-	spec.Location.DiskMoveType = string(types.VirtualMachineRelocateDiskMoveOptionsMoveAllDiskBackingsAndConsolidate)
+	err = powerOn(ctx, vm, name, nics, size)
+	if err != nil {
+		// the caller only tracks the VMs that are returned
+		_ = DeleteVM(vm)
+		return nil, err
+	}
+	return vm, nil
+}
+
+// powerOn sets the network config of the NICs and grows the disk of a created VM before it is powered on
+func powerOn(ctx context.Context, vm *object.VirtualMachine, name string, nics []NIC, size vsphereConfig.VMSize) error {
+	// the network config matches the NICs by the MACs vSphere assigned them
+	err := setMetadata(ctx, vm, name, nics)
+	if err != nil {
+		return err
+	}
+
+	// cloud-init grows the root filesystem to the disk on first boot
+	if size.DiskGB > 0 {
+		err = growDisk(ctx, vm, size.DiskGB)
+		if err != nil {
+			return err
+		}
+	}
+
+	// log.Debugf("powering on %s", name)
+	_, span := tracing.Start(ctx, metrics.TaskPowerOn)
+	span.SetAttribute("vm.name", name)
+	start := time.Now()
+	task, err := vm.PowerOn(ctx)
+	if err != nil {
+		span.End(err)
+		return fmt.Errorf("unable to power on VM, %v", err)
+	}
+
+	err = task.Wait(ctx)
+	metrics.ObserveTask(metrics.TaskPowerOn, start, err)
+	span.End(err)
+	if err != nil {
+		return fmt.Errorf("power on task failed, %v", err)
+	}
+	return nil
+}
+
+// vmConfig returns the config of a VM created from source, it replaces the NICs of source and sets the resources
+// of size
+func (s *Session) vmConfig(ctx context.Context, source *object.VirtualMachine, name string, extraConfig []types.BaseOptionValue, nics []NIC, size vsphereConfig.VMSize) (*types.VirtualMachineConfigSpec, error) {
+	config := &types.VirtualMachineConfigSpec{}
+	config.ExtraConfig = append(config.ExtraConfig, extraConfig...)
+	// resources that are not set keep the value of the template
+	config.NumCPUs = int32(size.VCPUs)
+	config.MemoryMB = int64(size.MemoryMB)
 
-	vmProps, err := getProperties(template)
+	vmProps, err := getProperties(source)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get virtual machine properties, %v", err)
 	}
 
 	l := object.VirtualDeviceList(vmProps.Config.Hardware.Device)
 
+	if size.DiskGB > 0 {
+		disk, err := firstDisk(l)
+		if err != nil {
+			return nil, fmt.Errorf("unable to size the disk of %s, %v", name, err)
+		}
+		if disk.CapacityInKB > int64(size.DiskGB)*1024*1024 {
+			return nil, fmt.Errorf("DiskGB %v of %s is smaller than the %v GB disk of its template", size.DiskGB, name, disk.CapacityInKB/1024/1024)
+		}
+	}
+
 	deviceSpecs := []types.BaseVirtualDeviceConfigSpec{}
 
-	nics := l.SelectByType((*types.VirtualEthernetCard)(nil))
+	existing := l.SelectByType((*types.VirtualEthernetCard)(nil))
 
 	// Remove any existing nics on the source vm
-	for _, dev := range nics {
+	for _, dev := range existing {
 		nic := dev.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
 		nicspec := &types.VirtualDeviceConfigSpec{}
 		nicspec.Operation = types.VirtualDeviceConfigSpecOperationRemove
@@ -113,51 +214,104 @@ func (s *Session) CloneTemplate(template *object.VirtualMachine, name string, bo
 		deviceSpecs = append(deviceSpecs, nicspec)
 	}
 
-	nic := types.VirtualVmxnet3{}
-	nic.Backing, err = s.Network.EthernetCardBackingInfo(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("unable to get information on NIC, %v", err)
+	for x, n := range nics {
+		nic := types.VirtualVmxnet3{}
+		nic.Backing, err = n.Network.EthernetCardBackingInfo(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get information on NIC, %v", err)
+		}
+		// negative keys are replaced by vSphere, they keep the NICs apart within the spec
+		nic.Key = int32(-100 - x)
+		nicspec := &types.VirtualDeviceConfigSpec{}
+		nicspec.Operation = types.VirtualDeviceConfigSpecOperationAdd
+		nicspec.Device = &nic
+		deviceSpecs = append(deviceSpecs, nicspec)
 	}
-	nicspec := &types.VirtualDeviceConfigSpec{}
-	nicspec.Operation = types.VirtualDeviceConfigSpecOperationAdd
-	nicspec.Device = &nic
-	deviceSpecs = append(deviceSpecs, nicspec)
 
-	spec.Config.DeviceChange = deviceSpecs
+	config.DeviceChange = deviceSpecs
+	return config, nil
+}
+
+// cloneVM clones template into a powered off VM name
+func (s *Session) cloneVM(ctx context.Context, template *object.VirtualMachine, name string, config *types.VirtualMachineConfigSpec) (*object.VirtualMachine, error) {
+	spec := types.VirtualMachineCloneSpec{}
+	spec.Config = config
+	spec.Location.Datastore = types.NewReference(s.Datastore.Reference())
+	spec.Location.Pool = types.NewReference(s.ResourcePool.Reference())
+	spec.PowerOn = false // Do not turn machine on until after metadata reconfiguration
+	spec.Location.DiskMoveType = string(types.VirtualMachineRelocateDiskMoveOptionsMoveAllDiskBackingsAndConsolidate)
 
 	// log.Debugf("cloning %s with spec: %+v", name, spec)
+	_, span := tracing.Start(ctx, metrics.TaskClone)
+	span.SetAttribute("vm.name", name)
+	start := time.Now()
 	task, err := template.Clone(ctx, s.Folder, name, spec)
 	if err != nil {
+		span.End(err)
 		return nil, fmt.Errorf("unable to clone template, %v", err)
 	}
 
-	err = task.Wait(ctx)
+	info, err := task.WaitForResult(ctx, nil)
+	metrics.ObserveTask(metrics.TaskClone, start, err)
+	span.End(err)
 	if err != nil {
 		return nil, fmt.Errorf("clone task failed, %v", err)
 	}
+	return object.NewVirtualMachine(s.Conn.Client, info.Result.(types.ManagedObjectReference)), nil
+}
 
-	vm, err := s.GetVM(name)
+// reconfigure applies config to vm
+func reconfigure(ctx context.Context, vm *object.VirtualMachine, config types.VirtualMachineConfigSpec) error {
+	task, err := vm.Reconfigure(ctx, config)
 	if err != nil {
-		return nil, fmt.Errorf("unable to find virtual machine, %v", err)
+		return fmt.Errorf("unable to reconfigure %s, %v", vm.InventoryPath, err)
 	}
-
 	err = task.Wait(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("reconfigure task failed, %v", err)
+		return fmt.Errorf("reconfigure task for %s failed, %v", vm.InventoryPath, err)
 	}
+	return nil
+}
 
-	// log.Debugf("powering on %s", name)
-	task, err = vm.PowerOn(ctx)
+// setMetadata sets the cloud-init metadata of vm, the network config is only rendered when a NIC has a Config or
+// there is more than one
+func setMetadata(ctx context.Context, vm *object.VirtualMachine, name string, nics []NIC) error {
+	var networks []cloudinit.NetworkConfig
+	if len(nics) > 1 || nics[0].Config != nil {
+		devices, err := vm.Device(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to get the devices of %s, %v", name, err)
+		}
+		cards := devices.SelectByType((*types.VirtualEthernetCard)(nil))
+		if len(cards) != len(nics) {
+			return fmt.Errorf("%s has %v NICs, expected %v", name, len(cards), len(nics))
+		}
+		// NICs keep the order they were added in
+		sort.Slice(cards, func(i, j int) bool {
+			return cards[i].GetVirtualDevice().Key < cards[j].GetVirtualDevice().Key
+		})
+		for x, n := range nics {
+			var c cloudinit.NetworkConfig
+			if n.Config != nil {
+				c = *n.Config
+			}
+			c.MAC = cards[x].(types.BaseVirtualEthernetCard).GetVirtualEthernetCard().MacAddress
+			networks = append(networks, c)
+		}
+	}
+	cloudinitMetaDataConfig, err := cloudinit.GenerateMetaData(name, networks)
 	if err != nil {
-		return nil, fmt.Errorf("unable to power on VM, %v", err)
+		return fmt.Errorf("unable to generate metadata, %v", err)
+	}
+	task, err := vm.Reconfigure(ctx, types.VirtualMachineConfigSpec{ExtraConfig: cloudinitMetaDataConfig})
+	if err != nil {
+		return fmt.Errorf("unable to set the metadata of %s, %v", name, err)
 	}
-
 	err = task.Wait(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("power on task failed, %v", err)
+		return fmt.Errorf("reconfigure task failed, %v", err)
 	}
-
-	return vm, nil
+	return nil
 }
 
 // DeleteVM deletes a VM
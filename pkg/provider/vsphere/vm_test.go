@@ -0,0 +1,54 @@
+package vsphere
+
+import (
+	"context"
+	"testing"
+
+	"github.com/netapp/cake/pkg/metrics"
+	"github.com/netapp/cake/pkg/tracing"
+)
+
+func TestCloneTemplatesSpans(t *testing.T) {
+	s := newFixture(t, withHostPool(-1)).Session
+	template, err := s.GetVM("DC0_H0_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracing.NewInMemoryExporter()
+	tracing.SetExporter(exporter)
+	defer tracing.SetExporter(nil)
+
+	ctx, root := tracing.StartRoot(context.Background(), "deploy", "")
+	var nodes []cloneSpec
+	for _, name := range []string{"spans-1", "spans-2"} {
+		nodes = append(nodes, cloneSpec{template: Template{VM: template}, name: name, bootScript: "#!/bin/bash", osUser: "ubuntu"})
+	}
+	vms, err := s.CloneTemplates(ctx, nodes...)
+	for _, vm := range vms {
+		defer DeleteVM(vm)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.End(nil)
+	tracing.Flush()
+	traceID, rootID, err := tracing.ParseTraceParent(root.TraceParent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the clones run in their own goroutines, their spans still belong to the deploy
+	var clones int
+	for _, span := range exporter.Spans() {
+		if span.Name != metrics.TaskClone {
+			continue
+		}
+		clones++
+		if span.TraceID != traceID || span.ParentSpanID != rootID {
+			t.Errorf("expected %s to be a child of the root span, actual: %+v", span.Attributes["vm.name"], span)
+		}
+	}
+	if clones != len(nodes) {
+		t.Fatalf("expected %v clone spans, actual: %+v", len(nodes), exporter.Spans())
+	}
+}
@@ -1,19 +1,20 @@
 package vsphere
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/netapp/cake/pkg/config/cluster"
+	"github.com/netapp/cake/pkg/config/types"
 	vsphereConfig "github.com/netapp/cake/pkg/config/vsphere"
+	"github.com/netapp/cake/pkg/ipam"
 	"github.com/netapp/cake/pkg/progress"
 	"github.com/netapp/cake/pkg/provider"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/object"
-	"io/ioutil"
-	"net/http"
-	"path"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vapi/tags"
 	"path/filepath"
-	"time"
+	"sort"
 )
 
 // Session holds govmomi connection details
@@ -24,18 +25,39 @@ type Session struct {
 	Folder       *object.Folder
 	ResourcePool *object.ResourcePool
 	Network      object.NetworkReference
+	// Networks are the networks VMs can be attached to by name, including Network
+	Networks map[string]object.NetworkReference
+	// REST is the vAPI client of vCenter, nil when the vAPI endpoint is not available
+	REST *rest.Client
+	// Tags is nil when the tagging service is not available
+	Tags *tags.Manager
+	// Events receives the download and upload progress of OVAs, nil publishes nothing
+	Events progress.Events
+	// Cache keeps the OVAs downloaded over HTTP, without one they are streamed from their URL on every read
+	Cache *OVACache
 }
 
 // TrackedResources are vmware objects created during the bootstrap process
 type TrackedResources struct {
 	Folders map[string]*object.Folder
 	VMs     map[string]*object.VirtualMachine
+	// Templates are imported from the OVAs, keyed by OVA path
+	Templates map[string]*object.VirtualMachine
+	// Bootstrap names the VMs, templates and folders Finalize removes as the Cleanup policy allows
+	Bootstrap map[string]bool
+	// Addresses are reserved from the IPAM, keyed by VM name
+	Addresses map[string]*ipam.Address
+	// Rules are the DRS rules created for the VMs, keyed by rule name
+	Rules map[string]*object.ClusterComputeResource
 }
 
 // GeneratedKey is the key pair generated for the run
 type GeneratedKey struct {
-	PrivateKey string
+	PrivateKey types.Secret
 	PublicKey  string
+	// HostKeys are the public ssh host keys the VMs published through guestinfo keyed by VM name, they are pinned
+	// when connecting to them
+	HostKeys map[string][]string
 }
 
 // MgmtBootstrap spec for CAPV
@@ -45,6 +67,10 @@ type MgmtBootstrap struct {
 	Session                       *Session         `yaml:"-" json:"-" mapstructure:"-"`
 	TrackedResources              TrackedResources `yaml:"-" json:"-" mapstructure:"-"`
 	Prerequisites                 string           `yaml:"-" json:"-" mapstructure:"-"`
+	GeneratedKey                  GeneratedKey     `yaml:"-" json:"-" mapstructure:"-"`
+	AddressManager                ipam.IPAM        `yaml:"-" json:"-" mapstructure:"-"`
+	// DeploymentID is tagged on everything the deploy creates
+	DeploymentID string `yaml:"-" json:"-" mapstructure:"-"`
 }
 
 // MgmtBootstrapCAPV is the spec for bootstrapping a CAPV management cluster
@@ -60,12 +86,32 @@ type MgmtBootstrapRKE struct {
 	Nodes         map[string]string `yaml:"Nodes" json:"nodes"`
 	RKEConfigPath string            `yaml:"RKEConfigPath"`
 	Hostname      string            `yaml:"Hostname" json:"hostname"`
-	GeneratedKey  GeneratedKey      `yaml:"-" json:"-" mapstructure:"-"`
+	Backup        cluster.Backup    `yaml:"Backup,omitempty" json:"backup,omitempty"`
 }
 
 // Client setups connection to remote vCenter
-func (v *MgmtBootstrap) Client() error {
-	c, err := NewClient(v.URL, v.Username, v.Password)
+func (v *MgmtBootstrap) Client(ctx context.Context) error {
+	_, err := v.CleanupPolicy()
+	if err != nil {
+		return err
+	}
+	err = v.validateStaticIPs()
+	if err != nil {
+		return err
+	}
+	err = v.validateVMSizes()
+	if err != nil {
+		return err
+	}
+	err = v.validateNetworks()
+	if err != nil {
+		return err
+	}
+	v.AddressManager, err = ipam.New(v.IPAM)
+	if err != nil {
+		return err
+	}
+	c, err := NewClient(v.URL, v.Username, v.Password.Reveal())
 	if err != nil {
 		return err
 	}
@@ -73,10 +119,34 @@ func (v *MgmtBootstrap) Client() error {
 	if err != nil {
 		return err
 	}
-	c.Network, err = c.GetNetwork(v.ManagementNetwork)
+	err = c.LoginTags(v.Username, v.Password.Reveal())
+	if err != nil && v.OVA.ContentLibrary.Name != "" {
+		return fmt.Errorf("content library %s can not be used, %v", v.OVA.ContentLibrary.Name, err)
+	}
+	if err != nil {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   fmt.Sprintf("%v, the objects cake creates are not tagged and can only be found from inventory.json", err),
+			Level: progress.LevelWarn,
+		})
+	}
+	v.DeploymentID = newDeploymentID()
+	c.Events = v.EventStream
+	c.Cache, err = NewOVACache(v.OVA.Checksums)
 	if err != nil {
 		return err
 	}
+	c.Networks = make(map[string]object.NetworkReference)
+	for _, name := range v.networkNames() {
+		if _, ok := c.Networks[name]; ok {
+			continue
+		}
+		c.Networks[name], err = c.GetNetwork(name)
+		if err != nil {
+			return err
+		}
+	}
+	c.Network = c.Networks[v.ManagementNetwork]
 	c.Datastore, err = c.GetDatastore(v.Datastore)
 	if err != nil {
 		return err
@@ -88,81 +158,36 @@ func (v *MgmtBootstrap) Client() error {
 	v.Session = c
 	v.TrackedResources.Folders = make(map[string]*object.Folder)
 	v.TrackedResources.VMs = make(map[string]*object.VirtualMachine)
+	v.TrackedResources.Templates = make(map[string]*object.VirtualMachine)
+	v.TrackedResources.Bootstrap = make(map[string]bool)
+	v.TrackedResources.Addresses = make(map[string]*ipam.Address)
+	v.TrackedResources.Rules = make(map[string]*object.ClusterComputeResource)
 
 	return nil
 }
 
 // Progress monitors the of the management cluster bootstrapping process
-func (v *MgmtBootstrap) Progress() error {
-	var err error
-	var completedSuccessfully bool
-	var respStruct progress.Status
-	var progressMessages []string
-	var msgLen int
-
-	for {
-		resp, err := http.Get("http://" + v.BootstrapperIP + ":8081/progress")
-		if err != nil {
-			time.Sleep(2 * time.Second)
-			continue
-		}
-		responseData, _ := ioutil.ReadAll(resp.Body)
-		json.Unmarshal(responseData, &respStruct)
-		currentProgressMessages := respStruct.Messages
-		msgLen = len(progressMessages)
-		for x := msgLen; x < len(currentProgressMessages); x++ {
-			v.EventStream.Publish(&progress.StatusEvent{
-				Type:  "progress",
-				Msg:   respStruct.Messages[x],
-				Level: "info",
-			})
-			progressMessages = append(progressMessages, respStruct.Messages[x])
-		}
-		if respStruct.Complete {
-			completedSuccessfully = respStruct.CompletedSuccessfully
-			break
-		}
-		time.Sleep(1 * time.Second)
-	}
-	if !completedSuccessfully {
-		err = fmt.Errorf("didnt complete successfully")
-	}
-
-	return err
+func (v *MgmtBootstrap) Progress(ctx context.Context) error {
+	return v.WatchProgress()
 }
 
 // Finalize handles saving deliverables and cleaning up the bootstrap VM
-func (v *MgmtBootstrap) Finalize() error {
-	var err error
-	url := fmt.Sprintf("http://%s:8081", v.BootstrapperIP)
-	downloadDir := v.LogDir
-	// save log file to disk
-	progress.DownloadTxtFile(fmt.Sprintf("%s%s", url, progress.URILogs), path.Join(downloadDir, v.ClusterName+".log"))
-
-	r, err := http.Get(fmt.Sprintf("%s%s", url, progress.URIDeliverable))
-	if err != nil {
-		return err
+func (v *MgmtBootstrap) Finalize(ctx context.Context, succeeded bool) error {
+	err := v.DownloadDeliverables()
+	// the deliverables only exist on the bootstrap node until they are downloaded
+	cleanupErr := v.cleanup(succeeded && err == nil)
+	if !succeeded && v.RemoveBootstrap(false) {
+		// a failed deploy is torn down, the nodes whose VMs are gone no longer need their reservations
+		v.rollbackAddresses(v.TrackedResources.reservedNames()...)
 	}
-	resp, err := ioutil.ReadAll(r.Body)
+	rulesErr := v.cleanupRules(succeeded)
 	if err != nil {
 		return err
 	}
-	var deliverables []progress.DeliverableInfo
-	json.Unmarshal(resp, &deliverables)
-	for _, elem := range deliverables {
-		name := fmt.Sprintf("%s%s", filepath.Base(elem.Url), elem.FileExt)
-		err := progress.DownloadTxtFile(fmt.Sprintf("%s%s", url, elem.Url), path.Join(downloadDir, name))
-		if err != nil {
-			return err
-		}
+	if cleanupErr != nil {
+		return cleanupErr
 	}
-
-	v.EventStream.Publish(&progress.StatusEvent{
-		Type:  "progress",
-		Msg:   fmt.Sprintf("all files from the cluster deployment can be found here: %s/", downloadDir),
-		Level: "info",
-	})
-	return err
+	return rulesErr
 }
 
 // Events returns the channel of progress messages
@@ -182,6 +207,12 @@ func (tr *TrackedResources) addTrackedVM(resources map[string]*object.VirtualMac
 	}
 }
 
+func (tr *TrackedResources) addTrackedTemplate(resources map[string]*object.VirtualMachine) {
+	for key, value := range resources {
+		tr.Templates[key] = value
+	}
+}
+
 func (v *MgmtBootstrap) createFolders() error {
 	desiredFolders := []string{
 		fmt.Sprintf("%s/%s", baseFolder, templatesFolder),
@@ -194,6 +225,11 @@ func (v *MgmtBootstrap) createFolders() error {
 			return err
 		}
 		v.TrackedResources.addTrackedFolder(tempFolder)
+		v.tagFolders(tempFolder)
+	}
+	v.TrackedResources.markBootstrap(bootstrapFolder)
+	if v.CleanupTemplates {
+		v.TrackedResources.markBootstrap(templatesFolder)
 	}
 
 	if v.Folder != "" {
@@ -202,6 +238,7 @@ func (v *MgmtBootstrap) createFolders() error {
 			return err
 		}
 		v.TrackedResources.addTrackedFolder(fromConfig)
+		v.tagFolders(fromConfig)
 		v.Folder = fromConfig[filepath.Base(v.Folder)].InventoryPath
 		v.Session.Folder = fromConfig[filepath.Base(v.Folder)]
 	} else {
@@ -210,8 +247,52 @@ func (v *MgmtBootstrap) createFolders() error {
 			return err
 		}
 		v.TrackedResources.addTrackedFolder(tempFolder)
+		v.tagFolders(tempFolder)
 		v.Folder = tempFolder[mgmtFolder].InventoryPath
 		v.Session.Folder = tempFolder[mgmtFolder]
 	}
 	return nil
 }
+
+// saveInventory records the tracked VMs, templates, folders, DRS rules and reserved addresses with the node IPs known so far, bootstrap names
+// the VM the engine runs on
+func (v *MgmtBootstrap) saveInventory(ips map[string]string, bootstrap string) {
+	inv := v.NewInventory()
+	inv.Deployment = v.DeploymentID
+	for name, vm := range v.TrackedResources.VMs {
+		n := inv.Node(name)
+		n.VM = vm.InventoryPath
+		n.Address = ips[name]
+		n.Bootstrap = name == bootstrap
+		n.HostKeys = v.GeneratedKey.HostKeys[name]
+	}
+	// addresses are reserved before the VMs are cloned
+	for name, a := range v.TrackedResources.Addresses {
+		inv.Node(name).IPAMRef = a.Ref
+	}
+	for x := range inv.Nodes {
+		if c := v.nodeNetwork(inv.Nodes[x].Name); c != nil {
+			inv.Nodes[x].Address = c.IP()
+		}
+	}
+	for _, template := range v.TrackedResources.Templates {
+		inv.Templates = append(inv.Templates, template.InventoryPath)
+	}
+	for _, folder := range v.TrackedResources.Folders {
+		inv.Folders = append(inv.Folders, folder.InventoryPath)
+	}
+	for name := range v.TrackedResources.Rules {
+		inv.Rules = append(inv.Rules, name)
+	}
+	sort.Strings(inv.Templates)
+	sort.Strings(inv.Folders)
+	sort.Strings(inv.Rules)
+	err := v.SaveInventory(inv)
+	if err != nil {
+		v.EventStream.Publish(&progress.StatusEvent{
+			Type:  "progress",
+			Msg:   err.Error(),
+			Level: progress.LevelWarn,
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Package support collects the logs and state of a deployment into a bundle that can be shared
+package support
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// IndexFileName lists every file of a bundle and where it was collected from
+const IndexFileName = "index.json"
+
+// Entry describes a file of the bundle, a collection that failed has an Error and possibly no file
+type Entry struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Size   int64  `json:"size"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Index is saved as the last file of a bundle
+type Index struct {
+	Cluster string    `json:"cluster"`
+	Created time.Time `json:"created"`
+	Entries []Entry   `json:"entries"`
+}
+
+// Bundle is a gzipped tarball, every file is redacted before it is added
+type Bundle struct {
+	// Path of the tarball
+	Path  string
+	root  string
+	file  *os.File
+	gz    *gzip.Writer
+	tw    *tar.Writer
+	index Index
+}
+
+// NewBundle creates cake-support-<cluster>-<timestamp>.tar.gz in dir, everything in it is under a directory of the same name
+func NewBundle(dir, cluster string, now time.Time) (*Bundle, error) {
+	root := fmt.Sprintf("cake-support-%s-%s", cluster, now.UTC().Format("20060102T150405Z"))
+	p := filepath.Join(dir, root+".tar.gz")
+	// the bundle is redacted but still describes the infrastructure
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create support bundle, %v", err)
+	}
+	gz := gzip.NewWriter(f)
+	return &Bundle{
+		Path:  p,
+		root:  root,
+		file:  f,
+		gz:    gz,
+		tw:    tar.NewWriter(gz),
+		index: Index{Cluster: cluster, Created: now.UTC()},
+	}, nil
+}
+
+// Add writes data as name and records it in the index with its source. The error of a failed collection is
+// recorded as well, whatever output it produced is still added
+func (b *Bundle) Add(name, source string, data []byte, err error) error {
+	e := Entry{Name: name, Source: source}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if len(data) > 0 || err == nil {
+		data = Redact(data)
+		werr := b.write(name, data)
+		if werr != nil {
+			return werr
+		}
+		e.Size = int64(len(data))
+	}
+	b.index.Entries = append(b.index.Entries, e)
+	return nil
+}
+
+func (b *Bundle) write(name string, data []byte) error {
+	err := b.tw.WriteHeader(&tar.Header{
+		Name:    path.Join(b.root, name),
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: b.index.Created,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to add %s to the support bundle, %v", name, err)
+	}
+	_, err = b.tw.Write(data)
+	if err != nil {
+		return fmt.Errorf("unable to add %s to the support bundle, %v", name, err)
+	}
+	return nil
+}
+
+// Entries returns what was added so far
+func (b *Bundle) Entries() []Entry {
+	return append([]Entry(nil), b.index.Entries...)
+}
+
+// Close adds the index and finishes the tarball
+func (b *Bundle) Close() error {
+	out, err := json.MarshalIndent(b.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = b.write(IndexFileName, out)
+	if err != nil {
+		return err
+	}
+	err = b.tw.Close()
+	if err != nil {
+		return err
+	}
+	err = b.gz.Close()
+	if err != nil {
+		return err
+	}
+	return b.file.Close()
+}
@@ -0,0 +1,124 @@
+package support
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readBundle returns the files of the tarball at p by their name in the bundle
+func readBundle(t *testing.T, p string) map[string]string {
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.SplitN(h.Name, "/", 2)
+		files[parts[1]] = string(data)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cake-support")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 5, 1, 10, 30, 0, 0, time.UTC)
+	b, err := NewBundle(dir, "test", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Base(b.Path) != "cake-support-test-20200501T103000Z.tar.gz" {
+		t.Fatalf("unexpected bundle name %s", b.Path)
+	}
+	_, err = NewBundle(dir, "test", now)
+	if err == nil {
+		t.Fatal("expected an existing bundle not to be overwritten")
+	}
+
+	err = b.Add("nodes/node1/cake.out", "ssh node1", []byte("export VSPHERE_PASSWORD=hunter2\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Add("nodes/node2", "ssh node2", nil, errors.New("connection refused"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Add("nodes/node1/docker-ps.txt", "ssh node1", []byte("partial"), errors.New("exit status 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(b.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, actual: %v", info.Mode().Perm())
+	}
+
+	files := readBundle(t, b.Path)
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, actual: %v", files)
+	}
+	if files["nodes/node1/cake.out"] != "export VSPHERE_PASSWORD="+Redacted+"\n" {
+		t.Fatalf("expected the password to be redacted, actual: %s", files["nodes/node1/cake.out"])
+	}
+	if files["nodes/node1/docker-ps.txt"] != "partial" {
+		t.Fatalf("expected the output of a failed command, actual: %s", files["nodes/node1/docker-ps.txt"])
+	}
+
+	var index Index
+	err = json.Unmarshal([]byte(files[IndexFileName]), &index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Cluster != "test" || !index.Created.Equal(now) {
+		t.Fatalf("unexpected index %+v", index)
+	}
+	expected := []Entry{
+		{Name: "nodes/node1/cake.out", Source: "ssh node1", Size: int64(len(files["nodes/node1/cake.out"]))},
+		{Name: "nodes/node2", Source: "ssh node2", Error: "connection refused"},
+		{Name: "nodes/node1/docker-ps.txt", Source: "ssh node1", Size: 7, Error: "exit status 1"},
+	}
+	if len(index.Entries) != len(expected) {
+		t.Fatalf("expected: %+v, actual: %+v", expected, index.Entries)
+	}
+	for x := range expected {
+		if index.Entries[x] != expected[x] {
+			t.Fatalf("expected: %+v, actual: %+v", expected[x], index.Entries[x])
+		}
+	}
+}
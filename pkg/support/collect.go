@@ -0,0 +1,195 @@
+package support
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/engine/capv"
+	"github.com/netapp/cake/pkg/provider"
+	"github.com/netapp/cake/pkg/util/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// commandTimeout keeps a hung command on a node from stalling the collection
+	commandTimeout = "timeout 60"
+	logTailLines   = 2000
+	kubeTimeout    = 30 * time.Second
+)
+
+// Command is run on a node over ssh, its output is saved as File
+type Command struct {
+	File string
+	Cmd  string
+}
+
+// NodeCommands are run on every node
+var NodeCommands = []Command{
+	{"cloud-init.log", "sudo cat /var/log/cloud-init.log"},
+	{"cloud-init-output.log", "sudo cat /var/log/cloud-init-output.log"},
+	{"cloud-init-status.txt", commandTimeout + " cloud-init status --long"},
+	{"docker-ps.txt", "sudo " + commandTimeout + " docker ps -a"},
+}
+
+// capiControllers are the namespaces and deployments of the CAPI and CAPV controllers
+var capiControllers = [][2]string{
+	{"capi-system", "capi-controller-manager"},
+	{"capi-kubeadm-bootstrap-system", "capi-kubeadm-bootstrap-controller-manager"},
+	{"capi-kubeadm-control-plane-system", "capi-kubeadm-control-plane-controller-manager"},
+	{"capv-system", "capv-controller-manager"},
+}
+
+// KubeNamespaces are the namespaces whose pod logs are collected over the Kubernetes API, pods that are not
+// running are collected from every namespace
+var KubeNamespaces = []string{"cattle-system", "cert-manager", "ingress-nginx", "capi-system", "capv-system"}
+
+// BootstrapCommands are run on the node the engine ran on, for CAPV they include the kind and CAPI controller logs
+func BootstrapCommands(engine types.EngineType, cluster string) []Command {
+	commands := []Command{{"cake.out", "cat " + provider.RemoteLog}}
+	if engine != "capv" {
+		return commands
+	}
+	commands = append(commands, Command{"kind-clusters.txt", "sudo " + commandTimeout + " kind get clusters"})
+	// the engine runs as root, the kind cluster is used until the pivot and the management cluster afterwards
+	dir := path.Join("/root", capv.ConfigDir, cluster)
+	for _, kubeconfig := range []string{capv.BootstrapKubeconfig, capv.PermanentKubeconfig} {
+		kubectl := fmt.Sprintf("sudo %s kubectl --kubeconfig %s", commandTimeout, path.Join(dir, kubeconfig))
+		prefix := strings.TrimSuffix(kubeconfig, ".kubeconfig")
+		commands = append(commands, Command{prefix + "-pods.txt", kubectl + " get pods --all-namespaces -o wide"})
+		for _, c := range capiControllers {
+			commands = append(commands, Command{
+				File: fmt.Sprintf("%s-%s.log", prefix, c[1]),
+				Cmd:  fmt.Sprintf("%s logs -n %s deployment/%s --all-containers --tail %v", kubectl, c[0], c[1], logTailLines),
+			})
+		}
+	}
+	return commands
+}
+
+// CollectNode runs every command on the node at address, a node that can not be reached is recorded in the index
+func (b *Bundle) CollectNode(name, address string, auth ssh.Auth, commands []Command) error {
+	dir := path.Join("nodes", name)
+	if address == "" {
+		return b.Add(dir, "ssh", nil, fmt.Errorf("%s has no address", name))
+	}
+	c, err := ssh.NewClient(address, auth)
+	if err != nil {
+		return b.Add(dir, "ssh "+address, nil, err)
+	}
+	defer c.Close()
+	for _, cmd := range commands {
+		stdout, stderr, err := c.Run(cmd.Cmd)
+		out := stdout
+		if err != nil && len(stderr) > 0 {
+			out = append(out, stderr...)
+		}
+		werr := b.Add(path.Join(dir, cmd.File), fmt.Sprintf("ssh %s: %s", c.Address, cmd.Cmd), out, err)
+		if werr != nil {
+			return werr
+		}
+	}
+	return nil
+}
+
+// CollectFiles adds the files directly in dir, yaml files are added with the values of secret keys replaced.
+// Files matching one of skip are left out
+func (b *Bundle) CollectFiles(dir string, skip ...string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return b.Add("local", dir, nil, err)
+	}
+	for _, f := range files {
+		if f.IsDir() || matchAny(f.Name(), skip) {
+			continue
+		}
+		p := filepath.Join(dir, f.Name())
+		data, err := ioutil.ReadFile(p)
+		if err == nil && (strings.HasSuffix(f.Name(), ".yaml") || strings.HasSuffix(f.Name(), ".yml")) {
+			// a file that could not be redacted is left out
+			data, err = RedactYAML(data)
+		}
+		werr := b.Add(path.Join("local", f.Name()), p, data, err)
+		if werr != nil {
+			return werr
+		}
+	}
+	return nil
+}
+
+func matchAny(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectKube adds the pods of the cluster of kubeconfig and the logs of the pods in namespaces or not running
+func (b *Bundle) CollectKube(kubeconfig string, namespaces []string) error {
+	dir := path.Join("kubernetes", filepath.Base(kubeconfig))
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return b.Add(dir, kubeconfig, nil, err)
+	}
+	return b.collectKube(dir, config, namespaces)
+}
+
+func (b *Bundle) collectKube(dir string, config *rest.Config, namespaces []string) error {
+	config.Timeout = kubeTimeout
+	kube, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return b.Add(dir, config.Host, nil, err)
+	}
+	pods, err := kube.CoreV1().Pods("").List(metav1.ListOptions{})
+	if err != nil {
+		return b.Add(path.Join(dir, "pods.txt"), config.Host, nil, err)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Namespace+"/"+pods.Items[i].Name < pods.Items[j].Namespace+"/"+pods.Items[j].Name
+	})
+	var list strings.Builder
+	for _, p := range pods.Items {
+		var restarts int32
+		for _, s := range p.Status.ContainerStatuses {
+			restarts += s.RestartCount
+		}
+		fmt.Fprintf(&list, "%s\t%s\t%s\t%s\t%v\n", p.Namespace, p.Name, p.Status.Phase, p.Spec.NodeName, restarts)
+	}
+	err = b.Add(path.Join(dir, "pods.txt"), config.Host, []byte(list.String()), nil)
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	for _, ns := range namespaces {
+		wanted[ns] = true
+	}
+	tail := int64(logTailLines)
+	for _, p := range pods.Items {
+		failing := p.Status.Phase != corev1.PodRunning && p.Status.Phase != corev1.PodSucceeded
+		if !wanted[p.Namespace] && !failing {
+			continue
+		}
+		for _, c := range p.Spec.Containers {
+			source := fmt.Sprintf("%s: logs %s/%s -c %s", config.Host, p.Namespace, p.Name, c.Name)
+			logs, err := kube.CoreV1().Pods(p.Namespace).GetLogs(p.Name, &corev1.PodLogOptions{Container: c.Name, TailLines: &tail}).Do().Raw()
+			name := path.Join(dir, "logs", p.Namespace, fmt.Sprintf("%s-%s.log", p.Name, c.Name))
+			err = b.Add(name, source, logs, err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package support
+
+import (
+	"fmt"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces secret values
+const Redacted = "REDACTED"
+
+var (
+	privateKeyPattern = regexp.MustCompile(`(?s)-----BEGIN ([A-Z ]*)PRIVATE KEY-----.*?-----END ([A-Z ]*)PRIVATE KEY-----`)
+	// assignments like Password: x, VSPHERE_PASSWORD=x or "token":"x"
+	assignmentPattern = regexp.MustCompile(`(?i)((?:password|passwd|secret|token|client-key-data|access-?key|secret-?key|api-?key)["']?\s*[:=]\s*["']?)[^\s"',]+`)
+	bearerPattern     = regexp.MustCompile(`(?i)(bearer\s+)[^\s"',]+`)
+	// yaml keys whose whole value is replaced
+	secretKeyPattern = regexp.MustCompile(`(?i)(password|passwd|secret|token|key|key-data|authorization|credentials)$`)
+)
+
+// Redact masks private keys, bearer tokens and values assigned to secret sounding names in text
+func Redact(data []byte) []byte {
+	data = privateKeyPattern.ReplaceAll(data, []byte("-----BEGIN ${1}PRIVATE KEY-----\n"+Redacted+"\n-----END ${2}PRIVATE KEY-----"))
+	data = assignmentPattern.ReplaceAll(data, []byte("${1}"+Redacted))
+	return bearerPattern.ReplaceAll(data, []byte("${1}"+Redacted))
+}
+
+// RedactYAML replaces the value of every key that names a secret, like Password, GithubToken or
+// client-key-data, at any depth of the document
+func RedactYAML(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to redact, %v", err)
+	}
+	if doc.Kind == 0 {
+		return data, nil
+	}
+	redactNode(&doc)
+	return yaml.Marshal(&doc)
+}
+
+func redactNode(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		for x := 0; x+1 < len(n.Content); x += 2 {
+			key, value := n.Content[x], n.Content[x+1]
+			if secretKeyPattern.MatchString(key.Value) && !(value.Kind == yaml.ScalarNode && value.Value == "") {
+				*value = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: Redacted}
+				continue
+			}
+			redactNode(value)
+		}
+		return
+	}
+	for _, c := range n.Content {
+		redactNode(c)
+	}
+}
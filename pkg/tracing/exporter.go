@@ -0,0 +1,176 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	otlpTracesPath   = "/v1/traces"
+	serviceName      = "cake"
+	scopeName        = "github.com/netapp/cake"
+	spanKindInternal = 1
+	statusOK         = 1
+	statusError      = 2
+)
+
+// InMemoryExporter keeps exported spans for tests
+type InMemoryExporter struct {
+	spans []SpanData
+	mutex sync.Mutex
+}
+
+// NewInMemoryExporter returns an empty InMemoryExporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// Export appends spans
+func (m *InMemoryExporter) Export(spans []SpanData) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.spans = append(m.spans, spans...)
+	return nil
+}
+
+// Spans returns a copy of everything exported so far
+func (m *InMemoryExporter) Spans() []SpanData {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]SpanData(nil), m.spans...)
+}
+
+// otlpExporter posts spans to an OTLP/HTTP collector using the JSON encoding of the protocol
+type otlpExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewOTLPExporter returns an Exporter for the collector at endpoint, /v1/traces is added unless endpoint already has it
+func NewOTLPExporter(endpoint string, headers map[string]string) Exporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, otlpTracesPath) {
+		url += otlpTracesPath
+	}
+	return &otlpExporter{url: url, headers: headers, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func attributes(m map[string]string) []otlpAttribute {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var attrs []otlpAttribute
+	for _, key := range keys {
+		a := otlpAttribute{Key: key}
+		a.Value.StringValue = m[key]
+		attrs = append(attrs, a)
+	}
+	return attrs
+}
+
+// newOTLPRequest converts spans to the body of an export request
+func newOTLPRequest(spans []SpanData) otlpRequest {
+	scopeSpans := otlpScopeSpans{Scope: otlpScope{Name: scopeName}}
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        attributes(s.Attributes),
+			Status:            otlpStatus{Code: statusOK},
+		}
+		if s.Error != "" {
+			span.Status = otlpStatus{Code: statusError, Message: s.Error}
+		}
+		scopeSpans.Spans = append(scopeSpans.Spans, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attributes(map[string]string{"service.name": serviceName})},
+		ScopeSpans: []otlpScopeSpans{scopeSpans},
+	}}}
+}
+
+// Export posts spans to the collector
+func (o *otlpExporter) Export(spans []SpanData) error {
+	body, err := json.Marshal(newOTLPRequest(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range o.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to post spans to %s, %v", o.url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unable to post spans to %s, status: %v", o.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+// Package tracing records the spans of a deploy and exports them to an OTLP/HTTP collector. The OpenTelemetry Go
+// SDK needs a newer Go than the go 1.14 this module builds with, so the exporter in exporter.go encodes the
+// requests itself. It follows the JSON encoding of opentelemetry-proto v1.0.0 (ExportTraceServiceRequest with
+// scopeSpans and hex trace and span ids), collectors that accept OTLP 1.0 accept it.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	traceIDBytes  = 16
+	spanIDBytes   = 8
+	batchSize     = 128
+	flushInterval = 5 * time.Second
+)
+
+// Config selects where spans are exported to
+type Config struct {
+	// Endpoint of an OTLP/HTTP collector, for example http://localhost:4318, defaults to the
+	// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT environment variables
+	Endpoint string `yaml:"Endpoint,omitempty" json:"endpoint,omitempty"`
+	// Headers are added to every export request, for example for authentication
+	Headers map[string]string `yaml:"Headers,omitempty" json:"headers,omitempty"`
+	// Parent is the W3C traceparent the deploy continues, the provider sets it for the cake on the bootstrap node
+	Parent string `yaml:"Parent,omitempty" json:"parent,omitempty"`
+}
+
+// Exporter sends finished spans to a tracing backend
+type Exporter interface {
+	Export(spans []SpanData) error
+}
+
+// SpanData is a finished span
+type SpanData struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+	// Error is the message of the error the span ended with
+	Error string
+}
+
+// Span is an operation within a trace, spans without an exporter are not recorded
+type Span struct {
+	data  SpanData
+	ended bool
+	mutex sync.Mutex
+}
+
+// spanKey is the context key of the span new spans are children of
+type spanKey struct{}
+
+var (
+	exporter Exporter
+	pending  []SpanData
+	mutex    sync.Mutex
+)
+
+// Init exports spans to the OTLP endpoint of c, tracing stays disabled when no endpoint is configured
+func Init(c Config) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	}
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" {
+		return
+	}
+	SetExporter(NewOTLPExporter(endpoint, c.Headers))
+	go func() {
+		for range time.Tick(flushInterval) {
+			Flush()
+		}
+	}()
+}
+
+// SetExporter replaces the exporter finished spans are sent to, nil disables tracing
+func SetExporter(e Exporter) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	exporter = e
+	pending = nil
+}
+
+// Flush exports the spans that finished since the last export
+func Flush() error {
+	mutex.Lock()
+	e := exporter
+	spans := pending
+	pending = nil
+	mutex.Unlock()
+	if e == nil || len(spans) == 0 {
+		return nil
+	}
+	err := e.Export(spans)
+	if err != nil {
+		return fmt.Errorf("unable to export %v spans, %v", len(spans), err)
+	}
+	return nil
+}
+
+// StartRoot starts the span of a deploy that the spans started from the returned copy of ctx are children of.
+// A valid traceparent makes it a child of that span in another process, otherwise a new trace is started
+func StartRoot(ctx context.Context, name, traceparent string) (context.Context, *Span) {
+	s := &Span{data: SpanData{Name: name, Start: time.Now(), Attributes: map[string]string{}}}
+	traceID, spanID, err := ParseTraceParent(traceparent)
+	if err == nil {
+		s.data.TraceID = traceID
+		s.data.ParentSpanID = spanID
+	} else {
+		s.data.TraceID = newID(traceIDBytes)
+	}
+	s.data.SpanID = newID(spanIDBytes)
+	return ContextWithSpan(ctx, s), s
+}
+
+// Start starts a child of the span of ctx and returns it in a copy of ctx. A context without a span starts a new
+// trace, the ctx of a phase has to be passed down for its spans to be part of the deploy
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	s := &Span{data: SpanData{Name: name, Start: time.Now(), Attributes: map[string]string{}}}
+	if parent != nil {
+		s.data.TraceID = parent.data.TraceID
+		s.data.ParentSpanID = parent.data.SpanID
+	} else {
+		s.data.TraceID = newID(traceIDBytes)
+	}
+	s.data.SpanID = newID(spanIDBytes)
+	return ContextWithSpan(ctx, s), s
+}
+
+// ContextWithSpan returns a copy of ctx that new spans are started as children of s from
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// FromContext returns the span of ctx, nil when it has none
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetAttribute adds a string attribute to the span
+func (s *Span) SetAttribute(key, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// TraceParent is the W3C traceparent header value other processes continue the trace from
+func (s *Span) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.data.TraceID, s.data.SpanID)
+}
+
+// End finishes the span with the outcome of the operation, only the first call has an effect
+func (s *Span) End(err error) {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	if err != nil {
+		s.data.Error = err.Error()
+	}
+	data := s.data
+	s.mutex.Unlock()
+
+	mutex.Lock()
+	if exporter == nil {
+		mutex.Unlock()
+		return
+	}
+	pending = append(pending, data)
+	full := len(pending) >= batchSize
+	mutex.Unlock()
+	if full {
+		go func() {
+			err := Flush()
+			if err != nil {
+				log.Warn(err.Error())
+			}
+		}()
+	}
+}
+
+// ParseTraceParent returns the trace and parent span ids of a W3C traceparent header value
+func ParseTraceParent(traceparent string) (string, string, error) {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || len(parts[1]) != 2*traceIDBytes || len(parts[2]) != 2*spanIDBytes {
+		return "", "", fmt.Errorf("invalid traceparent %q", traceparent)
+	}
+	for _, id := range parts[1:3] {
+		if _, err := hex.DecodeString(id); err != nil || strings.Trim(id, "0") == "" {
+			return "", "", fmt.Errorf("invalid traceparent %q", traceparent)
+		}
+	}
+	return parts[1], parts[2], nil
+}
+
+func newID(size int) string {
+	id := make([]byte, size)
+	// crypto/rand only fails when the system has no entropy source, an id of zeros is still usable locally
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,186 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSpans(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	SetExporter(exporter)
+	defer SetExporter(nil)
+
+	parent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	ctx, root := StartRoot(context.Background(), "engine", parent)
+	ctx, phase := Start(ctx, "Provision")
+	_, command := Start(ctx, "kubectl")
+	command.SetAttribute("command.binary", "kubectl")
+	command.End(errors.New("exit status 1"))
+	phase.End(nil)
+	root.End(nil)
+	root.End(errors.New("ignored"))
+
+	err := Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("expected: 3 spans, actual: %v", len(spans))
+	}
+	tests := []struct {
+		name   string
+		parent string
+		err    string
+	}{
+		{"kubectl", spans[1].SpanID, "exit status 1"},
+		{"Provision", spans[2].SpanID, ""},
+		{"engine", "b7ad6b7169203331", ""},
+	}
+	for x, tt := range tests {
+		s := spans[x]
+		if s.Name != tt.name || s.ParentSpanID != tt.parent || s.Error != tt.err || s.TraceID != "0af7651916cd43dd8448eb211c80319c" {
+			t.Fatalf("expected: %+v, actual: %+v", tt, s)
+		}
+		if s.End.Before(s.Start) {
+			t.Fatalf("expected the span to end after it started: %+v", s)
+		}
+	}
+	if spans[0].Attributes["command.binary"] != "kubectl" {
+		t.Fatalf("expected the command.binary attribute, actual: %v", spans[0].Attributes)
+	}
+
+	traceID, spanID, err := ParseTraceParent(root.TraceParent())
+	if err != nil || traceID != spans[2].TraceID || spanID != spans[2].SpanID {
+		t.Fatalf("expected the traceparent of the root span, actual: %s, %s, %v", traceID, spanID, err)
+	}
+}
+
+func TestNewTrace(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	SetExporter(exporter)
+	defer SetExporter(nil)
+
+	_, root := StartRoot(context.Background(), "deploy", "")
+	root.End(nil)
+	Flush()
+	spans := exporter.Spans()
+	if len(spans) != 1 || len(spans[0].TraceID) != 32 || len(spans[0].SpanID) != 16 || spans[0].ParentSpanID != "" {
+		t.Fatalf("expected a new trace, actual: %+v", spans)
+	}
+}
+
+func TestConcurrentParents(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	SetExporter(exporter)
+	defer SetExporter(nil)
+
+	ctx, root := StartRoot(context.Background(), "deploy", "")
+	parents := map[string]string{}
+	done := make(chan struct{})
+	for _, name := range []string{"node1", "node2"} {
+		vmCtx, vm := Start(ctx, name)
+		parents[name+"/clone"] = vm.data.SpanID
+		go func(name string) {
+			_, clone := Start(vmCtx, name+"/clone")
+			clone.End(nil)
+			done <- struct{}{}
+		}(name)
+		defer vm.End(nil)
+	}
+	<-done
+	<-done
+	Flush()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected: 3 spans, actual: %+v", spans)
+	}
+	for _, s := range spans {
+		if s.ParentSpanID != parents[s.Name] || s.TraceID != root.data.TraceID {
+			t.Fatalf("expected %s to be a child of %s, actual: %+v", s.Name, parents[s.Name], s)
+		}
+	}
+}
+
+func TestStartWithoutSpan(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	SetExporter(exporter)
+	defer SetExporter(nil)
+
+	_, root := StartRoot(context.Background(), "deploy", "")
+	// a context that lost the span of the deploy does not silently fall back to it
+	_, command := Start(context.Background(), "kubectl")
+	command.End(nil)
+	root.End(nil)
+	Flush()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 || spans[0].TraceID == spans[1].TraceID || spans[0].ParentSpanID != "" {
+		t.Fatalf("expected the span to start a new trace, actual: %+v", spans)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		traceparent string
+		valid       bool
+	}{
+		{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", true},
+		{"", false},
+		{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331", false},
+		{"00-00000000000000000000000000000000-b7ad6b7169203331-01", false},
+		{"00-0af7651916cd43dd8448eb211c80319c-xyzd6b7169203331-01", false},
+	}
+	for _, tt := range tests {
+		_, _, err := ParseTraceParent(tt.traceparent)
+		if (err == nil) != tt.valid {
+			t.Fatalf("expected %q valid: %v, actual: %v", tt.traceparent, tt.valid, err)
+		}
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpTracesPath || r.Header.Get("Authorization") != "Bearer collector" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		var req otlpRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		received <- req
+	}))
+	defer srv.Close()
+
+	e := NewOTLPExporter(srv.URL+"/", map[string]string{"Authorization": "Bearer collector"})
+	start := time.Unix(0, 1000)
+	err := e.Export([]SpanData{{
+		TraceID:    "0af7651916cd43dd8448eb211c80319c",
+		SpanID:     "b7ad6b7169203331",
+		Name:       "clone",
+		Start:      start,
+		End:        start.Add(time.Second),
+		Attributes: map[string]string{"vm.name": "node1"},
+		Error:      "task failed",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := <-received
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans[0].Spans) != 1 {
+		t.Fatalf("expected a single span, actual: %+v", req)
+	}
+	span := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if span.Name != "clone" || span.StartTimeUnixNano != "1000" || span.EndTimeUnixNano != "1000001000" || span.Status.Code != statusError {
+		t.Fatalf("unexpected span: %+v", span)
+	}
+	if len(span.Attributes) != 1 || span.Attributes[0].Key != "vm.name" || span.Attributes[0].Value.StringValue != "node1" {
+		t.Fatalf("unexpected attributes: %+v", span.Attributes)
+	}
+}
@@ -8,14 +8,21 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
+
+	"github.com/netapp/cake/pkg/metrics"
+	"github.com/netapp/cake/pkg/tracing"
 )
 
 // TODO dont use a global var, add this to the ctx
 // FileLogLocation to which we write all cmd stdout, stderr
 var FileLogLocation = "/dev/null"
 
+// secretArg matches flags whose value is a credential, like --secret-key=x
+var secretArg = regexp.MustCompile(`(?i)^(--?[a-z0-9-]*(password|passwd|secret|token|access-key)[a-z0-9-]*=).+$`)
+
 // Command interface execute a cli command and
 // returns the stdout, stderr and any error msgs
 type Command interface {
@@ -41,6 +48,21 @@ func NewCommandLine(envs map[string]string, cmd string, args []string, ctx *cont
 	}
 }
 
+// String is the command and its args for logs and errors, flag values that are credentials are masked and
+// the env vars, which can hold credentials like VSPHERE_PASSWORD, are left out
+func (c *CommandLine) String() string {
+	return strings.Join(append([]string{c.CommandName}, MaskArgs(c.Args)...), " ")
+}
+
+// MaskArgs returns a copy of args with the values of credential flags masked
+func MaskArgs(args []string) []string {
+	masked := make([]string, len(args))
+	for x, arg := range args {
+		masked[x] = secretArg.ReplaceAllString(arg, "${1}********")
+	}
+	return masked
+}
+
 // The CommandSession contains the CommandLine
 type CommandSession struct {
 	CommandLine *CommandLine
@@ -69,9 +91,19 @@ func (c *CommandSession) Execute() ([]byte, []byte, error) {
 		newEnv := append(os.Environ(), additionalEnv...)
 		cmd.Env = newEnv
 	}
+	// the command is traced as a child of the span of its context, a command run without one is not traced
+	var span *tracing.Span
+	if c.CommandLine.Ctx != nil {
+		_, span = tracing.Start(*c.CommandLine.Ctx, filepath.Base(c.CommandLine.CommandName))
+	}
+	start := time.Now()
 	err = cmd.Run()
+	metrics.ObserveCommand(c.CommandLine.CommandName, start, err)
+	if span != nil {
+		span.End(err)
+	}
 	if ctx.Err() == context.DeadlineExceeded {
-		return stdout.Bytes(), stderr.Bytes(), fmt.Errorf("command timed out: %v %v", c.CommandLine.CommandName, strings.Join(c.CommandLine.Args, " "))
+		return stdout.Bytes(), stderr.Bytes(), fmt.Errorf("command timed out: %v", c.CommandLine)
 	}
 	if err != nil {
 		return stdout.Bytes(), stderr.Bytes(), err
@@ -113,7 +145,7 @@ func Retry(c *CommandLine, timeout time.Duration, grepString string, grepNum int
 	var count, counter, errCounter int
 	tout := time.After(timeout)
 	retryInterval := 3 * time.Second
-	event <- fmt.Sprintf("checking for %v instances of '%v' from command: %v %v", grepNum, grepString, c.CommandName, strings.Join(c.Args, " "))
+	event <- fmt.Sprintf("checking for %v instances of '%v' from command: %v", grepNum, grepString, c)
 	FileLogLocationOriginal := FileLogLocation
 	FileLogLocation = "/dev/null"
 	for {
@@ -133,13 +165,14 @@ func Retry(c *CommandLine, timeout time.Duration, grepString string, grepNum int
 			}
 			count = strings.Count(string(stdout), grepString)
 			if count == grepNum {
-				event <- fmt.Sprintf("found %v/%v instances of '%v' from command: %v %v", count, grepNum, grepString, c.CommandName, strings.Join(c.Args, " "))
+				event <- fmt.Sprintf("found %v/%v instances of '%v' from command: %v", count, grepNum, grepString, c)
 				ok = true
 				break
 			} else if count > counter {
-				event <- fmt.Sprintf("found %v/%v instances of '%v' from command: %v %v", count, grepNum, grepString, c.CommandName, strings.Join(c.Args, " "))
+				event <- fmt.Sprintf("found %v/%v instances of '%v' from command: %v", count, grepNum, grepString, c)
 				counter++
 			}
+			metrics.Retry(metrics.LoopCommand)
 			time.Sleep(retryInterval)
 		}
 		if count == grepNum || errCounter == 10 {
@@ -169,12 +202,12 @@ func GenericExecute(envs map[string]string, name string, args []string, ctx *con
 
 	if name != "kind" {
 		if string(stderr) != "" {
-			err = fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), name, strings.Join(args, " "))
+			err = fmt.Errorf("err: %v, stderr: %v, cmd: %v", err, string(stderr), c)
 		}
 	}
 
 	if err != nil {
-		return fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), name, strings.Join(args, " "))
+		return fmt.Errorf("err: %v, stderr: %v, cmd: %v", err, string(stderr), c)
 	}
 
 	return err
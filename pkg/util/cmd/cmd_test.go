@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/netapp/cake/pkg/tracing"
 )
 
 func TestCommandSuccessful(t *testing.T) {
@@ -16,6 +19,30 @@ func TestCommandSuccessful(t *testing.T) {
 	}
 }
 
+func TestCommandSpan(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	tracing.SetExporter(exporter)
+	defer tracing.SetExporter(nil)
+
+	ctx, root := tracing.StartRoot(context.Background(), "deploy", "")
+	err := GenericExecute(nil, "pwd", nil, &ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a command without a context is not part of the deploy
+	err = GenericExecute(nil, "ls", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.End(nil)
+	tracing.Flush()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 || spans[0].Name != "pwd" || spans[0].ParentSpanID != spans[1].SpanID {
+		t.Fatalf("expected only the pwd span under the root span, actual: %+v", spans)
+	}
+}
+
 func TestCommandNotFound(t *testing.T) {
 	cmd := "im-not-a-command"
 	c := NewCommandLine(nil, cmd, nil, nil)
@@ -85,3 +112,20 @@ func TestLinkedListRemove(t *testing.T) {
 	fmt.Printf("after: %v\n", strings.Join(root.GetAll(), " "))
 
 }
+
+func TestCommandLineString(t *testing.T) {
+	envs := map[string]string{"VSPHERE_PASSWORD": "hunter2"}
+	args := []string{"etcd", "snapshot-save", "--access-key=AKIA", "--secret-key=abc123", "--config=cluster.yml"}
+	c := NewCommandLine(envs, "rke", args, nil)
+
+	expected := "rke etcd snapshot-save --access-key=******** --secret-key=******** --config=cluster.yml"
+	if c.String() != expected {
+		t.Errorf("expected: %v, actual: %v", expected, c.String())
+	}
+	if out := fmt.Sprintf("%v", c); strings.Contains(out, "hunter2") || strings.Contains(out, "abc123") {
+		t.Errorf("expected credentials to be masked, actual: %v", out)
+	}
+	if args[3] != "--secret-key=abc123" {
+		t.Errorf("expected args to be left as is, actual: %v", args)
+	}
+}
@@ -0,0 +1,228 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/netapp/cake/pkg/metrics"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const defaultPort = "22"
+
+// DefaultKnownHosts is the known_hosts file of the user running cake
+const DefaultKnownHosts = "~/.ssh/known_hosts"
+
+// Client is an authenticated ssh connection to a remote host
+type Client struct {
+	Address string
+	conn    *ssh.Client
+}
+
+// Auth holds the credentials used to connect to a remote host and what the host is authenticated with
+type Auth struct {
+	Username   string
+	Password   string
+	PrivateKey []byte
+	// HostKeys are the public keys the host may present in authorized_keys format, they are used instead of
+	// KnownHosts when set
+	HostKeys []string
+	// KnownHosts is the known_hosts file the host key is looked up in, DefaultKnownHosts when empty
+	KnownHosts string
+}
+
+// AuthFromKeyFile returns credentials using the private key found at keyPath
+func AuthFromKeyFile(username, keyPath string) (Auth, error) {
+	keyPath, err := homedir.Expand(keyPath)
+	if err != nil {
+		return Auth{}, err
+	}
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return Auth{}, fmt.Errorf("unable to read private key %s, %v", keyPath, err)
+	}
+	return Auth{Username: username, PrivateKey: key}, nil
+}
+
+func (a Auth) config() (*ssh.ClientConfig, error) {
+	var methods []ssh.AuthMethod
+	if len(a.PrivateKey) > 0 {
+		signer, err := ssh.ParsePrivateKey(a.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse private key, %v", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if a.Password != "" {
+		methods = append(methods, ssh.Password(a.Password))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no ssh credentials provided for user %s", a.Username)
+	}
+	callback, err := a.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{
+		User:            a.Username,
+		Auth:            methods,
+		HostKeyCallback: callback,
+		Timeout:         10 * time.Second,
+	}, nil
+}
+
+// hostKeyCallback accepts the pinned HostKeys, without them the host has to be in the KnownHosts file
+func (a Auth) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if len(a.HostKeys) > 0 {
+		var pinned []ssh.PublicKey
+		for _, k := range a.HostKeys {
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k))
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse host key %q, %v", k, err)
+			}
+			pinned = append(pinned, key)
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			for _, k := range pinned {
+				if bytes.Equal(k.Marshal(), key.Marshal()) {
+					return nil
+				}
+			}
+			return fmt.Errorf("%s host key of %s is not one of the pinned host keys", key.Type(), hostname)
+		}, nil
+	}
+	knownHosts := a.KnownHosts
+	if knownHosts == "" {
+		knownHosts = DefaultKnownHosts
+	}
+	knownHosts, err := homedir.Expand(knownHosts)
+	if err != nil {
+		return nil, err
+	}
+	callback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read known_hosts %s, %v", knownHosts, err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		if keyErr, ok := err.(*knownhosts.KeyError); ok && len(keyErr.Want) == 0 {
+			return fmt.Errorf("%s is not in %s, add its host key there or pin it", hostname, knownHosts)
+		}
+		return err
+	}, nil
+}
+
+// HostPort adds the default ssh port to address when none is given
+func HostPort(address string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(address, defaultPort)
+}
+
+// NewClient connects to address and authenticates with auth
+func NewClient(address string, auth Auth) (*Client, error) {
+	config, err := auth.config()
+	if err != nil {
+		return nil, err
+	}
+	address = HostPort(address)
+	conn, err := ssh.Dial("tcp", address, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %s, %v", address, err)
+	}
+	return &Client{Address: address, conn: conn}, nil
+}
+
+// WaitForClient retries connecting to address until sshd accepts the credentials or the timeout is reached
+func WaitForClient(address string, auth Auth, timeout time.Duration) (*Client, error) {
+	var err error
+	var c *Client
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		c, err = NewClient(address, auth)
+		if err == nil {
+			return c, nil
+		}
+		metrics.Retry(metrics.LoopSSH)
+		time.Sleep(2 * time.Second)
+	}
+	return nil, fmt.Errorf("timed out after %s waiting for ssh, %v", timeout, err)
+}
+
+// Close the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Run executes cmd on the remote host and waits for it to exit, a non-zero exit status is returned as an error
+func (c *Client) Run(cmd string) ([]byte, []byte, error) {
+	return c.RunWithInput(cmd, nil)
+}
+
+// RunWithInput executes cmd on the remote host with stdin read from input
+func (c *Client) RunWithInput(cmd string, input io.Reader) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create ssh session to %s, %v", c.Address, err)
+	}
+	defer session.Close()
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	session.Stdin = input
+
+	err = session.Run(cmd)
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return stdout.Bytes(), stderr.Bytes(), fmt.Errorf("cmd: %v, exit status: %v, stderr: %v", cmd, exitErr.ExitStatus(), strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return stdout.Bytes(), stderr.Bytes(), fmt.Errorf("cmd: %v, err: %v", cmd, err)
+	}
+	return stdout.Bytes(), stderr.Bytes(), nil
+}
+
+// RunAsync starts cmd on the remote host detached from the session, output is written to logFile
+func (c *Client) RunAsync(cmd string, logFile string) error {
+	_, _, err := c.Run(fmt.Sprintf("nohup %s > %s 2>&1 < /dev/null &", cmd, logFile))
+	return err
+}
+
+// Upload writes the contents of src to remotePath over sftp and returns the number of bytes written
+func (c *Client) Upload(src io.Reader, remotePath string, mode os.FileMode) (int64, error) {
+	client, err := sftp.NewClient(c.conn)
+	if err != nil {
+		return 0, fmt.Errorf("unable to start sftp session to %s, %v", c.Address, err)
+	}
+	defer client.Close()
+
+	err = client.MkdirAll(path.Dir(remotePath))
+	if err != nil {
+		return 0, fmt.Errorf("unable to create remote directory %s, %v", path.Dir(remotePath), err)
+	}
+	f, err := client.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return 0, fmt.Errorf("unable to open remote file %s, %v", remotePath, err)
+	}
+	defer f.Close()
+	// the mode is set before anything is written, a config with credentials is never readable by others
+	err = f.Chmod(mode)
+	if err != nil {
+		return 0, fmt.Errorf("unable to set permissions on %s, %v", remotePath, err)
+	}
+	written, err := io.Copy(f, src)
+	if err != nil {
+		return written, fmt.Errorf("unable to upload to %s, %v", remotePath, err)
+	}
+	return written, nil
+}
@@ -0,0 +1,147 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/netapp/cake/pkg/util/ssh/sshtest"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestRun(t *testing.T) {
+	address, hostKey := sshtest.NewServer(t)
+	c, err := NewClient(address, Auth{Username: "cake", Password: sshtest.Password, HostKeys: []string{hostKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	stdout, _, err := c.Run("echo hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(stdout)) != "hello" {
+		t.Fatalf("expected: hello, actual: %s", stdout)
+	}
+
+	_, _, err = c.Run("echo failed >&2; exit 3")
+	if err == nil || !strings.Contains(err.Error(), "exit status: 3") || !strings.Contains(err.Error(), "failed") {
+		t.Fatalf("expected exit status 3 error, actual: %v", err)
+	}
+
+	stdout, _, err = c.RunWithInput("cat", strings.NewReader("from stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stdout) != "from stdin" {
+		t.Fatalf("expected: from stdin, actual: %s", stdout)
+	}
+}
+
+func TestBadCredentials(t *testing.T) {
+	address, hostKey := sshtest.NewServer(t)
+	_, err := NewClient(address, Auth{Username: "cake", Password: "wrong", HostKeys: []string{hostKey}})
+	if err == nil {
+		t.Fatal("expected authentication to fail")
+	}
+	_, err = NewClient(address, Auth{Username: "cake", HostKeys: []string{hostKey}})
+	if err == nil {
+		t.Fatal("expected missing credentials to fail")
+	}
+}
+
+func TestUpload(t *testing.T) {
+	address, hostKey := sshtest.NewServer(t)
+	c, err := NewClient(address, Auth{Username: "cake", Password: sshtest.Password, HostKeys: []string{hostKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	dir, err := ioutil.TempDir("", "cake-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	remotePath := filepath.Join(dir, "nested", "cake")
+	contents := "#!/bin/sh\necho uploaded\n"
+
+	written, err := c.Upload(strings.NewReader(contents), remotePath, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(len(contents)) {
+		t.Fatalf("expected: %v bytes, actual: %v", len(contents), written)
+	}
+	info, err := os.Stat(remotePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Fatalf("expected: %v, actual: %v", os.FileMode(0755), info.Mode().Perm())
+	}
+	stdout, _, err := c.Run(remotePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(stdout)) != "uploaded" {
+		t.Fatalf("expected: uploaded, actual: %s", stdout)
+	}
+}
+
+func TestHostKeys(t *testing.T) {
+	address, hostKey := sshtest.NewServer(t)
+	_, otherKey := sshtest.NewServer(t)
+	_, err := NewClient(address, Auth{Username: "cake", Password: sshtest.Password, HostKeys: []string{otherKey}})
+	if err == nil || !strings.Contains(err.Error(), "not one of the pinned host keys") {
+		t.Fatalf("expected a host with another key to be refused, actual: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "cake-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	err = ioutil.WriteFile(knownHosts, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewClient(address, Auth{Username: "cake", Password: sshtest.Password, KnownHosts: knownHosts})
+	if err == nil || !strings.Contains(err.Error(), "is not in "+knownHosts) {
+		t.Fatalf("expected an unknown host to be refused, actual: %v", err)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(knownHosts, []byte(knownhosts.Line([]string{address}, key)+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(address, Auth{Username: "cake", Password: sshtest.Password, KnownHosts: knownHosts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
+
+func TestHostPort(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+	}{
+		{"10.0.0.1", "10.0.0.1:22"},
+		{"10.0.0.1:2222", "10.0.0.1:2222"},
+		{"node1.local", "node1.local:22"},
+	}
+	for _, tt := range tests {
+		if actual := HostPort(tt.address); actual != tt.expected {
+			t.Fatalf("expected: %v, actual: %v", tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package sshtest provides an in-process sshd for tests
+package sshtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"net"
+	"os/exec"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Password is accepted for any user
+const Password = "cake"
+
+// NewServer starts an sshd that runs exec requests with sh and serves sftp from the local filesystem, the listen address
+// and the host key in authorized_keys format are returned
+func NewServer(t *testing.T) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if string(pass) == Password {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(conn, config)
+		}
+	}()
+	return listener.Addr().String(), string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+}
+
+func serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				switch req.Type {
+				case "exec":
+					req.Reply(true, nil)
+					cmdLen := binary.BigEndian.Uint32(req.Payload[:4])
+					cmd := exec.Command("sh", "-c", string(req.Payload[4:4+cmdLen]))
+					cmd.Stdin = channel
+					cmd.Stdout = channel
+					cmd.Stderr = channel.Stderr()
+					status := make([]byte, 4)
+					if err := cmd.Run(); err != nil {
+						exitErr, _ := err.(*exec.ExitError)
+						binary.BigEndian.PutUint32(status, uint32(exitErr.ExitCode()))
+					}
+					channel.SendRequest("exit-status", false, status)
+					return
+				case "subsystem":
+					req.Reply(true, nil)
+					server, err := sftp.NewServer(channel)
+					if err != nil {
+						return
+					}
+					server.Serve()
+					return
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,5 @@
+// Package version is the version of the cake binary
+package version
+
+// Version is set at build time with -ldflags "-X github.com/netapp/cake/pkg/version.Version=<version>"
+var Version = "dev"